@@ -17,11 +17,14 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/auth"
 	"github.com/sinisterminister/moneytree/pkg/miraclegrow"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // growCmd represents the grow command
@@ -51,11 +54,29 @@ to quickly create a Cobra application.`,
 		if err != nil {
 			log.WithError(err).Fatal("could not parse update frequency")
 		}
+		strategyName, err := cmd.Flags().GetString("strategy")
+		if err != nil {
+			log.WithError(err).Fatal("could not get strategy")
+		}
+		strategy, err := miraclegrow.NewStrategy(strategyName)
+		if err != nil {
+			log.WithError(err).Fatal("could not load strategy")
+		}
 		address := fmt.Sprintf("%s:%d", host, port)
 
-		svc := miraclegrow.NewService(address, updateFrequency)
+		creds := auth.ClientConfig{
+			TLS:        viper.GetBool("tls"),
+			CACert:     viper.GetString("ca"),
+			Cert:       viper.GetString("cert"),
+			Key:        viper.GetString("key"),
+			ServerName: viper.GetString("serverName"),
+			Token:      viper.GetString("token"),
+		}
+
+		svc := miraclegrow.NewService(address, updateFrequency, creds)
 
-		svc.TrixR5Kids(make(chan bool))
+		log.Infof("growing with the %s strategy", strategyName)
+		svc.Grow(make(chan bool), strategy)
 	},
 }
 
@@ -65,4 +86,16 @@ func init() {
 	growCmd.Flags().String("host", "moneytree.sinimini.com", "Host to connect to")
 	growCmd.Flags().Int("port", 44444, "Port to connect to")
 	growCmd.Flags().String("updateFrequency", "5s", "Timeout")
+	growCmd.Flags().String("strategy", "trix", fmt.Sprintf("Strategy to grow with (%s)", strings.Join(miraclegrow.Strategies(), ", ")))
+
+	// Credentials can also be set in the config file or with GROW_* environment variables
+	growCmd.Flags().Bool("tls", false, "Connect over TLS")
+	growCmd.Flags().String("ca", "", "CA certificate to verify the server with")
+	growCmd.Flags().String("cert", "", "Client certificate to present to the server")
+	growCmd.Flags().String("key", "", "Key for the client certificate")
+	growCmd.Flags().String("serverName", "", "Name to verify the server certificate against")
+	growCmd.Flags().String("token", "", "Bearer token to authenticate with")
+	for _, flag := range []string{"tls", "ca", "cert", "key", "serverName", "token"} {
+		viper.BindPFlag(flag, growCmd.Flags().Lookup(flag))
+	}
 }
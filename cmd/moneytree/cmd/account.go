@@ -0,0 +1,103 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/cobra"
+)
+
+// accountCmd represents the account command
+var accountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Show the account balances, fees and allocation",
+	Long:  `Shows the total, available and held balance of every currency along with how much of it the open pairs are holding, the current fee rates and how the portfolio compares to its target allocation`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		host, err := cmd.Flags().GetString("host")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		timeout, err := cmd.Flags().GetString("timeout")
+		if err != nil {
+			log.WithError(err).Fatal("could not get timeout")
+		}
+		address := fmt.Sprintf("%s:%d", host, port)
+
+		// Set up a connection to the server.
+		conn, err := dial(address)
+		if err != nil {
+			log.Fatalf("did not connect: %v", err)
+		}
+		defer conn.Close()
+		c := proto.NewMoneytreeClient(conn)
+
+		// Contact the server and print out its response.
+		to, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.WithError(err).Fatal("could not parse timeout value")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), to)
+		defer cancel()
+		r, err := c.GetAccount(ctx, &proto.NullRequest{})
+		if err != nil {
+			log.Fatalf("could not get account: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CURRENCY\tTOTAL\tAVAILABLE\tHELD\tIN PAIRS")
+		for _, b := range r.Balances {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", b.Currency, b.Total, b.Available, b.Held, b.InPairs)
+		}
+		w.Flush()
+		fmt.Printf("\nmaker rate: %s\ntaker rate: %s\n30 day volume: %s\n", r.MakerRate, r.TakerRate, r.Volume)
+
+		a, err := c.GetAllocation(ctx, &proto.NullRequest{})
+		if err != nil {
+			log.Fatalf("could not get allocation: %v", err)
+		}
+		fmt.Printf("\nbase share of value: %s at %s\n", a.BaseRatio, a.Price)
+		if a.Target != "0" {
+			fmt.Printf("target band: %s to %s\n", a.Lower, a.Upper)
+		}
+		if a.Pull != "" {
+			fmt.Printf("outside the band; favoring %s pairs\n", a.Pull)
+		}
+		if a.RebalanceOrderId != "" {
+			fmt.Printf("rebalance order: %s\n", a.RebalanceOrderId)
+		}
+		if a.RebalanceDetails != "" {
+			fmt.Printf("last rebalance: %s\n", a.RebalanceDetails)
+		}
+	},
+}
+
+func init() {
+	clientCmd.AddCommand(accountCmd)
+	accountCmd.Flags().String("host", "localhost", "Host to connect to")
+	accountCmd.Flags().Int("port", 44444, "Port to connect to")
+	accountCmd.Flags().String("timeout", "15s", "Timeout")
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// auditLogCmd represents the auditLog command
+var auditLogCmd = &cobra.Command{
+	Use:   "auditLog",
+	Short: "Show who made which changes",
+	Long: `Shows the audit entries recorded for the calls that change something and the calls that were turned down,
+newest first. Pass --jsonl to export the entries as JSON lines.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		host, err := cmd.Flags().GetString("host")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		timeout, err := cmd.Flags().GetString("timeout")
+		if err != nil {
+			log.WithError(err).Fatal("could not get timeout")
+		}
+		since, err := cmd.Flags().GetDuration("since")
+		if err != nil {
+			log.WithError(err).Fatal("could not get since")
+		}
+		method, err := cmd.Flags().GetString("method")
+		if err != nil {
+			log.WithError(err).Fatal("could not get method")
+		}
+		caller, err := cmd.Flags().GetString("caller")
+		if err != nil {
+			log.WithError(err).Fatal("could not get caller")
+		}
+		limit, err := cmd.Flags().GetInt32("limit")
+		if err != nil {
+			log.WithError(err).Fatal("could not get limit")
+		}
+		jsonLines, err := cmd.Flags().GetBool("jsonl")
+		if err != nil {
+			log.WithError(err).Fatal("could not get jsonl")
+		}
+		address := fmt.Sprintf("%s:%d", host, port)
+
+		// Set up a connection to the server.
+		conn, err := dial(address)
+		if err != nil {
+			log.Fatalf("did not connect: %v", err)
+		}
+		defer conn.Close()
+		c := proto.NewMoneytreeClient(conn)
+
+		// Contact the server and print out its response.
+		to, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.WithError(err).Fatal("could not parse timeout value")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), to)
+		defer cancel()
+		r, err := c.AuditLog(ctx, &proto.AuditLogRequest{StartTime: time.Now().Add(-since).Unix(), Method: method, Caller: caller, Limit: limit})
+		if err != nil {
+			log.Fatalf("could not get audit log: %v", err)
+		}
+		if jsonLines {
+			for _, e := range r.Entries {
+				line, err := protojson.Marshal(e)
+				if err != nil {
+					log.WithError(err).Fatal("could not encode audit entry")
+				}
+				fmt.Println(string(line))
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tCALLER\tMETHOD\tPAIRS\tOUTCOME\tLATENCY\tREQUEST")
+		for _, e := range r.Entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%dms\t%s\n", time.Unix(e.Ts, 0).Format(time.RFC3339), e.Caller, e.Method, strings.Join(e.PairUuids, ","), e.Outcome, e.LatencyMs, e.Request)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	clientCmd.AddCommand(auditLogCmd)
+	auditLogCmd.Flags().String("host", "localhost", "Host to connect to")
+	auditLogCmd.Flags().Int("port", 44444, "Port to connect to")
+	auditLogCmd.Flags().String("timeout", "15s", "Timeout")
+	auditLogCmd.Flags().Duration("since", 24*time.Hour, "How far back to look")
+	auditLogCmd.Flags().String("method", "", "Only show calls to this method")
+	auditLogCmd.Flags().String("caller", "", "Only show calls by this caller")
+	auditLogCmd.Flags().Int32("limit", 100, "Maximum number of entries to show")
+	auditLogCmd.Flags().Bool("jsonl", false, "Print the entries as JSON lines")
+}
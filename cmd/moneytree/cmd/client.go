@@ -16,7 +16,10 @@ limitations under the License.
 package cmd
 
 import (
+	"github.com/sinisterminister/moneytree/pkg/auth"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
 )
 
 // clientCmd represents the client command
@@ -36,4 +39,31 @@ to quickly create a Cobra application.`,
 
 func init() {
 	rootCmd.AddCommand(clientCmd)
+
+	// Credentials can also be set with client.* in the config file or the environment
+	clientCmd.PersistentFlags().Bool("tls", false, "Connect over TLS")
+	clientCmd.PersistentFlags().String("ca", "", "CA certificate to verify the server with")
+	clientCmd.PersistentFlags().String("cert", "", "Client certificate to present to the server")
+	clientCmd.PersistentFlags().String("key", "", "Key for the client certificate")
+	clientCmd.PersistentFlags().String("serverName", "", "Name to verify the server certificate against")
+	clientCmd.PersistentFlags().String("token", "", "Bearer token to authenticate with")
+	for _, flag := range []string{"tls", "ca", "cert", "key", "serverName", "token"} {
+		viper.BindPFlag("client."+flag, clientCmd.PersistentFlags().Lookup(flag))
+	}
+}
+
+// dial connects to the server with the configured credentials
+func dial(address string) (*grpc.ClientConn, error) {
+	opts, err := auth.ClientConfig{
+		TLS:        viper.GetBool("client.tls"),
+		CACert:     viper.GetString("client.ca"),
+		Cert:       viper.GetString("client.cert"),
+		Key:        viper.GetString("client.key"),
+		ServerName: viper.GetString("client.serverName"),
+		Token:      viper.GetString("client.token"),
+	}.DialOptions()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Dial(address, append(opts, grpc.WithBlock())...)
 }
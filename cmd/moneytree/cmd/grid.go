@@ -0,0 +1,165 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/cobra"
+)
+
+// gridCmd represents the grid command
+var gridCmd = &cobra.Command{
+	Use:   "grid",
+	Short: "Show the grid of pairs",
+	Long:  `Shows the levels of the grid along with the pair placed at each one and how many pairs each has completed`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withClient(cmd, func(ctx context.Context, c proto.MoneytreeClient) {
+			r, err := c.GetGrid(ctx, &proto.NullRequest{})
+			if err != nil {
+				log.Fatalf("could not get grid: %v", err)
+			}
+			printGrid(r)
+		})
+	},
+}
+
+// gridStartCmd represents the grid start command
+var gridStartCmd = &cobra.Command{
+	Use:   "start [LOWER] [UPPER]",
+	Short: "Start a grid of pairs between two prices",
+	Long: `Spreads the levels evenly between the lower and upper prices. Levels below the price buy and levels above it
+sell, and each level is rearmed when its pair is done until the grid is stopped.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		levels, err := cmd.Flags().GetInt32("levels")
+		if err != nil {
+			log.WithError(err).Fatal("could not get levels")
+		}
+		quantity, err := cmd.Flags().GetString("quantity")
+		if err != nil {
+			log.WithError(err).Fatal("could not get quantity")
+		}
+
+		withClient(cmd, func(ctx context.Context, c proto.MoneytreeClient) {
+			r, err := c.StartGrid(ctx, &proto.StartGridRequest{Lower: args[0], Upper: args[1], Levels: levels, Quantity: quantity})
+			if err != nil {
+				log.Fatalf("could not start grid: %v", err)
+			}
+			printGrid(r)
+		})
+	},
+}
+
+// gridStopCmd represents the grid stop command
+var gridStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop rearming the grid",
+	Long:  `Stops rearming the levels of the grid. Pass --cancel to also cancel the pairs whose first order hasn't filled.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cancelOpen, err := cmd.Flags().GetBool("cancel")
+		if err != nil {
+			log.WithError(err).Fatal("could not get cancel")
+		}
+
+		withClient(cmd, func(ctx context.Context, c proto.MoneytreeClient) {
+			r, err := c.StopGrid(ctx, &proto.StopGridRequest{CancelOpenPairs: cancelOpen})
+			if err != nil {
+				log.Fatalf("could not stop grid: %v", err)
+			}
+			printGrid(r)
+		})
+	},
+}
+
+// withClient connects to the server and calls f with a client and a context that times out
+func withClient(cmd *cobra.Command, f func(ctx context.Context, c proto.MoneytreeClient)) {
+	port, err := cmd.Flags().GetInt("port")
+	if err != nil {
+		log.WithError(err).Fatal("could not get port")
+	}
+	host, err := cmd.Flags().GetString("host")
+	if err != nil {
+		log.WithError(err).Fatal("could not get host")
+	}
+	timeout, err := cmd.Flags().GetString("timeout")
+	if err != nil {
+		log.WithError(err).Fatal("could not get timeout")
+	}
+	address := fmt.Sprintf("%s:%d", host, port)
+
+	// Set up a connection to the server.
+	conn, err := dial(address)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	c := proto.NewMoneytreeClient(conn)
+
+	// Contact the server and print out its response.
+	to, err := time.ParseDuration(timeout)
+	if err != nil {
+		log.WithError(err).Fatal("could not parse timeout value")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), to)
+	defer cancel()
+	f(ctx, c)
+}
+
+func printGrid(grid *proto.Grid) {
+	state := "stopped"
+	if grid.Running {
+		state = "running"
+	}
+	fmt.Printf("grid is %s with %d levels of %s from %s to %s\n\n", state, grid.Levels, grid.Quantity, grid.Lower, grid.Upper)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PRICE\tDIRECTION\tPAIR\tSTATUS\tCOMPLETED\tDETAILS")
+	for _, level := range grid.Ladder {
+		uuid, status := "", ""
+		if level.Pair != nil {
+			uuid, status = level.Pair.Uuid, level.Pair.Status
+		}
+		if level.Paused {
+			status = "PAUSED"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", level.Price, level.Direction, uuid, status, level.Completed, level.Details)
+	}
+	w.Flush()
+}
+
+func init() {
+	clientCmd.AddCommand(gridCmd)
+	gridCmd.PersistentFlags().String("host", "localhost", "Host to connect to")
+	gridCmd.PersistentFlags().Int("port", 44444, "Port to connect to")
+	gridCmd.PersistentFlags().String("timeout", "15s", "Timeout")
+
+	gridCmd.AddCommand(gridStartCmd)
+	gridStartCmd.Flags().Int32("levels", 10, "Number of levels spread evenly between the prices")
+	gridStartCmd.Flags().String("quantity", "", "Quantity of base currency each level trades")
+	gridStartCmd.MarkFlagRequired("quantity")
+
+	gridCmd.AddCommand(gridStopCmd)
+	gridStopCmd.Flags().Bool("cancel", false, "Cancel the pairs whose first order hasn't filled")
+}
@@ -24,7 +24,6 @@ import (
 	"github.com/go-playground/log/v7"
 	"github.com/sinisterminister/moneytree/pkg/proto"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 // placePairCmd represents the placePair command
@@ -57,7 +56,7 @@ to quickly create a Cobra application.`,
 		fmt.Println(fmt.Sprintf("placePair called with %s:%d", host, port))
 
 		// Set up a connection to the server.
-		conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
+		conn, err := dial(address)
 		if err != nil {
 			log.Fatalf("did not connect: %v", err)
 		}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/cobra"
+)
+
+// reconcileCmd represents the reconcile command
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Reconcile the pairs against the exchange",
+	Long:  `Compares the orders of the pairs that are not done against the exchange and reports any drift, stuck pairs or orphaned orders`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		host, err := cmd.Flags().GetString("host")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		timeout, err := cmd.Flags().GetString("timeout")
+		if err != nil {
+			log.WithError(err).Fatal("could not get timeout")
+		}
+		address := fmt.Sprintf("%s:%d", host, port)
+
+		// Set up a connection to the server.
+		conn, err := dial(address)
+		if err != nil {
+			log.Fatalf("did not connect: %v", err)
+		}
+		defer conn.Close()
+		c := proto.NewMoneytreeClient(conn)
+
+		// Contact the server and print out its response.
+		to, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.WithError(err).Fatal("could not parse timeout value")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), to)
+		defer cancel()
+		r, err := c.Reconcile(ctx, &proto.NullRequest{})
+		if err != nil {
+			log.Fatalf("could not reconcile: %v", err)
+		}
+		for _, issue := range r.Issues {
+			fmt.Printf("%s\t%s\t%s\tfixed=%t\t%s\n", issue.Kind, issue.PairUuid, issue.OrderId, issue.Fixed, issue.Details)
+		}
+		log.Infof("reconciled %d pairs; found %d issues", r.PairsChecked, len(r.Issues))
+	},
+}
+
+func init() {
+	clientCmd.AddCommand(reconcileCmd)
+	reconcileCmd.Flags().String("host", "localhost", "Host to connect to")
+	reconcileCmd.Flags().Int("port", 44444, "Port to connect to")
+	reconcileCmd.Flags().String("timeout", "60s", "Timeout")
+}
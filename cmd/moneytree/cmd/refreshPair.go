@@ -23,7 +23,6 @@ import (
 	"github.com/go-playground/log/v7"
 	"github.com/sinisterminister/moneytree/pkg/proto"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
 )
 
 // refreshPairCmd represents the refreshPair command
@@ -51,7 +50,7 @@ var refreshPairCmd = &cobra.Command{
 		fmt.Println(fmt.Sprintf("attempting to refresh pair %s", uuid))
 
 		// Set up a connection to the server.
-		conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
+		conn, err := dial(address)
 		if err != nil {
 			log.Fatalf("did not connect: %v", err)
 		}
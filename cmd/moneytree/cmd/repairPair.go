@@ -0,0 +1,93 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/cobra"
+)
+
+// repairPairCmd represents the repairPair command
+var repairPairCmd = &cobra.Command{
+	Use:   "repairPair [UUID]",
+	Short: "Inspect or repair a broken pair",
+	Long: `Refreshes the orders of a broken pair and shows how much it is out of balance along with the
+actions that can repair it. Pass --action to retry the second order, reverse the pair or mark it resolved.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		host, err := cmd.Flags().GetString("host")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		timeout, err := cmd.Flags().GetString("timeout")
+		if err != nil {
+			log.WithError(err).Fatal("could not get timeout")
+		}
+		action, err := cmd.Flags().GetString("action")
+		if err != nil {
+			log.WithError(err).Fatal("could not get action")
+		}
+		note, err := cmd.Flags().GetString("note")
+		if err != nil {
+			log.WithError(err).Fatal("could not get note")
+		}
+		address := fmt.Sprintf("%s:%d", host, port)
+
+		uuid := args[0]
+
+		// Set up a connection to the server.
+		conn, err := dial(address)
+		if err != nil {
+			log.Fatalf("did not connect: %v", err)
+		}
+		defer conn.Close()
+		c := proto.NewMoneytreeClient(conn)
+
+		// Contact the server and print out its response.
+		to, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.WithError(err).Fatal("could not parse timeout value")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), to)
+		defer cancel()
+		r, err := c.RepairPair(ctx, &proto.RepairPairRequest{Uuid: uuid, Action: strings.ToUpper(action), Note: note})
+		if err != nil {
+			log.Fatalf("could not repair pair: %v", err)
+		}
+		fmt.Printf("pair %s is %s: %s\n", r.Pair.Uuid, r.Pair.Status, r.Pair.StatusDetails)
+		fmt.Printf("base imbalance: %s\nquote imbalance: %s\n", r.BaseImbalance, r.QuoteImbalance)
+		fmt.Printf("available actions: %s\n", strings.ToLower(strings.Join(r.Actions, ", ")))
+	},
+}
+
+func init() {
+	clientCmd.AddCommand(repairPairCmd)
+	repairPairCmd.Flags().String("host", "localhost", "Host to connect to")
+	repairPairCmd.Flags().Int("port", 44444, "Port to connect to")
+	repairPairCmd.Flags().String("timeout", "15s", "Timeout")
+	repairPairCmd.Flags().String("action", "inspect", "Repair action: inspect, retry, reverse or resolve")
+	repairPairCmd.Flags().String("note", "", "Note to record when resolving the pair")
+}
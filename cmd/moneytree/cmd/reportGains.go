@@ -0,0 +1,88 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/report"
+	"github.com/sinisterminister/moneytree/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// reportGainsCmd represents the report gains command
+var reportGainsCmd = &cobra.Command{
+	Use:   "gains",
+	Short: "Export the realized gains for a tax year as CSV",
+	Long: `Walks the filled orders of every finished pair, including reversal orders, and builds tax lots for the base
+currency. Every sale during the year is written as CSV with its acquisition date, disposal date, proceeds, cost
+basis, fees and gain. Orders are dated when they were placed since the exchange doesn't report when they filled.
+Sales that can't be matched to a purchase have no acquisition date or cost basis.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		year, err := cmd.Flags().GetInt("year")
+		if err != nil {
+			log.WithError(err).Fatal("could not get year")
+		}
+		rawMethod, err := cmd.Flags().GetString("method")
+		if err != nil {
+			log.WithError(err).Fatal("could not get method")
+		}
+		method, err := report.ParseLotMethod(rawMethod)
+		if err != nil {
+			log.WithError(err).Fatal("could not parse method")
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.WithError(err).Fatal("could not get output")
+		}
+
+		db, err := server.OpenDatabase()
+		if err != nil {
+			log.WithError(err).Fatal("could not connect to database")
+		}
+		defer db.Close()
+
+		trades, err := report.LoadTrades(db)
+		if err != nil {
+			log.WithError(err).Fatal("could not load trades")
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				log.WithError(err).Fatal("could not create output file")
+			}
+			defer f.Close()
+			w = f
+		}
+
+		err = report.WriteGainsCSV(w, report.BuildDisposals(trades, method), year)
+		if err != nil {
+			log.WithError(err).Fatal("could not write gains")
+		}
+	},
+}
+
+func init() {
+	reportCmd.AddCommand(reportGainsCmd)
+	reportGainsCmd.Flags().Int("year", time.Now().Year(), "Tax year to report")
+	reportGainsCmd.Flags().String("method", string(report.FIFO), "How lots are matched: fifo or specific-id")
+	reportGainsCmd.Flags().StringP("output", "o", "", "File to write the CSV to instead of stdout")
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/cobra"
+)
+
+// resumeTradingCmd represents the resumeTrading command
+var resumeTradingCmd = &cobra.Command{
+	Use:   "resumeTrading",
+	Short: "Resume trading after the risk guard halted it",
+	Long:  `Clears a trading halt from the risk guard. Only losses after resuming count towards the limits.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		host, err := cmd.Flags().GetString("host")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		timeout, err := cmd.Flags().GetString("timeout")
+		if err != nil {
+			log.WithError(err).Fatal("could not get timeout")
+		}
+		address := fmt.Sprintf("%s:%d", host, port)
+
+		// Set up a connection to the server.
+		conn, err := dial(address)
+		if err != nil {
+			log.Fatalf("did not connect: %v", err)
+		}
+		defer conn.Close()
+		c := proto.NewMoneytreeClient(conn)
+
+		// Contact the server and print out its response.
+		to, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.WithError(err).Fatal("could not parse timeout value")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), to)
+		defer cancel()
+		r, err := c.ResumeTrading(ctx, &proto.NullRequest{})
+		if err != nil {
+			log.Fatalf("could not resume trading: %v", err)
+		}
+		log.Infof("trading resumed; realized return %s, consecutive failures %d", r.RealizedReturn, r.ConsecutiveFailures)
+	},
+}
+
+func init() {
+	clientCmd.AddCommand(resumeTradingCmd)
+	resumeTradingCmd.Flags().String("host", "localhost", "Host to connect to")
+	resumeTradingCmd.Flags().Int("port", 44444, "Port to connect to")
+	resumeTradingCmd.Flags().String("timeout", "15s", "Timeout")
+}
@@ -0,0 +1,108 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/cobra"
+)
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "List the accumulation schedules",
+	Long:  `Lists the schedules that buy a fixed amount of quote currency's worth of the base currency along with their recent runs`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withClient(cmd, func(ctx context.Context, c proto.MoneytreeClient) {
+			r, err := c.ListSchedules(ctx, &proto.NullRequest{})
+			if err != nil {
+				log.Fatalf("could not list schedules: %v", err)
+			}
+			for _, schedule := range r.Schedules {
+				printSchedule(schedule)
+			}
+		})
+	},
+}
+
+// scheduleCreateCmd represents the schedule create command
+var scheduleCreateCmd = &cobra.Command{
+	Use:   "create [CRON] [AMOUNT]",
+	Short: "Schedule a buy of a quote amount",
+	Long: `Places a maker buy of the quote amount at the bid each time the cron expression matches. The expression takes
+the five standard fields in UTC, @hourly, @daily, @weekly, @monthly or @every followed by a duration. The buy is skipped
+while the trix oscillator is above --skipAbove and doubled while it's below --doubleBelow.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		skipAbove, err := cmd.Flags().GetString("skipAbove")
+		if err != nil {
+			log.WithError(err).Fatal("could not get skipAbove")
+		}
+		doubleBelow, err := cmd.Flags().GetString("doubleBelow")
+		if err != nil {
+			log.WithError(err).Fatal("could not get doubleBelow")
+		}
+
+		withClient(cmd, func(ctx context.Context, c proto.MoneytreeClient) {
+			r, err := c.CreateSchedule(ctx, &proto.CreateScheduleRequest{Cron: args[0], QuoteAmount: args[1], SkipAbove: skipAbove, DoubleBelow: doubleBelow})
+			if err != nil {
+				log.Fatalf("could not create schedule: %v", err)
+			}
+			printSchedule(r)
+		})
+	},
+}
+
+func printSchedule(schedule *proto.Schedule) {
+	fmt.Printf("%s buys %s every %q, next at %s", schedule.Uuid, schedule.QuoteAmount, schedule.Cron, time.Unix(schedule.NextRun, 0).UTC().Format(time.RFC3339))
+	if schedule.SkipAbove != "" {
+		fmt.Printf(", skipping above %s", schedule.SkipAbove)
+	}
+	if schedule.DoubleBelow != "" {
+		fmt.Printf(", doubling below %s", schedule.DoubleBelow)
+	}
+	fmt.Print("\n\n")
+	if len(schedule.Runs) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tAMOUNT\tPRICE\tQUANTITY\tFILLED\tSTATUS\tDETAILS")
+	for _, run := range schedule.Runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", time.Unix(run.Ts, 0).UTC().Format(time.RFC3339), run.Action, run.Amount, run.Price, run.Quantity, run.Filled, run.Status, run.Details)
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+func init() {
+	clientCmd.AddCommand(scheduleCmd)
+	scheduleCmd.PersistentFlags().String("host", "localhost", "Host to connect to")
+	scheduleCmd.PersistentFlags().Int("port", 44444, "Port to connect to")
+	scheduleCmd.PersistentFlags().String("timeout", "15s", "Timeout")
+
+	scheduleCmd.AddCommand(scheduleCreateCmd)
+	scheduleCreateCmd.Flags().String("skipAbove", "", "Skip the buy while the trix oscillator is above this")
+	scheduleCreateCmd.Flags().String("doubleBelow", "", "Double the buy while the trix oscillator is below this")
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/cobra"
+)
+
+// streamTickerCmd represents the streamTicker command
+var streamTickerCmd = &cobra.Command{
+	Use:   "streamTicker",
+	Short: "Print the ticker as it trades",
+	Long:  `Streams the ticker from the server and prints the price, bid and ask of every tick until interrupted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		host, err := cmd.Flags().GetString("host")
+		if err != nil {
+			log.WithError(err).Fatal("could not get port")
+		}
+		address := fmt.Sprintf("%s:%d", host, port)
+
+		// Set up a connection to the server.
+		conn, err := dial(address)
+		if err != nil {
+			log.Fatalf("did not connect: %v", err)
+		}
+		defer conn.Close()
+		c := proto.NewMoneytreeClient(conn)
+
+		stream, err := c.StreamTicker(context.Background(), &proto.NullRequest{})
+		if err != nil {
+			log.Fatalf("could not stream ticker: %v", err)
+		}
+		for {
+			tick, err := stream.Recv()
+			if err != nil {
+				log.Fatalf("ticker stream ended: %v", err)
+			}
+			fmt.Printf("%s price: %s bid: %s ask: %s\n", time.Unix(tick.Ts, 0).Format(time.RFC3339), tick.Price, tick.Bid, tick.Ask)
+		}
+	},
+}
+
+func init() {
+	clientCmd.AddCommand(streamTickerCmd)
+	streamTickerCmd.Flags().String("host", "localhost", "Host to connect to")
+	streamTickerCmd.Flags().Int("port", 44444, "Port to connect to")
+}
@@ -0,0 +1,98 @@
+// Package auth holds the roles and client credentials shared by the moneytree server and its clients
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type Role string
+
+var (
+	ReadOnly Role = "read-only"
+	Trader   Role = "trader"
+	Admin    Role = "admin"
+)
+
+var roleLevels = map[Role]int{ReadOnly: 1, Trader: 2, Admin: 3}
+
+// Allows reports whether the role has at least the permissions of the required role
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] > 0 && roleLevels[r] >= roleLevels[required]
+}
+
+// ParseRole converts a configured role name into a Role
+func ParseRole(raw string) (Role, error) {
+	role := Role(raw)
+	if _, ok := roleLevels[role]; !ok {
+		return "", fmt.Errorf("unknown role '%s'; roles are %s, %s and %s", raw, ReadOnly, Trader, Admin)
+	}
+	return role, nil
+}
+
+// ClientConfig describes how a client connects to the server. Without TLS the connection is insecure and the token
+// is not sent.
+type ClientConfig struct {
+	TLS        bool
+	CACert     string
+	Cert       string
+	Key        string
+	ServerName string
+	Token      string
+}
+
+// DialOptions builds the credentials for dialing the server
+func (c ClientConfig) DialOptions() ([]grpc.DialOption, error) {
+	if !c.TLS {
+		if c.Token != "" {
+			return nil, fmt.Errorf("refusing to send the token over an insecure connection; enable TLS")
+		}
+		return []grpc.DialOption{grpc.WithInsecure()}, nil
+	}
+
+	config := &tls.Config{ServerName: c.ServerName}
+
+	// Trust a private CA
+	if c.CACert != "" {
+		pem, err := ioutil.ReadFile(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA certificate: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("could not parse CA certificate %s", c.CACert)
+		}
+	}
+
+	// Present a client certificate
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(config))}
+	if c.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(c.Token)))
+	}
+	return opts, nil
+}
+
+// bearerToken sends the token in the authorization header of every call
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return true
+}
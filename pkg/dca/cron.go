@@ -0,0 +1,170 @@
+package dca
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression. It takes the five standard fields (minute, hour, day of month, month and day of
+// week) with *, lists, ranges and steps, one of @hourly, @daily, @weekly or @monthly, or @every followed by a duration.
+// Times are matched in UTC.
+type Cron struct {
+	every time.Duration
+
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	// Like cron, a day matches either field when both the day of month and day of week are restricted
+	anyDay     bool
+	anyWeekday bool
+}
+
+var cronDescriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// ParseCron parses the cron expression
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse interval of %q: %w", expr, err)
+		}
+		if every < time.Minute {
+			return nil, fmt.Errorf("interval of %q must be at least a minute", expr)
+		}
+		return &Cron{every: every}, nil
+	}
+	if standard, ok := cronDescriptors[expr]; ok {
+		expr = standard
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q needs 5 fields, got %d", expr, len(fields))
+	}
+
+	c := &Cron{anyDay: strings.HasPrefix(fields[2], "*"), anyWeekday: strings.HasPrefix(fields[4], "*")}
+	var err error
+	for i, f := range []struct {
+		set      *map[int]bool
+		min, max int
+	}{
+		{&c.minutes, 0, 59},
+		{&c.hours, 0, 23},
+		{&c.days, 1, 31},
+		{&c.months, 1, 12},
+		{&c.weekdays, 0, 7},
+	} {
+		*f.set, err = parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse cron expression %q: %w", expr, err)
+		}
+	}
+
+	// Sunday is both 0 and 7
+	if c.weekdays[7] {
+		c.weekdays[0] = true
+	}
+	return c, nil
+}
+
+// parseCronField parses a comma separated list of *, values and ranges, each with an optional step
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if step > 1 {
+				// A value with a step runs to the end like cron
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first time after the given time that matches
+func (c *Cron) Next(after time.Time) time.Time {
+	if c.every > 0 {
+		return after.Add(c.every)
+	}
+
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+
+	// Every combination repeats within a few years so give up after that. Only impossible dates like February 30th
+	// get this far.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !c.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.hours[t.Hour()] {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !c.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *Cron) matchesDay(t time.Time) bool {
+	day, weekday := c.days[t.Day()], c.weekdays[int(t.Weekday())]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
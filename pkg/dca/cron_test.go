@@ -0,0 +1,72 @@
+package dca
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron_Next(t *testing.T) {
+	// A Friday
+	after := time.Date(2021, 1, 1, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2021, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2021, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2021, 1, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2021, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * *", time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 3,6 *", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 1", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 6h", time.Date(2021, 1, 1, 16, 7, 30, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("could not parse: %s", err)
+			}
+			next := cron.Next(after)
+			if !next.Equal(tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, next)
+			}
+		})
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@yearly",
+		"@every 10s",
+		"@every soon",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := ParseCron(expr)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,459 @@
+// Package dca accumulates the base currency by buying a fixed amount of quote currency's worth of it on a schedule.
+package dca
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	uuid "github.com/satori/go.uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+	"github.com/spf13/viper"
+)
+
+// Action is what a run of a schedule did
+type Action string
+
+var (
+	Bought  Action = "BUY"
+	Doubled Action = "DOUBLE"
+	Skipped Action = "SKIP"
+	Failed  Action = "FAILED"
+)
+
+// Run is one run of a schedule and the buy it placed, if any
+type Run struct {
+	Time     time.Time         `json:"time"`
+	Action   Action            `json:"action"`
+	Details  string            `json:"details,omitempty"`
+	OrderID  string            `json:"orderId,omitempty"`
+	Price    decimal.Decimal   `json:"price"`
+	Quantity decimal.Decimal   `json:"quantity"`
+	Amount   decimal.Decimal   `json:"amount"`
+	Status   types.OrderStatus `json:"status,omitempty"`
+	Filled   decimal.Decimal   `json:"filled"`
+}
+
+// isOpen reports whether the buy of the run could still fill
+func (r Run) isOpen() bool {
+	return r.OrderID != "" && r.Status != order.Filled && r.Status != order.Canceled && r.Status != order.Rejected && r.Status != order.Expired
+}
+
+// Schedule buys QuoteAmount worth of the base currency each time the cron expression matches. The buy is skipped
+// while the trix oscillator is above SkipAbove and doubled while it's below DoubleBelow.
+type Schedule struct {
+	Uuid        string              `json:"uuid"`
+	Cron        string              `json:"cron"`
+	QuoteAmount decimal.Decimal     `json:"quoteAmount"`
+	SkipAbove   decimal.NullDecimal `json:"skipAbove"`
+	DoubleBelow decimal.NullDecimal `json:"doubleBelow"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	NextRun     time.Time           `json:"nextRun"`
+	Runs        []Run               `json:"runs"`
+}
+
+func (s Schedule) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *Schedule) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &s)
+}
+
+func (s Schedule) validate() error {
+	if !s.QuoteAmount.IsPositive() {
+		return fmt.Errorf("schedule amount of %s must be positive", s.QuoteAmount)
+	}
+	if s.SkipAbove.Valid && s.DoubleBelow.Valid && !s.DoubleBelow.Decimal.LessThan(s.SkipAbove.Decimal) {
+		return fmt.Errorf("schedule can't double below %s and skip above %s at the same time", s.DoubleBelow.Decimal, s.SkipAbove.Decimal)
+	}
+	return nil
+}
+
+// Signal returns the trix oscillator of the market. It's positive while the price is gaining momentum.
+type Signal interface {
+	Oscillator() (decimal.Decimal, error)
+}
+
+// Guard is asked before each buy and holds it off by returning an error
+type Guard interface {
+	Check() error
+}
+
+// Placer places the buys and turns them down by returning an error
+type Placer interface {
+	AttemptOrder(req types.OrderRequest) (types.Order, error)
+}
+
+// Service runs the schedules
+type Service struct {
+	db     *sql.DB
+	trader types.Trader
+	market types.Market
+
+	mutex  sync.Mutex
+	signal Signal
+	guard  Guard
+	placer Placer
+	clock  pair.Clock
+}
+
+// NewService creates a Service for use. Will initialize the database if it hasn't been already.
+func NewService(db *sql.DB, trader types.Trader, market types.Market) (svc *Service, err error) {
+	svc = &Service{db: db, trader: trader, market: market}
+	err = svc.initializeDB()
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// SetSignal sets where the trix oscillator comes from. Without one the schedules never skip or double.
+func (svc *Service) SetSignal(signal Signal) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	svc.signal = signal
+}
+
+// SetGuard sets the guard asked before each buy
+func (svc *Service) SetGuard(guard Guard) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	svc.guard = guard
+}
+
+// SetPlacer sets what places the buys. Without one they go straight to the market.
+func (svc *Service) SetPlacer(placer Placer) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	svc.placer = placer
+}
+
+// SetClock sets the clock the schedules run on. Without one they run on the wall clock.
+func (svc *Service) SetClock(clock pair.Clock) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	svc.clock = clock
+}
+
+func (svc *Service) now() time.Time {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	if svc.clock == nil {
+		return time.Now()
+	}
+	return svc.clock.Now()
+}
+
+// Create saves a new schedule. Its first run is the next time the cron expression matches.
+func (svc *Service) Create(schedule Schedule) (Schedule, error) {
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return Schedule{}, err
+	}
+	err = schedule.validate()
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	now := svc.now()
+	schedule.Uuid = uuid.NewV4().String()
+	schedule.CreatedAt = now
+	schedule.NextRun = cron.Next(now)
+	schedule.Runs = []Run{}
+	if schedule.NextRun.IsZero() {
+		return Schedule{}, fmt.Errorf("cron expression %q never matches", schedule.Cron)
+	}
+
+	log.Noticef("%s: buying %s %s every %q", schedule.Uuid, schedule.QuoteAmount, svc.market.QuoteCurrency().Symbol(), schedule.Cron)
+	return schedule, svc.save(schedule)
+}
+
+// List returns the schedules, oldest first
+func (svc *Service) List() (schedules []Schedule, err error) {
+	schedules = []Schedule{}
+	rows, err := svc.db.Query("SELECT data FROM dcaschedules ORDER BY (data->>'createdAt')::timestamptz;")
+	if err != nil {
+		return nil, fmt.Errorf("could not load schedules from database: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		schedule := Schedule{}
+		err = rows.Scan(&schedule)
+		if err != nil {
+			return nil, fmt.Errorf("could not load schedule from database: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// Start runs the schedules as they come due until stopped
+func (svc *Service) Start(stop <-chan bool) {
+	go func() {
+		ticker := time.NewTicker(viper.GetDuration("dca.pollInterval"))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := svc.runDue(svc.now())
+				if err != nil {
+					log.WithError(err).Error("could not run schedules")
+				}
+			}
+		}
+	}()
+}
+
+// runDue runs the schedules that are due and keeps the buys of the rest up to date
+func (svc *Service) runDue(now time.Time) error {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	schedules, err := svc.List()
+	if err != nil {
+		return err
+	}
+	for _, schedule := range schedules {
+		if schedule.NextRun.After(now) {
+			if !svc.refreshLastRun(&schedule) {
+				continue
+			}
+		} else {
+			err = svc.run(&schedule, now)
+			if err != nil {
+				log.WithError(err).Errorf("%s: could not run schedule", schedule.Uuid)
+				continue
+			}
+		}
+
+		err = svc.save(schedule)
+		if err != nil {
+			log.WithError(err).Errorf("%s: could not save schedule", schedule.Uuid)
+		}
+	}
+	return nil
+}
+
+// run places the buy for the schedule and sets its next run. Runs missed while the server was down aren't made up.
+func (svc *Service) run(schedule *Schedule, now time.Time) error {
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return err
+	}
+
+	// The buy of the last run is superseded by this one
+	if len(schedule.Runs) > 0 && schedule.Runs[len(schedule.Runs)-1].isOpen() {
+		svc.cancelRun(schedule.Uuid, &schedule.Runs[len(schedule.Runs)-1])
+	}
+
+	run := svc.decide(schedule)
+	run.Time = now
+	if run.Action != Skipped && svc.guard != nil {
+		err = svc.guard.Check()
+		if err != nil {
+			run = Run{Time: now, Action: Skipped, Details: err.Error()}
+		}
+	}
+	if run.Action != Skipped {
+		err = svc.buy(&run)
+		if err != nil {
+			log.WithError(err).Errorf("%s: could not place buy", schedule.Uuid)
+			run.Action = Failed
+			run.Details = err.Error()
+		}
+	}
+	log.Infof("%s: %s %s %s @ %s %s", schedule.Uuid, run.Action, run.Quantity, svc.market.BaseCurrency().Symbol(), run.Price, run.Details)
+
+	// Only keep the recent runs
+	schedule.Runs = append(schedule.Runs, run)
+	if max := viper.GetInt("dca.maxRuns"); max > 0 && len(schedule.Runs) > max {
+		schedule.Runs = schedule.Runs[len(schedule.Runs)-max:]
+	}
+	schedule.NextRun = cron.Next(now)
+	return nil
+}
+
+// decide sizes the buy from the trix oscillator. The regular amount is bought when the oscillator can't be read.
+func (svc *Service) decide(schedule *Schedule) Run {
+	run := Run{Action: Bought, Amount: schedule.QuoteAmount}
+	if !schedule.SkipAbove.Valid && !schedule.DoubleBelow.Valid {
+		return run
+	}
+	if svc.signal == nil {
+		run.Details = "no trix signal; buying the regular amount"
+		return run
+	}
+
+	osc, err := svc.signal.Oscillator()
+	if err != nil {
+		log.WithError(err).Warnf("%s: could not read the trix oscillator", schedule.Uuid)
+		run.Details = fmt.Sprintf("could not read the trix oscillator; buying the regular amount: %s", err)
+		return run
+	}
+
+	switch {
+	case schedule.SkipAbove.Valid && osc.GreaterThan(schedule.SkipAbove.Decimal):
+		run.Action = Skipped
+		run.Amount = decimal.Zero
+		run.Details = fmt.Sprintf("trix oscillator of %s is above %s", osc, schedule.SkipAbove.Decimal)
+	case schedule.DoubleBelow.Valid && osc.LessThan(schedule.DoubleBelow.Decimal):
+		run.Action = Doubled
+		run.Amount = schedule.QuoteAmount.Mul(decimal.NewFromInt(2))
+		run.Details = fmt.Sprintf("trix oscillator of %s is below %s", osc, schedule.DoubleBelow.Decimal)
+	}
+	return run
+}
+
+// buy places a maker limit buy of the run's amount at the bid
+func (svc *Service) buy(run *Run) error {
+	ticker, err := svc.market.Ticker()
+	if err != nil {
+		return fmt.Errorf("could not load ticker: %w", err)
+	}
+
+	rules := pair.RulesFromMarket(svc.market)
+	price := ticker.Bid().Div(rules.PriceIncrement).Floor().Mul(rules.PriceIncrement)
+	if !price.IsPositive() {
+		return fmt.Errorf("cannot buy at a bid of %s", ticker.Bid())
+	}
+	quantity := run.Amount.Div(price).Div(rules.QuantityStep).Floor().Mul(rules.QuantityStep)
+	if !quantity.IsPositive() || (rules.MinQuantity.IsPositive() && quantity.LessThan(rules.MinQuantity)) {
+		return fmt.Errorf("%s buys %s at %s, which is below the market minimum of %s", run.Amount, quantity, price, rules.MinQuantity)
+	}
+
+	req := order.NewRequest(svc.market, order.Limit, order.Buy, quantity, price, decimal.Zero, true)
+	var ord types.Order
+	if svc.placer != nil {
+		ord, err = svc.placer.AttemptOrder(req)
+	} else {
+		ord, err = svc.market.AttemptOrder(req)
+	}
+	if err != nil {
+		return err
+	}
+	run.OrderID = ord.ID()
+	run.Price = price
+	run.Quantity = quantity
+	run.Status = ord.Status()
+	run.Filled = ord.Filled()
+	return nil
+}
+
+// HeldInBuys returns how much quote currency is sitting in the open buys of the schedules
+func (svc *Service) HeldInBuys() (decimal.Decimal, error) {
+	schedules, err := svc.List()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	held := decimal.Zero
+	for _, schedule := range schedules {
+		held = held.Add(schedule.held())
+	}
+	return held, nil
+}
+
+// held returns the quote currency the unfilled part of the last run's buy is holding
+func (s Schedule) held() decimal.Decimal {
+	if len(s.Runs) == 0 || !s.Runs[len(s.Runs)-1].isOpen() {
+		return decimal.Zero
+	}
+	run := s.Runs[len(s.Runs)-1]
+	return decimal.Max(run.Quantity.Sub(run.Filled), decimal.Zero).Mul(run.Price)
+}
+
+// KnownOrderIDs returns the buys of the schedules that could still fill so reconciliation leaves them alone
+func (svc *Service) KnownOrderIDs() ([]string, error) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	schedules, err := svc.List()
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, schedule := range schedules {
+		ids = append(ids, schedule.openOrderIDs()...)
+	}
+	return ids, nil
+}
+
+// openOrderIDs returns the buys of the runs that could still fill. Earlier runs are kept in case canceling them failed.
+func (s Schedule) openOrderIDs() (ids []string) {
+	for _, run := range s.Runs {
+		if run.isOpen() {
+			ids = append(ids, run.OrderID)
+		}
+	}
+	return
+}
+
+// refreshLastRun updates the buy of the last run from the exchange. It returns whether anything changed.
+func (svc *Service) refreshLastRun(schedule *Schedule) bool {
+	if len(schedule.Runs) == 0 || !schedule.Runs[len(schedule.Runs)-1].isOpen() {
+		return false
+	}
+	run := &schedule.Runs[len(schedule.Runs)-1]
+
+	ord, err := svc.trader.OrderSvc().Order(svc.market, run.OrderID)
+	if err != nil {
+		log.WithError(err).Warnf("%s: could not load order %s", schedule.Uuid, run.OrderID)
+		return false
+	}
+	changed := ord.Status() != run.Status || !ord.Filled().Equal(run.Filled)
+	run.Status = ord.Status()
+	run.Filled = ord.Filled()
+	return changed
+}
+
+func (svc *Service) cancelRun(id string, run *Run) {
+	ord, err := svc.trader.OrderSvc().Order(svc.market, run.OrderID)
+	if err != nil {
+		log.WithError(err).Warnf("%s: could not load order %s to cancel", id, run.OrderID)
+		return
+	}
+	if !ord.IsDone() {
+		log.Infof("%s: canceling unfilled buy %s", id, run.OrderID)
+		err = svc.trader.OrderSvc().CancelOrder(ord)
+		if err != nil {
+			log.WithError(err).Warnf("%s: could not cancel order %s", id, run.OrderID)
+			return
+		}
+		run.Status = order.Canceled
+	} else {
+		run.Status = ord.Status()
+	}
+	run.Filled = ord.Filled()
+}
+
+func (svc *Service) initializeDB() error {
+	_, err := svc.db.Exec("CREATE TABLE IF NOT EXISTS dcaschedules (uuid char(36) primary key, data JSONB);")
+	return err
+}
+
+func (svc *Service) save(schedule Schedule) error {
+	_, err := svc.db.Exec("INSERT INTO dcaschedules (uuid, data) VALUES ($1, $2) ON CONFLICT (uuid) DO UPDATE SET data = $2;", schedule.Uuid, schedule)
+	if err != nil {
+		return fmt.Errorf("could not insert into database: %w", err)
+	}
+	return nil
+}
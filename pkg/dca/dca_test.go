@@ -0,0 +1,258 @@
+package dca
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair/fake_types"
+)
+
+type fixedSignal struct {
+	osc decimal.Decimal
+	err error
+}
+
+func (s fixedSignal) Oscillator() (decimal.Decimal, error) { return s.osc, s.err }
+
+type haltedGuard struct{}
+
+func (haltedGuard) Check() error { return errors.New("trading halted") }
+
+func newTestService() (*Service, *fake_types.Trader) {
+	trader := fake_types.NewTrader(types.MarketDTO{
+		Name:          "BTC-USD",
+		BaseCurrency:  types.CurrencyDTO{Name: "Bitcoin", Symbol: "BTC", Precision: 8},
+		QuoteCurrency: types.CurrencyDTO{Name: "US Dollar", Symbol: "USD", Precision: 2},
+		MinQuantity:   decimal.NewFromFloat(0.001),
+	}, types.FeesDTO{})
+	trader.Market().SetPrice(decimal.NewFromFloat(30000.12))
+	return &Service{trader: trader, market: trader.Market()}, trader
+}
+
+func newTestSchedule() *Schedule {
+	return &Schedule{
+		Uuid:        "schedule",
+		Cron:        "@daily",
+		QuoteAmount: decimal.NewFromInt(100),
+		SkipAbove:   decimal.NullDecimal{Decimal: decimal.NewFromFloat(0.01), Valid: true},
+		DoubleBelow: decimal.NullDecimal{Decimal: decimal.NewFromFloat(-0.01), Valid: true},
+	}
+}
+
+var runTime = time.Date(2021, 1, 1, 0, 0, 10, 0, time.UTC)
+
+func TestRun_Buys(t *testing.T) {
+	svc, trader := newTestService()
+	schedule := newTestSchedule()
+
+	err := svc.run(schedule, runTime)
+	if err != nil {
+		t.Fatalf("could not run schedule: %s", err)
+	}
+
+	if len(trader.Orders()) != 1 {
+		t.Fatalf("expected one buy, got %d orders", len(trader.Orders()))
+	}
+	req := trader.Orders()[0].Request()
+	if req.Side() != order.Buy || !req.Price().Equal(decimal.NewFromFloat(30000.12)) || !req.ForceMaker() {
+		t.Errorf("expected a maker buy at the bid, got %s at %s", req.Side(), req.Price())
+	}
+	if !req.Quantity().Equal(decimal.NewFromFloat(0.00333332)) {
+		t.Errorf("expected to buy 0.00333332, got %s", req.Quantity())
+	}
+
+	run := schedule.Runs[0]
+	if run.Action != Bought || run.OrderID != trader.Orders()[0].ID() || !run.Amount.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("expected the buy to be recorded, got %+v", run)
+	}
+	if !schedule.NextRun.Equal(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the next run tomorrow, got %s", schedule.NextRun)
+	}
+}
+
+func TestRun_Trix(t *testing.T) {
+	tests := []struct {
+		scenario string
+		signal   Signal
+		action   Action
+		amount   decimal.Decimal
+	}{
+		{"strongly positive", fixedSignal{osc: decimal.NewFromFloat(0.02)}, Skipped, decimal.Zero},
+		{"strongly negative", fixedSignal{osc: decimal.NewFromFloat(-0.02)}, Doubled, decimal.NewFromInt(200)},
+		{"flat", fixedSignal{osc: decimal.NewFromFloat(0.001)}, Bought, decimal.NewFromInt(100)},
+		{"unreadable", fixedSignal{err: errors.New("not warmed up")}, Bought, decimal.NewFromInt(100)},
+		{"no signal", nil, Bought, decimal.NewFromInt(100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			svc, trader := newTestService()
+			svc.signal = tt.signal
+			schedule := newTestSchedule()
+
+			err := svc.run(schedule, runTime)
+			if err != nil {
+				t.Fatalf("could not run schedule: %s", err)
+			}
+			run := schedule.Runs[0]
+			if run.Action != tt.action || !run.Amount.Equal(tt.amount) {
+				t.Errorf("expected to %s %s, got %s %s", tt.action, tt.amount, run.Action, run.Amount)
+			}
+			if tt.action == Skipped && len(trader.Orders()) != 0 {
+				t.Errorf("expected no buy, got %d orders", len(trader.Orders()))
+			}
+		})
+	}
+}
+
+func TestRun_Guard(t *testing.T) {
+	svc, trader := newTestService()
+	svc.guard = haltedGuard{}
+	schedule := newTestSchedule()
+
+	err := svc.run(schedule, runTime)
+	if err != nil {
+		t.Fatalf("could not run schedule: %s", err)
+	}
+	if schedule.Runs[0].Action != Skipped || schedule.Runs[0].Details != "trading halted" {
+		t.Errorf("expected the halt to skip the buy, got %+v", schedule.Runs[0])
+	}
+	if len(trader.Orders()) != 0 {
+		t.Errorf("expected no buy, got %d orders", len(trader.Orders()))
+	}
+}
+
+func TestRun_CancelsUnfilledBuy(t *testing.T) {
+	svc, trader := newTestService()
+	schedule := newTestSchedule()
+
+	err := svc.run(schedule, runTime)
+	if err != nil {
+		t.Fatalf("could not run schedule: %s", err)
+	}
+	first := trader.Orders()[0]
+	first.Fill(decimal.NewFromFloat(0.001))
+
+	err = svc.run(schedule, schedule.NextRun)
+	if err != nil {
+		t.Fatalf("could not run schedule: %s", err)
+	}
+	if first.Status() != order.Canceled {
+		t.Errorf("expected the unfilled buy to be canceled, got %s", first.Status())
+	}
+	if schedule.Runs[0].Status != order.Canceled || !schedule.Runs[0].Filled.Equal(decimal.NewFromFloat(0.001)) {
+		t.Errorf("expected the canceled buy and its fill to be recorded, got %+v", schedule.Runs[0])
+	}
+	if len(schedule.Runs) != 2 || len(trader.Orders()) != 2 {
+		t.Errorf("expected a second buy, got %d runs and %d orders", len(schedule.Runs), len(trader.Orders()))
+	}
+}
+
+func TestRun_Failures(t *testing.T) {
+	t.Run("below the market minimum", func(t *testing.T) {
+		svc, _ := newTestService()
+		schedule := newTestSchedule()
+		schedule.QuoteAmount = decimal.NewFromInt(10)
+
+		err := svc.run(schedule, runTime)
+		if err != nil {
+			t.Fatalf("could not run schedule: %s", err)
+		}
+		if schedule.Runs[0].Action != Failed || !strings.Contains(schedule.Runs[0].Details, "market minimum") {
+			t.Errorf("expected the buy to fail on the minimum, got %+v", schedule.Runs[0])
+		}
+	})
+
+	t.Run("rejected by the exchange", func(t *testing.T) {
+		svc, trader := newTestService()
+		trader.FailNextOrder(errors.New("insufficient funds"))
+		schedule := newTestSchedule()
+
+		err := svc.run(schedule, runTime)
+		if err != nil {
+			t.Fatalf("could not run schedule: %s", err)
+		}
+		if schedule.Runs[0].Action != Failed || schedule.Runs[0].Details != "insufficient funds" {
+			t.Errorf("expected the buy to fail, got %+v", schedule.Runs[0])
+		}
+		if !schedule.NextRun.After(runTime) {
+			t.Error("expected the schedule to move on to the next run")
+		}
+	})
+}
+
+func TestSchedule_Validate(t *testing.T) {
+	valid := newTestSchedule()
+	if err := valid.validate(); err != nil {
+		t.Errorf("expected schedule to be valid, got %s", err)
+	}
+
+	noAmount := newTestSchedule()
+	noAmount.QuoteAmount = decimal.Zero
+	if err := noAmount.validate(); err == nil {
+		t.Error("expected an error for a schedule without an amount")
+	}
+
+	crossed := newTestSchedule()
+	crossed.DoubleBelow.Decimal = decimal.NewFromFloat(0.02)
+	if err := crossed.validate(); err == nil {
+		t.Error("expected an error for a schedule that doubles above where it skips")
+	}
+}
+
+func TestSchedule_Held(t *testing.T) {
+	svc, trader := newTestService()
+	schedule := newTestSchedule()
+	if !schedule.held().IsZero() {
+		t.Errorf("expected a schedule that never ran to hold nothing, got %s", schedule.held())
+	}
+
+	// The unfilled part of the open buy is held at its price
+	err := svc.run(schedule, runTime)
+	if err != nil {
+		t.Fatalf("could not run schedule: %s", err)
+	}
+	schedule.Runs[0].Filled = decimal.NewFromFloat(0.00133332)
+	if expected := decimal.NewFromFloat(60.00024); !schedule.held().Equal(expected) {
+		t.Errorf("expected %s to be held, got %s", expected, schedule.held())
+	}
+
+	// Canceled buys hold nothing
+	svc.cancelRun(schedule.Uuid, &schedule.Runs[0])
+	if !schedule.held().IsZero() || trader.Orders()[0].Status() != order.Canceled {
+		t.Errorf("expected the canceled buy to hold nothing, got %s", schedule.held())
+	}
+}
+
+func TestSchedule_OpenOrderIDs(t *testing.T) {
+	svc, trader := newTestService()
+	schedule := newTestSchedule()
+	err := svc.run(schedule, runTime)
+	if err != nil {
+		t.Fatalf("could not run schedule: %s", err)
+	}
+	first := trader.Orders()[0]
+
+	// A buy that couldn't be canceled is still resting next to the new one
+	trader.FailNextCancel(errors.New("exchange unavailable"))
+	err = svc.run(schedule, schedule.NextRun)
+	if err != nil {
+		t.Fatalf("could not run schedule: %s", err)
+	}
+	second := trader.Orders()[1]
+	if ids := schedule.openOrderIDs(); len(ids) != 2 || ids[0] != first.ID() || ids[1] != second.ID() {
+		t.Errorf("expected both buys to be open, got %v", ids)
+	}
+
+	// Filled buys are dropped
+	second.Fill(second.Request().Quantity())
+	svc.refreshLastRun(schedule)
+	if ids := schedule.openOrderIDs(); len(ids) != 1 || ids[0] != first.ID() {
+		t.Errorf("expected only the first buy to be open, got %v", ids)
+	}
+}
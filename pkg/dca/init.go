@@ -0,0 +1,11 @@
+package dca
+
+import "github.com/spf13/viper"
+
+func init() {
+	// How often to check for schedules that are due. Schedules run on the minute so this should be under a minute
+	viper.SetDefault("dca.pollInterval", "30s")
+
+	// Keep this many of the most recent runs of each schedule. 0 keeps them all
+	viper.SetDefault("dca.maxRuns", 100)
+}
@@ -0,0 +1,103 @@
+package indicators
+
+// SMA is the simple moving average of the closes over a period
+type SMA struct {
+	period int
+	window *window
+	sum    float64
+}
+
+func NewSMA(period int) *SMA {
+	return &SMA{period: period, window: newWindow(period)}
+}
+
+func (s *SMA) Update(c Candle) {
+	s.add(c.Close)
+}
+
+func (s *SMA) add(v float64) {
+	old, evicted := s.window.push(v)
+	s.sum += v
+	if evicted {
+		s.sum -= old
+	}
+}
+
+func (s *SMA) Ready() bool {
+	return s.window.full
+}
+
+func (s *SMA) Value() float64 {
+	if !s.Ready() {
+		return 0
+	}
+	return s.sum / float64(s.period)
+}
+
+// EMA is the exponential moving average of the closes over a period. It is seeded with the simple average of the
+// first period closes.
+type EMA struct {
+	period int
+	alpha  float64
+	count  int
+	value  float64
+}
+
+func NewEMA(period int) *EMA {
+	return &EMA{period: period, alpha: 2 / (float64(period) + 1)}
+}
+
+func (e *EMA) Update(c Candle) {
+	e.add(c.Close)
+}
+
+func (e *EMA) add(v float64) {
+	e.count++
+	switch {
+	case e.count < e.period:
+		e.value += v
+	case e.count == e.period:
+		e.value = (e.value + v) / float64(e.period)
+	default:
+		e.value = (v-e.value)*e.alpha + e.value
+	}
+}
+
+func (e *EMA) Ready() bool {
+	return e.count >= e.period
+}
+
+func (e *EMA) Value() float64 {
+	if !e.Ready() {
+		return 0
+	}
+	return e.value
+}
+
+// DEMA is the double exponential moving average of the closes over a period
+type DEMA struct {
+	ema    *EMA
+	emaEma *EMA
+}
+
+func NewDEMA(period int) *DEMA {
+	return &DEMA{NewEMA(period), NewEMA(period)}
+}
+
+func (d *DEMA) Update(c Candle) {
+	d.ema.add(c.Close)
+	if d.ema.Ready() {
+		d.emaEma.add(d.ema.Value())
+	}
+}
+
+func (d *DEMA) Ready() bool {
+	return d.emaEma.Ready()
+}
+
+func (d *DEMA) Value() float64 {
+	if !d.Ready() {
+		return 0
+	}
+	return 2*d.ema.Value() - d.emaEma.Value()
+}
@@ -0,0 +1,95 @@
+// Package indicators implements streaming technical indicators over candle series. Every indicator updates in
+// constant time per candle so they can be fed straight from a live candle stream.
+package indicators
+
+import (
+	"time"
+)
+
+// Candle is a single period of price data fed to the indicators
+type Candle struct {
+	Timestamp time.Time
+	Open      float64
+	High      float64
+	Low       float64
+	Close     float64
+	Volume    float64
+}
+
+// Indicator is the common interface for the streaming indicators
+type Indicator interface {
+	// Update adds the next candle in the series
+	Update(c Candle)
+
+	// Ready reports whether enough candles have been seen for Value to be meaningful
+	Ready() bool
+
+	// Value returns the primary value of the indicator, or 0 until it is ready
+	Value() float64
+}
+
+// UpdateAll feeds the candles, oldest first, to all of the indicators
+func UpdateAll(candles []Candle, indicators ...Indicator) {
+	for _, c := range candles {
+		for _, i := range indicators {
+			i.Update(c)
+		}
+	}
+}
+
+// window is a fixed size ring buffer of the latest values
+type window struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func newWindow(size int) *window {
+	return &window{values: make([]float64, size)}
+}
+
+// push adds the value and returns the value it pushed out of the window, if any
+func (w *window) push(v float64) (old float64, evicted bool) {
+	old, evicted = w.values[w.next], w.full
+	w.values[w.next] = v
+	w.next++
+	if w.next == len(w.values) {
+		w.next = 0
+		w.full = true
+	}
+	return
+}
+
+// extremes tracks the highest or lowest value over the last period values with a monotonic deque
+type extremes struct {
+	period int
+	count  int
+	less   func(a, b float64) bool
+	values []float64
+	index  []int
+}
+
+func newExtremes(period int, less func(a, b float64) bool) *extremes {
+	return &extremes{period: period, less: less}
+}
+
+func (e *extremes) push(v float64) {
+	// Drop the values that can never be the extreme again
+	for len(e.values) > 0 && !e.less(e.values[len(e.values)-1], v) {
+		e.values = e.values[:len(e.values)-1]
+		e.index = e.index[:len(e.index)-1]
+	}
+	e.values = append(e.values, v)
+	e.index = append(e.index, e.count)
+	e.count++
+
+	// Drop the values that have left the window
+	if e.index[0] <= e.count-1-e.period {
+		e.values = e.values[1:]
+		e.index = e.index[1:]
+	}
+}
+
+func (e *extremes) value() float64 {
+	return e.values[0]
+}
@@ -0,0 +1,103 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+// The closes are Wilder's RSI example series; the highs, lows and volumes are synthetic. Expected values come from
+// batch calculations over the whole series.
+var closes = []float64{
+	44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08, 45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03,
+	46.41, 46.22, 45.64, 46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57, 43.42, 42.66, 43.13,
+}
+
+func buildCandles() []Candle {
+	candles := make([]Candle, len(closes))
+	for i, c := range closes {
+		candles[i] = Candle{
+			Open:   c,
+			High:   c + 0.25 + float64(i%3)*0.1,
+			Low:    c - 0.2 - float64(i%4)*0.1,
+			Close:  c,
+			Volume: float64(100 + (i*37)%50),
+		}
+	}
+	return candles
+}
+
+func TestIndicators(t *testing.T) {
+	var tests = []struct {
+		name       string
+		indicator  Indicator
+		value      func(Indicator) float64
+		firstReady int
+		expected   map[int]float64
+	}{
+		{"sma", NewSMA(10), nil, 9, map[int]float64{9: 44.7790, 20: 46.0710, 32: 44.3790}},
+		{"ema", NewEMA(10), nil, 9, map[int]float64{9: 44.7790, 20: 45.9321, 32: 44.1193}},
+		{"dema", NewDEMA(5), nil, 8, map[int]float64{8: 45.7661, 20: 46.0921, 32: 42.9253}},
+		{"rsi", NewRSI(14), nil, 14, map[int]float64{14: 70.4641, 15: 66.2496, 20: 62.8807, 32: 37.7888}},
+		{"macd", NewMACD(5, 10, 4), nil, 12, map[int]float64{12: 0.4577, 32: -0.6082}},
+		{"macd signal", NewMACD(5, 10, 4), func(i Indicator) float64 { return i.(*MACD).Signal() }, 12, map[int]float64{12: 0.5993, 32: -0.5410}},
+		{"macd histogram", NewMACD(5, 10, 4), func(i Indicator) float64 { return i.(*MACD).Histogram() }, 12, map[int]float64{12: 0.4577 - 0.5993, 32: -0.6082 + 0.5410}},
+		{"bollinger middle", NewBollingerBands(20, 2), nil, 19, map[int]float64{19: 45.4090, 32: 45.2410}},
+		{"bollinger upper", NewBollingerBands(20, 2), func(i Indicator) float64 { return i.(*BollingerBands).Upper() }, 19, map[int]float64{19: 47.1153, 32: 47.6202}},
+		{"bollinger lower", NewBollingerBands(20, 2), func(i Indicator) float64 { return i.(*BollingerBands).Lower() }, 19, map[int]float64{19: 43.7027, 32: 42.8618}},
+		{"atr", NewATR(14), nil, 13, map[int]float64{13: 0.8050, 20: 0.8178, 32: 0.9299}},
+		{"vwap", NewVWAP(), nil, 0, map[int]float64{0: 44.3567, 10: 44.9032, 32: 45.1407}},
+		{"stochastic k", NewStochastic(14, 3), nil, 15, map[int]float64{15: 79.8343, 20: 66.4948, 32: 20.4641}},
+		{"stochastic d", NewStochastic(14, 3), func(i Indicator) float64 { return i.(*Stochastic).D() }, 15, map[int]float64{15: 85.8200, 20: 60.8485, 32: 13.7740}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := tt.value
+			if value == nil {
+				value = Indicator.Value
+			}
+
+			for i, c := range buildCandles() {
+				tt.indicator.Update(c)
+				if ready := tt.indicator.Ready(); ready != (i >= tt.firstReady) {
+					t.Fatalf("candle %d: expected ready to be %t got %t", i, i >= tt.firstReady, ready)
+				}
+				if !tt.indicator.Ready() && value(tt.indicator) != 0 {
+					t.Errorf("candle %d: expected 0 before ready got %f", i, value(tt.indicator))
+				}
+
+				expected, ok := tt.expected[i]
+				if !ok {
+					continue
+				}
+				if actual := value(tt.indicator); math.Abs(actual-expected) > 0.0001 {
+					t.Errorf("candle %d: expected %.4f got %.4f", i, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestVWAPReset(t *testing.T) {
+	vwap := NewVWAP()
+	vwap.Update(Candle{High: 10, Low: 10, Close: 10, Volume: 5})
+	vwap.Reset()
+	if vwap.Ready() {
+		t.Fatal("expected vwap not to be ready after reset")
+	}
+
+	vwap.Update(Candle{High: 21, Low: 18, Close: 21, Volume: 2})
+	if vwap.Value() != 20 {
+		t.Errorf("expected 20 got %f", vwap.Value())
+	}
+}
+
+func TestRSIWithoutLosses(t *testing.T) {
+	rsi := NewRSI(3)
+	for _, c := range []float64{1, 2, 3, 4, 5} {
+		rsi.Update(Candle{Close: c})
+	}
+	if rsi.Value() != 100 {
+		t.Errorf("expected 100 got %f", rsi.Value())
+	}
+}
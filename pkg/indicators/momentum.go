@@ -0,0 +1,167 @@
+package indicators
+
+// RSI is Wilder's relative strength index of the closes over a period
+type RSI struct {
+	period  int
+	count   int
+	prev    float64
+	avgGain float64
+	avgLoss float64
+}
+
+func NewRSI(period int) *RSI {
+	return &RSI{period: period}
+}
+
+func (r *RSI) Update(c Candle) {
+	r.count++
+	if r.count == 1 {
+		r.prev = c.Close
+		return
+	}
+
+	var gain, loss float64
+	if change := c.Close - r.prev; change > 0 {
+		gain = change
+	} else {
+		loss = -change
+	}
+	r.prev = c.Close
+
+	// Seed with the simple average of the first changes then smooth
+	n := float64(r.period)
+	if r.count <= r.period+1 {
+		r.avgGain += gain / n
+		r.avgLoss += loss / n
+		return
+	}
+	r.avgGain = (r.avgGain*(n-1) + gain) / n
+	r.avgLoss = (r.avgLoss*(n-1) + loss) / n
+}
+
+func (r *RSI) Ready() bool {
+	return r.count > r.period
+}
+
+func (r *RSI) Value() float64 {
+	if !r.Ready() {
+		return 0
+	}
+	if r.avgLoss == 0 {
+		return 100
+	}
+	return 100 - 100/(1+r.avgGain/r.avgLoss)
+}
+
+// MACD is the moving average convergence divergence of the closes
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+}
+
+func NewMACD(fast int, slow int, signal int) *MACD {
+	return &MACD{NewEMA(fast), NewEMA(slow), NewEMA(signal)}
+}
+
+func (m *MACD) Update(c Candle) {
+	m.fast.add(c.Close)
+	m.slow.add(c.Close)
+	if m.slow.Ready() {
+		m.signal.add(m.MACD())
+	}
+}
+
+func (m *MACD) Ready() bool {
+	return m.signal.Ready()
+}
+
+// Value returns the MACD line
+func (m *MACD) Value() float64 {
+	if !m.Ready() {
+		return 0
+	}
+	return m.MACD()
+}
+
+// MACD returns the difference between the fast and slow averages once the slow average is ready
+func (m *MACD) MACD() float64 {
+	if !m.slow.Ready() {
+		return 0
+	}
+	return m.fast.Value() - m.slow.Value()
+}
+
+// Signal returns the average of the MACD line
+func (m *MACD) Signal() float64 {
+	return m.signal.Value()
+}
+
+// Histogram returns the distance between the MACD line and its signal
+func (m *MACD) Histogram() float64 {
+	if !m.Ready() {
+		return 0
+	}
+	return m.MACD() - m.Signal()
+}
+
+// Stochastic is the stochastic oscillator. %K places the close within the range of the period and %D smooths %K.
+type Stochastic struct {
+	highs *extremes
+	lows  *extremes
+	count int
+	k     float64
+	d     *SMA
+	kPer  int
+}
+
+func NewStochastic(kPeriod int, dPeriod int) *Stochastic {
+	return &Stochastic{
+		highs: newExtremes(kPeriod, func(a, b float64) bool { return a > b }),
+		lows:  newExtremes(kPeriod, func(a, b float64) bool { return a < b }),
+		d:     NewSMA(dPeriod),
+		kPer:  kPeriod,
+	}
+}
+
+func (s *Stochastic) Update(c Candle) {
+	s.highs.push(c.High)
+	s.lows.push(c.Low)
+	s.count++
+	if s.count < s.kPer {
+		return
+	}
+
+	high, low := s.highs.value(), s.lows.value()
+	if high == low {
+		s.k = 50
+	} else {
+		s.k = 100 * (c.Close - low) / (high - low)
+	}
+	s.d.add(s.k)
+}
+
+func (s *Stochastic) Ready() bool {
+	return s.d.Ready()
+}
+
+// Value returns %K once %D is ready
+func (s *Stochastic) Value() float64 {
+	if !s.Ready() {
+		return 0
+	}
+	return s.K()
+}
+
+// K returns the position of the close within the range of the period
+func (s *Stochastic) K() float64 {
+	if s.count < s.kPer {
+		return 0
+	}
+	return s.k
+}
+
+// D returns the moving average of %K
+func (s *Stochastic) D() float64 {
+	return s.d.Value()
+}
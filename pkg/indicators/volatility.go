@@ -0,0 +1,141 @@
+package indicators
+
+import "math"
+
+// BollingerBands places bands a number of standard deviations above and below the simple moving average
+type BollingerBands struct {
+	period int
+	k      float64
+	window *window
+	sum    float64
+	sumSq  float64
+}
+
+func NewBollingerBands(period int, k float64) *BollingerBands {
+	return &BollingerBands{period: period, k: k, window: newWindow(period)}
+}
+
+func (b *BollingerBands) Update(c Candle) {
+	old, evicted := b.window.push(c.Close)
+	b.sum += c.Close
+	b.sumSq += c.Close * c.Close
+	if evicted {
+		b.sum -= old
+		b.sumSq -= old * old
+	}
+}
+
+func (b *BollingerBands) Ready() bool {
+	return b.window.full
+}
+
+// Value returns the middle band
+func (b *BollingerBands) Value() float64 {
+	return b.Middle()
+}
+
+func (b *BollingerBands) Middle() float64 {
+	if !b.Ready() {
+		return 0
+	}
+	return b.sum / float64(b.period)
+}
+
+func (b *BollingerBands) Upper() float64 {
+	if !b.Ready() {
+		return 0
+	}
+	return b.Middle() + b.k*b.stdDev()
+}
+
+func (b *BollingerBands) Lower() float64 {
+	if !b.Ready() {
+		return 0
+	}
+	return b.Middle() - b.k*b.stdDev()
+}
+
+func (b *BollingerBands) stdDev() float64 {
+	n := float64(b.period)
+	mean := b.sum / n
+	variance := b.sumSq/n - mean*mean
+
+	// Guard against rounding pushing the variance below zero
+	if variance < 0 {
+		return 0
+	}
+	return math.Sqrt(variance)
+}
+
+// ATR is Wilder's average true range over a period
+type ATR struct {
+	period int
+	count  int
+	prev   float64
+	value  float64
+}
+
+func NewATR(period int) *ATR {
+	return &ATR{period: period}
+}
+
+func (a *ATR) Update(c Candle) {
+	tr := c.High - c.Low
+	if a.count > 0 {
+		tr = math.Max(tr, math.Max(math.Abs(c.High-a.prev), math.Abs(c.Low-a.prev)))
+	}
+	a.prev = c.Close
+	a.count++
+
+	// Seed with the simple average of the first ranges then smooth
+	n := float64(a.period)
+	if a.count <= a.period {
+		a.value += tr / n
+		return
+	}
+	a.value = (a.value*(n-1) + tr) / n
+}
+
+func (a *ATR) Ready() bool {
+	return a.count >= a.period
+}
+
+func (a *ATR) Value() float64 {
+	if !a.Ready() {
+		return 0
+	}
+	return a.value
+}
+
+// VWAP is the volume weighted average of the typical price since it was last reset
+type VWAP struct {
+	volume float64
+	total  float64
+}
+
+func NewVWAP() *VWAP {
+	return &VWAP{}
+}
+
+func (v *VWAP) Update(c Candle) {
+	typical := (c.High + c.Low + c.Close) / 3
+	v.total += typical * c.Volume
+	v.volume += c.Volume
+}
+
+// Reset starts a new session
+func (v *VWAP) Reset() {
+	v.volume = 0
+	v.total = 0
+}
+
+func (v *VWAP) Ready() bool {
+	return v.volume > 0
+}
+
+func (v *VWAP) Value() float64 {
+	if !v.Ready() {
+		return 0
+	}
+	return v.total / v.volume
+}
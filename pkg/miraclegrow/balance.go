@@ -0,0 +1,49 @@
+package miraclegrow
+
+import (
+	"fmt"
+
+	"github.com/go-playground/log/v7"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+)
+
+func init() {
+	RegisterStrategy("balance", func() Strategy { return &balanceStrategy{newTrixTracker()} })
+}
+
+// balanceStrategy keeps the number of filled pairs even in both directions and only follows the trix indicators when
+// they're balanced
+type balanceStrategy struct {
+	trix *trixTracker
+}
+
+func (s *balanceStrategy) Decide(in *Inputs) (Decision, error) {
+	// Get the the direction with the least number of pairs
+	upCount, downCount := countFilledPairs(in.OpenPairs)
+	log.Infof("pair counts - total: %d, up: %d, down: %d", len(in.OpenPairs), upCount, downCount)
+	if upCount > downCount {
+		return Decision{pair.Downward, fmt.Sprintf("more filled up pairs than down (%d > %d)", upCount, downCount)}, nil
+	} else if upCount < downCount {
+		return Decision{pair.Upward, fmt.Sprintf("more filled down pairs than up (%d > %d)", downCount, upCount)}, nil
+	}
+
+	// We'll place the pair based on the trix indicators
+	currentPrice, movingAverage, oscillator, err := s.trix.getTrixIndicators(in, proto.GetCandlesRequest_FIVE_MINUTES)
+	if err != nil {
+		return Decision{}, fmt.Errorf("could not get trix indicators: %w", err)
+	}
+
+	// If the current price is above the moving average and gaining momentum, going up
+	if currentPrice.GreaterThan(movingAverage) && oscillator.GreaterThanOrEqual(decimal.Zero) {
+		return Decision{pair.Upward, "price is above the 5m trix average and gaining momentum"}, nil
+	}
+
+	// If the current price is below the moving average and losing momentum, going down
+	if currentPrice.LessThan(movingAverage) && oscillator.LessThanOrEqual(decimal.Zero) {
+		return Decision{pair.Downward, "price is below the 5m trix average and losing momentum"}, nil
+	}
+
+	return Decision{Reason: "pairs are balanced and the 5m trix is inconclusive"}, nil
+}
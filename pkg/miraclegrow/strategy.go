@@ -0,0 +1,159 @@
+package miraclegrow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+)
+
+// Strategy decides which pair, if any, to place on each tick
+type Strategy interface {
+	Decide(in *Inputs) (Decision, error)
+}
+
+// Decision is the outcome of a strategy for a tick. An empty direction means no pair should be placed.
+type Decision struct {
+	Direction pair.Direction
+	Reason    string
+}
+
+// Inputs gives strategies access to the state of the market for a tick. The ticker and candles are fetched lazily and
+// cached for the rest of the tick.
+type Inputs struct {
+	OpenPairs []*proto.Pair
+
+	ctx       context.Context
+	moneytree proto.MoneytreeClient
+	candles   map[proto.GetCandlesRequest_Duration][]*proto.Candle
+	ticker    *proto.Ticker
+}
+
+// Ticker returns the latest ticker
+func (in *Inputs) Ticker() (*proto.Ticker, error) {
+	if in.ticker != nil {
+		return in.ticker, nil
+	}
+
+	ticker, err := in.moneytree.GetTicker(in.ctx, &proto.NullRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get ticker: %w", err)
+	}
+	in.ticker = ticker
+	return ticker, nil
+}
+
+// Candles returns the last three hours of candles for the duration, newest first
+func (in *Inputs) Candles(duration proto.GetCandlesRequest_Duration) ([]*proto.Candle, error) {
+	if candles, ok := in.candles[duration]; ok {
+		return candles, nil
+	}
+
+	candles, err := in.fetchCandles(duration, time.Now().Add(-3*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	in.candles[duration] = candles
+	return candles, nil
+}
+
+// CandlesSince returns the candles for the duration starting at or after the time, newest first. The cached
+// candles are used when they cover the time.
+func (in *Inputs) CandlesSince(duration proto.GetCandlesRequest_Duration, since time.Time) ([]*proto.Candle, error) {
+	if candles, ok := in.candles[duration]; ok && candles[len(candles)-1].Ts <= since.Unix() {
+		for i, c := range candles {
+			if c.Ts < since.Unix() {
+				if i == 0 {
+					return nil, fmt.Errorf("no %s candles since %s", duration, since)
+				}
+				return candles[:i], nil
+			}
+		}
+		return candles, nil
+	}
+	return in.fetchCandles(duration, since)
+}
+
+func (in *Inputs) fetchCandles(duration proto.GetCandlesRequest_Duration, since time.Time) ([]*proto.Candle, error) {
+	res, err := in.moneytree.GetCandles(in.ctx, &proto.GetCandlesRequest{Duration: duration, StartTime: since.Unix(), EndTime: time.Now().Unix()})
+	if err != nil {
+		return nil, fmt.Errorf("could not get candles: %w", err)
+	}
+	if len(res.GetCandles()) == 0 {
+		return nil, fmt.Errorf("no %s candles returned", duration)
+	}
+	return res.GetCandles(), nil
+}
+
+// Price returns the price of the latest ticker
+func (in *Inputs) Price() (decimal.Decimal, error) {
+	ticker, err := in.Ticker()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimal.NewFromString(ticker.Price)
+}
+
+var (
+	strategyMutex sync.RWMutex
+	strategies    = map[string]func() Strategy{}
+)
+
+// RegisterStrategy makes a strategy selectable by name. The factory is called once for each service that uses it.
+func RegisterStrategy(name string, factory func() Strategy) {
+	strategyMutex.Lock()
+	defer strategyMutex.Unlock()
+
+	strategies[name] = factory
+}
+
+// NewStrategy builds the strategy registered under the name
+func NewStrategy(name string) (Strategy, error) {
+	strategyMutex.RLock()
+	defer strategyMutex.RUnlock()
+
+	factory, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy '%s'; available strategies are %v", name, strategyNames())
+	}
+	return factory(), nil
+}
+
+// Strategies returns the names of the registered strategies
+func Strategies() []string {
+	strategyMutex.RLock()
+	defer strategyMutex.RUnlock()
+
+	return strategyNames()
+}
+
+func strategyNames() []string {
+	names := []string{}
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// countFilledPairs counts the open pairs whose first order has filled in each direction
+func countFilledPairs(pairs []*proto.Pair) (upCount int, downCount int) {
+	for _, p := range pairs {
+		switch pair.Direction(p.Direction) {
+		case pair.Upward:
+			if p.BuyOrder.Status == "FILLED" {
+				upCount++
+			}
+		case pair.Downward:
+			if p.SellOrder.Status == "FILLED" {
+				downCount++
+			}
+		}
+	}
+	return
+}
@@ -2,12 +2,13 @@ package miraclegrow
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-playground/log/v7"
 	"github.com/heptiolabs/healthcheck"
-	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/moneytree/pkg/auth"
 	"github.com/sinisterminister/moneytree/pkg/pair"
 	"github.com/sinisterminister/moneytree/pkg/proto"
 	"google.golang.org/grpc"
@@ -18,10 +19,15 @@ type Service struct {
 	updateFrequency time.Duration
 }
 
-func NewService(address string, updateFrequency time.Duration) (svc *Service) {
+func NewService(address string, updateFrequency time.Duration, creds auth.ClientConfig) (svc *Service) {
+	opts, err := creds.DialOptions()
+	if err != nil {
+		log.WithError(err).Fatal("could not load credentials")
+	}
+
 	// Set up a connection to the server.
 	log.Infof("connecting to %s...", address)
-	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
+	conn, err := grpc.Dial(address, append(opts, grpc.WithBlock())...)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -30,7 +36,8 @@ func NewService(address string, updateFrequency time.Duration) (svc *Service) {
 	return
 }
 
-func (svc *Service) MakeItGrow(stop <-chan bool) (err error) {
+// Grow asks the strategy what to do on every tick and places the pairs it decides on until stopped
+func (svc *Service) Grow(stop <-chan bool, strategy Strategy) (err error) {
 	svc.startHealthcheckHandler()
 	ticker := time.NewTimer(1)
 	for {
@@ -45,7 +52,7 @@ func (svc *Service) MakeItGrow(stop <-chan bool) (err error) {
 		case <-ticker.C:
 			// WATER THE MONEYTREE
 			log.Infof("water the moneytree")
-			err = svc.startWatering()
+			err = svc.startWatering(strategy)
 			if err != nil {
 				log.WithError(err).Error("something happened while watering")
 			}
@@ -57,7 +64,7 @@ func (svc *Service) MakeItGrow(stop <-chan bool) (err error) {
 	}
 }
 
-func (svc *Service) startWatering() (err error) {
+func (svc *Service) startWatering(strategy Strategy) (err error) {
 	log.Infof("get all the open pairs")
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
@@ -67,52 +74,48 @@ func (svc *Service) startWatering() (err error) {
 		return
 	}
 
-	// Get the the direction with the least number of pairs
-	var upCount, downCount int
-	for _, p := range pairs.GetPairs() {
-		switch pair.Direction(p.Direction) {
-		case pair.Upward:
-			if p.BuyOrder.Status == "FILLED" {
-				upCount++
-			}
-		case pair.Downward:
-			if p.SellOrder.Status == "FILLED" {
-				downCount++
-			}
-		}
+	// Let the strategy decide
+	decision, err := strategy.Decide(&Inputs{
+		OpenPairs: pairs.GetPairs(),
+		ctx:       ctx,
+		moneytree: svc.moneytree,
+		candles:   map[proto.GetCandlesRequest_Duration][]*proto.Candle{},
+	})
+	if err != nil {
+		return
 	}
-	log.Infof("pair counts - total: %d, up: %d, down: %d", len(pairs.GetPairs()), upCount, downCount)
-	if upCount > downCount {
-		svc.placePair(pair.Downward)
-	} else if upCount < downCount {
-		svc.placePair(pair.Upward)
-	} else {
-		// We'll place the pair based on the trix indicators
-		currentPrice, movingAverage, oscillator, err := svc.getFiveMinuteTrixIndicators(ctx)
-		if err != nil {
-			log.WithError(err).Error("could not get trix indicators")
-		}
 
-		// If the current price is above the moving average, going up
-		if currentPrice.GreaterThan(movingAverage) {
-			// Make sure gaining momentum
-			if oscillator.GreaterThanOrEqual(decimal.Zero) {
-				// Place the upward pair
-				svc.placePair(pair.Upward)
-			}
-		}
+	// Let the portfolio's target band settle what the strategy can't
+	decision = svc.rebalance(ctx, decision)
+	if decision.Direction == "" {
+		log.Infof("not placing a pair: %s", decision.Reason)
+		return
+	}
 
-		// If the current price is below the moving average, going down
-		if currentPrice.LessThan(movingAverage) {
-			// Make sure losing momentum
-			if oscillator.LessThanOrEqual(decimal.Zero) {
-				// Place the downward pair
-				svc.placePair(pair.Downward)
-			}
-		}
+	log.Infof("placing %s pair: %s", decision.Direction, decision.Reason)
+	return svc.placePair(decision.Direction)
+}
+
+// rebalance picks the direction that pulls the portfolio back into its target band when the strategy is
+// inconclusive. Decisions the strategy did make are left alone; the server shrinks pairs that push the portfolio
+// further out of the band.
+func (svc *Service) rebalance(ctx context.Context, decision Decision) Decision {
+	if decision.Direction != "" {
+		return decision
 	}
 
-	return
+	allocation, err := svc.moneytree.GetAllocation(ctx, &proto.NullRequest{})
+	if err != nil {
+		log.WithError(err).Warn("could not get allocation; not rebalancing")
+		return decision
+	}
+
+	pull := pair.Direction(allocation.GetPull())
+	if pull == "" {
+		return decision
+	}
+	return Decision{pull, fmt.Sprintf("base currency is %s of the portfolio, outside %s to %s; pulling it back (%s)",
+		allocation.GetBaseRatio(), allocation.GetLower(), allocation.GetUpper(), decision.Reason)}
 }
 
 func (svc *Service) placePair(direction pair.Direction) (err error) {
@@ -1,7 +1,7 @@
 package miraclegrow
 
 import (
-	"context"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -12,52 +12,25 @@ import (
 	"github.com/sinisterminister/moneytree/pkg/trix"
 )
 
-func (svc *Service) TrixR5Kids(stop <-chan bool) (err error) {
-	svc.startHealthcheckHandler()
-	ticker := time.NewTimer(1)
-	for {
-		select {
-		case <-stop:
-			// Bail out immediately
-			return
-		default:
-			// Continue on
-		}
-		select {
-		case <-ticker.C:
-			// TURN TRIX BABY
-			log.Infof("pouring a bowl")
-			err = svc.turnTrix()
-			if err != nil {
-				log.WithError(err).Error("something happened while pouring")
-			}
-			ticker.Reset(svc.updateFrequency)
-		case <-stop:
-			// Try to bail out if necessary
-			return
-		}
-	}
+func init() {
+	RegisterStrategy("trix", func() Strategy { return &trixStrategy{newTrixTracker()} })
+}
+
+// trixStrategy follows the momentum when the 1m and 5m trix oscillators agree and balances the pairs otherwise
+type trixStrategy struct {
+	trix *trixTracker
 }
 
-func (svc *Service) turnTrix() (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	pairs, err := svc.moneytree.GetOpenPairs(ctx, &proto.NullRequest{})
+func (s *trixStrategy) Decide(in *Inputs) (Decision, error) {
+	currentPrice, movingAverage, fiveMinuteOscillator, err := s.trix.getTrixIndicators(in, proto.GetCandlesRequest_FIVE_MINUTES)
 	if err != nil {
-		log.WithError(err).Error("could not get open pairs")
-		return
-	}
-	currentPrice, movingAverage, fiveMinuteOscillator, err := svc.getFiveMinuteTrixIndicators(ctx)
-	if err != nil {
-		log.WithError(err).Error("could not get 5min trix indicators")
-		return
+		return Decision{}, fmt.Errorf("could not get 5min trix indicators: %w", err)
 	}
 
 	// Get one minute trix oscillator
-	_, _, oneMinuteOscillator, err := svc.getOneMinuteTrixIndicators(ctx)
+	_, _, oneMinuteOscillator, err := s.trix.getTrixIndicators(in, proto.GetCandlesRequest_ONE_MINUTE)
 	if err != nil {
-		log.WithError(err).Error("could not get 1min trix indicators")
-		return
+		return Decision{}, fmt.Errorf("could not get 1min trix indicators: %w", err)
 	}
 
 	// If the current price is above the moving average, going up
@@ -65,100 +38,94 @@ func (svc *Service) turnTrix() (err error) {
 		// Make sure gaining momentum in both 1m and 5m intervals
 		fiveMinuteOscillator.GreaterThan(decimal.Zero) && oneMinuteOscillator.GreaterThan(decimal.Zero) {
 
-		// Place the upward pair
-		svc.placePair(pair.Upward)
+		return Decision{pair.Upward, "price is above the 5m trix average and gaining momentum in 1m and 5m"}, nil
 
 	} else if currentPrice.LessThan(movingAverage) &&
 		// Make sure losing momentum
 		fiveMinuteOscillator.LessThan(decimal.Zero) && oneMinuteOscillator.LessThan(decimal.Zero) {
 
-		// Place the downward pair
-		svc.placePair(pair.Downward)
-	} else {
-		// Get the the direction with the least number of pairs
-		var upCount, downCount int
-		for _, p := range pairs.GetPairs() {
-			switch pair.Direction(p.Direction) {
-			case pair.Upward:
-				if p.BuyOrder.Status == "FILLED" {
-					upCount++
-				}
-			case pair.Downward:
-				if p.SellOrder.Status == "FILLED" {
-					downCount++
-				}
-			}
-		}
-		log.Infof("pair counts - total: %d, up: %d, down: %d", len(pairs.GetPairs()), upCount, downCount)
-		if upCount > downCount {
-			svc.placePair(pair.Downward)
-		} else {
-			svc.placePair(pair.Upward)
-		}
+		return Decision{pair.Downward, "price is below the 5m trix average and losing momentum in 1m and 5m"}, nil
 	}
-	return
-}
 
-func (svc *Service) getFiveMinuteTrixIndicators(ctx context.Context) (currentPrice decimal.Decimal, movingAvg decimal.Decimal, oscillator decimal.Decimal, err error) {
-	log.Infof("calculate trix moving average and oscillator")
-	candles, err := svc.moneytree.GetCandles(ctx, &proto.GetCandlesRequest{Duration: proto.GetCandlesRequest_FIVE_MINUTES, StartTime: time.Now().Add(-3 * time.Hour).Unix(), EndTime: time.Now().Unix()})
-	if err != nil {
-		log.WithError(err).Error("could not get candles")
-		return
+	// Get the the direction with the least number of pairs
+	upCount, downCount := countFilledPairs(in.OpenPairs)
+	log.Infof("pair counts - total: %d, up: %d, down: %d", len(in.OpenPairs), upCount, downCount)
+	if upCount > downCount {
+		return Decision{pair.Downward, "trix is inconclusive; balancing towards down pairs"}, nil
 	}
+	return Decision{pair.Upward, "trix is inconclusive; balancing towards up pairs"}, nil
+}
 
-	// Set the current price
-	currentPrice, err = decimal.NewFromString(candles.GetCandles()[0].Close)
-	if err != nil {
-		log.WithError(err).Error("could not parse current price")
-		return
-	}
+// trixTracker keeps a streaming trix indicator per candle duration so only the new candles are fetched each tick
+type trixTracker struct {
+	indicators map[proto.GetCandlesRequest_Duration]*trix.Trix
+	lastCandle map[proto.GetCandlesRequest_Duration]int64
+}
 
-	// Convert the candle values to floats so we can use them while reversing the sort
-	rawValues := []float64{}
-	for _, can := range candles.GetCandles() {
-		val, e := strconv.ParseFloat(can.Close, 64)
-		if e != nil {
-			return
-		}
-		rawValues = append([]float64{val}, rawValues...)
+func newTrixTracker() *trixTracker {
+	return &trixTracker{
+		indicators: map[proto.GetCandlesRequest_Duration]*trix.Trix{},
+		lastCandle: map[proto.GetCandlesRequest_Duration]int64{},
 	}
-
-	ma, osc := trix.GetTrixIndicator(rawValues, 5)
-	movingAvg = decimal.NewFromFloat(ma)
-	oscillator = decimal.NewFromFloat(osc)
-	log.Infof("5m trix cp: %s ma: %s osc: %s", currentPrice, movingAvg, oscillator)
-	return
 }
 
-func (svc *Service) getOneMinuteTrixIndicators(ctx context.Context) (currentPrice decimal.Decimal, movingAvg decimal.Decimal, oscillator decimal.Decimal, err error) {
+func (t *trixTracker) getTrixIndicators(in *Inputs, duration proto.GetCandlesRequest_Duration) (currentPrice decimal.Decimal, movingAvg decimal.Decimal, oscillator decimal.Decimal, err error) {
 	log.Infof("calculate trix moving average and oscillator")
-	candles, err := svc.moneytree.GetCandles(ctx, &proto.GetCandlesRequest{Duration: proto.GetCandlesRequest_ONE_MINUTE, StartTime: time.Now().Add(-3 * time.Hour).Unix(), EndTime: time.Now().Unix()})
+	indicator, ok := t.indicators[duration]
+	last := t.lastCandle[duration]
+
+	// Only fetch what's new once we've started
+	since := time.Now().Add(-3 * time.Hour)
+	if ok && last > 0 {
+		since = time.Unix(last, 0)
+	}
+	candles, err := in.CandlesSince(duration, since)
 	if err != nil {
-		log.WithError(err).Error("could not get candles")
 		return
 	}
 
 	// Set the current price
-	currentPrice, err = decimal.NewFromString(candles.GetCandles()[0].Close)
+	currentPrice, err = in.Price()
 	if err != nil {
-		log.WithError(err).Error("could not parse current price")
+		err = fmt.Errorf("could not parse current price: %w", err)
 		return
 	}
 
-	// Convert the candle values to floats so we can use them while reversing the sort
-	rawValues := []float64{}
-	for _, can := range candles.GetCandles() {
-		val, e := strconv.ParseFloat(can.Close, 64)
+	// Start over if there's a gap between what we've seen and the new candles
+	if !ok || candles[len(candles)-1].Ts > last {
+		if ok {
+			log.Warnf("%s candles have a gap since %s; warming up trix again", duration, time.Unix(last, 0))
+			candles, err = in.Candles(duration)
+			if err != nil {
+				return
+			}
+		}
+		indicator = trix.New(5)
+		last = 0
+		t.indicators[duration] = indicator
+	}
+
+	// Add the closed candles we haven't seen yet, oldest first. The newest candle is still forming so it's skipped.
+	for i := len(candles) - 1; i > 0; i-- {
+		if candles[i].Ts <= last {
+			continue
+		}
+		val, e := strconv.ParseFloat(candles[i].Close, 64)
 		if e != nil {
+			err = fmt.Errorf("could not parse candle close: %w", e)
 			return
 		}
-		rawValues = append([]float64{val}, rawValues...)
+		indicator.Add(val)
+		last = candles[i].Ts
 	}
+	t.lastCandle[duration] = last
 
-	ma, osc := trix.GetTrixIndicator(rawValues, 5)
+	ma, osc, err := indicator.Value()
+	if err != nil {
+		return
+	}
 	movingAvg = decimal.NewFromFloat(ma)
 	oscillator = decimal.NewFromFloat(osc)
-	log.Infof("1m trix cp: %s ma: %s osc: %s", currentPrice, movingAvg, oscillator)
+	log.Infof("%s trix cp: %s ma: %s osc: %s", duration, currentPrice, movingAvg, oscillator)
 	return
 }
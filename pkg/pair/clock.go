@@ -0,0 +1,68 @@
+package pair
+
+import (
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/spf13/viper"
+)
+
+// Clock tells the pairs what time it is and how to wait. It lets tests run the pair lifecycles without waiting on the
+// wall clock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SetClock replaces the clock used by the service and its pairs
+func (svc *Service) SetClock(clock Clock) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	svc.clock = clock
+}
+
+// Clock returns the clock used by the service and its pairs
+func (svc *Service) Clock() Clock {
+	svc.mutex.RLock()
+	defer svc.mutex.RUnlock()
+
+	if svc.clock == nil {
+		return realClock{}
+	}
+	return svc.clock
+}
+
+// waitForConsistency gives the exchange pair.consistencyWait to settle after an order is done
+func (svc *Service) waitForConsistency() {
+	<-svc.Clock().After(viper.GetDuration("pair.consistencyWait"))
+}
+
+// refreshBackoff returns how long to wait before the given refresh retry, starting at 1. The wait starts at
+// pair.refreshBackoff and grows along pair.refreshBackoffCurve up to pair.maxRefreshBackoff.
+func refreshBackoff(retry int) time.Duration {
+	backoff := viper.GetDuration("pair.refreshBackoff")
+	switch curve := viper.GetString("pair.refreshBackoffCurve"); curve {
+	case "constant":
+	case "exponential":
+		for i := 1; i < retry; i++ {
+			backoff *= 2
+		}
+	default:
+		if curve != "linear" {
+			log.Warnf("unknown refresh backoff curve '%s'; using linear", curve)
+		}
+		backoff *= time.Duration(retry)
+	}
+
+	if max := viper.GetDuration("pair.maxRefreshBackoff"); max > 0 && backoff > max {
+		backoff = max
+	}
+	return backoff
+}
@@ -0,0 +1,41 @@
+package pair
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestRefreshBackoff(t *testing.T) {
+	defer viper.Set("pair.refreshBackoff", viper.GetDuration("pair.refreshBackoff"))
+	defer viper.Set("pair.refreshBackoffCurve", viper.GetString("pair.refreshBackoffCurve"))
+	defer viper.Set("pair.maxRefreshBackoff", viper.GetDuration("pair.maxRefreshBackoff"))
+
+	tests := []struct {
+		curve    string
+		max      time.Duration
+		expected []time.Duration
+	}{
+		{"linear", 0, []time.Duration{1, 2, 3, 4, 5}},
+		{"linear", 3 * time.Second, []time.Duration{1, 2, 3, 3, 3}},
+		{"constant", 0, []time.Duration{1, 1, 1, 1, 1}},
+		{"exponential", 0, []time.Duration{1, 2, 4, 8, 16}},
+		{"exponential", 5 * time.Second, []time.Duration{1, 2, 4, 5, 5}},
+		{"unknown", 0, []time.Duration{1, 2, 3, 4, 5}},
+	}
+
+	viper.Set("pair.refreshBackoff", time.Second)
+	for _, tt := range tests {
+		t.Run(tt.curve, func(t *testing.T) {
+			viper.Set("pair.refreshBackoffCurve", tt.curve)
+			viper.Set("pair.maxRefreshBackoff", tt.max)
+			for i, expected := range tt.expected {
+				backoff := refreshBackoff(i + 1)
+				if backoff != expected*time.Second {
+					t.Errorf("retry %d: expected %s, got %s", i+1, expected*time.Second, backoff)
+				}
+			}
+		})
+	}
+}
@@ -40,3 +40,37 @@ func (o *OrderPairDAO) Scan(value interface{}) error {
 
 	return json.Unmarshal(b, &o)
 }
+
+// MultiLegPairDAO is what's saved for a multi-leg pair
+type MultiLegPairDAO struct {
+	Uuid          string    `json:"uuid"`
+	CreatedAt     time.Time `json:"createdAt"`
+	EndedAt       time.Time `json:"endedAt"`
+	Done          bool      `json:"done"`
+	Status        Status    `json:"status"`
+	StatusDetails string    `json:"statusDetails"`
+
+	Legs []LegDAO `json:"legs"`
+}
+
+// LegDAO is the request and order of a leg of a multi-leg pair along with the order that unwound it
+type LegDAO struct {
+	Request types.OrderRequestDTO `json:"request"`
+	Order   types.OrderDTO        `json:"order"`
+
+	ReversalRequest types.OrderRequestDTO `json:"reversalRequest"`
+	ReversalOrder   types.OrderDTO        `json:"reversalOrder"`
+}
+
+func (o MultiLegPairDAO) Value() (driver.Value, error) {
+	return json.Marshal(o)
+}
+
+func (o *MultiLegPairDAO) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &o)
+}
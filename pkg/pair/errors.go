@@ -1,6 +1,10 @@
 package pair
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
 
 type LosingPropositionError struct {
 	orderPair *OrderPair
@@ -25,3 +29,43 @@ type SkipSecondOrderError struct {
 func (err *SkipSecondOrderError) Error() string {
 	return fmt.Sprintf("first order was not filled, skipping second")
 }
+
+type ExposureLimitError struct {
+	limit string
+	value decimal.Decimal
+	max   decimal.Decimal
+}
+
+func (err *ExposureLimitError) Error() string {
+	return fmt.Sprintf("order would exceed the %s limit (%s > %s)", err.limit, err.value, err.max)
+}
+
+type NoRoomError struct {
+	openPairs int
+}
+
+func (err *NoRoomError) Error() string {
+	return fmt.Sprintf("no room for a new pair with %d pairs open", err.openPairs)
+}
+
+type DegenerateSizingError struct {
+	denominator decimal.Decimal
+}
+
+func (err *DegenerateSizingError) Error() string {
+	return fmt.Sprintf("cannot size the second order; the denominator %s is not positive", err.denominator)
+}
+
+type MarketLimitError struct {
+	field string
+	value decimal.Decimal
+	limit decimal.Decimal
+	max   bool
+}
+
+func (err *MarketLimitError) Error() string {
+	if err.max {
+		return fmt.Sprintf("%s of %s is above the market maximum of %s", err.field, err.value, err.limit)
+	}
+	return fmt.Sprintf("%s of %s is below the market minimum of %s", err.field, err.value, err.limit)
+}
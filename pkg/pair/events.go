@@ -0,0 +1,60 @@
+package pair
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type EventKind string
+
+var (
+	PairSucceeded          EventKind = "PAIR_SUCCESS"
+	PairReversed           EventKind = "PAIR_REVERSED"
+	PairBroken             EventKind = "PAIR_BROKEN"
+	LossMitigatorTriggered EventKind = "LOSS_MITIGATOR"
+)
+
+// Event describes something notable that happened to a pair
+type Event struct {
+	Kind    EventKind
+	Pair    *OrderPair
+	Details string
+	Time    time.Time
+}
+
+// EventListener is told about the events of every pair. Listeners are called on their own goroutine.
+type EventListener interface {
+	PairEvent(event Event)
+}
+
+// AddEventListener registers the listener for the events of every pair
+func (svc *Service) AddEventListener(listener EventListener) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	svc.listeners = append(svc.listeners, listener)
+}
+
+func (svc *Service) emit(kind EventKind, pair *OrderPair, details string) {
+	event := Event{kind, pair, details, svc.Clock().Now()}
+
+	svc.mutex.RLock()
+	defer svc.mutex.RUnlock()
+
+	for _, l := range svc.listeners {
+		go l.PairEvent(event)
+	}
+}
+
+// statusEvents are the statuses that emit an event when a pair reaches them
+var statusEvents = map[Status]EventKind{
+	Success:  PairSucceeded,
+	Reversed: PairReversed,
+	Broken:   PairBroken,
+}
+
+func (o *OrderPair) emitLossMitigator(price decimal.Decimal, target decimal.Decimal) {
+	o.svc.emit(LossMitigatorTriggered, o, fmt.Sprintf("price %s crossed the bail target %s; canceling the pair", price, target))
+}
@@ -0,0 +1,193 @@
+package pair
+
+import (
+	"fmt"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/spf13/viper"
+)
+
+// CheckExposure makes sure executing the pair won't push the open pairs past the configured exposure limits.
+// Returns an ExposureLimitError describing the first limit that would be exceeded. Pairs are checked again as their
+// first order is placed.
+func (svc *Service) CheckExposure(newPair *OrderPair) error {
+	return svc.checkExposure(newPair.UUID(), newPair.Direction(), newPair.FirstRequest())
+}
+
+// AttemptOrder places an order that isn't part of a pair once it's been checked against the exposure limits
+func (svc *Service) AttemptOrder(req types.OrderRequest) (types.Order, error) {
+	svc.exposureMutex.Lock()
+	defer svc.exposureMutex.Unlock()
+
+	err := svc.checkExposure(uuid.Nil, sideDirection(req.Side()), req)
+	if err != nil {
+		return nil, err
+	}
+	return req.Market().AttemptOrder(req)
+}
+
+// checkExposure checks a request that opens a new position in the direction against the limits, leaving out the pair
+// with the id. The notional and net base limits are in terms of the service's market so they only apply to requests
+// on it.
+func (svc *Service) checkExposure(id uuid.UUID, direction Direction, req types.OrderRequest) error {
+	notional := requestNotional(req)
+	if req.Market().Name() == svc.market.Name() {
+		// Check the size of the request itself
+		maxPairNotional := decimal.NewFromFloat(viper.GetFloat64("exposure.maxPairNotional"))
+		if maxPairNotional.IsPositive() && notional.GreaterThan(maxPairNotional) {
+			return &ExposureLimitError{"pair notional", notional, maxPairNotional}
+		}
+
+		// The rest of the limits are checked against the open pairs
+		maxDirectionNotional := decimal.NewFromFloat(viper.GetFloat64("exposure.maxDirectionNotional"))
+		maxNetBase := decimal.NewFromFloat(viper.GetFloat64("exposure.maxNetBase"))
+		if maxDirectionNotional.IsPositive() || maxNetBase.IsPositive() {
+			openPairs, err := svc.LoadOpenPairs()
+			if err != nil {
+				return fmt.Errorf("could not load open pairs to check exposure: %w", err)
+			}
+
+			// Tally up the open pairs
+			var netBase, directionNotional decimal.Decimal
+			for _, p := range openPairs {
+				if p.UUID() == id {
+					continue
+				}
+				netBase = netBase.Add(p.baseExposure())
+				if p.Direction() == direction {
+					directionNotional = directionNotional.Add(p.notional())
+				}
+			}
+
+			// Check the value tied up in the direction
+			directionNotional = directionNotional.Add(notional)
+			if maxDirectionNotional.IsPositive() && directionNotional.GreaterThan(maxDirectionNotional) {
+				return &ExposureLimitError{fmt.Sprintf("%s notional", direction), directionNotional, maxDirectionNotional}
+			}
+
+			// Check the net base position. Requests that bring the position back towards zero are always allowed.
+			newNetBase := netBase.Add(req.Quantity())
+			if direction == Downward {
+				newNetBase = netBase.Sub(req.Quantity())
+			}
+			if maxNetBase.IsPositive() && newNetBase.Abs().GreaterThan(maxNetBase) && newNetBase.Abs().GreaterThan(netBase.Abs()) {
+				return &ExposureLimitError{"net base exposure", newNetBase.Abs(), maxNetBase}
+			}
+		}
+	}
+
+	// Make sure the request leaves the reserve untouched
+	var currency types.Currency
+	var spend decimal.Decimal
+	if req.Side() == order.Buy {
+		currency = req.Market().QuoteCurrency()
+		spend = notional
+	} else {
+		currency = req.Market().BaseCurrency()
+		spend = req.Quantity()
+	}
+	if raw, ok := viper.GetStringMapString("exposure.minReserve")[strings.ToLower(currency.Symbol())]; ok {
+		reserve, err := decimal.NewFromString(raw)
+		if err != nil {
+			return fmt.Errorf("could not parse %s reserve: %w", currency.Symbol(), err)
+		}
+		available := currency.Wallet().Available()
+		if available.Sub(spend).LessThan(reserve) {
+			return &ExposureLimitError{fmt.Sprintf("%s reserve", currency.Symbol()), spend, available.Sub(reserve)}
+		}
+	}
+
+	return nil
+}
+
+// requestNotional returns the value of the request in its quote currency
+func requestNotional(req types.OrderRequest) decimal.Decimal {
+	if req.Funds().IsPositive() {
+		return req.Funds()
+	}
+	return req.Quantity().Mul(req.Price())
+}
+
+// sideDirection returns the direction a request on the side takes the position in
+func sideDirection(side types.OrderSide) Direction {
+	if side == order.Buy {
+		return Upward
+	}
+	return Downward
+}
+
+// notional returns the value of the first request in the quote currency
+func (o *OrderPair) notional() decimal.Decimal {
+	return o.FirstRequest().Quantity().Mul(o.FirstRequest().Price())
+}
+
+// baseExposure returns how much base currency the pair is holding (positive) or owes (negative) until its second
+// order fills. Unfilled first orders count at their full quantity.
+func (o *OrderPair) baseExposure() decimal.Decimal {
+	var first, second decimal.Decimal
+
+	if o.FirstOrder() != nil && o.FirstOrder().IsDone() {
+		first = o.FirstOrder().Filled()
+	} else {
+		first = o.FirstRequest().Quantity()
+	}
+	if o.SecondOrder() != nil {
+		second = o.SecondOrder().Filled()
+	}
+
+	if o.Direction() == Upward {
+		return first.Sub(second)
+	}
+	return second.Sub(first)
+}
+
+// HeldInPairs returns how much of each market currency is sitting in the unfinished orders of the open pairs. Orders
+// placed by funds hold the funds they haven't spent yet; sells placed by funds are valued in base at the ticker price.
+func (svc *Service) HeldInPairs() (base decimal.Decimal, quote decimal.Decimal, err error) {
+	openPairs, err := svc.LoadOpenPairs()
+	if err != nil {
+		return base, quote, fmt.Errorf("could not load open pairs to tally holds: %w", err)
+	}
+
+	var price decimal.Decimal
+	for _, p := range openPairs {
+		for _, o := range []types.Order{p.FirstOrder(), p.SecondOrder(), p.ReversalOrder()} {
+			if o == nil || o.IsDone() {
+				continue
+			}
+
+			// Quantity based orders
+			if !o.Request().Funds().IsPositive() {
+				remaining := decimal.Max(o.Request().Quantity().Sub(o.Filled()), decimal.Zero)
+				if o.Request().Side() == order.Buy {
+					quote = quote.Add(remaining.Mul(o.Request().Price()))
+				} else {
+					base = base.Add(remaining)
+				}
+				continue
+			}
+
+			// Funds based orders
+			remaining := decimal.Max(o.Request().Funds().Sub(o.Paid()), decimal.Zero)
+			if o.Request().Side() == order.Buy {
+				quote = quote.Add(remaining)
+				continue
+			}
+			if price.IsZero() {
+				ticker, err := svc.market.Ticker()
+				if err != nil {
+					return base, quote, fmt.Errorf("could not get ticker to value sells by funds: %w", err)
+				}
+				price = ticker.Price()
+			}
+			if price.IsPositive() {
+				base = base.Add(remaining.Div(price))
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,215 @@
+package pair
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/spf13/viper"
+)
+
+// setExposureLimit changes an exposure limit for the rest of the test
+func setExposureLimit(t *testing.T, key string, value interface{}) {
+	previous := viper.Get("exposure." + key)
+	viper.Set("exposure."+key, value)
+	t.Cleanup(func() { viper.Set("exposure."+key, previous) })
+}
+
+// downwardPair builds a pair that sells 100 at 200 and buys 101 back at 100
+func (h *lifecycleHarness) downwardPair() *OrderPair {
+	market := h.trader.Market()
+	first := order.NewRequest(market, order.Limit, order.Sell, decimal.NewFromFloat(100), decimal.NewFromFloat(200), decimal.Zero, false)
+	second := order.NewRequest(market, order.Limit, order.Buy, decimal.NewFromFloat(101), decimal.NewFromFloat(100), decimal.Zero, false)
+
+	pair, err := h.svc.New(first, second)
+	if err != nil {
+		h.t.Fatalf("could not create pair: %s", err)
+	}
+	return pair
+}
+
+// expectRejected executes the pair and makes sure the limit turned it down before anything was placed
+func (h *lifecycleHarness) expectRejected(pair *OrderPair, limit string) {
+	h.t.Helper()
+	placed := len(h.trader.Orders())
+
+	err := pair.Execute()
+	var exposureErr *ExposureLimitError
+	if !errors.As(err, &exposureErr) {
+		h.t.Fatalf("expected the pair to be turned down by the %s limit, got %v", limit, err)
+	}
+	if exposureErr.limit != limit {
+		h.t.Errorf("expected the pair to be turned down by the %s limit, got %s", limit, err)
+	}
+	if len(h.trader.Orders()) != placed {
+		h.t.Errorf("expected nothing to be placed, got %d new orders", len(h.trader.Orders())-placed)
+	}
+	if dao := h.finish(pair); dao.Status != Failed {
+		h.t.Errorf("expected the pair to be %s, got %s", Failed, dao.Status)
+	}
+}
+
+func TestExposure_PairNotional(t *testing.T) {
+	setExposureLimit(t, "maxPairNotional", 15000)
+	h := newLifecycleHarness(t)
+
+	h.execute(h.upwardPair())
+	h.expectRejected(h.downwardPair(), "pair notional")
+}
+
+func TestExposure_DirectionNotional(t *testing.T) {
+	setExposureLimit(t, "maxDirectionNotional", 25000)
+	h := newLifecycleHarness(t)
+
+	// Two upward pairs make 20000 and a third would make 30000
+	h.execute(h.upwardPair())
+	h.execute(h.upwardPair())
+	h.expectRejected(h.upwardPair(), "UP notional")
+
+	// The other direction has its own limit
+	h.execute(h.downwardPair())
+}
+
+func TestExposure_NetBase(t *testing.T) {
+	setExposureLimit(t, "maxNetBase", 150)
+	h := newLifecycleHarness(t)
+
+	h.execute(h.upwardPair())
+	h.expectRejected(h.upwardPair(), "net base exposure")
+
+	// Pairs that bring the position back towards zero are always allowed
+	h.execute(h.downwardPair())
+	h.execute(h.upwardPair())
+}
+
+func TestExposure_NetBaseCountsFills(t *testing.T) {
+	setExposureLimit(t, "maxNetBase", 150)
+	h := newLifecycleHarness(t)
+
+	// Once the second order has sold 60 of the 100 bought the pair only holds 40
+	p := h.upwardPair()
+	h.execute(p).Fill(decimal.NewFromFloat(100))
+	second := h.placed()
+	second.Fill(decimal.NewFromFloat(60))
+
+	h.execute(h.upwardPair())
+	second.Fill(decimal.NewFromFloat(39))
+	h.finish(p)
+}
+
+func TestExposure_MinReserve(t *testing.T) {
+	setExposureLimit(t, "minReserve", map[string]string{"usd": "995000", "btc": "950"})
+	h := newLifecycleHarness(t)
+
+	// Buying 10000 would leave 990000 USD and selling 100 would leave 900 BTC
+	h.expectRejected(h.upwardPair(), "USD reserve")
+	h.expectRejected(h.downwardPair(), "BTC reserve")
+
+	setExposureLimit(t, "minReserve", map[string]string{"usd": "990000", "btc": "900"})
+	h.execute(h.upwardPair())
+	h.execute(h.downwardPair())
+}
+
+func TestExposure_ConcurrentPairs(t *testing.T) {
+	setExposureLimit(t, "maxDirectionNotional", 15000)
+	h := newLifecycleHarness(t)
+
+	// Only one of the pairs fits so only one can be placed no matter how they race
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		p := h.upwardPair()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- p.Execute()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	placed := 0
+	for err := range errs {
+		if err == nil {
+			placed++
+		}
+	}
+	if placed != 1 || len(h.trader.Orders()) != 1 {
+		t.Errorf("expected one pair to be placed, got %d with %d orders", placed, len(h.trader.Orders()))
+	}
+}
+
+func TestExposure_StandaloneOrders(t *testing.T) {
+	setExposureLimit(t, "maxPairNotional", 5000)
+	h := newLifecycleHarness(t)
+
+	_, err := h.svc.AttemptOrder(limitRequest(h.trader.Market(), order.Buy, 100, 100))
+	if err == nil || !strings.Contains(err.Error(), "pair notional") {
+		t.Errorf("expected the order to be turned down by the pair notional limit, got %v", err)
+	}
+	ord, err := h.svc.AttemptOrder(limitRequest(h.trader.Market(), order.Buy, 10, 100))
+	if err != nil || ord == nil {
+		t.Fatalf("expected the order to be placed, got %v", err)
+	}
+	if len(h.trader.Orders()) != 1 {
+		t.Errorf("expected one order to be placed, got %d", len(h.trader.Orders()))
+	}
+}
+
+func TestExposure_MultiLegFirstLeg(t *testing.T) {
+	setExposureLimit(t, "minReserve", map[string]string{"usd": "999950"})
+	h := newLoopHarness(t)
+
+	// The first leg spends 100 USD of the 1000000
+	p := h.newLoop(11)
+	err := p.Execute()
+	var exposureErr *ExposureLimitError
+	if !errors.As(err, &exposureErr) {
+		t.Fatalf("expected the first leg to be turned down by the reserve, got %v", err)
+	}
+	if dao := h.finishLoop(p); dao.Status != Failed || len(h.trader.Orders()) != 0 {
+		t.Errorf("expected the pair to be %s without any orders, got %s with %d orders", Failed, dao.Status, len(h.trader.Orders()))
+	}
+}
+
+func TestHeldInPairs(t *testing.T) {
+	h := newLifecycleHarness(t)
+	h.trader.Market().SetPrice(decimal.NewFromFloat(100))
+	market := h.trader.Market()
+
+	// 60 of the 100 are still to be bought at 100
+	limited := h.upwardPair()
+	first := h.execute(limited)
+	first.Fill(decimal.NewFromFloat(40))
+
+	// Orders placed by funds hold what they haven't spent, with sells valued at the ticker
+	for _, side := range []types.OrderSide{order.Buy, order.Sell} {
+		req := order.NewRequest(market, order.Market, side, decimal.Zero, decimal.Zero, decimal.NewFromFloat(5000), false)
+		ord, err := market.AttemptOrder(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.placed()
+		err = h.svc.Save(OrderPairDAO{Uuid: uuid.NewV4().String(), Status: Open, FirstRequest: req.ToDTO(), FirstOrder: ord.ToDTO()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base, quote, err := h.svc.HeldInPairs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quote.Equal(decimal.NewFromFloat(11000)) || !base.Equal(decimal.NewFromFloat(50)) {
+		t.Errorf("expected 11000 quote and 50 base to be held, got %s and %s", quote, base)
+	}
+
+	first.Fill(decimal.NewFromFloat(60))
+	h.placed().Fill(decimal.NewFromFloat(99))
+	h.finish(limited)
+}
@@ -0,0 +1,46 @@
+package fake_types
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock never waits. Every wait moves the clock forward and returns straight away so the time spent waiting can be
+// checked without spending it.
+type Clock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	waited time.Duration
+}
+
+// NewClock starts a clock at the time
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+	c.waited += d
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// Waited returns how long everything has waited on the clock in total
+func (c *Clock) Waited() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.waited
+}
@@ -0,0 +1,199 @@
+package fake_types
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/ticker"
+)
+
+// Market is a fake types.Market whose ticker is set by the test
+type Market struct {
+	trader *Trader
+	dto    types.MarketDTO
+
+	mutex       sync.Mutex
+	ticker      types.TickerDTO
+	subscribers map[chan types.Ticker]<-chan bool
+}
+
+func newMarket(trader *Trader, dto types.MarketDTO) *Market {
+	return &Market{trader: trader, dto: dto, subscribers: map[chan types.Ticker]<-chan bool{}}
+}
+
+// SetPrice updates the ticker and sends it to the ticker streams
+func (m *Market) SetPrice(price decimal.Decimal) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.ticker = types.TickerDTO{Price: price, Bid: price, Ask: price, Timestamp: time.Now()}
+	for sub, stop := range m.subscribers {
+		select {
+		case sub <- ticker.New(m.ticker):
+		case <-stop:
+		}
+	}
+}
+
+// Streams returns how many ticker streams are open
+func (m *Market) Streams() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return len(m.subscribers)
+}
+
+func (m *Market) AttemptOrder(req types.OrderRequest) (types.Order, error) {
+	return m.trader.attemptOrder(m, req)
+}
+
+func (m *Market) AverageTradeVolume() (decimal.Decimal, error) { return decimal.Zero, nil }
+
+func (m *Market) BaseCurrency() types.Currency { return &Currency{m.trader, m.dto.BaseCurrency} }
+
+func (m *Market) Candles(interval types.CandleInterval, start time.Time, end time.Time) ([]types.Candle, error) {
+	return nil, fmt.Errorf("the fake market has no candles")
+}
+
+func (m *Market) MaxFunds() decimal.Decimal { return m.dto.MaxFunds }
+
+func (m *Market) MaxPrice() decimal.Decimal { return m.dto.MaxPrice }
+
+func (m *Market) MaxQuantity() decimal.Decimal { return m.dto.MaxQuantity }
+
+func (m *Market) MinFunds() decimal.Decimal { return m.dto.MinFunds }
+
+func (m *Market) MinPrice() decimal.Decimal { return m.dto.MinPrice }
+
+func (m *Market) MinQuantity() decimal.Decimal { return m.dto.MinQuantity }
+
+func (m *Market) Name() string { return m.dto.Name }
+
+func (m *Market) PriceIncrement() decimal.Decimal { return m.dto.PriceIncrement }
+
+func (m *Market) QuantityStepSize() decimal.Decimal { return m.dto.QuantityStepSize }
+
+func (m *Market) QuoteCurrency() types.Currency { return &Currency{m.trader, m.dto.QuoteCurrency} }
+
+func (m *Market) Ticker() (types.Ticker, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return ticker.New(m.ticker), nil
+}
+
+// TickerStream sends every price set on the market until stopped. The stream is unbuffered so SetPrice returns once
+// every open stream has received the price.
+func (m *Market) TickerStream(stop <-chan bool) <-chan types.Ticker {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sub := make(chan types.Ticker)
+	m.subscribers[sub] = stop
+	go func() {
+		<-stop
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		delete(m.subscribers, sub)
+	}()
+	return sub
+}
+
+func (m *Market) ToDTO() types.MarketDTO { return m.dto }
+
+// Currency is a fake types.Currency backed by the trader's wallets
+type Currency struct {
+	trader *Trader
+	dto    types.CurrencyDTO
+}
+
+func (c *Currency) Increment() decimal.Decimal { return c.dto.Increment }
+
+func (c *Currency) Name() string { return c.dto.Name }
+
+func (c *Currency) Precision() int { return c.dto.Precision }
+
+func (c *Currency) Symbol() string { return c.dto.Symbol }
+
+func (c *Currency) ToDTO() types.CurrencyDTO { return c.dto }
+
+func (c *Currency) Wallet() types.Wallet { return c.trader.wallet(c.dto.Symbol) }
+
+// Wallet is a fake types.Wallet
+type Wallet struct {
+	trader *Trader
+
+	mutex sync.Mutex
+	dto   types.WalletDTO
+}
+
+func (w *Wallet) Available() decimal.Decimal {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.dto.Free.Sub(w.dto.Reserved)
+}
+
+func (w *Wallet) Currency() types.Currency { return &Currency{w.trader, w.dto.Currency} }
+
+func (w *Wallet) Free() decimal.Decimal {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.dto.Free
+}
+
+func (w *Wallet) ID() string { return w.dto.ID }
+
+func (w *Wallet) Locked() decimal.Decimal {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.dto.Locked
+}
+
+func (w *Wallet) Release(amt decimal.Decimal) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if amt.GreaterThan(w.dto.Reserved) {
+		return fmt.Errorf("cannot release %s; only %s is reserved", amt, w.dto.Reserved)
+	}
+	w.dto.Reserved = w.dto.Reserved.Sub(amt)
+	return nil
+}
+
+func (w *Wallet) Reserve(amt decimal.Decimal) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if amt.GreaterThan(w.dto.Free.Sub(w.dto.Reserved)) {
+		return fmt.Errorf("cannot reserve %s; only %s is available", amt, w.dto.Free.Sub(w.dto.Reserved))
+	}
+	w.dto.Reserved = w.dto.Reserved.Add(amt)
+	return nil
+}
+
+func (w *Wallet) Reserved() decimal.Decimal {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.dto.Reserved
+}
+
+func (w *Wallet) ToDTO() types.WalletDTO {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.dto
+}
+
+func (w *Wallet) Total() decimal.Decimal {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.dto.Free.Add(w.dto.Locked)
+}
@@ -0,0 +1,215 @@
+package fake_types
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+)
+
+// RefreshStep is what the order looks like after a refresh. An empty status leaves the order as it is. The refresh
+// doesn't return until Wait is closed, if it's set.
+type RefreshStep struct {
+	Status types.OrderStatus
+	Filled decimal.Decimal
+	Err    error
+	Wait   <-chan bool
+}
+
+// Order is a fake types.Order that changes only when the test says so
+type Order struct {
+	trader *Trader
+	market *Market
+
+	mutex   sync.RWMutex
+	dto     types.OrderDTO
+	done    chan bool
+	refresh []RefreshStep
+}
+
+func newOrder(trader *Trader, market *Market, dto types.OrderDTO) *Order {
+	if dto.CreationTime.IsZero() {
+		dto.CreationTime = time.Now()
+	}
+	o := &Order{trader: trader, market: market, dto: dto, done: make(chan bool)}
+	o.closeIfDone()
+	return o
+}
+
+// Fill fills the quantity of the order at the requested price. The order is filled once the requested quantity has
+// been filled or, for market orders, on the first fill.
+func (o *Order) Fill(qty decimal.Decimal) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.dto.Filled = o.dto.Filled.Add(qty)
+	o.dto.Paid = o.dto.Paid.Add(qty.Mul(o.dto.Request.Price))
+	o.dto.Status = order.Partial
+	if o.dto.Request.Quantity.IsZero() || o.dto.Filled.GreaterThanOrEqual(o.dto.Request.Quantity) {
+		o.dto.Status = order.Filled
+	}
+	o.closeIfDone()
+}
+
+// SetFees sets the fees charged for the order
+func (o *Order) SetFees(side types.OrderSide, fees decimal.Decimal) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.dto.FeesSide = side
+	o.dto.Fees = fees
+}
+
+// Cancel cancels whatever is left of the order
+func (o *Order) Cancel() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.dto.Status == order.Filled {
+		return
+	}
+	o.dto.Status = order.Canceled
+	o.closeIfDone()
+}
+
+// Close marks the order as done with the status, even if the status isn't a final one. It mimics the exchange
+// reporting an order as done before the final status has caught up.
+func (o *Order) Close(status types.OrderStatus) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.dto.Status = status
+	select {
+	case <-o.done:
+	default:
+		close(o.done)
+	}
+}
+
+// OnRefresh queues what the order looks like after each of the next refreshes
+func (o *Order) OnRefresh(steps ...RefreshStep) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.refresh = append(o.refresh, steps...)
+}
+
+// closeIfDone closes the done channel when the order reached a final status. The mutex must be held.
+func (o *Order) closeIfDone() {
+	switch o.dto.Status {
+	case order.Filled, order.Canceled, order.Expired, order.Rejected:
+		select {
+		case <-o.done:
+		default:
+			close(o.done)
+		}
+	}
+}
+
+func (o *Order) CreationTime() time.Time {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	return o.dto.CreationTime
+}
+
+func (o *Order) Done() <-chan bool { return o.done }
+
+func (o *Order) Fees() (types.OrderSide, decimal.Decimal) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	return o.dto.FeesSide, o.dto.Fees
+}
+
+func (o *Order) Filled() decimal.Decimal {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	return o.dto.Filled
+}
+
+func (o *Order) ID() string {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	return o.dto.ID
+}
+
+func (o *Order) IsDone() bool {
+	select {
+	case <-o.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (o *Order) Market() types.Market { return o.market }
+
+func (o *Order) Paid() decimal.Decimal {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	return o.dto.Paid
+}
+
+func (o *Order) Refresh() error {
+	o.mutex.Lock()
+	if len(o.refresh) == 0 {
+		o.mutex.Unlock()
+		return nil
+	}
+	step := o.refresh[0]
+	o.refresh = o.refresh[1:]
+	o.mutex.Unlock()
+
+	if step.Wait != nil {
+		<-step.Wait
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if step.Err != nil {
+		return step.Err
+	}
+	if step.Status != "" {
+		o.dto.Status = step.Status
+		o.dto.Filled = step.Filled
+		o.dto.Paid = step.Filled.Mul(o.dto.Request.Price)
+		o.closeIfDone()
+	}
+	return nil
+}
+
+func (o *Order) Request() types.OrderRequest {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	return order.NewRequestFromDTO(o.market, o.dto.Request)
+}
+
+func (o *Order) Status() types.OrderStatus {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	return o.dto.Status
+}
+
+// StatusStream sends the current status and closes
+func (o *Order) StatusStream(stop <-chan bool) <-chan types.OrderStatus {
+	stream := make(chan types.OrderStatus, 1)
+	stream <- o.Status()
+	close(stream)
+	return stream
+}
+
+func (o *Order) ToDTO() types.OrderDTO {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	return o.dto
+}
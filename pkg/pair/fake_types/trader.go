@@ -0,0 +1,314 @@
+// Package fake_types is an in-memory exchange for testing against the currencytrader types. Orders only move when the
+// test fills, cancels or closes them, so every step of a trade can be played out deterministically.
+package fake_types
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+)
+
+var (
+	_ types.Trader = &Trader{}
+	_ types.Market = &Market{}
+	_ types.Order  = &Order{}
+	_ types.Wallet = &Wallet{}
+)
+
+// Trader is a fake types.Trader. It starts with a single market and more can be added for orders that span markets.
+type Trader struct {
+	mutex      sync.Mutex
+	market     *Market
+	markets    []*Market
+	fees       types.FeesDTO
+	feesErr    error
+	wallets    map[string]*Wallet
+	orders     []*Order
+	placed     chan *Order
+	orderErrs  []error
+	cancelErrs []error
+	clock      *Clock
+}
+
+// NewTrader builds a trader for the market with empty wallets and the given fee rates
+func NewTrader(market types.MarketDTO, fees types.FeesDTO) *Trader {
+	t := &Trader{
+		fees:    fees,
+		wallets: map[string]*Wallet{},
+		placed:  make(chan *Order, 100),
+	}
+	t.market = t.AddMarket(market)
+	return t
+}
+
+// Market returns the trader's first market
+func (t *Trader) Market() *Market { return t.market }
+
+// AddMarket adds another market to the trader along with wallets for any currencies it doesn't have yet
+func (t *Trader) AddMarket(market types.MarketDTO) *Market {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	m := newMarket(t, market)
+	t.markets = append(t.markets, m)
+	for _, cur := range []types.CurrencyDTO{market.BaseCurrency, market.QuoteCurrency} {
+		if _, ok := t.wallets[cur.Symbol]; !ok {
+			t.wallets[cur.Symbol] = &Wallet{trader: t, dto: types.WalletDTO{Currency: cur, ID: cur.Symbol}}
+		}
+	}
+	return m
+}
+
+// Placed receives every order as it's placed
+func (t *Trader) Placed() <-chan *Order { return t.placed }
+
+// Orders returns the orders placed so far in the order they were placed
+func (t *Trader) Orders() []*Order {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]*Order{}, t.orders...)
+}
+
+// FailNextOrder makes the next order attempt fail with the error
+func (t *Trader) FailNextOrder(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.orderErrs = append(t.orderErrs, err)
+}
+
+// FailNextCancel makes the next cancel fail with the error
+func (t *Trader) FailNextCancel(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.cancelErrs = append(t.cancelErrs, err)
+}
+
+// FailFees makes loading the fee rates fail with the error. Nil clears it.
+func (t *Trader) FailFees(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.feesErr = err
+}
+
+// SetClock makes the orders placed from now on take their creation time from the clock
+func (t *Trader) SetClock(clock *Clock) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.clock = clock
+}
+
+// SetBalance sets how much of the currency is free in its wallet
+func (t *Trader) SetBalance(symbol string, free decimal.Decimal) {
+	w := t.wallet(symbol)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.dto.Free = free
+}
+
+func (t *Trader) wallet(symbol string) *Wallet {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	w, ok := t.wallets[symbol]
+	if !ok {
+		w = &Wallet{trader: t, dto: types.WalletDTO{Currency: types.CurrencyDTO{Symbol: symbol, Name: symbol}, ID: symbol}}
+		t.wallets[symbol] = w
+	}
+	return w
+}
+
+func (t *Trader) Start() {}
+
+func (t *Trader) Stop() {}
+
+func (t *Trader) AccountSvc() types.AccountSvc { return accountSvc{t} }
+
+func (t *Trader) MarketSvc() types.MarketSvc { return marketSvc{t} }
+
+func (t *Trader) OrderSvc() types.OrderSvc { return orderSvc{t} }
+
+func (t *Trader) TickerSvc() types.TickerSvc { return tickerSvc{t} }
+
+// marketNamed returns the market with the name, falling back to the first market
+func (t *Trader) marketNamed(name string) *Market {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, m := range t.markets {
+		if m.Name() == name {
+			return m
+		}
+	}
+	return t.market
+}
+
+func (t *Trader) attemptOrder(m *Market, req types.OrderRequest) (types.Order, error) {
+	t.mutex.Lock()
+	if len(t.orderErrs) > 0 {
+		err := t.orderErrs[0]
+		t.orderErrs = t.orderErrs[1:]
+		t.mutex.Unlock()
+		return nil, err
+	}
+
+	dto := types.OrderDTO{
+		Market:  m.ToDTO(),
+		ID:      fmt.Sprintf("order-%d", len(t.orders)+1),
+		Request: req.ToDTO(),
+		Status:  order.Pending,
+	}
+	if t.clock != nil {
+		dto.CreationTime = t.clock.Now()
+	}
+	ord := newOrder(t, m, dto)
+	t.orders = append(t.orders, ord)
+	t.mutex.Unlock()
+
+	t.placed <- ord
+	return ord, nil
+}
+
+func (t *Trader) cancelOrder(o types.Order) error {
+	t.mutex.Lock()
+	if len(t.cancelErrs) > 0 {
+		err := t.cancelErrs[0]
+		t.cancelErrs = t.cancelErrs[1:]
+		t.mutex.Unlock()
+		return err
+	}
+	t.mutex.Unlock()
+
+	ord, ok := o.(*Order)
+	if !ok {
+		return fmt.Errorf("order %s was not placed with the fake trader", o.ID())
+	}
+	ord.Cancel()
+	return nil
+}
+
+func (t *Trader) order(id string) (*Order, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, ord := range t.orders {
+		if ord.ID() == id {
+			return ord, nil
+		}
+	}
+	return nil, fmt.Errorf("order %s not found", id)
+}
+
+type accountSvc struct{ t *Trader }
+
+func (s accountSvc) Currencies() ([]types.Currency, error) {
+	currencies := []types.Currency{}
+	seen := map[string]bool{}
+	for _, m := range s.t.MarketSvc().Markets() {
+		for _, cur := range []types.Currency{m.BaseCurrency(), m.QuoteCurrency()} {
+			if !seen[cur.Symbol()] {
+				seen[cur.Symbol()] = true
+				currencies = append(currencies, cur)
+			}
+		}
+	}
+	return currencies, nil
+}
+
+func (s accountSvc) Currency(name string) (types.Currency, error) {
+	currencies, _ := s.Currencies()
+	for _, cur := range currencies {
+		if cur.Name() == name || cur.Symbol() == name {
+			return cur, nil
+		}
+	}
+	return nil, fmt.Errorf("currency %s not found", name)
+}
+
+func (s accountSvc) Fees() (types.Fees, error) {
+	s.t.mutex.Lock()
+	defer s.t.mutex.Unlock()
+
+	if s.t.feesErr != nil {
+		return nil, s.t.feesErr
+	}
+	return fees{s.t.fees}, nil
+}
+
+func (s accountSvc) Wallet(currency types.Currency) (types.Wallet, error) {
+	return s.t.wallet(currency.Symbol()), nil
+}
+
+func (s accountSvc) Wallets() ([]types.Wallet, error) {
+	s.t.mutex.Lock()
+	defer s.t.mutex.Unlock()
+
+	wallets := []types.Wallet{}
+	for _, w := range s.t.wallets {
+		wallets = append(wallets, w)
+	}
+	return wallets, nil
+}
+
+type marketSvc struct{ t *Trader }
+
+func (s marketSvc) Market(cur0 types.Currency, cur1 types.Currency) (types.Market, error) {
+	for _, m := range s.Markets() {
+		base, quote := m.BaseCurrency().Symbol(), m.QuoteCurrency().Symbol()
+		if (cur0.Symbol() == base && cur1.Symbol() == quote) || (cur0.Symbol() == quote && cur1.Symbol() == base) {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("market %s-%s not found", cur0.Symbol(), cur1.Symbol())
+}
+
+func (s marketSvc) Markets() []types.Market {
+	s.t.mutex.Lock()
+	defer s.t.mutex.Unlock()
+
+	markets := []types.Market{}
+	for _, m := range s.t.markets {
+		markets = append(markets, m)
+	}
+	return markets
+}
+
+type orderSvc struct{ t *Trader }
+
+func (s orderSvc) AttemptOrder(m types.Market, req types.OrderRequest) (types.Order, error) {
+	return s.t.attemptOrder(s.t.marketNamed(m.Name()), req)
+}
+
+func (s orderSvc) CancelOrder(order types.Order) error { return s.t.cancelOrder(order) }
+
+func (s orderSvc) Order(m types.Market, id string) (types.Order, error) { return s.t.order(id) }
+
+func (s orderSvc) OrderFromDTO(dto types.OrderDTO) types.Order {
+	return newOrder(s.t, s.t.marketNamed(dto.Market.Name), dto)
+}
+
+type tickerSvc struct{ t *Trader }
+
+func (s tickerSvc) Ticker(market types.Market) (types.Ticker, error) { return market.Ticker() }
+
+func (s tickerSvc) TickerStream(stop <-chan bool, market types.Market) <-chan types.Ticker {
+	return market.TickerStream(stop)
+}
+
+type fees struct{ dto types.FeesDTO }
+
+func (f fees) MakerRate() decimal.Decimal { return f.dto.MakerRate }
+
+func (f fees) TakerRate() decimal.Decimal { return f.dto.TakerRate }
+
+func (f fees) ToDTO() types.FeesDTO { return f.dto }
+
+func (f fees) Volume() decimal.Decimal { return f.dto.Volume }
@@ -0,0 +1,435 @@
+package pair
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+)
+
+// GridConfig describes the ladder of a grid. Levels are spread evenly from the lower to the upper price and each one
+// places pairs of the given quantity.
+type GridConfig struct {
+	Lower    decimal.Decimal `json:"lower"`
+	Upper    decimal.Decimal `json:"upper"`
+	Levels   int             `json:"levels"`
+	Quantity decimal.Decimal `json:"quantity"`
+}
+
+func (c GridConfig) validate() error {
+	if !c.Lower.IsPositive() {
+		return fmt.Errorf("grid lower price of %s must be positive", c.Lower)
+	}
+	if !c.Upper.GreaterThan(c.Lower) {
+		return fmt.Errorf("grid upper price of %s must be above the lower price of %s", c.Upper, c.Lower)
+	}
+	if c.Levels < 2 {
+		return fmt.Errorf("grid needs at least 2 levels, got %d", c.Levels)
+	}
+	if !c.Quantity.IsPositive() {
+		return fmt.Errorf("grid quantity of %s must be positive", c.Quantity)
+	}
+	return nil
+}
+
+// GridLevel is one rung of the ladder and the pair currently placed at it
+type GridLevel struct {
+	Price     decimal.Decimal `json:"price"`
+	Direction Direction       `json:"direction,omitempty"`
+	PairUUID  string          `json:"pairUuid,omitempty"`
+	Completed int             `json:"completed"`
+	Paused    bool            `json:"paused"`
+	Details   string          `json:"details,omitempty"`
+}
+
+// GridState is everything the grid saves so it survives restarts
+type GridState struct {
+	Running   bool        `json:"running"`
+	Config    GridConfig  `json:"config"`
+	Levels    []GridLevel `json:"levels"`
+	StartedAt time.Time   `json:"startedAt"`
+	StoppedAt time.Time   `json:"stoppedAt"`
+}
+
+func (g GridState) Value() (driver.Value, error) {
+	return json.Marshal(g)
+}
+
+func (g *GridState) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &g)
+}
+
+// GridGuard is asked before the grid places each pair. Returning an error holds off placing pairs until the next pass.
+type GridGuard interface {
+	Check() error
+}
+
+// Grid keeps a ladder of pairs at fixed prices within a band. Levels below the price place Upward pairs and levels
+// above it place Downward pairs. When a level's pair is done the level is armed again in whichever direction the price
+// now calls for. Levels whose pair broke are paused until the grid is started again.
+type Grid struct {
+	svc   *Service
+	guard GridGuard
+
+	armMutex sync.Mutex
+	mutex    sync.Mutex
+	state    GridState
+	stop     chan bool
+	wake     chan bool
+	watching map[string]bool
+}
+
+// NewGrid loads the grid from the database. Call Resume to pick a running grid back up.
+func NewGrid(svc *Service) (grid *Grid, err error) {
+	grid = &Grid{
+		svc:      svc,
+		wake:     make(chan bool, 1),
+		watching: map[string]bool{},
+	}
+	err = grid.initializeDB()
+	if err != nil {
+		return nil, err
+	}
+	err = grid.load()
+	return
+}
+
+// SetGuard sets the guard asked before each pair is placed
+func (g *Grid) SetGuard(guard GridGuard) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.guard = guard
+}
+
+// State returns a copy of the grid
+func (g *Grid) State() GridState {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.copyState()
+}
+
+// Start lays out a new ladder and places the first pairs. A running grid has to be stopped first.
+func (g *Grid) Start(config GridConfig) (GridState, error) {
+	err := config.validate()
+	if err != nil {
+		return GridState{}, err
+	}
+
+	g.mutex.Lock()
+	if g.state.Running {
+		g.mutex.Unlock()
+		return GridState{}, fmt.Errorf("grid is already running; stop it first")
+	}
+
+	// Snap the levels to the market so the pairs rest exactly on them
+	rules := RulesFromMarket(g.svc.market)
+	step := config.Upper.Sub(config.Lower).Div(decimal.NewFromInt(int64(config.Levels - 1)))
+	levels := []GridLevel{}
+	for i := 0; i < config.Levels; i++ {
+		price := snapDown(config.Lower.Add(step.Mul(decimal.NewFromInt(int64(i)))), rules.PriceIncrement)
+		if len(levels) > 0 && !price.GreaterThan(levels[len(levels)-1].Price) {
+			g.mutex.Unlock()
+			return GridState{}, fmt.Errorf("grid levels %s apart are closer than the market price increment of %s", step, rules.PriceIncrement)
+		}
+		levels = append(levels, GridLevel{Price: price})
+	}
+
+	log.Noticef("starting grid of %d levels from %s to %s", config.Levels, config.Lower, config.Upper)
+	g.state = GridState{
+		Running:   true,
+		Config:    config,
+		Levels:    levels,
+		StartedAt: g.svc.Clock().Now(),
+	}
+	err = g.save()
+	g.mutex.Unlock()
+	if err != nil {
+		return GridState{}, err
+	}
+
+	g.Resume()
+	return g.State(), nil
+}
+
+// Resume arms the levels of a running grid and keeps them armed until the grid is stopped
+func (g *Grid) Resume() {
+	g.mutex.Lock()
+	if !g.state.Running || g.stop != nil {
+		g.mutex.Unlock()
+		return
+	}
+	stop := make(chan bool)
+	g.stop = stop
+	g.mutex.Unlock()
+
+	g.arm()
+	go g.run(stop)
+}
+
+// Stop stops arming levels. Pairs that are already placed carry on unless cancelOpen is set, in which case those
+// whose first order hasn't filled are canceled.
+func (g *Grid) Stop(cancelOpen bool) (GridState, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !g.state.Running {
+		return GridState{}, fmt.Errorf("grid is not running")
+	}
+
+	log.Noticef("stopping grid")
+	if g.stop != nil {
+		close(g.stop)
+		g.stop = nil
+	}
+	g.state.Running = false
+	g.state.StoppedAt = g.svc.Clock().Now()
+	err := g.save()
+	if err != nil {
+		return GridState{}, err
+	}
+
+	if cancelOpen {
+		for _, level := range g.state.Levels {
+			if level.PairUUID != "" {
+				go g.cancelFirstLeg(level.PairUUID)
+			}
+		}
+	}
+	return g.copyState(), nil
+}
+
+func (g *Grid) run(stop <-chan bool) {
+	// Retry levels that couldn't be armed every so often
+	var retry <-chan time.Time
+	if interval := viper.GetDuration("grid.interval"); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		retry = ticker.C
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-g.wake:
+		case <-retry:
+		}
+		g.arm()
+	}
+}
+
+// arm places a pair at every level that doesn't have one. The levels are copied so the exchange is only called
+// without the mutex held and the results are applied afterwards.
+func (g *Grid) arm() {
+	// One pass at a time so two passes can't arm the same level
+	g.armMutex.Lock()
+	defer g.armMutex.Unlock()
+
+	g.mutex.Lock()
+	if !g.state.Running {
+		g.mutex.Unlock()
+		return
+	}
+	startedAt := g.state.StartedAt
+	quantity := g.state.Config.Quantity
+	levels := append([]GridLevel{}, g.state.Levels...)
+	guard := g.guard
+	g.mutex.Unlock()
+
+	ticker, err := g.svc.market.Ticker()
+	if err != nil {
+		log.WithError(err).Error("could not load the ticker to arm the grid")
+		return
+	}
+
+	watch := []*OrderPair{}
+	for i := range levels {
+		level := &levels[i]
+		if level.Paused {
+			continue
+		}
+
+		// Wait on the pair at the level to finish
+		if level.PairUUID != "" {
+			p, err := g.svc.Load(level.PairUUID)
+			if err != nil {
+				log.WithError(err).Errorf("could not load grid pair %s", level.PairUUID)
+				continue
+			}
+			if !p.IsDone() {
+				watch = append(watch, p)
+				continue
+			}
+			g.complete(level, p)
+			if level.Paused {
+				continue
+			}
+		}
+
+		// Buy below the price and sell above it. The level at the price waits for the price to move.
+		var dir Direction
+		switch {
+		case level.Price.LessThan(ticker.Price()):
+			dir = Upward
+		case level.Price.GreaterThan(ticker.Price()):
+			dir = Downward
+		default:
+			continue
+		}
+
+		// Hold off while the guard says so
+		if guard != nil {
+			err = guard.Check()
+			if err != nil {
+				log.WithError(err).Warn("holding off arming the grid")
+				level.Details = err.Error()
+				break
+			}
+		}
+
+		p, err := g.place(dir, level.Price, quantity)
+		if err != nil {
+			log.WithError(err).Errorf("could not arm grid level %s", level.Price)
+			level.Details = err.Error()
+			continue
+		}
+		log.Infof("%s: armed grid level %s %s", p.UUID().String(), level.Price, dir)
+		level.Direction = dir
+		level.PairUUID = p.UUID().String()
+		level.Details = ""
+		watch = append(watch, p)
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// A grid started over while arming has its own levels
+	if !g.state.StartedAt.Equal(startedAt) {
+		log.Warn("grid was started again while arming; dropping the armed levels")
+		return
+	}
+
+	// Keep the pairs placed even if the grid was stopped in the meantime
+	g.state.Levels = levels
+	if g.stop != nil {
+		for _, p := range watch {
+			g.watch(p)
+		}
+	}
+
+	err = g.save()
+	if err != nil {
+		log.WithError(err).Error("could not save the grid")
+	}
+}
+
+func (g *Grid) place(dir Direction, price decimal.Decimal, quantity decimal.Decimal) (*OrderPair, error) {
+	p, err := BuildPairAt(g.svc, dir, price, quantity)
+	if err != nil {
+		return nil, err
+	}
+	err = p.Execute()
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// complete records how the pair at the level ended and frees the level
+func (g *Grid) complete(level *GridLevel, p *OrderPair) {
+	level.PairUUID = ""
+	switch p.Status() {
+	case Success:
+		level.Completed++
+		level.Details = ""
+	case Broken:
+		log.Errorf("%s: pausing grid level %s after the pair broke", p.UUID().String(), level.Price)
+		level.Paused = true
+		level.Details = fmt.Sprintf("pair %s broke: %s", p.UUID().String(), p.StatusDetails())
+	default:
+		level.Details = fmt.Sprintf("pair %s was %s", p.UUID().String(), p.Status())
+	}
+}
+
+// watch wakes the grid up once the pair is done
+func (g *Grid) watch(p *OrderPair) {
+	id := p.UUID().String()
+	if g.watching[id] {
+		return
+	}
+	g.watching[id] = true
+
+	stop := g.stop
+	go func() {
+		select {
+		case <-p.Done():
+		case <-stop:
+		}
+
+		g.mutex.Lock()
+		delete(g.watching, id)
+		g.mutex.Unlock()
+
+		select {
+		case g.wake <- true:
+		default:
+		}
+	}()
+}
+
+func (g *Grid) cancelFirstLeg(id string) {
+	p, err := g.svc.Load(id)
+	if err != nil {
+		log.WithError(err).Errorf("could not load grid pair %s to cancel", id)
+		return
+	}
+	if p.IsDone() || p.SecondOrder() != nil {
+		return
+	}
+
+	log.Infof("%s: canceling first leg after stopping the grid", id)
+	err = p.Cancel()
+	if err != nil {
+		log.WithError(err).Errorf("%s: could not cancel first leg", id)
+	}
+}
+
+func (g *Grid) copyState() GridState {
+	state := g.state
+	state.Levels = append([]GridLevel{}, g.state.Levels...)
+	return state
+}
+
+func (g *Grid) initializeDB() error {
+	_, err := g.svc.db.Exec("CREATE TABLE IF NOT EXISTS grid (id int primary key, data JSONB);")
+	return err
+}
+
+func (g *Grid) load() error {
+	err := g.svc.db.QueryRow("SELECT data FROM grid WHERE id = 1;").Scan(&g.state)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("could not load grid from database: %w", err)
+	}
+	return nil
+}
+
+func (g *Grid) save() error {
+	_, err := g.svc.db.Exec("INSERT INTO grid (id, data) VALUES (1, $1) ON CONFLICT (id) DO UPDATE SET data = $1;", g.state)
+	if err != nil {
+		return fmt.Errorf("could not insert into database: %w", err)
+	}
+	return nil
+}
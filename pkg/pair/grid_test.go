@@ -0,0 +1,260 @@
+package pair
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair/fake_types"
+	"github.com/spf13/viper"
+)
+
+// gridConfig lays out levels at 90, 95, 100, 105 and 110
+var gridConfig = GridConfig{
+	Lower:    decimal.NewFromInt(90),
+	Upper:    decimal.NewFromInt(110),
+	Levels:   5,
+	Quantity: decimal.NewFromInt(1),
+}
+
+type haltedGuard struct{ err error }
+
+func (g haltedGuard) Check() error { return g.err }
+
+// startGrid starts a grid with the price at 100 and returns the first orders placed, keyed by price
+func (h *lifecycleHarness) startGrid() (*Grid, map[string]*fake_types.Order) {
+	h.t.Helper()
+	h.trader.Market().SetPrice(decimal.NewFromInt(100))
+	grid, err := NewGrid(h.svc)
+	if err != nil {
+		h.t.Fatalf("could not load grid: %s", err)
+	}
+	h.t.Cleanup(func() { grid.Stop(false) })
+
+	_, err = grid.Start(gridConfig)
+	if err != nil {
+		h.t.Fatalf("could not start grid: %s", err)
+	}
+
+	orders := map[string]*fake_types.Order{}
+	for i := 0; i < 4; i++ {
+		ord := h.placed()
+		orders[ord.Request().Price().String()] = ord
+	}
+	return grid, orders
+}
+
+// waitForGrid waits for the grid to reach the condition
+func (h *lifecycleHarness) waitForGrid(grid *Grid, condition func(GridState) bool) GridState {
+	h.t.Helper()
+	deadline := time.Now().Add(lifecycleTimeout)
+	for {
+		state := grid.State()
+		if condition(state) {
+			return state
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting on the grid; levels are %+v", state.Levels)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGrid_Ladder(t *testing.T) {
+	h := newLifecycleHarness(t)
+	grid, orders := h.startGrid()
+
+	expected := map[string]types.OrderSide{"90": order.Buy, "95": order.Buy, "105": order.Sell, "110": order.Sell}
+	for price, side := range expected {
+		ord, ok := orders[price]
+		if !ok {
+			t.Errorf("expected an order at %s", price)
+			continue
+		}
+		if ord.Request().Side() != side || !ord.Request().Quantity().Equal(decimal.NewFromInt(1)) {
+			t.Errorf("expected to %s 1 at %s, got %s %s", side, price, ord.Request().Side(), ord.Request().Quantity())
+		}
+	}
+
+	// The level at the price waits for it to move
+	state := grid.State()
+	if state.Levels[2].PairUUID != "" {
+		t.Errorf("expected the level at the price to be empty, got pair %s", state.Levels[2].PairUUID)
+	}
+	if state.Levels[0].Direction != Upward || state.Levels[4].Direction != Downward {
+		t.Errorf("expected to buy below the price and sell above it, got %s and %s", state.Levels[0].Direction, state.Levels[4].Direction)
+	}
+}
+
+func TestGrid_TakerFees(t *testing.T) {
+	defer viper.Set("forceMakerOrders", viper.GetBool("forceMakerOrders"))
+	viper.Set("forceMakerOrders", false)
+
+	// Levels are validated with the taker rate on their first order, so they have to be sized with it too
+	h := newFeesHarness(t, btcUSD(), types.FeesDTO{MakerRate: decimal.NewFromFloat(0.001), TakerRate: decimal.NewFromFloat(0.01)})
+	for _, dir := range []Direction{Upward, Downward} {
+		_, err := BuildPairAt(h.svc, dir, decimal.NewFromInt(100), decimal.NewFromInt(1))
+		if err != nil {
+			t.Errorf("could not build %s level: %s", dir, err)
+		}
+	}
+}
+
+func TestGrid_Rearm(t *testing.T) {
+	h := newLifecycleHarness(t)
+	grid, orders := h.startGrid()
+	first := grid.State().Levels[1].PairUUID
+
+	// Complete the pair at 95
+	orders["95"].Fill(decimal.NewFromInt(1))
+	second := h.placed()
+	second.Fill(second.Request().Quantity())
+
+	// The level is armed again with a new pair
+	rearmed := h.placed()
+	if rearmed.Request().Side() != order.Buy || !rearmed.Request().Price().Equal(decimal.NewFromInt(95)) {
+		t.Errorf("expected to buy at 95 again, got %s at %s", rearmed.Request().Side(), rearmed.Request().Price())
+	}
+	state := h.waitForGrid(grid, func(s GridState) bool { return s.Levels[1].Completed == 1 })
+	if state.Levels[1].PairUUID == first || state.Levels[1].PairUUID == "" {
+		t.Errorf("expected a new pair at 95, got %q", state.Levels[1].PairUUID)
+	}
+}
+
+func TestGrid_PausesBrokenLevel(t *testing.T) {
+	h := newLifecycleHarness(t)
+	grid, orders := h.startGrid()
+
+	h.trader.FailNextOrder(errors.New("insufficient funds"))
+	orders["105"].Fill(decimal.NewFromInt(1))
+
+	state := h.waitForGrid(grid, func(s GridState) bool { return s.Levels[3].Paused })
+	if !strings.Contains(state.Levels[3].Details, "insufficient funds") {
+		t.Errorf("expected the level to hold the pair error, got %q", state.Levels[3].Details)
+	}
+	if state.Levels[3].PairUUID != "" {
+		t.Errorf("expected the paused level to be empty, got pair %s", state.Levels[3].PairUUID)
+	}
+}
+
+func TestGrid_SurvivesRestart(t *testing.T) {
+	h := newLifecycleHarness(t)
+	grid, _ := h.startGrid()
+	before := grid.State()
+
+	// Load the grid up again and pick it back up
+	restarted, err := NewGrid(h.svc)
+	if err != nil {
+		t.Fatalf("could not load grid: %s", err)
+	}
+	restarted.Resume()
+	after := restarted.State()
+
+	if !after.Running {
+		t.Error("expected the grid to still be running")
+	}
+	for i := range before.Levels {
+		if after.Levels[i].PairUUID != before.Levels[i].PairUUID {
+			t.Errorf("expected level %s to keep pair %q, got %q", before.Levels[i].Price, before.Levels[i].PairUUID, after.Levels[i].PairUUID)
+		}
+	}
+	if len(h.trader.Orders()) != 4 {
+		t.Errorf("expected no new orders for the armed levels, got %d orders", len(h.trader.Orders()))
+	}
+}
+
+func TestGrid_Stop(t *testing.T) {
+	h := newLifecycleHarness(t)
+	grid, orders := h.startGrid()
+
+	state, err := grid.Stop(true)
+	if err != nil {
+		t.Fatalf("could not stop grid: %s", err)
+	}
+	if state.Running || state.StoppedAt.IsZero() {
+		t.Errorf("expected grid to be stopped, got %+v", state)
+	}
+
+	// Unfilled first legs are canceled and not rearmed
+	for price, ord := range orders {
+		select {
+		case <-ord.Done():
+		case <-time.After(lifecycleTimeout):
+			t.Fatalf("timed out waiting for the order at %s to be canceled", price)
+		}
+		if ord.Status() != order.Canceled {
+			t.Errorf("expected the order at %s to be %s, got %s", price, order.Canceled, ord.Status())
+		}
+	}
+	if len(h.trader.Orders()) != 4 {
+		t.Errorf("expected no new orders after stopping, got %d orders", len(h.trader.Orders()))
+	}
+
+	_, err = grid.Stop(false)
+	if err == nil {
+		t.Error("expected an error stopping a stopped grid")
+	}
+}
+
+func TestGrid_Guard(t *testing.T) {
+	h := newLifecycleHarness(t)
+	h.trader.Market().SetPrice(decimal.NewFromInt(100))
+	grid, err := NewGrid(h.svc)
+	if err != nil {
+		t.Fatalf("could not load grid: %s", err)
+	}
+	grid.SetGuard(haltedGuard{errors.New("trading halted")})
+
+	state, err := grid.Start(gridConfig)
+	if err != nil {
+		t.Fatalf("could not start grid: %s", err)
+	}
+	defer grid.Stop(false)
+
+	if len(h.trader.Orders()) != 0 {
+		t.Errorf("expected no orders while halted, got %d", len(h.trader.Orders()))
+	}
+	if state.Levels[0].Details != "trading halted" {
+		t.Errorf("expected the level to say why it isn't armed, got %q", state.Levels[0].Details)
+	}
+}
+
+func TestGrid_Start(t *testing.T) {
+	tests := []struct {
+		scenario string
+		config   GridConfig
+	}{
+		{"no lower price", GridConfig{Upper: decimal.NewFromInt(110), Levels: 5, Quantity: decimal.NewFromInt(1)}},
+		{"upside down", GridConfig{Lower: decimal.NewFromInt(110), Upper: decimal.NewFromInt(90), Levels: 5, Quantity: decimal.NewFromInt(1)}},
+		{"one level", GridConfig{Lower: decimal.NewFromInt(90), Upper: decimal.NewFromInt(110), Levels: 1, Quantity: decimal.NewFromInt(1)}},
+		{"no quantity", GridConfig{Lower: decimal.NewFromInt(90), Upper: decimal.NewFromInt(110), Levels: 5}},
+		{"levels closer than a cent", GridConfig{Lower: decimal.NewFromInt(90), Upper: decimal.NewFromFloat(90.02), Levels: 5, Quantity: decimal.NewFromInt(1)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			h := newLifecycleHarness(t)
+			grid, err := NewGrid(h.svc)
+			if err != nil {
+				t.Fatalf("could not load grid: %s", err)
+			}
+			_, err = grid.Start(tt.config)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	t.Run("already running", func(t *testing.T) {
+		h := newLifecycleHarness(t)
+		grid, _ := h.startGrid()
+		_, err := grid.Start(gridConfig)
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -21,6 +21,63 @@ func init() {
 	// Make sure fees are taken into account by default
 	viper.SetDefault("disableFees", false)
 
-	// Set the strategy used to make room for new orders
+	// Set the strategy used to make room for new orders. One of oldest, newest, least-profitable, farthest-from-price or none
 	viper.SetDefault("makeRoomStrategy", "oldest")
+
+	// How long to let the exchange settle after an order is done before trusting its fills and fees
+	viper.SetDefault("pair.consistencyWait", "5s")
+
+	// How many times to refresh an order the exchange reported done before its status caught up
+	viper.SetDefault("pair.refreshRetries", 9)
+
+	// The wait before the first refresh retry and how it grows with each retry. One of constant, linear or exponential
+	viper.SetDefault("pair.refreshBackoff", "1s")
+	viper.SetDefault("pair.refreshBackoffCurve", "linear")
+
+	// Cap the wait between refresh retries. 0 disables the cap
+	viper.SetDefault("pair.maxRefreshBackoff", 0)
+
+	// How long to let the exchange settle after canceling a pair to make room
+	viper.SetDefault("pair.makeRoomWait", "1s")
+
+	// How often to reconcile the pairs against the exchange. 0 disables the reconciler
+	viper.SetDefault("reconcile.interval", "15m")
+
+	// Cancel open exchange orders that don't belong to any pair while reconciling
+	viper.SetDefault("reconcile.cancelOrphans", false)
+
+	// Only treat an exchange order without a pair as orphaned once it's this old
+	viper.SetDefault("reconcile.orphanGracePeriod", "5m")
+
+	// Cap the net amount of base currency held or owed across open pairs. 0 disables the limit
+	viper.SetDefault("exposure.maxNetBase", 0)
+
+	// Cap the value in quote currency of a single pair. 0 disables the limit
+	viper.SetDefault("exposure.maxPairNotional", 0)
+
+	// Cap the value in quote currency of all the open pairs in a direction. 0 disables the limit
+	viper.SetDefault("exposure.maxDirectionNotional", 0)
+
+	// How often the grid retries arming levels it couldn't place a pair at. Levels are rearmed as soon as their pair
+	// is done either way. 0 disables the retries
+	viper.SetDefault("grid.interval", "1m")
+
+	// Keep this share of the portfolio's value in the base currency, give or take the band. Pairs that would push the
+	// portfolio further out of the band are sized by the size bias. 0 disables the target
+	viper.SetDefault("rebalance.target", 0)
+	viper.SetDefault("rebalance.band", 0.1)
+	viper.SetDefault("rebalance.sizeBias", 0.5)
+
+	// Place maker orders every interval that bring the portfolio back to its target while it's outside the band, each
+	// worth no more than the max order notional in quote currency. 0 disables the cap
+	viper.SetDefault("rebalance.placeOrders", false)
+	viper.SetDefault("rebalance.interval", "5m")
+	viper.SetDefault("rebalance.maxOrderNotional", 0)
+
+	// Keep at least this much of each currency out of new pairs, keyed by currency symbol
+	viper.SetDefault("exposure.minReserve", map[string]string{})
+
+	// Fee rates of markets the exchange charges differently from the account's rates, keyed by market name
+	viper.SetDefault("fees.makerRates", map[string]string{})
+	viper.SetDefault("fees.takerRates", map[string]string{})
 }
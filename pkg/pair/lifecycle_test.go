@@ -0,0 +1,607 @@
+package pair
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair/fake_types"
+	"github.com/sinisterminister/moneytree/pkg/simulated"
+	"github.com/spf13/viper"
+)
+
+// How long to wait on the pair's goroutines before giving up. Nothing in a lifecycle waits on the wall clock so this
+// only matters when a test is broken.
+const lifecycleTimeout = 2 * time.Second
+
+type lifecycleHarness struct {
+	t      *testing.T
+	db     *sql.DB
+	svc    *Service
+	trader *fake_types.Trader
+	clock  *fake_types.Clock
+}
+
+// btcUSD is the market pairs trade on unless a test needs different rules
+func btcUSD() types.MarketDTO {
+	return types.MarketDTO{
+		Name:          "BTC-USD",
+		BaseCurrency:  types.CurrencyDTO{Name: "Bitcoin", Symbol: "BTC", Precision: 8},
+		QuoteCurrency: types.CurrencyDTO{Name: "US Dollar", Symbol: "USD", Precision: 2},
+		MinQuantity:   decimal.NewFromFloat(0.001),
+	}
+}
+
+func newLifecycleHarness(t *testing.T) *lifecycleHarness {
+	return newMarketHarness(t, btcUSD())
+}
+
+func newMarketHarness(t *testing.T, market types.MarketDTO) *lifecycleHarness {
+	return newFeesHarness(t, market, types.FeesDTO{MakerRate: decimal.NewFromFloat(0.005), TakerRate: decimal.NewFromFloat(0.005)})
+}
+
+func newFeesHarness(t *testing.T, market types.MarketDTO, fees types.FeesDTO) *lifecycleHarness {
+	// Every harness gets a fresh table
+	db, err := sql.Open("memdb", uuid.NewV4().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	trader := fake_types.NewTrader(market, fees)
+	trader.SetBalance("USD", decimal.NewFromInt(1000000))
+	trader.SetBalance("BTC", decimal.NewFromInt(1000))
+
+	svc, err := NewService(db, trader, trader.Market())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := fake_types.NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	svc.SetClock(clock)
+
+	return &lifecycleHarness{t, db, svc, trader, clock}
+}
+
+// upwardPair builds a pair that buys 100 at 100 and sells 99 at 200
+func (h *lifecycleHarness) upwardPair() *OrderPair {
+	market := h.trader.Market()
+	first := order.NewRequest(market, order.Limit, order.Buy, decimal.NewFromFloat(100), decimal.NewFromFloat(100), decimal.Zero, false)
+	second := order.NewRequest(market, order.Limit, order.Sell, decimal.NewFromFloat(99), decimal.NewFromFloat(200), decimal.Zero, false)
+
+	pair, err := h.svc.New(first, second)
+	if err != nil {
+		h.t.Fatalf("could not create pair: %s", err)
+	}
+	return pair
+}
+
+// placed returns the next order placed on the exchange
+func (h *lifecycleHarness) placed() *fake_types.Order {
+	h.t.Helper()
+	select {
+	case ord := <-h.trader.Placed():
+		return ord
+	case <-time.After(lifecycleTimeout):
+		h.t.Fatal("timed out waiting for an order to be placed")
+	}
+	return nil
+}
+
+// finish waits for the pair to be done and returns what was saved for it
+func (h *lifecycleHarness) finish(pair *OrderPair) OrderPairDAO {
+	h.t.Helper()
+	select {
+	case <-pair.Done():
+	case <-time.After(lifecycleTimeout):
+		h.t.Fatalf("timed out waiting for the pair to finish; status is %s", pair.Status())
+	}
+
+	// The pair is saved once more after it's marked as done
+	deadline := time.Now().Add(lifecycleTimeout)
+	for {
+		dao, err := savedPair(h.db, pair.UUID().String())
+		if err != nil {
+			h.t.Fatalf("could not load saved pair: %s", err)
+		}
+		if dao.Done && !dao.EndedAt.IsZero() {
+			return dao
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatal("timed out waiting for the finished pair to be saved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (h *lifecycleHarness) execute(pair *OrderPair) *fake_types.Order {
+	h.t.Helper()
+	err := pair.Execute()
+	if err != nil {
+		h.t.Fatalf("could not execute pair: %s", err)
+	}
+	return h.placed()
+}
+
+func TestLifecycle_Success(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+
+	first := h.execute(pair)
+	if pair.Status() != Open {
+		t.Errorf("expected pair to be %s once the first order is placed, got %s", Open, pair.Status())
+	}
+	first.Fill(decimal.NewFromFloat(100))
+
+	second := h.placed()
+	if second.Request().Side() != order.Sell || !second.Request().Quantity().Equal(decimal.NewFromFloat(99)) {
+		t.Errorf("expected second order to sell 99, got %s %s", second.Request().Side(), second.Request().Quantity())
+	}
+	second.Fill(decimal.NewFromFloat(99))
+
+	dao := h.finish(pair)
+	if dao.Status != Success {
+		t.Errorf("expected pair to be %s, got %s", Success, dao.Status)
+	}
+	if dao.SecondOrder.Status != order.Filled {
+		t.Errorf("expected second order to be saved as %s, got %s", order.Filled, dao.SecondOrder.Status)
+	}
+	if h.clock.Waited() != 10*time.Second {
+		t.Errorf("expected to wait 10s for consistency, waited %s", h.clock.Waited())
+	}
+}
+
+func TestLifecycle_PartialFill(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+
+	// The exchange reports the order done before it settles on canceled with half of it filled
+	first := h.execute(pair)
+	first.Fill(decimal.NewFromFloat(50))
+	first.OnRefresh(
+		fake_types.RefreshStep{Status: order.Partial, Filled: decimal.NewFromFloat(50)},
+		fake_types.RefreshStep{Status: order.Canceled, Filled: decimal.NewFromFloat(50)},
+	)
+	first.Close(order.Partial)
+
+	// The second order is resized to what was filled
+	second := h.placed()
+	if !second.Request().Quantity().Equal(decimal.NewFromFloat(49.5)) {
+		t.Errorf("expected second order to be resized to 49.5, got %s", second.Request().Quantity())
+	}
+	second.Fill(decimal.NewFromFloat(49.5))
+
+	dao := h.finish(pair)
+	if dao.Status != Success {
+		t.Errorf("expected pair to be %s, got %s", Success, dao.Status)
+	}
+	if !dao.SecondRequest.Quantity.Equal(decimal.NewFromFloat(49.5)) {
+		t.Errorf("expected resized second request to be saved, got %s", dao.SecondRequest.Quantity)
+	}
+}
+
+func TestLifecycle_PartialFillSnapsToStep(t *testing.T) {
+	market := btcUSD()
+	market.QuantityStepSize = decimal.NewFromFloat(0.01)
+	h := newMarketHarness(t, market)
+	pair := h.upwardPair()
+
+	first := h.execute(pair)
+	first.Fill(decimal.NewFromFloat(33.333))
+	first.OnRefresh(
+		fake_types.RefreshStep{Status: order.Partial, Filled: decimal.NewFromFloat(33.333)},
+		fake_types.RefreshStep{Status: order.Canceled, Filled: decimal.NewFromFloat(33.333)},
+	)
+	first.Close(order.Partial)
+
+	// 99% of what was filled, rounded down to the step so the base currency still gains
+	second := h.placed()
+	if !second.Request().Quantity().Equal(decimal.NewFromFloat(32.99)) {
+		t.Errorf("expected second order to be resized to 32.99, got %s", second.Request().Quantity())
+	}
+	second.Fill(decimal.NewFromFloat(32.99))
+
+	dao := h.finish(pair)
+	if dao.Status != Success {
+		t.Errorf("expected pair to be %s, got %s", Success, dao.Status)
+	}
+}
+
+func TestLifecycle_PartialFillBelowMinimum(t *testing.T) {
+	market := btcUSD()
+	market.QuantityStepSize = decimal.NewFromFloat(0.01)
+	market.MinQuantity = decimal.NewFromInt(1)
+	h := newMarketHarness(t, market)
+	pair := h.upwardPair()
+
+	first := h.execute(pair)
+	first.Fill(decimal.NewFromFloat(0.5))
+	first.OnRefresh(
+		fake_types.RefreshStep{Status: order.Partial, Filled: decimal.NewFromFloat(0.5)},
+		fake_types.RefreshStep{Status: order.Canceled, Filled: decimal.NewFromFloat(0.5)},
+	)
+	first.Close(order.Partial)
+
+	// Too little was bought to sell with a limit order so it's sold back at the market
+	reversal := h.placed()
+	if reversal.Request().Type() != order.Market || reversal.Request().Side() != order.Sell {
+		t.Errorf("expected the partial fill to be reversed with a market sell, got %s %s", reversal.Request().Type(), reversal.Request().Side())
+	}
+	reversal.Fill(decimal.NewFromFloat(0.5))
+
+	dao := h.finish(pair)
+	if dao.Status != Reversed {
+		t.Errorf("expected pair to be %s, got %s", Reversed, dao.Status)
+	}
+	if !strings.Contains(dao.StatusDetails, "below the market minimum") {
+		t.Errorf("expected status details to hold the limit error, got %q", dao.StatusDetails)
+	}
+	if len(h.trader.Orders()) != 2 {
+		t.Errorf("expected only the first and reversal orders to be placed, got %d orders", len(h.trader.Orders()))
+	}
+}
+
+func TestLifecycle_Cancel(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+	first := h.execute(pair)
+
+	err := pair.Cancel()
+	if err != nil {
+		t.Fatalf("could not cancel pair: %s", err)
+	}
+
+	dao := h.finish(pair)
+	if dao.Status != Canceled {
+		t.Errorf("expected pair to be %s, got %s", Canceled, dao.Status)
+	}
+	if first.Status() != order.Canceled {
+		t.Errorf("expected first order to be %s, got %s", order.Canceled, first.Status())
+	}
+	if len(h.trader.Orders()) != 1 {
+		t.Errorf("expected no orders after the first, got %d orders", len(h.trader.Orders()))
+	}
+}
+
+func TestLifecycle_CancelFails(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+	first := h.execute(pair)
+
+	h.trader.FailNextCancel(errors.New("exchange is down"))
+	err := pair.Cancel()
+	if err == nil {
+		t.Fatal("expected cancel to fail")
+	}
+	if pair.IsDone() || first.IsDone() {
+		t.Error("expected pair to stay open when the cancel fails")
+	}
+}
+
+func TestLifecycle_CancelAfterPartialFillReverses(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+	first := h.execute(pair)
+	first.Fill(decimal.NewFromFloat(50))
+
+	// Cancel waits for the reversal so it has to run alongside the test
+	canceled := make(chan error)
+	go func() { canceled <- pair.Cancel() }()
+
+	reversal := h.placed()
+	if reversal.Request().Side() != order.Sell || reversal.Request().Type() != order.Market {
+		t.Errorf("expected a market sell to reverse the buy, got %s %s", reversal.Request().Type(), reversal.Request().Side())
+	}
+	if !reversal.Request().Funds().Equal(decimal.NewFromFloat(5025.13)) {
+		t.Errorf("expected reversal to raise the 5000 paid plus fees, got %s", reversal.Request().Funds())
+	}
+	reversal.Fill(decimal.NewFromFloat(50))
+
+	dao := h.finish(pair)
+	if dao.Status != Reversed {
+		t.Errorf("expected pair to be %s, got %s", Reversed, dao.Status)
+	}
+	if dao.ReversalOrder.Status != order.Filled {
+		t.Errorf("expected reversal order to be saved as %s, got %s", order.Filled, dao.ReversalOrder.Status)
+	}
+	select {
+	case err := <-canceled:
+		if err != nil {
+			t.Errorf("could not cancel pair: %s", err)
+		}
+	case <-time.After(lifecycleTimeout):
+		t.Error("timed out waiting for cancel to return")
+	}
+}
+
+func TestLifecycle_SecondOrderCanceledReverses(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+	first := h.execute(pair)
+	first.Fill(decimal.NewFromFloat(100))
+
+	second := h.placed()
+	second.Cancel()
+
+	reversal := h.placed()
+	if reversal.Request().Side() != order.Sell {
+		t.Errorf("expected reversal to sell, got %s", reversal.Request().Side())
+	}
+	reversal.Fill(decimal.NewFromFloat(100))
+
+	dao := h.finish(pair)
+	if dao.Status != Reversed {
+		t.Errorf("expected pair to be %s, got %s", Reversed, dao.Status)
+	}
+	if !strings.Contains(dao.StatusDetails, "second order was canceled") {
+		t.Errorf("expected status details to explain the reversal, got %q", dao.StatusDetails)
+	}
+}
+
+func TestLifecycle_Broken(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+	first := h.execute(pair)
+
+	h.trader.FailNextOrder(errors.New("insufficient funds"))
+	first.Fill(decimal.NewFromFloat(100))
+
+	dao := h.finish(pair)
+	if dao.Status != Broken {
+		t.Errorf("expected pair to be %s, got %s", Broken, dao.Status)
+	}
+	if !strings.Contains(dao.StatusDetails, "insufficient funds") {
+		t.Errorf("expected status details to hold the order error, got %q", dao.StatusDetails)
+	}
+}
+
+func TestLifecycle_BrokenAfterRefreshRetries(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+
+	// The order never settles after it's reported done
+	first := h.execute(pair)
+	first.Close(order.Partial)
+
+	dao := h.finish(pair)
+	if dao.Status != Broken {
+		t.Errorf("expected pair to be %s, got %s", Broken, dao.Status)
+	}
+	if h.clock.Waited() != 50*time.Second {
+		t.Errorf("expected to wait 5s plus 1s to 9s between refreshes, waited %s", h.clock.Waited())
+	}
+}
+
+func TestLifecycle_FirstOrderFails(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+
+	h.trader.FailNextOrder(errors.New("rejected"))
+	err := pair.Execute()
+	if err == nil {
+		t.Fatal("expected execute to fail")
+	}
+
+	dao := h.finish(pair)
+	if dao.Status != Failed {
+		t.Errorf("expected pair to be %s, got %s", Failed, dao.Status)
+	}
+}
+
+type eventRecorder chan Event
+
+func (r eventRecorder) PairEvent(event Event) { r <- event }
+
+func TestLifecycle_LossMitigator(t *testing.T) {
+	defer viper.Set("enableLossMitigator", viper.GetBool("enableLossMitigator"))
+	defer viper.Set("bailPercentage", viper.GetFloat64("bailPercentage"))
+	viper.Set("enableLossMitigator", true)
+	viper.Set("bailPercentage", 0.05)
+
+	h := newLifecycleHarness(t)
+	events := eventRecorder(make(chan Event, 10))
+	h.svc.AddEventListener(events)
+
+	pair := h.upwardPair()
+	first := h.execute(pair)
+	first.Fill(decimal.NewFromFloat(100))
+	h.placed()
+
+	// Wait for the mitigator to watch the ticker
+	deadline := time.Now().Add(lifecycleTimeout)
+	for h.trader.Market().Streams() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the loss mitigator to start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Staying above the bail target of 190 keeps the pair open
+	h.trader.Market().SetPrice(decimal.NewFromFloat(191))
+	if pair.IsDone() || len(h.trader.Orders()) != 2 {
+		t.Fatal("expected the pair to stay open above the bail target")
+	}
+
+	// Dropping below it reverses the pair
+	h.trader.Market().SetPrice(decimal.NewFromFloat(150))
+	reversal := h.placed()
+	reversal.Fill(decimal.NewFromFloat(100))
+
+	dao := h.finish(pair)
+	if dao.Status != Reversed {
+		t.Errorf("expected pair to be %s, got %s", Reversed, dao.Status)
+	}
+
+	kinds := map[EventKind]bool{}
+	for len(kinds) < 2 {
+		select {
+		case event := <-events:
+			kinds[event.Kind] = true
+		case <-time.After(lifecycleTimeout):
+			t.Fatalf("timed out waiting for events; got %v", kinds)
+		}
+	}
+	if !kinds[LossMitigatorTriggered] || !kinds[PairReversed] {
+		t.Errorf("expected %s and %s events, got %v", LossMitigatorTriggered, PairReversed, kinds)
+	}
+}
+
+func TestMakeRoom(t *testing.T) {
+	defer viper.Set("maxOpenPairs", viper.GetInt("maxOpenPairs"))
+	defer viper.Set("makeRoomStrategy", viper.GetString("makeRoomStrategy"))
+	viper.Set("maxOpenPairs", 4)
+	viper.Set("makeRoomStrategy", "oldest")
+
+	h := newLifecycleHarness(t)
+	h.trader.Market().SetPrice(decimal.NewFromFloat(150))
+
+	pairs := []*OrderPair{}
+	for i := 0; i < 3; i++ {
+		pair := h.upwardPair()
+		h.execute(pair)
+		pairs = append(pairs, pair)
+
+		// Space the pairs out so the oldest is clear
+		<-h.clock.After(time.Minute)
+	}
+
+	err := h.svc.MakeRoom(decimal.NewFromFloat(100), Upward)
+	if err != nil {
+		t.Fatalf("could not make room: %s", err)
+	}
+
+	// One slot is held back so the two oldest make way for the new pair
+	for i, pair := range pairs[:2] {
+		dao := h.finish(pair)
+		if dao.Status != Canceled {
+			t.Errorf("expected pair %d to be %s, got %s", i, Canceled, dao.Status)
+		}
+	}
+	if pairs[2].Status() != Open {
+		t.Errorf("expected newest pair to stay %s, got %s", Open, pairs[2].Status())
+	}
+}
+
+func TestLifecycle_ConfiguredWaits(t *testing.T) {
+	for key, value := range map[string]interface{}{
+		"pair.consistencyWait":     2 * time.Second,
+		"pair.refreshRetries":      3,
+		"pair.refreshBackoff":      time.Second,
+		"pair.refreshBackoffCurve": "exponential",
+		"pair.maxRefreshBackoff":   3 * time.Second,
+	} {
+		defer viper.Set(key, viper.Get(key))
+		viper.Set(key, value)
+	}
+
+	h := newLifecycleHarness(t)
+	start := h.clock.Now()
+	pair := h.upwardPair()
+
+	// The order never settles so every retry is used
+	first := h.execute(pair)
+	first.Close(order.Partial)
+
+	dao := h.finish(pair)
+	if dao.Status != Broken {
+		t.Errorf("expected pair to be %s, got %s", Broken, dao.Status)
+	}
+	if h.clock.Waited() != 8*time.Second {
+		t.Errorf("expected to wait 2s then 1s, 2s and 3s between refreshes, waited %s", h.clock.Waited())
+	}
+	if !dao.CreatedAt.Equal(start) || !dao.EndedAt.Equal(start.Add(8*time.Second)) {
+		t.Errorf("expected pair to run from %s to %s on the clock, ran from %s to %s", start, start.Add(8*time.Second), dao.CreatedAt, dao.EndedAt)
+	}
+}
+
+func TestLifecycle_SimulatedReversal(t *testing.T) {
+	db, err := sql.Open("memdb", uuid.NewV4().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// The simulated exchange fills the market reversal itself
+	stop := make(chan bool)
+	defer close(stop)
+	market := btcUSD()
+	market.PriceIncrement = decimal.NewFromFloat(0.01)
+	provider := simulated.New(stop, simulated.Config{
+		Market:   market,
+		Fees:     types.FeesDTO{MakerRate: decimal.NewFromFloat(0.001), TakerRate: decimal.NewFromFloat(0.002)},
+		Balances: map[string]decimal.Decimal{"USD": decimal.NewFromInt(1000), "BTC": decimal.NewFromInt(10)},
+		Price:    decimal.NewFromInt(100),
+		Seed:     1,
+	})
+	trader := currencytrader.New(provider)
+	trader.Start()
+	defer trader.Stop()
+
+	btc, err := trader.AccountSvc().Currency("BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usd, err := trader.AccountSvc().Currency("USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mkt, err := trader.MarketSvc().Market(btc, usd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := NewService(db, trader, mkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.SetClock(fake_types.NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)))
+	h := &lifecycleHarness{t: t, db: db, svc: svc}
+
+	// Buy 1 at 99 and sell 0.99 at 110
+	first := order.NewRequest(mkt, order.Limit, order.Buy, decimal.NewFromInt(1), decimal.NewFromInt(99), decimal.Zero, false)
+	second := order.NewRequest(mkt, order.Limit, order.Sell, decimal.NewFromFloat(0.99), decimal.NewFromInt(110), decimal.Zero, false)
+	pair, err := svc.New(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pair.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the buy and give up on the sell once it's placed
+	provider.SetPrice(decimal.NewFromFloat(98.5))
+	deadline := time.Now().Add(lifecycleTimeout)
+	for pair.SecondOrder() == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the second order; status is %s", pair.Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	err = pair.Cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dao := h.finish(pair)
+	if dao.Status != Reversed {
+		t.Fatalf("expected pair to be %s, got %s with %q", Reversed, dao.Status, dao.StatusDetails)
+	}
+	reversal := dao.ReversalOrder
+	if reversal.Status != order.Filled || reversal.Request.Type != order.Market || reversal.Request.Side != order.Sell {
+		t.Errorf("expected a filled market sell, got %s %s %s", reversal.Status, reversal.Request.Type, reversal.Request.Side)
+	}
+
+	// The sell raises the 99.10 the buy paid at the bid, less the taker fee
+	if !reversal.Request.Price.Equal(decimal.NewFromFloat(98.5)) || !reversal.Filled.Equal(decimal.NewFromFloat(1.00812182)) {
+		t.Errorf("expected to sell 1.00812182 at 98.5, got %s at %s", reversal.Filled, reversal.Request.Price)
+	}
+	if !reversal.Fees.Equal(decimal.NewFromFloat(0.2)) || !reversal.Paid.Equal(reversal.Filled.Mul(reversal.Request.Price).Add(reversal.Fees)) {
+		t.Errorf("expected the taker fee of 0.2 to be paid on top of the sale, got %s and %s", reversal.Fees, reversal.Paid)
+	}
+}
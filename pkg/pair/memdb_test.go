@@ -0,0 +1,199 @@
+package pair
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memDB is just enough of a database/sql driver to save, load and reconcile order pairs, multi-leg pairs, the grid and the rebalancer without postgres. Each
+// data source name gets its own tables.
+type memDB struct {
+	mutex  sync.Mutex
+	tables map[string]*memTable
+}
+
+type memTable struct {
+	mutex sync.Mutex
+	rows  map[string][]byte
+	grid  []byte
+
+	multiLegPairs map[string][]byte
+
+	rebalancer []byte
+}
+
+var testDB = &memDB{tables: map[string]*memTable{}}
+
+func init() {
+	sql.Register("memdb", testDB)
+}
+
+func (d *memDB) Open(name string) (driver.Conn, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	table, ok := d.tables[name]
+	if !ok {
+		table = &memTable{rows: map[string][]byte{}, multiLegPairs: map[string][]byte{}}
+		d.tables[name] = table
+	}
+	return &memConn{table}, nil
+}
+
+type memConn struct{ table *memTable }
+
+func (c *memConn) Prepare(query string) (driver.Stmt, error) { return &memStmt{c.table, query}, nil }
+
+func (c *memConn) Close() error { return nil }
+
+func (c *memConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("memdb does not support transactions")
+}
+
+type memStmt struct {
+	table *memTable
+	query string
+}
+
+func (s *memStmt) Close() error { return nil }
+
+func (s *memStmt) NumInput() int { return -1 }
+
+func (s *memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.table.mutex.Lock()
+	defer s.table.mutex.Unlock()
+
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+	case strings.HasPrefix(s.query, "INSERT INTO orderpairs"):
+		data := append([]byte{}, args[1].([]byte)...)
+		s.table.rows[args[0].(string)] = data
+	case strings.HasPrefix(s.query, "INSERT INTO multilegpairs"):
+		s.table.multiLegPairs[args[0].(string)] = append([]byte{}, args[1].([]byte)...)
+	case strings.HasPrefix(s.query, "INSERT INTO grid"):
+		s.table.grid = append([]byte{}, args[0].([]byte)...)
+	case strings.HasPrefix(s.query, "INSERT INTO rebalancer"):
+		s.table.rebalancer = append([]byte{}, args[0].([]byte)...)
+	default:
+		return nil, fmt.Errorf("memdb does not support %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.table.mutex.Lock()
+	defer s.table.mutex.Unlock()
+
+	rows := &memRows{}
+	switch {
+	case strings.HasPrefix(s.query, "SELECT data FROM orderpairs WHERE uuid = $1"):
+		if data, ok := s.table.rows[args[0].(string)]; ok {
+			rows.data = append(rows.data, data)
+		}
+	case strings.HasPrefix(s.query, "SELECT data FROM multilegpairs WHERE uuid = $1"):
+		if data, ok := s.table.multiLegPairs[args[0].(string)]; ok {
+			rows.data = append(rows.data, data)
+		}
+	case strings.HasPrefix(s.query, "SELECT data FROM multilegpairs WHERE data->>'status' = 'OPEN'"):
+		daos := []MultiLegPairDAO{}
+		for _, data := range s.table.multiLegPairs {
+			dao := MultiLegPairDAO{}
+			err := json.Unmarshal(data, &dao)
+			if err != nil {
+				return nil, err
+			}
+			if dao.Status == Open {
+				daos = append(daos, dao)
+			}
+		}
+		sort.Slice(daos, func(i, j int) bool { return daos[i].CreatedAt.Before(daos[j].CreatedAt) })
+		for _, dao := range daos {
+			rows.data = append(rows.data, s.table.multiLegPairs[dao.Uuid])
+		}
+	case strings.HasPrefix(s.query, "SELECT data FROM grid WHERE id = 1"):
+		if s.table.grid != nil {
+			rows.data = append(rows.data, s.table.grid)
+		}
+	case strings.HasPrefix(s.query, "SELECT data FROM rebalancer WHERE id = 1"):
+		if s.table.rebalancer != nil {
+			rows.data = append(rows.data, s.table.rebalancer)
+		}
+	case strings.HasPrefix(s.query, "SELECT data FROM orderpairs WHERE data->>'status' IN ('NEW', 'OPEN') OR data->>'done' = 'false'"):
+		daos := []OrderPairDAO{}
+		for _, data := range s.table.rows {
+			dao := OrderPairDAO{}
+			err := json.Unmarshal(data, &dao)
+			if err != nil {
+				return nil, err
+			}
+			if dao.Status == New || dao.Status == Open || !dao.Done {
+				daos = append(daos, dao)
+			}
+		}
+		sort.Slice(daos, func(i, j int) bool { return daos[i].CreatedAt.Before(daos[j].CreatedAt) })
+		for _, dao := range daos {
+			rows.data = append(rows.data, s.table.rows[dao.Uuid])
+		}
+	case strings.HasPrefix(s.query, "SELECT uuid FROM orderpairs"):
+		for id, data := range s.table.rows {
+			dao := OrderPairDAO{}
+			err := json.Unmarshal(data, &dao)
+			if err != nil {
+				return nil, err
+			}
+			if dao.FirstOrder.ID == args[0] || dao.SecondOrder.ID == args[0] || dao.ReversalOrder.ID == args[0] {
+				rows.data = append(rows.data, []byte(id))
+				break
+			}
+		}
+	case strings.HasPrefix(s.query, "SELECT data FROM orderpairs WHERE data->>'status' = 'OPEN'"):
+		daos := []OrderPairDAO{}
+		for _, data := range s.table.rows {
+			dao := OrderPairDAO{}
+			err := json.Unmarshal(data, &dao)
+			if err != nil {
+				return nil, err
+			}
+			if dao.Status == Open {
+				daos = append(daos, dao)
+			}
+		}
+		sort.Slice(daos, func(i, j int) bool { return daos[i].CreatedAt.Before(daos[j].CreatedAt) })
+		for _, dao := range daos {
+			rows.data = append(rows.data, s.table.rows[dao.Uuid])
+		}
+	default:
+		return nil, fmt.Errorf("memdb does not support %q", s.query)
+	}
+	return rows, nil
+}
+
+type memRows struct {
+	data [][]byte
+	next int
+}
+
+func (r *memRows) Columns() []string { return []string{"data"} }
+
+func (r *memRows) Close() error { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.data) {
+		return io.EOF
+	}
+	dest[0] = r.data[r.next]
+	r.next++
+	return nil
+}
+
+// savedPair loads what was last saved for the pair
+func savedPair(db *sql.DB, id string) (dao OrderPairDAO, err error) {
+	err = db.QueryRow("SELECT data FROM orderpairs WHERE uuid = $1;", id).Scan(&dao)
+	return
+}
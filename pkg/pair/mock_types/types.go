@@ -94,6 +94,20 @@ func (mr *MockMarketMockRecorder) Candles(arg0, arg1, arg2 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Candles", reflect.TypeOf((*MockMarket)(nil).Candles), arg0, arg1, arg2)
 }
 
+// MaxFunds mocks base method
+func (m *MockMarket) MaxFunds() decimal.Decimal {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MaxFunds")
+	ret0, _ := ret[0].(decimal.Decimal)
+	return ret0
+}
+
+// MaxFunds indicates an expected call of MaxFunds
+func (mr *MockMarketMockRecorder) MaxFunds() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MaxFunds", reflect.TypeOf((*MockMarket)(nil).MaxFunds))
+}
+
 // MaxPrice mocks base method
 func (m *MockMarket) MaxPrice() decimal.Decimal {
 	m.ctrl.T.Helper()
@@ -122,6 +136,20 @@ func (mr *MockMarketMockRecorder) MaxQuantity() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MaxQuantity", reflect.TypeOf((*MockMarket)(nil).MaxQuantity))
 }
 
+// MinFunds mocks base method
+func (m *MockMarket) MinFunds() decimal.Decimal {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MinFunds")
+	ret0, _ := ret[0].(decimal.Decimal)
+	return ret0
+}
+
+// MinFunds indicates an expected call of MinFunds
+func (mr *MockMarketMockRecorder) MinFunds() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MinFunds", reflect.TypeOf((*MockMarket)(nil).MinFunds))
+}
+
 // MinPrice mocks base method
 func (m *MockMarket) MinPrice() decimal.Decimal {
 	m.ctrl.T.Helper()
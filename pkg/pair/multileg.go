@@ -0,0 +1,718 @@
+package pair
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	uuid "github.com/satori/go.uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/spf13/viper"
+)
+
+// MultiLegPair is a pair whose orders can each be on a different market, like a loop that buys BTC with USD, ETH with
+// the BTC and sells the ETH back for USD. The legs are placed one at a time, each once the one before it has filled.
+// If the loop can't be finished, every leg that filled is unwound with a market order, newest first.
+type MultiLegPair struct {
+	svc *Service
+
+	mtx      sync.RWMutex
+	runner   sync.Once
+	ready    chan bool
+	execErr  error
+	canceled bool
+
+	uuid          uuid.UUID
+	createdAt     time.Time
+	endedAt       time.Time
+	done          chan bool
+	status        Status
+	statusDetails string
+
+	legs []*pairLeg
+}
+
+// pairLeg is one of the orders of a multi-leg pair along with the order that unwinds it
+type pairLeg struct {
+	request types.OrderRequest
+	order   types.Order
+
+	reversalRequest types.OrderRequest
+	reversalOrder   types.Order
+}
+
+func (p *MultiLegPair) IsDone() bool {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.isDone()
+}
+
+func (p *MultiLegPair) Done() <-chan bool {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.done
+}
+
+func (p *MultiLegPair) Status() Status {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.status
+}
+
+func (p *MultiLegPair) StatusDetails() string {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.statusDetails
+}
+
+func (p *MultiLegPair) UUID() uuid.UUID {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.uuid
+}
+
+func (p *MultiLegPair) CreatedAt() time.Time {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.createdAt
+}
+
+func (p *MultiLegPair) EndedAt() time.Time {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.endedAt
+}
+
+// Requests returns the requests of the legs in the order they're placed
+func (p *MultiLegPair) Requests() []types.OrderRequest {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	requests := []types.OrderRequest{}
+	for _, leg := range p.legs {
+		requests = append(requests, leg.request)
+	}
+	return requests
+}
+
+// Orders returns the order of each leg. Legs that haven't been placed are nil.
+func (p *MultiLegPair) Orders() []types.Order {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	orders := []types.Order{}
+	for _, leg := range p.legs {
+		orders = append(orders, leg.order)
+	}
+	return orders
+}
+
+// ReversalOrders returns the order that unwound each leg. Legs that haven't been unwound are nil.
+func (p *MultiLegPair) ReversalOrders() []types.Order {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	orders := []types.Order{}
+	for _, leg := range p.legs {
+		orders = append(orders, leg.reversalOrder)
+	}
+	return orders
+}
+
+// ExpectedReturns returns how much of each currency the loop gains (positive) or spends (negative) after fees if
+// every leg fills
+func (p *MultiLegPair) ExpectedReturns() (map[string]decimal.Decimal, error) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return p.expectedReturns()
+}
+
+func (p *MultiLegPair) ToDAO() MultiLegPairDAO {
+	dao := MultiLegPairDAO{
+		Uuid:          p.uuid.String(),
+		CreatedAt:     p.createdAt,
+		EndedAt:       p.endedAt,
+		Done:          p.isDone(),
+		Status:        p.status,
+		StatusDetails: p.statusDetails,
+		Legs:          []LegDAO{},
+	}
+
+	// Populate the legs with whatever has been set
+	for _, leg := range p.legs {
+		legDAO := LegDAO{Request: leg.request.ToDTO()}
+		if leg.order != nil {
+			legDAO.Order = leg.order.ToDTO()
+		}
+		if leg.reversalRequest != nil {
+			legDAO.ReversalRequest = leg.reversalRequest.ToDTO()
+		}
+		if leg.reversalOrder != nil {
+			legDAO.ReversalOrder = leg.reversalOrder.ToDTO()
+		}
+		dao.Legs = append(dao.Legs, legDAO)
+	}
+	return dao
+}
+
+func (p *MultiLegPair) Save() error {
+	p.mtx.RLock()
+	dao := p.ToDAO()
+	p.mtx.RUnlock()
+
+	return p.svc.SaveMultiLegPair(dao)
+}
+
+// Execute triggers the execution of the legs
+func (p *MultiLegPair) Execute() error {
+	p.mtx.RLock()
+	ready := p.ready
+	p.mtx.RUnlock()
+
+	// Only execute once
+	p.runner.Do(func() {
+		log.Infof("%s: executing multi-leg pair", p.UUID().String())
+		go p.execute()
+	})
+
+	// Wait for the first leg to be placed
+	<-ready
+
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return p.execErr
+}
+
+// Cancel cancels the open leg and stops any further legs from being placed. Whatever has filled is unwound.
+func (p *MultiLegPair) Cancel() error {
+	p.mtx.Lock()
+	p.canceled = true
+	p.mtx.Unlock()
+
+	for i, ord := range p.Orders() {
+		if ord == nil || ord.IsDone() {
+			continue
+		}
+		log.Infof("%s: canceling leg %d", p.UUID().String(), i+1)
+		err := p.svc.trader.OrderSvc().CancelOrder(ord)
+		if err != nil {
+			return fmt.Errorf("%s: could not cancel leg %d - %w", p.UUID().String(), i+1, err)
+		}
+		<-ord.Done()
+	}
+	return nil
+}
+
+// Reverse unwinds every leg that has filled with a market order for what it filled, newest leg first
+func (p *MultiLegPair) Reverse() (err error) {
+	log.Errorf("%s: reversing multi-leg pair", p.UUID().String())
+	p.setStatus(Reversed)
+	p.save()
+
+	for i := len(p.legs) - 1; i >= 0; i-- {
+		err = p.reverseLeg(i)
+		if err != nil {
+			log.WithError(err).Errorf("%s: could not reverse multi-leg pair", p.UUID().String())
+			p.setStatus(Broken)
+			p.setStatusDetails(err)
+			p.setEndedAt()
+			p.markAsDone()
+			p.save()
+			return
+		}
+	}
+
+	p.setEndedAt()
+	p.markAsDone()
+	p.save()
+	log.Infof("%s: multi-leg pair reversed", p.UUID().String())
+	return nil
+}
+
+// ###########################
+// ###   Private Methods   ###
+// ###########################
+
+func (p *MultiLegPair) execute() {
+	p.save()
+
+	// Place the first leg before letting Execute return
+	err := p.placeLeg(0)
+	if err != nil {
+		log.WithError(err).Errorf("%s: could not place first leg", p.UUID().String())
+		p.setStatus(Failed)
+		p.setStatusDetails(err)
+		p.setExecErr(err)
+		p.setEndedAt()
+		p.markAsDone()
+		p.markAsReady()
+		p.save()
+		return
+	}
+	p.markAsReady()
+	p.setStatus(Open)
+	p.save()
+
+	for i := range p.legs {
+		err = p.placeLeg(i)
+		if err != nil {
+			log.WithError(err).Errorf("%s: could not place leg %d", p.UUID().String(), i+1)
+			p.setStatusDetails(err)
+			p.Reverse()
+			return
+		}
+		p.save()
+
+		err = p.handleLeg(i)
+		if err == nil {
+			continue
+		}
+		log.WithError(err).Warnf("%s: error handling leg %d", p.UUID().String(), i+1)
+		if p.Status() == Reversed {
+			p.Reverse()
+			return
+		}
+		p.setEndedAt()
+		p.markAsDone()
+		p.save()
+		return
+	}
+
+	p.setStatus(Success)
+	p.setEndedAt()
+	p.markAsDone()
+	p.save()
+	log.Infof("%s: multi-leg pair complete", p.UUID().String())
+}
+
+// placeLeg places the order for the leg unless it's already been placed
+func (p *MultiLegPair) placeLeg(i int) (err error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	leg := p.legs[i]
+	if leg.order != nil {
+		return nil
+	}
+	if p.canceled {
+		return fmt.Errorf("pair was canceled before leg %d was placed", i+1)
+	}
+
+	req := leg.request
+	log.Infof("%s: placing leg %d on %s - %s %s @ %s", p.uuid.String(), i+1, req.Market().Name(), req.Side(), req.Quantity(), req.Price())
+	if i == 0 {
+		// Only the first leg opens a position; the rest trade its proceeds around the loop
+		leg.order, err = p.svc.AttemptOrder(req)
+		return
+	}
+	leg.order, err = req.Market().AttemptOrder(req)
+	return
+}
+
+// handleLeg waits for the leg to close and sets the status of the pair if it didn't fill
+func (p *MultiLegPair) handleLeg(i int) (err error) {
+	ord := p.Orders()[i]
+	<-ord.Done()
+	log.Infof("%s: leg %d complete", p.UUID().String(), i+1)
+
+	// Give the system some time to get consistent
+	p.svc.waitForConsistency()
+
+	// Refresh the order to make sure we have the fees
+	err = ord.Refresh()
+	if err != nil {
+		err = fmt.Errorf("could not refresh leg %d: %w", i+1, err)
+		p.setStatus(Broken)
+		p.setStatusDetails(err)
+		return
+	}
+
+	switch ord.Status() {
+	case order.Filled:
+		return nil
+
+	case order.Canceled:
+		return p.legCanceled(i, ord)
+
+	case order.Pending, order.Partial:
+		// The order was marked done before it finished updating so poll it for a while
+		for retry := 1; retry <= viper.GetInt("pair.refreshRetries"); retry++ {
+			<-p.svc.Clock().After(refreshBackoff(retry))
+			ord.Refresh()
+			if ord.Status() == order.Filled {
+				return nil
+			}
+			if ord.Status() == order.Canceled {
+				return p.legCanceled(i, ord)
+			}
+		}
+	}
+
+	err = fmt.Errorf("leg %d returned unexpectedly with status %s", i+1, ord.Status())
+	p.setStatus(Broken)
+	p.setStatusDetails(err)
+	return
+}
+
+// legCanceled cancels the pair when nothing has filled yet and reverses it otherwise
+func (p *MultiLegPair) legCanceled(i int, ord types.Order) error {
+	err := fmt.Errorf("leg %d was canceled", i+1)
+	if i == 0 && !ord.Filled().IsPositive() {
+		p.setStatus(Canceled)
+	} else {
+		err = fmt.Errorf("%w. setting status to %s and reversing", err, Reversed)
+		p.setStatus(Reversed)
+	}
+	p.setStatusDetails(err)
+	return err
+}
+
+// reverseLeg places a market order for the opposite side of what the leg filled and waits for it to fill
+func (p *MultiLegPair) reverseLeg(i int) error {
+	p.mtx.Lock()
+	leg := p.legs[i]
+	if leg.order == nil || !leg.order.Filled().IsPositive() {
+		p.mtx.Unlock()
+		return nil
+	}
+
+	if leg.reversalOrder == nil {
+		side := order.Sell
+		if leg.request.Side() == order.Sell {
+			side = order.Buy
+		}
+		market := leg.request.Market()
+		req := order.NewRequest(market, order.Market, side, leg.order.Filled(), decimal.Zero, decimal.Zero, false)
+		log.Infof("%s: placing reversal of leg %d on %s - %s %s", p.uuid.String(), i+1, market.Name(), side, req.Quantity())
+		ord, err := market.AttemptOrder(req)
+		if err != nil {
+			p.mtx.Unlock()
+			return fmt.Errorf("could not reverse leg %d: %w", i+1, err)
+		}
+		leg.reversalRequest, leg.reversalOrder = req, ord
+	}
+	ord := leg.reversalOrder
+	p.mtx.Unlock()
+	p.save()
+
+	// Wait for the reversal to fill and load its fees
+	<-ord.Done()
+	p.svc.waitForConsistency()
+	ord.Refresh()
+	if ord.Status() != order.Filled {
+		return fmt.Errorf("reversal of leg %d ended with status %s", i+1, ord.Status())
+	}
+	return nil
+}
+
+// expectedReturns nets out what each leg buys and sells if it fills. Fees are charged in the quote currency of each
+// leg's market at that market's rates, the maker rate for post only orders and the taker rate otherwise.
+func (p *MultiLegPair) expectedReturns() (map[string]decimal.Decimal, error) {
+	returns := map[string]decimal.Decimal{}
+	for _, leg := range p.legs {
+		req := leg.request
+		base, quote := req.Market().BaseCurrency().Symbol(), req.Market().QuoteCurrency().Symbol()
+
+		rates, err := getMarketFees(p.svc.trader, req.Market())
+		if err != nil {
+			return nil, fmt.Errorf("could not load fees of %s: %w", req.Market().Name(), err)
+		}
+
+		rate := rates.TakerRate()
+		if req.ForceMaker() {
+			rate = rates.MakerRate()
+		}
+		value := req.Quantity().Mul(req.Price())
+		fee := value.Mul(rate)
+
+		if req.Side() == order.Buy {
+			returns[base] = returns[base].Add(req.Quantity())
+			returns[quote] = returns[quote].Sub(value).Sub(fee)
+		} else {
+			returns[base] = returns[base].Sub(req.Quantity())
+			returns[quote] = returns[quote].Add(value).Sub(fee)
+		}
+	}
+	return returns, nil
+}
+
+// validate makes sure every leg fits its market and that the loop doesn't lose any currency after fees
+func (p *MultiLegPair) validate() error {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	if len(p.legs) < 2 {
+		return fmt.Errorf("a multi-leg pair needs at least two legs, got %d", len(p.legs))
+	}
+
+	for i, leg := range p.legs {
+		req := leg.request
+		if req.Type() != order.Limit || !req.Price().IsPositive() || !req.Quantity().IsPositive() {
+			return fmt.Errorf("leg %d must be a limit order with a price and quantity", i+1)
+		}
+		rules := RulesFromMarket(req.Market())
+		err := rules.checkQuantity(req.Quantity())
+		if err == nil {
+			err = rules.checkPrice(req.Price())
+		}
+		if err != nil {
+			return fmt.Errorf("leg %d on %s: %w", i+1, req.Market().Name(), err)
+		}
+	}
+
+	returns, err := p.expectedReturns()
+	if err != nil {
+		return err
+	}
+
+	symbols := []string{}
+	for symbol := range returns {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	gains := false
+	for _, symbol := range symbols {
+		if returns[symbol].IsNegative() {
+			return fmt.Errorf("losing %s %s after fees, %w", returns[symbol].Neg(), symbol, &LosingPropositionError{})
+		}
+		if returns[symbol].IsPositive() {
+			gains = true
+		}
+	}
+	if !gains {
+		return fmt.Errorf("not making more of any currency after fees, %w", &LosingPropositionError{})
+	}
+	return nil
+}
+
+func (p *MultiLegPair) save() {
+	err := p.Save()
+	if err != nil {
+		log.WithError(err).Errorf("%s: could not save the multi-leg pair", p.UUID().String())
+	}
+}
+
+func (p *MultiLegPair) isDone() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *MultiLegPair) markAsDone() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if !p.isDone() {
+		close(p.done)
+	}
+}
+
+func (p *MultiLegPair) markAsReady() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	select {
+	case <-p.ready:
+	default:
+		close(p.ready)
+	}
+}
+
+func (p *MultiLegPair) setStatus(status Status) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.status = status
+}
+
+func (p *MultiLegPair) setStatusDetails(err error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.statusDetails = err.Error()
+}
+
+func (p *MultiLegPair) setEndedAt() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.endedAt = p.svc.Clock().Now()
+}
+
+func (p *MultiLegPair) setExecErr(err error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.execErr = err
+}
+
+// NewMultiLegPair builds a pair out of the requests, placed in the order given. The requests can be on any of the
+// trader's markets. Nothing in the server places multi-leg pairs yet; it only picks up the open ones at startup.
+func (svc *Service) NewMultiLegPair(requests ...types.OrderRequest) (*MultiLegPair, error) {
+	p := &MultiLegPair{
+		svc:       svc,
+		uuid:      uuid.NewV4(),
+		ready:     make(chan bool),
+		done:      make(chan bool),
+		createdAt: svc.Clock().Now(),
+		status:    New,
+	}
+	for _, req := range requests {
+		p.legs = append(p.legs, &pairLeg{request: req})
+	}
+
+	err := p.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	svc.mutex.Lock()
+	svc.multiLegPairs[p.uuid] = p
+	svc.mutex.Unlock()
+	return p, nil
+}
+
+// NewMultiLegPairFromDAO builds the pair from the DAO, loading its orders from the exchange
+func (svc *Service) NewMultiLegPairFromDAO(dao MultiLegPairDAO) (*MultiLegPair, error) {
+	id, err := uuid.FromString(dao.Uuid)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse multi-leg pair ID: %w", err)
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	// The live pair is more up to date than the database
+	if p, ok := svc.multiLegPairs[id]; ok {
+		return p, nil
+	}
+
+	done := make(chan bool)
+	if dao.Done {
+		close(done)
+	}
+	p := &MultiLegPair{
+		svc:           svc,
+		uuid:          id,
+		ready:         make(chan bool),
+		done:          done,
+		createdAt:     dao.CreatedAt,
+		endedAt:       dao.EndedAt,
+		status:        dao.Status,
+		statusDetails: dao.StatusDetails,
+	}
+	for i, legDAO := range dao.Legs {
+		market, err := svc.marketFromDTO(legDAO.Request.Market)
+		if err != nil {
+			return nil, fmt.Errorf("could not load market for leg %d: %w", i+1, err)
+		}
+		leg := &pairLeg{request: order.NewRequestFromDTO(market, legDAO.Request)}
+		leg.order, err = svc.loadOrder(market, legDAO.Order)
+		if err != nil {
+			return nil, fmt.Errorf("could not load leg %d: %w", i+1, err)
+		}
+		leg.reversalOrder, err = svc.loadOrder(market, legDAO.ReversalOrder)
+		if err != nil {
+			return nil, fmt.Errorf("could not load reversal of leg %d: %w", i+1, err)
+		}
+		if leg.reversalOrder != nil {
+			leg.reversalRequest = order.NewRequestFromDTO(market, legDAO.ReversalRequest)
+		}
+		p.legs = append(p.legs, leg)
+	}
+
+	svc.multiLegPairs[id] = p
+	return p, nil
+}
+
+func (svc *Service) SaveMultiLegPair(dao MultiLegPairDAO) (err error) {
+	log.WithField("dao", dao).Debug("saving multi-leg pair")
+	_, err = svc.db.Exec("INSERT INTO multilegpairs (uuid, data) VALUES ($1, $2) ON CONFLICT (uuid) DO UPDATE SET data = $2;", dao.Uuid, dao)
+	if err != nil {
+		err = fmt.Errorf("could not insert into database: %w", err)
+	}
+	return
+}
+
+func (svc *Service) LoadMultiLegPair(id string) (*MultiLegPair, error) {
+	dao := MultiLegPairDAO{}
+	err := svc.db.QueryRow("SELECT data FROM multilegpairs WHERE uuid = $1;", id).Scan(&dao)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("multi-leg pair %s was not found in the database", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load multi-leg pair from database: %w", err)
+	}
+	return svc.NewMultiLegPairFromDAO(dao)
+}
+
+// LoadOpenMultiLegPairs loads the multi-leg pairs that are still open. Pairs that can't be loaded are marked as broken.
+func (svc *Service) LoadOpenMultiLegPairs() (pairs []*MultiLegPair, err error) {
+	pairs = []*MultiLegPair{}
+	rows, err := svc.db.Query("SELECT data FROM multilegpairs WHERE data->>'status' = 'OPEN' ORDER BY data->>'createdAt'")
+	if err != nil {
+		return nil, fmt.Errorf("could not load open multi-leg pairs from database: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		dao := MultiLegPairDAO{}
+		err = rows.Scan(&dao)
+		if err != nil {
+			return nil, fmt.Errorf("could not load open multi-leg pair from database: %w", err)
+		}
+
+		p, err := svc.NewMultiLegPairFromDAO(dao)
+		if err != nil {
+			log.WithError(err).Warnf("could not load open multi-leg pair %s; marking as broken", dao.Uuid)
+			dao.StatusDetails = err.Error()
+			dao.Status = Broken
+			svc.SaveMultiLegPair(dao)
+			continue
+		}
+		pairs = append(pairs, p)
+	}
+	return
+}
+
+// marketFromDTO finds the trader's market for the currencies of the DTO
+func (svc *Service) marketFromDTO(dto types.MarketDTO) (types.Market, error) {
+	if dto.Name == svc.market.Name() {
+		return svc.market, nil
+	}
+	base, err := svc.trader.AccountSvc().Currency(dto.BaseCurrency.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	quote, err := svc.trader.AccountSvc().Currency(dto.QuoteCurrency.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	return svc.trader.MarketSvc().Market(base, quote)
+}
+
+// loadOrder loads the order from the exchange unless it was never placed or was canceled
+func (svc *Service) loadOrder(market types.Market, dto types.OrderDTO) (types.Order, error) {
+	if dto.ID == "" {
+		return nil, nil
+	}
+	if dto.Status == order.Canceled {
+		return svc.trader.OrderSvc().OrderFromDTO(dto), nil
+	}
+	return svc.trader.OrderSvc().Order(market, dto.ID)
+}
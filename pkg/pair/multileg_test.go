@@ -0,0 +1,375 @@
+package pair
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair/fake_types"
+	"github.com/spf13/viper"
+)
+
+// loopHarness adds the ETH markets to the lifecycle harness so a loop can go from USD to BTC to ETH and back to USD
+type loopHarness struct {
+	*lifecycleHarness
+	ethBTC *fake_types.Market
+	ethUSD *fake_types.Market
+}
+
+func newLoopHarness(t *testing.T) *loopHarness {
+	return withLoopMarkets(newLifecycleHarness(t))
+}
+
+// withLoopMarkets adds the ETH markets to the harness
+func withLoopMarkets(h *lifecycleHarness) *loopHarness {
+	eth := types.CurrencyDTO{Name: "Ether", Symbol: "ETH", Precision: 8}
+	ethBTC := h.trader.AddMarket(types.MarketDTO{
+		Name:          "ETH-BTC",
+		BaseCurrency:  eth,
+		QuoteCurrency: btcUSD().BaseCurrency,
+		MinQuantity:   decimal.NewFromFloat(0.01),
+	})
+	ethUSD := h.trader.AddMarket(types.MarketDTO{
+		Name:          "ETH-USD",
+		BaseCurrency:  eth,
+		QuoteCurrency: btcUSD().QuoteCurrency,
+		MinQuantity:   decimal.NewFromFloat(0.01),
+	})
+	return &loopHarness{h, ethBTC, ethUSD}
+}
+
+func limitRequest(market types.Market, side types.OrderSide, quantity float64, price float64) types.OrderRequest {
+	return order.NewRequest(market, order.Limit, side, decimal.NewFromFloat(quantity), decimal.NewFromFloat(price), decimal.Zero, false)
+}
+
+// loop buys 1 BTC at 100 USD, buys 9.9 ETH at 0.1 BTC and sells the ETH at the price given in USD
+func (h *loopHarness) loop(ethPrice float64) []types.OrderRequest {
+	return []types.OrderRequest{
+		limitRequest(h.trader.Market(), order.Buy, 1, 100),
+		limitRequest(h.ethBTC, order.Buy, 9.9, 0.1),
+		limitRequest(h.ethUSD, order.Sell, 9.9, ethPrice),
+	}
+}
+
+func (h *loopHarness) newLoop(ethPrice float64) *MultiLegPair {
+	h.t.Helper()
+	p, err := h.svc.NewMultiLegPair(h.loop(ethPrice)...)
+	if err != nil {
+		h.t.Fatalf("could not create multi-leg pair: %s", err)
+	}
+	return p
+}
+
+// finishLoop waits for the pair to be done and returns what was saved for it
+func (h *loopHarness) finishLoop(p *MultiLegPair) MultiLegPairDAO {
+	h.t.Helper()
+	select {
+	case <-p.Done():
+	case <-time.After(lifecycleTimeout):
+		h.t.Fatalf("timed out waiting for the multi-leg pair to finish; status is %s", p.Status())
+	}
+
+	deadline := time.Now().Add(lifecycleTimeout)
+	for {
+		dao := MultiLegPairDAO{}
+		err := h.db.QueryRow("SELECT data FROM multilegpairs WHERE uuid = $1;", p.UUID().String()).Scan(&dao)
+		if err != nil {
+			h.t.Fatalf("could not load saved multi-leg pair: %s", err)
+		}
+		if dao.Done && !dao.EndedAt.IsZero() {
+			return dao
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatal("timed out waiting for the finished multi-leg pair to be saved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMultiLegPair_Validate(t *testing.T) {
+	h := newLoopHarness(t)
+	btcUSD := h.trader.Market()
+	tests := []struct {
+		scenario    string
+		requests    []types.OrderRequest
+		disableFees bool
+		valid       bool
+	}{
+		{"profitable loop", h.loop(11), false, true},
+		{"losing loop", h.loop(10), false, false},
+		{"only profitable before fees", h.loop(10.2), false, false},
+		{"fees disabled", h.loop(10.2), true, true},
+		{"single leg", h.loop(11)[:1], false, false},
+		{"leg below the market minimum", []types.OrderRequest{
+			limitRequest(btcUSD, order.Buy, 1, 100),
+			limitRequest(h.ethBTC, order.Buy, 0.001, 0.1),
+			limitRequest(h.ethUSD, order.Sell, 0.001, 11),
+		}, false, false},
+		{"market order leg", []types.OrderRequest{
+			limitRequest(btcUSD, order.Buy, 1, 100),
+			order.NewRequest(btcUSD, order.Market, order.Sell, decimal.NewFromInt(1), decimal.Zero, decimal.Zero, false),
+		}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			defer viper.Set("disableFees", viper.GetBool("disableFees"))
+			viper.Set("disableFees", tt.disableFees)
+
+			_, err := h.svc.NewMultiLegPair(tt.requests...)
+			if tt.valid && err != nil {
+				t.Errorf("expected the pair to be valid, got %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected the pair to be refused")
+			}
+		})
+	}
+}
+
+func TestMultiLegPair_ExpectedReturns(t *testing.T) {
+	h := newLoopHarness(t)
+	returns, err := h.newLoop(11).ExpectedReturns()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each leg pays its fee in the quote currency of its own market
+	expected := map[string]decimal.Decimal{
+		"USD": decimal.NewFromFloat(7.8555),
+		"BTC": decimal.NewFromFloat(0.00505),
+		"ETH": decimal.Zero,
+	}
+	for symbol, amount := range expected {
+		if !returns[symbol].Equal(amount) {
+			t.Errorf("expected to return %s %s, got %s", amount, symbol, returns[symbol])
+		}
+	}
+}
+
+func TestMultiLegPair_MarketFees(t *testing.T) {
+	h := newLoopHarness(t)
+	defer viper.Set("fees.takerRates", viper.Get("fees.takerRates"))
+
+	// Only the ETH-BTC leg is charged the market's own rate
+	viper.Set("fees.takerRates", map[string]string{"eth-btc": "0.001"})
+	returns, err := h.newLoop(11).ExpectedReturns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !returns["BTC"].Equal(decimal.NewFromFloat(0.00901)) || !returns["USD"].Equal(decimal.NewFromFloat(7.8555)) {
+		t.Errorf("expected to return 0.00901 BTC and 7.8555 USD, got %s and %s", returns["BTC"], returns["USD"])
+	}
+
+	// A loop that only pays off before fees is fine on markets that don't charge any
+	_, err = h.svc.NewMultiLegPair(h.loop(10.2)...)
+	if err == nil {
+		t.Error("expected the loop to lose at the account's rates")
+	}
+	viper.Set("fees.takerRates", map[string]string{"btc-usd": "0", "eth-btc": "0", "eth-usd": "0"})
+	_, err = h.svc.NewMultiLegPair(h.loop(10.2)...)
+	if err != nil {
+		t.Errorf("expected the loop to be valid on markets without fees, got %s", err)
+	}
+
+	viper.Set("fees.takerRates", map[string]string{"eth-btc": "cheap"})
+	if _, err = h.svc.NewMultiLegPair(h.loop(11)...); err == nil {
+		t.Error("expected a rate that can't be parsed to be refused")
+	}
+}
+
+func TestMultiLegPair_Success(t *testing.T) {
+	h := newLoopHarness(t)
+	p := h.newLoop(11)
+
+	err := p.Execute()
+	if err != nil {
+		t.Fatalf("could not execute multi-leg pair: %s", err)
+	}
+	if p.Status() != Open {
+		t.Errorf("expected pair to be %s once the first leg is placed, got %s", Open, p.Status())
+	}
+
+	// Each leg is placed on its own market once the one before it fills
+	for i, market := range []string{"BTC-USD", "ETH-BTC", "ETH-USD"} {
+		leg := h.placed()
+		if leg.Market().Name() != market || leg.Request().Market().Name() != market {
+			t.Errorf("expected leg %d on %s, got %s", i+1, market, leg.Market().Name())
+		}
+		leg.Fill(leg.Request().Quantity())
+	}
+
+	dao := h.finishLoop(p)
+	if dao.Status != Success || len(dao.Legs) != 3 {
+		t.Fatalf("expected the pair to succeed with 3 legs saved, got %s with %d", dao.Status, len(dao.Legs))
+	}
+	for i, leg := range dao.Legs {
+		if leg.Order.Status != order.Filled || leg.ReversalOrder.ID != "" {
+			t.Errorf("expected leg %d to be filled without a reversal, got %s", i+1, leg.Order.Status)
+		}
+	}
+}
+
+func TestMultiLegPair_Reversed(t *testing.T) {
+	h := newLoopHarness(t)
+	p := h.newLoop(11)
+
+	err := p.Execute()
+	if err != nil {
+		t.Fatalf("could not execute multi-leg pair: %s", err)
+	}
+	h.placed().Fill(decimal.NewFromInt(1))
+	second := h.placed()
+	second.Fill(decimal.NewFromInt(5))
+
+	// Canceling part way through the second leg unwinds both legs, newest first
+	err = p.Cancel()
+	if err != nil {
+		t.Fatalf("could not cancel multi-leg pair: %s", err)
+	}
+	for _, expected := range []struct {
+		market   string
+		side     types.OrderSide
+		quantity int64
+	}{
+		{"ETH-BTC", order.Sell, 5},
+		{"BTC-USD", order.Sell, 1},
+	} {
+		reversal := h.placed()
+		req := reversal.Request()
+		if reversal.Market().Name() != expected.market || req.Type() != order.Market || req.Side() != expected.side || !req.Quantity().Equal(decimal.NewFromInt(expected.quantity)) {
+			t.Errorf("expected a market %s of %d on %s, got %s %s %s on %s", expected.side, expected.quantity, expected.market, req.Type(), req.Side(), req.Quantity(), reversal.Market().Name())
+		}
+		reversal.Fill(req.Quantity())
+	}
+
+	dao := h.finishLoop(p)
+	if dao.Status != Reversed {
+		t.Errorf("expected the pair to be %s, got %s: %s", Reversed, dao.Status, dao.StatusDetails)
+	}
+	if dao.Legs[2].Order.ID != "" {
+		t.Error("expected the third leg to never be placed")
+	}
+	if len(h.trader.Orders()) != 4 {
+		t.Errorf("expected 2 legs and 2 reversals, got %d orders", len(h.trader.Orders()))
+	}
+}
+
+func TestMultiLegPair_Failures(t *testing.T) {
+	t.Run("first leg refused", func(t *testing.T) {
+		h := newLoopHarness(t)
+		h.trader.FailNextOrder(errors.New("insufficient funds"))
+		p := h.newLoop(11)
+
+		err := p.Execute()
+		if err == nil {
+			t.Fatal("expected the first leg to fail")
+		}
+		dao := h.finishLoop(p)
+		if dao.Status != Failed {
+			t.Errorf("expected the pair to be %s, got %s", Failed, dao.Status)
+		}
+	})
+
+	t.Run("first leg canceled", func(t *testing.T) {
+		h := newLoopHarness(t)
+		p := h.newLoop(11)
+		p.Execute()
+		h.placed().Cancel()
+
+		dao := h.finishLoop(p)
+		if dao.Status != Canceled || len(h.trader.Orders()) != 1 {
+			t.Errorf("expected the pair to be %s without a reversal, got %s with %d orders", Canceled, dao.Status, len(h.trader.Orders()))
+		}
+	})
+
+	t.Run("second leg refused", func(t *testing.T) {
+		h := newLoopHarness(t)
+		p := h.newLoop(11)
+		p.Execute()
+		h.trader.FailNextOrder(errors.New("post only"))
+		h.placed().Fill(decimal.NewFromInt(1))
+
+		reversal := h.placed()
+		if reversal.Market().Name() != "BTC-USD" || reversal.Request().Side() != order.Sell {
+			t.Errorf("expected the BTC to be sold back, got %s on %s", reversal.Request().Side(), reversal.Market().Name())
+		}
+		reversal.Fill(decimal.NewFromInt(1))
+
+		dao := h.finishLoop(p)
+		if dao.Status != Reversed || dao.StatusDetails == "" {
+			t.Errorf("expected the pair to be %s with details, got %s %q", Reversed, dao.Status, dao.StatusDetails)
+		}
+	})
+
+	t.Run("reversal refused", func(t *testing.T) {
+		h := newLoopHarness(t)
+		p := h.newLoop(11)
+		p.Execute()
+		h.placed().Fill(decimal.NewFromInt(1))
+		second := h.placed()
+		second.Fill(decimal.NewFromInt(2))
+		h.trader.FailNextOrder(errors.New("market closed"))
+		second.Cancel()
+
+		dao := h.finishLoop(p)
+		if dao.Status != Broken || dao.Legs[0].ReversalOrder.ID != "" {
+			t.Errorf("expected the pair to be %s before unwinding the first leg, got %s", Broken, dao.Status)
+		}
+	})
+}
+
+func TestMultiLegPair_Resume(t *testing.T) {
+	h := newLoopHarness(t)
+	p := h.newLoop(11)
+
+	// Place the first leg as if the server went down right after
+	first, err := h.trader.Market().AttemptOrder(p.legs[0].request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-h.trader.Placed()
+	p.legs[0].order = first
+	p.status = Open
+	err = p.Save()
+	if err != nil {
+		t.Fatalf("could not save multi-leg pair: %s", err)
+	}
+
+	// A new service loads the legs with their markets and picks up where the pair left off
+	svc, err := NewService(h.db, h.trader, h.trader.Market())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.SetClock(h.clock)
+	pairs, err := svc.LoadOpenMultiLegPairs()
+	if err != nil || len(pairs) != 1 {
+		t.Fatalf("expected to load the open multi-leg pair, got %d: %v", len(pairs), err)
+	}
+	resumed := pairs[0]
+	for i, req := range resumed.Requests() {
+		if req.Market().Name() != p.legs[i].request.Market().Name() {
+			t.Errorf("expected leg %d on %s, got %s", i+1, p.legs[i].request.Market().Name(), req.Market().Name())
+		}
+	}
+
+	err = resumed.Execute()
+	if err != nil {
+		t.Fatalf("could not execute resumed pair: %s", err)
+	}
+	first.(*fake_types.Order).Fill(decimal.NewFromInt(1))
+	second := h.placed()
+	if second.Market().Name() != "ETH-BTC" {
+		t.Errorf("expected the second leg on ETH-BTC, got %s", second.Market().Name())
+	}
+	second.Fill(second.Request().Quantity())
+	h.placed().Fill(decimal.NewFromFloat(9.9))
+
+	dao := h.finishLoop(resumed)
+	if dao.Status != Success {
+		t.Errorf("expected the resumed pair to succeed, got %s", dao.Status)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	uuid "github.com/satori/go.uuid"
 	"github.com/shopspring/decimal"
 	"github.com/sinisterminister/currencytrader/types"
-	"github.com/sinisterminister/currencytrader/types/fees"
 	"github.com/sinisterminister/currencytrader/types/order"
 	"github.com/spf13/viper"
 )
@@ -282,7 +281,7 @@ func (o *OrderPair) Cancel() (err error) {
 	}
 
 	// Give the system some time to get consistent
-	<-time.Tick(time.Second * 5)
+	o.svc.waitForConsistency()
 
 	if o.ReversalOrder() != nil && !o.ReversalOrder().IsDone() {
 		log.Infof("%s: waiting on reversal order to close", o.UUID().String())
@@ -346,7 +345,7 @@ func (o *OrderPair) Reverse() (err error) {
 	log.Infof("%s: reversal order complete", o.UUID().String())
 
 	// Give the system some time to get consistent
-	<-time.Tick(time.Second * 5)
+	o.svc.waitForConsistency()
 
 	// Load the reversal fees
 	o.ReversalOrder().Refresh()
@@ -373,7 +372,7 @@ func (o *OrderPair) execute() {
 	}
 
 	// Execute first request
-	err = o.executeFirstRequest()
+	err = o.placeFirstOrder()
 	if err != nil {
 		log.WithError(err).Errorf("%s: could not execute first request", o.UUID().String())
 		o.setStatus(Failed)
@@ -391,16 +390,6 @@ func (o *OrderPair) execute() {
 		return
 	}
 
-	// Mark the pair as ready
-	o.markAsReady()
-	o.setStatus(Open)
-
-	// Save the pair
-	err = o.Save()
-	if err != nil {
-		log.WithError(err).Errorf("%s: could not save the pair", o.UUID().String())
-	}
-
 	// Handle first order
 	err = o.handleFirstOrder()
 	if err != nil {
@@ -428,9 +417,22 @@ func (o *OrderPair) execute() {
 		return
 	}
 
-	// Recalculate the second order if necessary
+	o.executeSecondLeg()
+}
+
+// executeSecondLeg places the second order once the first has filled and sees the pair through to the end
+func (o *OrderPair) executeSecondLeg() {
+	var err error
+
+	// Recalculate the second order if necessary. A fill too small to trade on its own is reversed instead.
 	if !o.FirstOrder().Filled().Equal(o.FirstRequest().Quantity()) {
-		o.recalculateSecondOrderSizeFromFilled()
+		err = o.recalculateSecondOrderSizeFromFilled()
+		if err != nil {
+			log.WithError(err).Warnf("%s: reversing the partial fill", o.UUID().String())
+			o.setStatusDetails(fmt.Errorf("%w. setting status to %s and reversing", err, Reversed))
+			o.Reverse()
+			return
+		}
 	}
 
 	// Execute second request
@@ -489,6 +491,36 @@ func (o *OrderPair) execute() {
 	}
 }
 
+// placeFirstOrder places the first order once the pair has been checked against the exposure limits. The pair is saved
+// as open before the next one is checked so the limits count it.
+func (o *OrderPair) placeFirstOrder() error {
+	o.svc.exposureMutex.Lock()
+	defer o.svc.exposureMutex.Unlock()
+
+	// Pairs being resumed already have their exposure
+	if o.FirstOrder() == nil {
+		err := o.svc.CheckExposure(o)
+		if err != nil {
+			return err
+		}
+	}
+	err := o.executeFirstRequest()
+	if err != nil {
+		return err
+	}
+
+	// Mark the pair as ready
+	o.markAsReady()
+	o.setStatus(Open)
+
+	// Save the pair
+	err = o.Save()
+	if err != nil {
+		log.WithError(err).Errorf("%s: could not save the pair", o.UUID().String())
+	}
+	return nil
+}
+
 func (o *OrderPair) executeFirstRequest() (err error) {
 	o.mtx.Lock()
 	defer o.mtx.Unlock()
@@ -540,7 +572,7 @@ func (o *OrderPair) handleFirstOrder() (err error) {
 	log.Infof("%s: first order complete", o.UUID().String())
 
 	// Give the system some time to get consistent
-	<-time.Tick(time.Second * 5)
+	o.svc.waitForConsistency()
 
 	// Refresh the order to make sure we have the fees
 	err = o.FirstOrder().Refresh()
@@ -568,12 +600,9 @@ func (o *OrderPair) handleFirstOrder() (err error) {
 	case order.Partial:
 		// Somehow the order was marked done when not fully updated or filled. We need to
 		// poll the refresh method a few times to see if it finishes or not.
-		var count time.Duration = 1
-
-		// Retry refreshes
-		for count < 10 {
+		for retry := 1; retry <= viper.GetInt("pair.refreshRetries"); retry++ {
 			// Backoff on refreshes slowly
-			<-time.Tick(time.Second * count)
+			<-o.svc.Clock().After(refreshBackoff(retry))
 			o.FirstOrder().Refresh()
 			if o.FirstOrder().Status() == order.Filled {
 				// We're good to move on
@@ -592,7 +621,6 @@ func (o *OrderPair) handleFirstOrder() (err error) {
 				o.setStatusDetails(err)
 				return
 			}
-			count++
 		}
 		fallthrough
 
@@ -612,7 +640,7 @@ func (o *OrderPair) handleSecondOrder() (err error) {
 	log.Infof("%s: second order complete", o.UUID().String())
 
 	// Give the system some time to get consistent
-	<-time.NewTicker(time.Second * 5).C
+	o.svc.waitForConsistency()
 
 	// Refresh the order to get the fees
 	err = o.SecondOrder().Refresh()
@@ -639,12 +667,9 @@ func (o *OrderPair) handleSecondOrder() (err error) {
 	case order.Partial:
 		// Somehow the order was marked done when not fully updated or filled. We need to
 		// poll the refresh method a few times to see if it finishes or not.
-		var count time.Duration = 1
-
-		// Retry refreshes
-		for count < 10 {
+		for retry := 1; retry <= viper.GetInt("pair.refreshRetries"); retry++ {
 			// Backoff on refreshes slowly
-			<-time.Tick(time.Second * count)
+			<-o.svc.Clock().After(refreshBackoff(retry))
 			o.SecondOrder().Refresh()
 			if o.SecondOrder().Status() == order.Filled {
 				// Mark pair as success
@@ -658,7 +683,6 @@ func (o *OrderPair) handleSecondOrder() (err error) {
 				o.setStatusDetails(err)
 				return
 			}
-			count++
 		}
 		fallthrough
 
@@ -672,12 +696,22 @@ func (o *OrderPair) handleSecondOrder() (err error) {
 	return
 }
 
-func (o *OrderPair) recalculateSecondOrderSizeFromFilled() {
+func (o *OrderPair) recalculateSecondOrderSizeFromFilled() error {
 	// Determine the ratio from the first to the second
 	ratio := o.SecondRequest().Quantity().Div(o.firstRequest.Quantity())
 
-	// Calculate the new size
-	size := o.FirstOrder().Filled().Mul(ratio).RoundBank(int32(o.svc.market.BaseCurrency().Precision()))
+	// Calculate the new size. Sell less or buy more when snapping so the base currency still gains.
+	rules := RulesFromMarket(o.svc.market)
+	size := o.FirstOrder().Filled().Mul(ratio)
+	if o.SecondRequest().Side() == order.Sell {
+		size = snapDown(size, rules.QuantityStep)
+	} else {
+		size = snapUp(size, rules.QuantityStep)
+	}
+	err := rules.checkQuantity(size)
+	if err != nil {
+		return fmt.Errorf("could not resize the second order to the %s filled: %w", o.FirstOrder().Filled(), err)
+	}
 
 	// Build updated DTO
 	dto := o.SecondRequest().ToDTO()
@@ -687,6 +721,13 @@ func (o *OrderPair) recalculateSecondOrderSizeFromFilled() {
 	o.mtx.Lock()
 	o.secondRequest = order.NewRequestFromDTO(o.svc.market, dto)
 	o.mtx.Unlock()
+
+	// Placing the second order still loses less than reversing so only warn about it
+	err = o.validate()
+	if err != nil {
+		log.WithError(err).Warnf("%s: resized pair is no longer profitable", o.UUID().String())
+	}
+	return nil
 }
 
 func (o *OrderPair) markAsDone() {
@@ -697,6 +738,11 @@ func (o *OrderPair) markAsDone() {
 	case <-o.done:
 	default:
 		close(o.done)
+
+		// Let the listeners know how it ended
+		if kind, ok := statusEvents[o.status]; ok && o.svc != nil {
+			o.svc.emit(kind, o, o.statusDetails)
+		}
 	}
 }
 
@@ -713,16 +759,39 @@ func (o *OrderPair) markAsReady() {
 
 func (o *OrderPair) buildReversalRequest() error {
 	var (
-		req            types.OrderRequest
-		remains, funds decimal.Decimal
+		req   types.OrderRequest
+		funds decimal.Decimal
 	)
 
 	// Get fee rates
-	rates, err := getFees(o.svc.trader)
+	rates, err := getMarketFees(o.svc.trader, o.svc.market)
 	if err != nil {
 		log.WithError(err).Warnf("%s: could not get fee rates to predict loss", o.UUID().String())
 	}
 
+	// Get how much cash remains to be filled
+	remains := o.quoteImbalance()
+
+	one := decimal.NewFromInt(1)
+	// Build the request
+	if remains.IsPositive() {
+		req = order.NewRequest(o.svc.market, order.Market, order.Buy, decimal.Zero, decimal.Zero, remains.RoundBank(int32(o.svc.market.QuoteCurrency().Precision())), false)
+	} else {
+		funds = remains.Div(one.Sub(rates.TakerRate())).RoundBank(int32(o.svc.market.QuoteCurrency().Precision()))
+		req = order.NewRequest(o.svc.market, order.Market, order.Sell, decimal.Zero, decimal.Zero, funds.Abs(), false)
+	}
+
+	// Add to pair
+	o.mtx.Lock()
+	o.reversalRequest = req
+	o.mtx.Unlock()
+
+	return nil
+}
+
+// quoteImbalance returns how much quote currency the filled orders have brought in (positive) or paid out (negative)
+// after fees
+func (o *OrderPair) quoteImbalance() (remains decimal.Decimal) {
 	// Get how much cash went out in the buy order
 	if o.BuyOrder() != nil {
 		remains = remains.Sub(o.BuyOrder().Filled().Mul(o.BuyOrder().Request().Price()))
@@ -740,23 +809,18 @@ func (o *OrderPair) buildReversalRequest() error {
 		// Capture the fees
 		remains = remains.Sub(fee)
 	}
+	return
+}
 
-	// Get how much cash remains to be filled
-	one := decimal.NewFromInt(1)
-	// Build the request
-	if remains.IsPositive() {
-		req = order.NewRequest(o.svc.market, order.Market, order.Buy, decimal.Zero, decimal.Zero, remains.RoundBank(int32(o.svc.market.QuoteCurrency().Precision())), false)
-	} else {
-		funds = remains.Div(one.Sub(rates.TakerRate())).RoundBank(int32(o.svc.market.QuoteCurrency().Precision()))
-		req = order.NewRequest(o.svc.market, order.Market, order.Sell, decimal.Zero, decimal.Zero, funds.Abs(), false)
+// baseImbalance returns how much base currency the filled orders have bought (positive) or sold (negative)
+func (o *OrderPair) baseImbalance() (remains decimal.Decimal) {
+	if o.BuyOrder() != nil {
+		remains = remains.Add(o.BuyOrder().Filled())
 	}
-
-	// Add to pair
-	o.mtx.Lock()
-	o.reversalRequest = req
-	o.mtx.Unlock()
-
-	return nil
+	if o.SellOrder() != nil {
+		remains = remains.Sub(o.SellOrder().Filled())
+	}
+	return
 }
 
 func (o *OrderPair) isDone() bool {
@@ -814,7 +878,7 @@ func (o *OrderPair) setEndedAt() {
 	o.mtx.Lock()
 	defer o.mtx.Unlock()
 
-	o.endedAt = time.Now()
+	o.endedAt = o.svc.Clock().Now()
 }
 
 func (o *OrderPair) setExecErr(err error) {
@@ -846,31 +910,15 @@ func (o *OrderPair) validate() error {
 	}
 
 	// Get the fee rates
-	rates, err := o.svc.trader.AccountSvc().Fees()
+	rates, err := getMarketFees(o.svc.trader, o.svc.market)
 	if err != nil {
 		return err
 	}
-	if viper.GetBool("disableFees") == true {
-		rates = fees.ZeroFee()
-	}
 
 	// Determin the fees
-	var baseFee, quoteFee decimal.Decimal
-	if o.direction == Upward {
-		if viper.GetBool("forceMakerOrders") {
-			baseFee = o.buyRequest().Quantity().Mul(rates.MakerRate().Mul(o.buyRequest().Price()))
-		} else {
-			baseFee = o.buyRequest().Quantity().Mul(rates.TakerRate().Mul(o.buyRequest().Price()))
-		}
-		quoteFee = o.sellRequest().Price().Mul(o.sellRequest().Quantity().Mul(rates.MakerRate()))
-	} else {
-		if viper.GetBool("forceMakerOrders") {
-			quoteFee = o.sellRequest().Price().Mul(o.sellRequest().Quantity()).Mul(rates.MakerRate())
-		} else {
-			quoteFee = o.sellRequest().Price().Mul(o.sellRequest().Quantity()).Mul(rates.TakerRate())
-		}
-		baseFee = o.buyRequest().Quantity().Mul(o.buyRequest().Price()).Mul(rates.MakerRate())
-	}
+	buyRate, sellRate := legFees(rates, o.direction)
+	baseFee := o.buyRequest().Quantity().Mul(buyRate.Mul(o.buyRequest().Price()))
+	quoteFee := o.sellRequest().Price().Mul(o.sellRequest().Quantity().Mul(sellRate))
 
 	// Make sure we're not losing currency
 	if quoteRes.LessThanOrEqual(quoteFee.Add(baseFee)) {
@@ -900,6 +948,7 @@ func (o *OrderPair) lossMitigator() {
 				// The price has dropped too much
 				if tick.Price().LessThan(bailTarget) {
 					// Cancel the pair
+					o.emitLossMitigator(tick.Price(), bailTarget)
 					o.Cancel()
 					return
 				}
@@ -910,6 +959,7 @@ func (o *OrderPair) lossMitigator() {
 				// The price has risen too much
 				if tick.Price().GreaterThan(bailTarget) {
 					// Cancel the pair
+					o.emitLossMitigator(tick.Price(), bailTarget)
 					o.Cancel()
 					return
 				}
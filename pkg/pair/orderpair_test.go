@@ -53,7 +53,7 @@ func TestValidate_HappyPath(t *testing.T) {
 			}
 			err := op.validate()
 			if err != nil {
-				t.Errorf("failed to create order pair: %w", err)
+				t.Errorf("failed to create order pair: %s", err)
 			}
 		})
 	}
@@ -0,0 +1,303 @@
+package pair
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/spf13/viper"
+)
+
+// Allocation is how the value of the portfolio splits between the base and quote currencies at a price, along with
+// the band the rebalance target keeps the base currency's share in
+type Allocation struct {
+	Price      decimal.Decimal `json:"price"`
+	BaseValue  decimal.Decimal `json:"baseValue"`
+	QuoteValue decimal.Decimal `json:"quoteValue"`
+	BaseRatio  decimal.Decimal `json:"baseRatio"`
+	Target     decimal.Decimal `json:"target"`
+	Lower      decimal.Decimal `json:"lower"`
+	Upper      decimal.Decimal `json:"upper"`
+}
+
+// Pull returns the direction of pair that moves the portfolio back into its band. Downward pairs sell the base
+// currency first and Upward pairs buy it first. It's empty while the portfolio is within its band or there's no target.
+func (a Allocation) Pull() Direction {
+	if !a.Target.IsPositive() {
+		return ""
+	}
+	switch {
+	case a.BaseRatio.GreaterThan(a.Upper):
+		return Downward
+	case a.BaseRatio.LessThan(a.Lower):
+		return Upward
+	}
+	return ""
+}
+
+// Allocation values the wallets at the price and sets the band from rebalance.target and rebalance.band
+func (svc *Service) Allocation(price decimal.Decimal) (Allocation, error) {
+	if !price.IsPositive() {
+		return Allocation{}, fmt.Errorf("cannot value the portfolio at a price of %s", price)
+	}
+
+	a := Allocation{
+		Price:      price,
+		BaseValue:  svc.market.BaseCurrency().Wallet().Total().Mul(price),
+		QuoteValue: svc.market.QuoteCurrency().Wallet().Total(),
+	}
+	if total := a.BaseValue.Add(a.QuoteValue); total.IsPositive() {
+		a.BaseRatio = a.BaseValue.Div(total)
+	}
+
+	target := decimal.NewFromFloat(viper.GetFloat64("rebalance.target"))
+	if !target.IsPositive() {
+		return a, nil
+	}
+	if target.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		return Allocation{}, fmt.Errorf("rebalance target of %s must be below 1", target)
+	}
+	band := decimal.NewFromFloat(viper.GetFloat64("rebalance.band"))
+	a.Target = target
+	a.Lower = decimal.Max(target.Sub(band), decimal.Zero)
+	a.Upper = decimal.Min(target.Add(band), decimal.NewFromInt(1))
+	return a, nil
+}
+
+// RebalanceState is what the rebalancer saves so its order can still be canceled after a restart
+type RebalanceState struct {
+	OrderID string    `json:"orderId,omitempty"`
+	LastRun time.Time `json:"lastRun"`
+	Details string    `json:"details,omitempty"`
+}
+
+func (r RebalanceState) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *RebalanceState) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &r)
+}
+
+// RebalanceGuard is asked before the rebalancer places an order. Returning an error holds off rebalancing until the
+// next pass.
+type RebalanceGuard interface {
+	Check() error
+}
+
+// Rebalancer places maker orders that bring the portfolio back to its target whenever it drifts out of its band.
+// Each pass cancels what's left of the previous order before placing a new one at the current price.
+type Rebalancer struct {
+	svc   *Service
+	guard RebalanceGuard
+
+	mutex sync.Mutex
+	state RebalanceState
+}
+
+// NewRebalancer loads the rebalancer from the database and lets reconciliation know about its order
+func NewRebalancer(svc *Service) (r *Rebalancer, err error) {
+	r = &Rebalancer{svc: svc}
+	err = r.initializeDB()
+	if err != nil {
+		return nil, err
+	}
+	err = r.load()
+	if err != nil {
+		return nil, err
+	}
+	svc.AddKnownOrders(r)
+	return
+}
+
+// KnownOrderIDs returns the rebalance order that's waiting to be canceled, if any
+func (r *Rebalancer) KnownOrderIDs() ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.state.OrderID == "" {
+		return nil, nil
+	}
+	return []string{r.state.OrderID}, nil
+}
+
+// SetGuard sets the guard asked before each order is placed
+func (r *Rebalancer) SetGuard(guard RebalanceGuard) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.guard = guard
+}
+
+// State returns a copy of the state of the rebalancer
+func (r *Rebalancer) State() RebalanceState {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.state
+}
+
+// Start rebalances every rebalance.interval until stopped. Orders are only placed when rebalance.placeOrders is set.
+func (r *Rebalancer) Start(stop <-chan bool) {
+	interval := viper.GetDuration("rebalance.interval")
+	if interval <= 0 || !viper.GetBool("rebalance.placeOrders") {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, err := r.Rebalance()
+				if err != nil {
+					log.WithError(err).Error("could not rebalance")
+				}
+			}
+		}
+	}()
+}
+
+// Rebalance cancels the previous rebalance order and places a new one if the portfolio is outside its band
+func (r *Rebalancer) Rebalance() (Allocation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Let go of the funds the last order is holding before valuing the portfolio
+	err := r.cancelOrder()
+	if err != nil {
+		return Allocation{}, err
+	}
+
+	ticker, err := r.svc.market.Ticker()
+	if err != nil {
+		return Allocation{}, fmt.Errorf("could not load ticker: %w", err)
+	}
+	a, err := r.svc.Allocation(ticker.Price())
+	if err != nil {
+		return Allocation{}, err
+	}
+	r.state.LastRun = r.svc.Clock().Now()
+	r.state.Details = ""
+
+	pull := a.Pull()
+	if pull != "" && r.guard != nil {
+		if err = r.guard.Check(); err != nil {
+			r.state.Details = err.Error()
+			pull = ""
+		}
+	}
+	if pull != "" {
+		ord, err := r.place(a, pull, ticker)
+		if err != nil {
+			log.WithError(err).Warn("could not place rebalance order")
+			r.state.Details = err.Error()
+		} else {
+			log.Noticef("base currency is %s of the portfolio; placed %s rebalance order %s", a.BaseRatio.StringFixed(4), ord.Request().Side(), ord.ID())
+			r.state.OrderID = ord.ID()
+		}
+	}
+	return a, r.save()
+}
+
+// place puts up a maker order for the difference between the portfolio and its target, capped by
+// rebalance.maxOrderNotional and what's available in the wallet
+func (r *Rebalancer) place(a Allocation, pull Direction, ticker types.Ticker) (types.Order, error) {
+	rules := RulesFromMarket(r.svc.market)
+	err := rules.checkIncrements()
+	if err != nil {
+		return nil, err
+	}
+
+	notional := a.BaseValue.Sub(a.BaseValue.Add(a.QuoteValue).Mul(a.Target)).Abs()
+	if max := decimal.NewFromFloat(viper.GetFloat64("rebalance.maxOrderNotional")); max.IsPositive() {
+		notional = decimal.Min(notional, max)
+	}
+
+	var side types.OrderSide
+	var price, quantity decimal.Decimal
+	if pull == Downward {
+		side, price = order.Sell, snapUp(ticker.Ask(), rules.PriceIncrement)
+		quantity = decimal.Min(notional.Div(price), r.svc.market.BaseCurrency().Wallet().Available())
+	} else {
+		side, price = order.Buy, snapDown(ticker.Bid(), rules.PriceIncrement)
+		quantity = decimal.Min(notional, r.svc.market.QuoteCurrency().Wallet().Available()).Div(price)
+	}
+	quantity = snapDown(quantity, rules.QuantityStep)
+	if rules.MaxQuantity.IsPositive() {
+		quantity = decimal.Min(quantity, snapDown(rules.MaxQuantity, rules.QuantityStep))
+	}
+	if !quantity.IsPositive() {
+		return nil, fmt.Errorf("nothing available to %s", side)
+	}
+	err = rules.checkQuantity(quantity)
+	if err == nil {
+		err = rules.checkPrice(price)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req := order.NewRequest(r.svc.market, order.Limit, side, quantity, price, decimal.Zero, true)
+	return r.svc.AttemptOrder(req)
+}
+
+// cancelOrder cancels the last rebalance order if it's still open. An order that can't be loaded is forgotten so it
+// doesn't hold up rebalancing; reconciliation flags it if it's still open.
+func (r *Rebalancer) cancelOrder() error {
+	if r.state.OrderID == "" {
+		return nil
+	}
+
+	ord, err := r.svc.trader.OrderSvc().Order(r.svc.market, r.state.OrderID)
+	if err != nil {
+		log.WithError(err).Warnf("could not load rebalance order %s; forgetting it", r.state.OrderID)
+		r.state.OrderID = ""
+		return nil
+	}
+	if !ord.IsDone() {
+		err = r.svc.trader.OrderSvc().CancelOrder(ord)
+		if err != nil {
+			return fmt.Errorf("could not cancel rebalance order %s: %w", r.state.OrderID, err)
+		}
+		log.Infof("canceled rebalance order %s after %s filled", r.state.OrderID, ord.Filled())
+	}
+	r.state.OrderID = ""
+	return nil
+}
+
+func (r *Rebalancer) initializeDB() error {
+	_, err := r.svc.db.Exec("CREATE TABLE IF NOT EXISTS rebalancer (id int primary key, data JSONB);")
+	return err
+}
+
+func (r *Rebalancer) load() error {
+	err := r.svc.db.QueryRow("SELECT data FROM rebalancer WHERE id = 1;").Scan(&r.state)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("could not load rebalancer from database: %w", err)
+	}
+	return nil
+}
+
+func (r *Rebalancer) save() error {
+	_, err := r.svc.db.Exec("INSERT INTO rebalancer (id, data) VALUES (1, $1) ON CONFLICT (id) DO UPDATE SET data = $1;", r.state)
+	if err != nil {
+		return fmt.Errorf("could not insert into database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package pair
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/spf13/viper"
+)
+
+// setRebalanceTarget sets the target band for the test and puts the old one back afterwards
+func setRebalanceTarget(t *testing.T, target float64, band float64) {
+	target0, band0 := viper.GetFloat64("rebalance.target"), viper.GetFloat64("rebalance.band")
+	t.Cleanup(func() {
+		viper.Set("rebalance.target", target0)
+		viper.Set("rebalance.band", band0)
+	})
+	viper.Set("rebalance.target", target)
+	viper.Set("rebalance.band", band)
+}
+
+func TestAllocation_Pull(t *testing.T) {
+	tests := []struct {
+		scenario string
+		base     int64
+		quote    int64
+		target   float64
+		pull     Direction
+	}{
+		{"heavy in base", 9, 100, 0.5, Downward},
+		{"light in base", 1, 900, 0.5, Upward},
+		{"within the band", 5, 600, 0.5, ""},
+		{"no target", 9, 100, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			h := newLifecycleHarness(t)
+			setRebalanceTarget(t, tt.target, 0.1)
+			h.trader.SetBalance("BTC", decimal.NewFromInt(tt.base))
+			h.trader.SetBalance("USD", decimal.NewFromInt(tt.quote))
+
+			a, err := h.svc.Allocation(decimal.NewFromInt(100))
+			if err != nil {
+				t.Fatalf("could not value portfolio: %s", err)
+			}
+			expected := decimal.NewFromInt(tt.base * 100).Div(decimal.NewFromInt(tt.base*100 + tt.quote))
+			if !a.BaseRatio.Equal(expected) {
+				t.Errorf("expected base to be %s of the portfolio, got %s", expected, a.BaseRatio)
+			}
+			if a.Pull() != tt.pull {
+				t.Errorf("expected to pull %q, got %q", tt.pull, a.Pull())
+			}
+		})
+	}
+}
+
+func TestBuildSpreadBasedPair_SizeBias(t *testing.T) {
+	// 100,000 of the 1,100,000 is held in base so the portfolio needs to buy
+	h := newLifecycleHarness(t)
+	h.trader.Market().SetPrice(decimal.NewFromInt(100))
+
+	tests := []struct {
+		target   float64
+		dir      Direction
+		expected decimal.Decimal
+	}{
+		{0, Downward, decimal.NewFromInt(200)},
+		{0.5, Downward, decimal.NewFromInt(100)},
+		{0.5, Upward, decimal.NewFromInt(2000)},
+	}
+
+	for _, tt := range tests {
+		setRebalanceTarget(t, tt.target, 0.1)
+		op, err := BuildSpreadBasedPair(h.svc, tt.dir)
+		if err != nil {
+			t.Fatalf("could not build pair: %s", err)
+		}
+		if !op.FirstRequest().Quantity().Equal(tt.expected) {
+			t.Errorf("expected %s pair with a target of %v to trade %s, got %s", tt.dir, tt.target, tt.expected, op.FirstRequest().Quantity())
+		}
+	}
+}
+
+func TestRebalancer_Rebalance(t *testing.T) {
+	h := newLifecycleHarness(t)
+	setRebalanceTarget(t, 0.5, 0.1)
+	h.trader.Market().SetPrice(decimal.NewFromInt(100))
+	h.trader.SetBalance("BTC", decimal.NewFromInt(9000))
+	h.trader.SetBalance("USD", decimal.NewFromInt(100000))
+
+	r, err := NewRebalancer(h.svc)
+	if err != nil {
+		t.Fatalf("could not load rebalancer: %s", err)
+	}
+
+	// 900,000 of the 1,000,000 is held in base so 400,000 worth is sold
+	_, err = r.Rebalance()
+	if err != nil {
+		t.Fatalf("could not rebalance: %s", err)
+	}
+	first := h.placed()
+	req := first.Request()
+	if req.Side() != order.Sell || !req.Quantity().Equal(decimal.NewFromInt(4000)) || !req.Price().Equal(decimal.NewFromInt(100)) || !req.ForceMaker() {
+		t.Errorf("expected a maker sell of 4000 at 100, got %s %s at %s", req.Side(), req.Quantity(), req.Price())
+	}
+	if r.State().OrderID != first.ID() {
+		t.Errorf("expected the rebalancer to track order %s, got %q", first.ID(), r.State().OrderID)
+	}
+
+	// The next pass replaces the unfilled order
+	first.Fill(decimal.NewFromInt(1000))
+	h.trader.SetBalance("BTC", decimal.NewFromInt(8000))
+	h.trader.SetBalance("USD", decimal.NewFromInt(200000))
+	_, err = r.Rebalance()
+	if err != nil {
+		t.Fatalf("could not rebalance: %s", err)
+	}
+	if first.Status() != order.Canceled {
+		t.Errorf("expected the unfilled order to be canceled, got %s", first.Status())
+	}
+	second := h.placed()
+	if !second.Request().Quantity().Equal(decimal.NewFromInt(3000)) {
+		t.Errorf("expected to sell the 3000 left, got %s", second.Request().Quantity())
+	}
+
+	// Picks the order back up after a restart and leaves the portfolio be once it's within the band
+	restarted, err := NewRebalancer(h.svc)
+	if err != nil {
+		t.Fatalf("could not load rebalancer: %s", err)
+	}
+	second.Fill(decimal.NewFromInt(3000))
+	h.trader.SetBalance("BTC", decimal.NewFromInt(5000))
+	h.trader.SetBalance("USD", decimal.NewFromInt(500000))
+	a, err := restarted.Rebalance()
+	if err != nil {
+		t.Fatalf("could not rebalance: %s", err)
+	}
+	if a.Pull() != "" || len(h.trader.Orders()) != 2 {
+		t.Errorf("expected no order within the band, got %d orders", len(h.trader.Orders()))
+	}
+	if restarted.State().OrderID != "" {
+		t.Errorf("expected the filled order to be forgotten, got %q", restarted.State().OrderID)
+	}
+}
+
+func TestRebalancer_LostOrder(t *testing.T) {
+	h := newLifecycleHarness(t)
+	setRebalanceTarget(t, 0.5, 0.1)
+	h.trader.Market().SetPrice(decimal.NewFromInt(100))
+
+	// An order the exchange can't find doesn't hold up the next pass
+	r, err := NewRebalancer(h.svc)
+	if err != nil {
+		t.Fatalf("could not load rebalancer: %s", err)
+	}
+	r.state.OrderID = "lost"
+	_, err = r.Rebalance()
+	if err != nil {
+		t.Fatalf("could not rebalance: %s", err)
+	}
+	if placed := h.placed(); r.State().OrderID != placed.ID() {
+		t.Errorf("expected the rebalancer to track order %s, got %q", placed.ID(), r.State().OrderID)
+	}
+}
+
+func TestRebalancer_Reconcile(t *testing.T) {
+	h := newReconcileHarness(t)
+	setRebalanceTarget(t, 0.5, 0.1)
+	h.trader.Market().SetPrice(decimal.NewFromInt(100))
+
+	r, err := NewRebalancer(h.svc)
+	if err != nil {
+		t.Fatalf("could not load rebalancer: %s", err)
+	}
+	_, err = r.Rebalance()
+	if err != nil {
+		t.Fatalf("could not rebalance: %s", err)
+	}
+	resting := h.placed()
+
+	// The resting order belongs to the rebalancer
+	<-h.clock.After(time.Hour)
+	if orphans := issuesOfKind(h.reconcile(), OrphanedOrder); len(orphans) != 0 || resting.IsDone() {
+		t.Errorf("expected the rebalance order to be left alone, got %+v", orphans)
+	}
+}
+
+func TestRebalancer_Limits(t *testing.T) {
+	t.Run("max order notional", func(t *testing.T) {
+		h := newLifecycleHarness(t)
+		setRebalanceTarget(t, 0.5, 0.1)
+		defer viper.Set("rebalance.maxOrderNotional", viper.GetFloat64("rebalance.maxOrderNotional"))
+		viper.Set("rebalance.maxOrderNotional", 50000)
+		h.trader.Market().SetPrice(decimal.NewFromInt(100))
+
+		r, err := NewRebalancer(h.svc)
+		if err != nil {
+			t.Fatalf("could not load rebalancer: %s", err)
+		}
+		_, err = r.Rebalance()
+		if err != nil {
+			t.Fatalf("could not rebalance: %s", err)
+		}
+		req := h.placed().Request()
+		if req.Side() != order.Buy || !req.Quantity().Equal(decimal.NewFromInt(500)) {
+			t.Errorf("expected to buy 500, got %s %s", req.Side(), req.Quantity())
+		}
+	})
+
+	t.Run("halted", func(t *testing.T) {
+		h := newLifecycleHarness(t)
+		setRebalanceTarget(t, 0.5, 0.1)
+		h.trader.Market().SetPrice(decimal.NewFromInt(100))
+
+		r, err := NewRebalancer(h.svc)
+		if err != nil {
+			t.Fatalf("could not load rebalancer: %s", err)
+		}
+		r.SetGuard(haltedGuard{errors.New("trading halted")})
+		_, err = r.Rebalance()
+		if err != nil {
+			t.Fatalf("could not rebalance: %s", err)
+		}
+		if len(h.trader.Orders()) != 0 || r.State().Details != "trading halted" {
+			t.Errorf("expected no orders while halted, got %d orders and %q", len(h.trader.Orders()), r.State().Details)
+		}
+	})
+
+	t.Run("below the market minimum", func(t *testing.T) {
+		h := newLifecycleHarness(t)
+		setRebalanceTarget(t, 0.5, 0.1)
+		h.trader.Market().SetPrice(decimal.NewFromInt(100))
+		h.trader.SetBalance("BTC", decimal.Zero)
+		h.trader.SetBalance("USD", decimal.NewFromFloat(0.05))
+
+		r, err := NewRebalancer(h.svc)
+		if err != nil {
+			t.Fatalf("could not load rebalancer: %s", err)
+		}
+		_, err = r.Rebalance()
+		if err != nil {
+			t.Fatalf("could not rebalance: %s", err)
+		}
+		if len(h.trader.Orders()) != 0 || r.State().Details == "" {
+			t.Errorf("expected the order to be refused, got %d orders and %q", len(h.trader.Orders()), r.State().Details)
+		}
+	})
+}
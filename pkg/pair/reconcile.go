@@ -0,0 +1,334 @@
+package pair
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/spf13/viper"
+)
+
+// OpenOrderLister lists the IDs of the orders that are open on the exchange for a market
+type OpenOrderLister interface {
+	OpenOrderIDs(market types.Market) ([]string, error)
+}
+
+// KnownOrders lists the IDs of the exchange orders placed outside of the pairs, like scheduled buys, so reconciliation
+// doesn't take them for orphans
+type KnownOrders interface {
+	KnownOrderIDs() ([]string, error)
+}
+
+type IssueKind string
+
+var (
+	OrphanedOrder IssueKind = "ORPHANED_ORDER"
+	MissingOrder  IssueKind = "MISSING_ORDER"
+	OrderDrift    IssueKind = "ORDER_DRIFT"
+	StuckPair     IssueKind = "STUCK_PAIR"
+)
+
+// ReconcileIssue describes a difference found between the database and the exchange
+type ReconcileIssue struct {
+	PairUUID string
+	OrderID  string
+	Kind     IssueKind
+	Details  string
+	Fixed    bool
+}
+
+// ReconcileReport holds the results of a reconciliation run
+type ReconcileReport struct {
+	StartedAt    time.Time
+	EndedAt      time.Time
+	PairsChecked int
+	Issues       []ReconcileIssue
+}
+
+// SetOpenOrderLister enables the detection of orphaned exchange orders during reconciliation
+func (svc *Service) SetOpenOrderLister(lister OpenOrderLister) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	svc.lister = lister
+}
+
+// AddKnownOrders registers orders placed outside of the pairs that reconciliation should leave alone
+func (svc *Service) AddKnownOrders(known KnownOrders) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	svc.known = append(svc.known, known)
+}
+
+// StartReconciler reconciles the pairs against the exchange every reconcile.interval until stopped
+func (svc *Service) StartReconciler(stop <-chan bool) {
+	interval := viper.GetDuration("reconcile.interval")
+	if interval <= 0 {
+		log.Info("reconciler is disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				report, err := svc.Reconcile()
+				if err != nil {
+					log.WithError(err).Error("could not reconcile pairs")
+					continue
+				}
+				log.Infof("reconciled %d pairs; found %d issues", report.PairsChecked, len(report.Issues))
+			}
+		}
+	}()
+}
+
+// Reconcile compares the orders of every pair that isn't done against the exchange. Drifted fills and fees are
+// updated, pairs left open after both legs finished are resumed and exchange orders without a pair are flagged.
+func (svc *Service) Reconcile() (report ReconcileReport, err error) {
+	svc.reconcileMutex.Lock()
+	defer svc.reconcileMutex.Unlock()
+
+	report.StartedAt = svc.Clock().Now()
+	defer func() { report.EndedAt = svc.Clock().Now() }()
+
+	rows, err := svc.db.Query("SELECT data FROM orderpairs WHERE data->>'status' IN ('NEW', 'OPEN') OR data->>'done' = 'false' ORDER BY data->>'createdAt'")
+	if err != nil {
+		return report, fmt.Errorf("could not load pairs to reconcile: %w", err)
+	}
+	daos := []OrderPairDAO{}
+	for rows.Next() {
+		dao := OrderPairDAO{}
+		err = rows.Scan(&dao)
+		if err != nil {
+			rows.Close()
+			return report, fmt.Errorf("could not load pair to reconcile: %w", err)
+		}
+		daos = append(daos, dao)
+	}
+	rows.Close()
+
+	for _, dao := range daos {
+		report.PairsChecked++
+		report.Issues = append(report.Issues, svc.reconcilePair(dao)...)
+	}
+
+	// Look for exchange orders that no pair knows about
+	svc.mutex.RLock()
+	lister := svc.lister
+	svc.mutex.RUnlock()
+	if lister != nil {
+		issues, err := svc.findOrphanedOrders(lister)
+		if err != nil {
+			return report, err
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+
+	for _, issue := range report.Issues {
+		log.WithFields(log.F("kind", issue.Kind), log.F("order", issue.OrderID), log.F("fixed", issue.Fixed)).Warnf("%s: %s", issue.PairUUID, issue.Details)
+	}
+	return
+}
+
+func (svc *Service) reconcilePair(dao OrderPairDAO) (issues []ReconcileIssue) {
+	id, err := uuid.FromString(dao.Uuid)
+	if err != nil {
+		return []ReconcileIssue{{PairUUID: dao.Uuid, Kind: MissingOrder, Details: fmt.Sprintf("could not parse order pair ID: %s", err)}}
+	}
+
+	// Live pairs keep their own orders up to date so refresh those instead of touching the DAO
+	svc.mutex.RLock()
+	live, cached := svc.pairs[id]
+	svc.mutex.RUnlock()
+
+	var drifted bool
+	legs := []struct {
+		name string
+		dto  *types.OrderDTO
+		live func() types.Order
+	}{
+		{"first", &dao.FirstOrder, func() types.Order { return live.FirstOrder() }},
+		{"second", &dao.SecondOrder, func() types.Order { return live.SecondOrder() }},
+		{"reversal", &dao.ReversalOrder, func() types.Order { return live.ReversalOrder() }},
+	}
+	exchangeOrders := map[string]types.Order{}
+	for _, leg := range legs {
+		if leg.dto.ID == "" {
+			continue
+		}
+
+		ord, err := svc.trader.OrderSvc().Order(svc.market, leg.dto.ID)
+		if err != nil {
+			issues = append(issues, ReconcileIssue{dao.Uuid, leg.dto.ID, MissingOrder, fmt.Sprintf("could not load %s order from exchange: %s", leg.name, err), false})
+			continue
+		}
+		exchangeOrders[leg.name] = ord
+
+		// Compare against what we have stored
+		if ord.Status() == leg.dto.Status && ord.Filled().Equal(leg.dto.Filled) {
+			if _, fees := ord.Fees(); fees.Equal(leg.dto.Fees) {
+				continue
+			}
+		}
+		_, fees := ord.Fees()
+		details := fmt.Sprintf("%s order drifted: status %s -> %s, filled %s -> %s, fees %s -> %s", leg.name, leg.dto.Status, ord.Status(), leg.dto.Filled, ord.Filled(), leg.dto.Fees, fees)
+
+		if cached && leg.live() != nil {
+			err = leg.live().Refresh()
+		} else {
+			*leg.dto = ord.ToDTO()
+			drifted = true
+		}
+		issues = append(issues, ReconcileIssue{dao.Uuid, leg.dto.ID, OrderDrift, details, err == nil})
+	}
+
+	// Persist the fixes
+	if cached {
+		if len(issues) > 0 {
+			live.Save()
+		}
+	} else if drifted {
+		err = svc.Save(dao)
+		if err != nil {
+			log.WithError(err).Errorf("%s: could not save reconciled pair", dao.Uuid)
+		}
+	}
+
+	// Resume pairs that are still open after both legs are done
+	first, second := exchangeOrders["first"], exchangeOrders["second"]
+	if dao.Status == Open && first != nil && second != nil && first.IsDone() && second.IsDone() {
+		issue := ReconcileIssue{PairUUID: dao.Uuid, Kind: StuckPair, Details: "pair is open but both orders are done"}
+		if !cached {
+			p, err := svc.NewFromDAO(dao)
+			if err == nil {
+				err = p.Execute()
+			}
+			if err != nil {
+				issue.Details = fmt.Sprintf("%s; could not resume pair: %s", issue.Details, err)
+			} else {
+				issue.Details = fmt.Sprintf("%s; resumed pair", issue.Details)
+				issue.Fixed = true
+			}
+		}
+		issues = append(issues, issue)
+	}
+
+	return
+}
+
+func (svc *Service) findOrphanedOrders(lister OpenOrderLister) (issues []ReconcileIssue, err error) {
+	ids, err := lister.OpenOrderIDs(svc.market)
+	if err != nil {
+		return nil, fmt.Errorf("could not list open orders on the exchange: %w", err)
+	}
+
+	// Live pairs can have placed an order that hasn't been saved with them yet
+	live := svc.liveOrderIDs()
+	grace := viper.GetDuration("reconcile.orphanGracePeriod")
+
+	// Orders placed outside of the pairs belong to whatever placed them
+	known, err := svc.knownOrderIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if live[id] || known[id] {
+			continue
+		}
+
+		var pairID string
+		err = svc.db.QueryRow(`SELECT uuid FROM orderpairs
+			WHERE data->'firstOrder'->>'id' = $1 OR data->'secondOrder'->>'id' = $1 OR data->'reversalOrder'->>'id' = $1
+			LIMIT 1`, id).Scan(&pairID)
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("could not look up pair for order %s: %w", id, err)
+		}
+
+		ord, err := svc.trader.OrderSvc().Order(svc.market, id)
+		if err != nil {
+			issues = append(issues, ReconcileIssue{OrderID: id, Kind: OrphanedOrder, Details: fmt.Sprintf("open exchange order does not belong to any pair; could not load order: %s", err)})
+			continue
+		}
+
+		// Give whatever placed the order time to save it
+		if age := svc.Clock().Now().Sub(ord.CreationTime()); age < grace {
+			log.Debugf("skipping order %s without a pair; it was only placed %s ago", id, age)
+			continue
+		}
+
+		issue := ReconcileIssue{OrderID: id, Kind: OrphanedOrder, Details: "open exchange order does not belong to any pair"}
+		if viper.GetBool("reconcile.cancelOrphans") {
+			err = svc.trader.OrderSvc().CancelOrder(ord)
+			if err != nil {
+				issue.Details = fmt.Sprintf("%s; could not cancel order: %s", issue.Details, err)
+			} else {
+				issue.Details = fmt.Sprintf("%s; canceled order", issue.Details)
+				issue.Fixed = true
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// liveOrderIDs returns the IDs of the orders held by the pairs in the cache
+func (svc *Service) liveOrderIDs() map[string]bool {
+	svc.mutex.RLock()
+	pairs := make([]*OrderPair, 0, len(svc.pairs))
+	for _, p := range svc.pairs {
+		pairs = append(pairs, p)
+	}
+	multiLegPairs := make([]*MultiLegPair, 0, len(svc.multiLegPairs))
+	for _, p := range svc.multiLegPairs {
+		multiLegPairs = append(multiLegPairs, p)
+	}
+	svc.mutex.RUnlock()
+
+	orders := []types.Order{}
+	for _, p := range pairs {
+		orders = append(orders, p.FirstOrder(), p.SecondOrder(), p.ReversalOrder())
+	}
+	for _, p := range multiLegPairs {
+		orders = append(orders, p.Orders()...)
+		orders = append(orders, p.ReversalOrders()...)
+	}
+
+	ids := map[string]bool{}
+	for _, ord := range orders {
+		if ord != nil {
+			ids[ord.ID()] = true
+		}
+	}
+	return ids
+}
+
+func (svc *Service) knownOrderIDs() (map[string]bool, error) {
+	svc.mutex.RLock()
+	sources := append([]KnownOrders{}, svc.known...)
+	svc.mutex.RUnlock()
+
+	ids := map[string]bool{}
+	for _, source := range sources {
+		known, err := source.KnownOrderIDs()
+		if err != nil {
+			return nil, fmt.Errorf("could not list orders placed outside of the pairs: %w", err)
+		}
+		for _, id := range known {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
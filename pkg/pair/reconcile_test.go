@@ -0,0 +1,232 @@
+package pair
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair/fake_types"
+	"github.com/spf13/viper"
+)
+
+// openOrders lists the orders on the fake exchange that aren't done
+type openOrders struct{ trader *fake_types.Trader }
+
+func (l openOrders) OpenOrderIDs(market types.Market) (ids []string, err error) {
+	for _, ord := range l.trader.Orders() {
+		if !ord.IsDone() {
+			ids = append(ids, ord.ID())
+		}
+	}
+	return
+}
+
+// newReconcileHarness starts a harness that cancels orphans older than a minute
+func newReconcileHarness(t *testing.T) *lifecycleHarness {
+	defaults := map[string]interface{}{"reconcile.cancelOrphans": true, "reconcile.orphanGracePeriod": time.Minute}
+	for key, value := range defaults {
+		previous := viper.Get(key)
+		viper.Set(key, value)
+		key := key
+		t.Cleanup(func() { viper.Set(key, previous) })
+	}
+
+	h := newLifecycleHarness(t)
+	h.trader.SetClock(h.clock)
+	h.svc.SetOpenOrderLister(openOrders{h.trader})
+	return h
+}
+
+func (h *lifecycleHarness) reconcile() ReconcileReport {
+	h.t.Helper()
+	report, err := h.svc.Reconcile()
+	if err != nil {
+		h.t.Fatalf("could not reconcile: %s", err)
+	}
+	return report
+}
+
+// savedOpen waits for the pair to be saved with its first order and returns what was saved
+func (h *lifecycleHarness) savedOpen(p *OrderPair) OrderPairDAO {
+	h.t.Helper()
+	deadline := time.Now().Add(lifecycleTimeout)
+	for {
+		dao, err := savedPair(h.db, p.UUID().String())
+		if err != nil {
+			h.t.Fatalf("could not load saved pair: %s", err)
+		}
+		if dao.FirstOrder.ID != "" {
+			return dao
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatal("timed out waiting for the open pair to be saved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func issuesOfKind(report ReconcileReport, kind IssueKind) (issues []ReconcileIssue) {
+	for _, issue := range report.Issues {
+		if issue.Kind == kind {
+			issues = append(issues, issue)
+		}
+	}
+	return
+}
+
+func TestReconcile_CancelsOrphans(t *testing.T) {
+	h := newReconcileHarness(t)
+	orphan, err := h.trader.Market().AttemptOrder(limitRequest(h.trader.Market(), order.Buy, 1, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Orders get a minute to be saved with whatever placed them
+	if orphans := issuesOfKind(h.reconcile(), OrphanedOrder); len(orphans) != 0 || orphan.IsDone() {
+		t.Fatalf("expected the new order to be left alone, got %+v", orphans)
+	}
+
+	<-h.clock.After(time.Minute)
+	orphans := issuesOfKind(h.reconcile(), OrphanedOrder)
+	if len(orphans) != 1 || orphans[0].OrderID != orphan.ID() || !orphans[0].Fixed {
+		t.Fatalf("expected the order to be canceled as an orphan, got %+v", orphans)
+	}
+	if orphan.Status() != order.Canceled {
+		t.Errorf("expected the orphan to be %s, got %s", order.Canceled, orphan.Status())
+	}
+}
+
+func TestReconcile_FlagsOrphansWithoutCanceling(t *testing.T) {
+	h := newReconcileHarness(t)
+	viper.Set("reconcile.cancelOrphans", false)
+	orphan, err := h.trader.Market().AttemptOrder(limitRequest(h.trader.Market(), order.Buy, 1, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-h.clock.After(time.Hour)
+	orphans := issuesOfKind(h.reconcile(), OrphanedOrder)
+	if len(orphans) != 1 || orphans[0].Fixed || orphan.IsDone() {
+		t.Errorf("expected the orphan to be flagged and left open, got %+v with the order %s", orphans, orphan.Status())
+	}
+}
+
+// knownOrders stands in for the accumulation schedules, which place their buys through the service but save them
+// outside of the pairs
+type knownOrders []string
+
+func (k knownOrders) KnownOrderIDs() ([]string, error) { return k, nil }
+
+func TestReconcile_KnownOrders(t *testing.T) {
+	h := newReconcileHarness(t)
+	market := h.trader.Market()
+	buy, err := h.svc.AttemptOrder(order.NewRequest(market, order.Limit, order.Buy, decimal.NewFromInt(1), decimal.NewFromInt(100), decimal.Zero, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan, err := market.AttemptOrder(limitRequest(market, order.Buy, 1, 90))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.svc.AddKnownOrders(knownOrders{buy.ID()})
+
+	// The resting buy belongs to its schedule
+	<-h.clock.After(time.Hour)
+	orphans := issuesOfKind(h.reconcile(), OrphanedOrder)
+	if len(orphans) != 1 || orphans[0].OrderID != orphan.ID() {
+		t.Fatalf("expected only the unknown order to be an orphan, got %+v", orphans)
+	}
+	if buy.IsDone() {
+		t.Errorf("expected the known buy to be left open, got %s", buy.Status())
+	}
+}
+
+func TestReconcile_SavedPairOrders(t *testing.T) {
+	h := newReconcileHarness(t)
+	p := h.upwardPair()
+	first := h.execute(p)
+	h.savedOpen(p)
+
+	// A second service on the same database only knows the pair from what was saved
+	svc, err := NewService(h.db, h.trader, h.trader.Market())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.SetClock(h.clock)
+	svc.SetOpenOrderLister(openOrders{h.trader})
+
+	<-h.clock.After(time.Hour)
+	report, err := svc.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orphans := issuesOfKind(report, OrphanedOrder); len(orphans) != 0 || first.IsDone() {
+		t.Errorf("expected the saved first order to be left alone, got %+v", orphans)
+	}
+}
+
+func TestReconcile_UnsavedPairOrders(t *testing.T) {
+	h := newReconcileHarness(t)
+	p := h.upwardPair()
+	first := h.execute(p)
+
+	// Once the pair is saved as open, put it back to how it was saved before its first order was placed
+	dao := h.savedOpen(p)
+	dao.Status = New
+	dao.FirstOrder = types.OrderDTO{}
+	err := h.svc.Save(dao)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pair holds the order so it isn't an orphan however old it is
+	<-h.clock.After(time.Hour)
+	if orphans := issuesOfKind(h.reconcile(), OrphanedOrder); len(orphans) != 0 || first.IsDone() {
+		t.Errorf("expected the live pair's order to be left alone, got %+v with the order %s", orphans, first.Status())
+	}
+}
+
+func TestReconcile_UnsavedMultiLegOrders(t *testing.T) {
+	h := withLoopMarkets(newReconcileHarness(t))
+
+	p := h.newLoop(11)
+	p.Execute()
+	first := h.placed()
+
+	<-h.clock.After(time.Hour)
+	if orphans := issuesOfKind(h.reconcile(), OrphanedOrder); len(orphans) != 0 || first.IsDone() {
+		t.Errorf("expected the multi-leg pair's order to be left alone, got %+v", orphans)
+	}
+}
+
+func TestReconcile_Drift(t *testing.T) {
+	h := newReconcileHarness(t)
+	p := h.upwardPair()
+	first := h.execute(p)
+	h.savedOpen(p)
+
+	// The exchange filled part of the order without a second service hearing about it
+	first.Fill(decimal.NewFromFloat(40))
+	svc, err := NewService(h.db, h.trader, h.trader.Market())
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := svc.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drift := issuesOfKind(report, OrderDrift)
+	if len(drift) != 1 || drift[0].OrderID != first.ID() || !drift[0].Fixed {
+		t.Fatalf("expected the first order's drift to be fixed, got %+v", report.Issues)
+	}
+	dao, err := savedPair(h.db, drift[0].PairUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dao.FirstOrder.Status != order.Partial || !dao.FirstOrder.Filled.Equal(decimal.NewFromFloat(40)) {
+		t.Errorf("expected the partial fill to be saved, got %s with %s filled", dao.FirstOrder.Status, dao.FirstOrder.Filled)
+	}
+}
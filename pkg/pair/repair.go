@@ -0,0 +1,157 @@
+package pair
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types/order"
+)
+
+type RepairAction string
+
+var (
+	InspectPair    RepairAction = "INSPECT"
+	RetrySecondLeg RepairAction = "RETRY"
+	ReversePair    RepairAction = "REVERSE"
+	ResolvePair    RepairAction = "RESOLVE"
+)
+
+// RepairPlan describes what a broken pair is still holding and how it can be repaired
+type RepairPlan struct {
+	BaseImbalance  decimal.Decimal
+	QuoteImbalance decimal.Decimal
+	Actions        []RepairAction
+}
+
+// Repair refreshes the orders of a broken pair and applies the requested action. Inspecting the pair only reports
+// the remaining imbalance and the actions available to fix it.
+func (svc *Service) Repair(id string, action RepairAction, note string) (pair *OrderPair, plan RepairPlan, err error) {
+	// Repairs run one at a time so a pair is reopened before anyone else can see it as broken
+	svc.repairMutex.Lock()
+	defer svc.repairMutex.Unlock()
+
+	pair, err = svc.loadForRepair(id)
+	if err != nil {
+		return
+	}
+	if pair.Status() != Broken {
+		return nil, plan, fmt.Errorf("pair %s is %s; only %s pairs can be repaired", id, pair.Status(), Broken)
+	}
+
+	// Get the latest from the exchange
+	for _, o := range []interface{ Refresh() error }{pair.FirstOrder(), pair.SecondOrder(), pair.ReversalOrder()} {
+		if o == nil {
+			continue
+		}
+		err = o.Refresh()
+		if err != nil {
+			log.WithError(err).Warnf("%s: could not refresh order for repair", id)
+		}
+	}
+	err = pair.Save()
+	if err != nil {
+		log.WithError(err).Errorf("%s: could not save the pair", id)
+	}
+
+	plan = pair.repairPlan()
+	if action == InspectPair || action == "" {
+		return pair, plan, nil
+	}
+
+	// Make sure the action makes sense for the pair
+	allowed := false
+	for _, a := range plan.Actions {
+		if a == action {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, plan, fmt.Errorf("cannot %s pair %s; available actions are %v", action, id, plan.Actions)
+	}
+
+	log.Infof("%s: repairing pair with %s", id, action)
+	switch action {
+	case RetrySecondLeg:
+		pair.reopen()
+		go pair.executeSecondLeg()
+	case ReversePair:
+		pair.reopen()
+		go pair.Reverse()
+	case ResolvePair:
+		pair.mtx.Lock()
+		pair.status = Resolved
+		pair.statusDetails = fmt.Sprintf("resolved: %s (was: %s)", note, pair.statusDetails)
+		pair.mtx.Unlock()
+	default:
+		return nil, plan, fmt.Errorf("unknown repair action '%s'", action)
+	}
+
+	err = pair.Save()
+	return pair, plan, err
+}
+
+func (svc *Service) loadForRepair(id string) (*OrderPair, error) {
+	dao := OrderPairDAO{}
+	err := svc.db.QueryRow("SELECT data FROM orderpairs WHERE uuid = $1;", id).Scan(&dao)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("pair %s was not found in the database", id)
+		}
+		return nil, fmt.Errorf("could not load order pair from database: %w", err)
+	}
+
+	return svc.newFromDAO(dao, true)
+}
+
+func (o *OrderPair) repairPlan() (plan RepairPlan) {
+	plan.BaseImbalance = o.baseImbalance()
+	plan.QuoteImbalance = o.quoteImbalance()
+
+	// The second leg can be retried as long as the first filled and the second never traded
+	firstFilled := o.FirstOrder() != nil && o.FirstOrder().IsDone() && o.FirstOrder().Filled().IsPositive()
+	secondUnused := o.SecondOrder() == nil || (o.SecondOrder().Status() == order.Canceled && o.SecondOrder().Filled().IsZero())
+	reversalUnused := o.ReversalOrder() == nil || (o.ReversalOrder().Status() == order.Canceled && o.ReversalOrder().Filled().IsZero())
+	if firstFilled && secondUnused && reversalUnused {
+		plan.Actions = append(plan.Actions, RetrySecondLeg)
+	}
+
+	// Anything still out of balance can be reversed
+	if !plan.BaseImbalance.IsZero() && reversalUnused {
+		plan.Actions = append(plan.Actions, ReversePair)
+	}
+
+	plan.Actions = append(plan.Actions, ResolvePair)
+	return
+}
+
+// reopen puts a finished pair back into play so it can be run again
+func (o *OrderPair) reopen() {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	// Drop orders that never traded so they get placed again
+	if o.secondOrder != nil && o.secondOrder.Status() == order.Canceled && o.secondOrder.Filled().IsZero() {
+		o.secondOrder = nil
+	}
+	if o.reversalOrder != nil && o.reversalOrder.Status() == order.Canceled && o.reversalOrder.Filled().IsZero() {
+		o.reversalOrder = nil
+	}
+
+	o.status = Open
+	o.statusDetails = ""
+	o.endedAt = time.Time{}
+	o.done = make(chan bool)
+}
+
+// ParseRepairAction converts a user supplied action name into a RepairAction
+func ParseRepairAction(raw string) (RepairAction, error) {
+	for _, action := range []RepairAction{InspectPair, RetrySecondLeg, ReversePair, ResolvePair} {
+		if string(action) == raw {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("unknown repair action '%s'", raw)
+}
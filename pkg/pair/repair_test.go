@@ -0,0 +1,225 @@
+package pair
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair/fake_types"
+)
+
+// brokenPair runs an upward pair until its second order can't be placed after the first filled
+func (h *lifecycleHarness) brokenPair() *OrderPair {
+	h.t.Helper()
+	pair := h.upwardPair()
+	first := h.execute(pair)
+	h.trader.FailNextOrder(errors.New("insufficient funds"))
+	first.Fill(decimal.NewFromFloat(100))
+
+	if dao := h.finish(pair); dao.Status != Broken {
+		h.t.Fatalf("expected pair to be %s, got %s", Broken, dao.Status)
+	}
+	return pair
+}
+
+func (h *lifecycleHarness) repair(pair *OrderPair, action RepairAction) (*OrderPair, RepairPlan) {
+	h.t.Helper()
+	repaired, plan, err := h.svc.Repair(pair.UUID().String(), action, "test")
+	if err != nil {
+		h.t.Fatalf("could not %s pair: %s", action, err)
+	}
+	return repaired, plan
+}
+
+func TestRepair_Inspect(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.brokenPair()
+
+	_, plan := h.repair(pair, InspectPair)
+	if !plan.BaseImbalance.Equal(decimal.NewFromFloat(100)) || !plan.QuoteImbalance.IsNegative() {
+		t.Errorf("expected the pair to hold 100 bought with quote currency, got %s and %s", plan.BaseImbalance, plan.QuoteImbalance)
+	}
+	if expected := []RepairAction{RetrySecondLeg, ReversePair, ResolvePair}; !reflect.DeepEqual(plan.Actions, expected) {
+		t.Errorf("expected the actions to be %v, got %v", expected, plan.Actions)
+	}
+	if pair.Status() != Broken {
+		t.Errorf("expected inspecting to leave the pair %s, got %s", Broken, pair.Status())
+	}
+}
+
+func TestRepair_OnlyBroken(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+	first := h.execute(pair)
+	h.savedOpen(pair)
+
+	_, _, err := h.svc.Repair(pair.UUID().String(), InspectPair, "")
+	if err == nil || !strings.Contains(err.Error(), "only BROKEN pairs") {
+		t.Errorf("expected an open pair to be turned down, got %v", err)
+	}
+
+	first.Cancel()
+	h.finish(pair)
+}
+
+func TestRepair_UnavailableAction(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.upwardPair()
+
+	// Nothing was bought so there's nothing to sell or reverse
+	first := h.execute(pair)
+	first.Close(order.Partial)
+	if dao := h.finish(pair); dao.Status != Broken {
+		t.Fatalf("expected pair to be %s, got %s", Broken, dao.Status)
+	}
+
+	_, plan, err := h.svc.Repair(pair.UUID().String(), RetrySecondLeg, "")
+	if err == nil || !reflect.DeepEqual(plan.Actions, []RepairAction{ResolvePair}) {
+		t.Errorf("expected retrying to be turned down with only %s available, got %v with %v", ResolvePair, err, plan.Actions)
+	}
+	if pair.Status() != Broken || len(h.trader.Orders()) != 1 {
+		t.Errorf("expected the pair to be left %s, got %s with %d orders", Broken, pair.Status(), len(h.trader.Orders()))
+	}
+}
+
+func TestRepair_Retry(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.brokenPair()
+
+	repaired, _ := h.repair(pair, RetrySecondLeg)
+	second := h.placed()
+	if second.Request().Side() != order.Sell || !second.Request().Quantity().Equal(decimal.NewFromFloat(99)) {
+		t.Errorf("expected the second order to sell 99, got %s %s", second.Request().Side(), second.Request().Quantity())
+	}
+	second.Fill(decimal.NewFromFloat(99))
+
+	if dao := h.finish(repaired); dao.Status != Success {
+		t.Errorf("expected the repaired pair to be %s, got %s", Success, dao.Status)
+	}
+}
+
+func TestRepair_Reverse(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.brokenPair()
+
+	repaired, _ := h.repair(pair, ReversePair)
+	reversal := h.placed()
+	if reversal.Request().Side() != order.Sell || reversal.Request().Type() != order.Market {
+		t.Errorf("expected the reversal to be a market sell, got %s %s", reversal.Request().Type(), reversal.Request().Side())
+	}
+	reversal.Fill(decimal.NewFromFloat(100))
+
+	if dao := h.finish(repaired); dao.Status != Reversed {
+		t.Errorf("expected the repaired pair to be %s, got %s", Reversed, dao.Status)
+	}
+}
+
+func TestRepair_Resolve(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.brokenPair()
+
+	_, _, err := h.svc.Repair(pair.UUID().String(), ResolvePair, "sold by hand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dao, err := savedPair(h.db, pair.UUID().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dao.Status != Resolved || !strings.HasPrefix(dao.StatusDetails, "resolved: sold by hand (was: ") {
+		t.Errorf("expected the pair to be saved as %s with the note, got %s with %q", Resolved, dao.Status, dao.StatusDetails)
+	}
+	if len(h.trader.Orders()) != 1 {
+		t.Errorf("expected nothing to be placed, got %d orders", len(h.trader.Orders()))
+	}
+}
+
+func TestRepair_Concurrent(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.brokenPair()
+
+	// Hold the repairs up while they refresh the first order so they all try to go at once
+	refreshed := make(chan bool)
+	for i := 0; i < 4; i++ {
+		pair.FirstOrder().(*fake_types.Order).OnRefresh(fake_types.RefreshStep{Wait: refreshed})
+	}
+
+	// Only the first repair finds the pair broken however they race
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := h.svc.Repair(pair.UUID().String(), RetrySecondLeg, "")
+			errs <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(refreshed)
+	wg.Wait()
+	close(errs)
+
+	repaired := 0
+	for err := range errs {
+		if err == nil {
+			repaired++
+		}
+	}
+	second := h.placed()
+	if repaired != 1 || len(h.trader.Orders()) != 2 {
+		t.Errorf("expected the pair to be repaired once, got %d repairs with %d orders", repaired, len(h.trader.Orders()))
+	}
+
+	second.Fill(decimal.NewFromFloat(99))
+	h.finish(pair)
+}
+
+func TestReopen(t *testing.T) {
+	h := newLifecycleHarness(t)
+	pair := h.brokenPair()
+
+	// A canceled reversal that never traded is dropped and one that traded is kept
+	unused, err := h.trader.Market().AttemptOrder(limitRequest(h.trader.Market(), order.Sell, 100, 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.placed().Cancel()
+	pair.mtx.Lock()
+	pair.reversalOrder = unused
+	pair.mtx.Unlock()
+
+	pair.reopen()
+	if pair.ReversalOrder() != nil {
+		t.Errorf("expected the unused reversal to be dropped, got %s", pair.ReversalOrder().ID())
+	}
+	if pair.Status() != Open || pair.StatusDetails() != "" || !pair.EndedAt().IsZero() {
+		t.Errorf("expected the pair to be %s and not ended, got %s with %q ended at %s", Open, pair.Status(), pair.StatusDetails(), pair.EndedAt())
+	}
+	select {
+	case <-pair.Done():
+		t.Error("expected the reopened pair not to be done")
+	default:
+	}
+
+	traded, err := h.trader.Market().AttemptOrder(limitRequest(h.trader.Market(), order.Sell, 100, 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ord := h.placed()
+	ord.Fill(decimal.NewFromFloat(10))
+	ord.Cancel()
+	pair.mtx.Lock()
+	pair.reversalOrder = traded
+	pair.mtx.Unlock()
+
+	pair.reopen()
+	if pair.ReversalOrder() == nil {
+		t.Error("expected the reversal that traded to be kept")
+	}
+}
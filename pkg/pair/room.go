@@ -0,0 +1,102 @@
+package pair
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+)
+
+// RoomStrategy picks which of the open pairs to cancel when there isn't enough room for a new pair
+type RoomStrategy interface {
+	Select(pairs []*OrderPair, ticker types.Ticker) (*OrderPair, error)
+}
+
+// RoomStrategyFunc lets a plain function be used as a RoomStrategy
+type RoomStrategyFunc func(pairs []*OrderPair, ticker types.Ticker) (*OrderPair, error)
+
+func (f RoomStrategyFunc) Select(pairs []*OrderPair, ticker types.Ticker) (*OrderPair, error) {
+	return f(pairs, ticker)
+}
+
+var (
+	roomStrategyMutex sync.RWMutex
+	roomStrategies    = map[string]RoomStrategy{
+		"oldest":              RoomStrategyFunc(selectOldest),
+		"newest":              RoomStrategyFunc(selectNewest),
+		"least-profitable":    RoomStrategyFunc(selectLeastProfitable),
+		"farthest-from-price": RoomStrategyFunc(selectFarthestFromPrice),
+		"none":                RoomStrategyFunc(selectNone),
+	}
+)
+
+// RegisterRoomStrategy makes a strategy available to the makeRoomStrategy setting under the given name
+func RegisterRoomStrategy(name string, strategy RoomStrategy) {
+	roomStrategyMutex.Lock()
+	defer roomStrategyMutex.Unlock()
+
+	roomStrategies[name] = strategy
+}
+
+func getRoomStrategy(name string) (RoomStrategy, error) {
+	roomStrategyMutex.RLock()
+	defer roomStrategyMutex.RUnlock()
+
+	strategy, ok := roomStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy '%s'", name)
+	}
+	return strategy, nil
+}
+
+func selectOldest(pairs []*OrderPair, ticker types.Ticker) (*OrderPair, error) {
+	oldest := pairs[0]
+	for _, pair := range pairs {
+		if pair.CreatedAt().Before(oldest.CreatedAt()) {
+			oldest = pair
+		}
+	}
+	return oldest, nil
+}
+
+func selectNewest(pairs []*OrderPair, ticker types.Ticker) (*OrderPair, error) {
+	newest := pairs[0]
+	for _, pair := range pairs {
+		if pair.CreatedAt().After(newest.CreatedAt()) {
+			newest = pair
+		}
+	}
+	return newest, nil
+}
+
+func selectLeastProfitable(pairs []*OrderPair, ticker types.Ticker) (*OrderPair, error) {
+	least := pairs[0]
+	for _, pair := range pairs {
+		if pair.expectedReturn(ticker.Price()).LessThan(least.expectedReturn(ticker.Price())) {
+			least = pair
+		}
+	}
+	return least, nil
+}
+
+func selectFarthestFromPrice(pairs []*OrderPair, ticker types.Ticker) (*OrderPair, error) {
+	farthest := pairs[0]
+	for _, pair := range pairs {
+		if pair.SecondRequest().Price().Sub(ticker.Price()).Abs().GreaterThan(farthest.SecondRequest().Price().Sub(ticker.Price()).Abs()) {
+			farthest = pair
+		}
+	}
+	return farthest, nil
+}
+
+func selectNone(pairs []*OrderPair, ticker types.Ticker) (*OrderPair, error) {
+	return nil, &NoRoomError{len(pairs)}
+}
+
+// expectedReturn values the gains of both currencies in the quote currency at the given price, before fees
+func (o *OrderPair) expectedReturn(price decimal.Decimal) decimal.Decimal {
+	baseRes := o.BuyRequest().Quantity().Sub(o.SellRequest().Quantity())
+	quoteRes := o.SellRequest().Price().Mul(o.SellRequest().Quantity()).Sub(o.BuyRequest().Price().Mul(o.BuyRequest().Quantity()))
+	return baseRes.Mul(price).Add(quoteRes)
+}
@@ -0,0 +1,95 @@
+package pair
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/currencytrader/types/ticker"
+)
+
+func buildRoomPairs(market types.Market) []*OrderPair {
+	now := time.Now()
+	return []*OrderPair{
+		{
+			uuid:          [16]byte{1},
+			createdAt:     now.Add(-2 * time.Hour),
+			direction:     Upward,
+			firstRequest:  order.NewRequest(market, order.Limit, order.Buy, decimal.NewFromFloat(1), decimal.NewFromFloat(100), decimal.Zero, false),
+			secondRequest: order.NewRequest(market, order.Limit, order.Sell, decimal.NewFromFloat(0.99), decimal.NewFromFloat(102), decimal.Zero, false),
+		},
+		{
+			uuid:          [16]byte{2},
+			createdAt:     now,
+			direction:     Upward,
+			firstRequest:  order.NewRequest(market, order.Limit, order.Buy, decimal.NewFromFloat(1), decimal.NewFromFloat(100), decimal.Zero, false),
+			secondRequest: order.NewRequest(market, order.Limit, order.Sell, decimal.NewFromFloat(0.999), decimal.NewFromFloat(101), decimal.Zero, false),
+		},
+		{
+			uuid:          [16]byte{3},
+			createdAt:     now.Add(-time.Hour),
+			direction:     Upward,
+			firstRequest:  order.NewRequest(market, order.Limit, order.Buy, decimal.NewFromFloat(1), decimal.NewFromFloat(110), decimal.Zero, false),
+			secondRequest: order.NewRequest(market, order.Limit, order.Sell, decimal.NewFromFloat(0.99), decimal.NewFromFloat(115), decimal.Zero, false),
+		},
+	}
+}
+
+func TestRoomStrategies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	_, market := buildStubs(ctrl)
+	pairs := buildRoomPairs(market)
+	tick := ticker.New(types.TickerDTO{Price: decimal.NewFromFloat(100)})
+
+	var tests = []struct {
+		strategy string
+		expected *OrderPair
+	}{
+		{"oldest", pairs[0]},
+		{"newest", pairs[1]},
+		{"least-profitable", pairs[1]},
+		{"farthest-from-price", pairs[2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			strategy, err := getRoomStrategy(tt.strategy)
+			if err != nil {
+				t.Fatalf("could not get strategy: %s", err)
+			}
+			selected, err := strategy.Select(pairs, tick)
+			if err != nil {
+				t.Fatalf("could not select pair: %s", err)
+			}
+			if selected != tt.expected {
+				t.Errorf("expected pair %s, got %s", tt.expected.uuid, selected.uuid)
+			}
+		})
+	}
+}
+
+func TestRoomStrategies_None(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	_, market := buildStubs(ctrl)
+
+	strategy, err := getRoomStrategy("none")
+	if err != nil {
+		t.Fatalf("could not get strategy: %s", err)
+	}
+	_, err = strategy.Select(buildRoomPairs(market), ticker.New(types.TickerDTO{}))
+	var expected *NoRoomError
+	if !errors.As(err, &expected) {
+		t.Errorf("exected NoRoomError, got %T", err)
+	}
+}
+
+func TestRoomStrategies_Unknown(t *testing.T) {
+	_, err := getRoomStrategy("random")
+	if err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
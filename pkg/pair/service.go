@@ -21,8 +21,17 @@ type Service struct {
 	market types.Market
 	db     *sql.DB
 
-	mutex sync.RWMutex
-	pairs map[uuid.UUID]*OrderPair
+	mutex         sync.RWMutex
+	pairs         map[uuid.UUID]*OrderPair
+	multiLegPairs map[uuid.UUID]*MultiLegPair
+	lister        OpenOrderLister
+	known         []KnownOrders
+	listeners     []EventListener
+	clock         Clock
+
+	reconcileMutex sync.Mutex
+	exposureMutex  sync.Mutex
+	repairMutex    sync.Mutex
 }
 
 // NewService creates a Service for use. Will initialize the database if it hasn't been already.
@@ -32,6 +41,9 @@ func NewService(db *sql.DB, trader types.Trader, market types.Market) (svc *Serv
 		trader: trader,
 		market: market,
 		pairs:  make(map[uuid.UUID]*OrderPair),
+		clock:  realClock{},
+
+		multiLegPairs: make(map[uuid.UUID]*MultiLegPair),
 	}
 	err = svc.initializeDB()
 
@@ -54,7 +66,7 @@ func (svc *Service) New(first types.OrderRequest, second types.OrderRequest) (or
 		ready:         make(chan bool),
 		firstRequest:  first,
 		secondRequest: second,
-		createdAt:     time.Now(),
+		createdAt:     svc.Clock().Now(),
 		status:        New,
 		direction:     dir,
 	}
@@ -74,6 +86,12 @@ func (svc *Service) New(first types.OrderRequest, second types.OrderRequest) (or
 }
 
 func (svc *Service) NewFromDAO(dao OrderPairDAO) (*OrderPair, error) {
+	return svc.newFromDAO(dao, false)
+}
+
+// newFromDAO builds the pair from the DAO. When tolerant, orders that can't be loaded from the exchange fall back to
+// what was saved in the DAO instead of failing.
+func (svc *Service) newFromDAO(dao OrderPairDAO, tolerant bool) (*OrderPair, error) {
 	id, err := uuid.FromString(dao.Uuid)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse order pair ID: %w", err)
@@ -125,9 +143,13 @@ func (svc *Service) NewFromDAO(dao OrderPairDAO) (*OrderPair, error) {
 		if dao.FirstOrder.ID != "" {
 			if dao.FirstOrder.Status != order.Canceled {
 				order, err := svc.trader.OrderSvc().Order(svc.market, dao.FirstOrder.ID)
-				if err != nil {
+				if err != nil && !tolerant {
 					return nil, fmt.Errorf("could not load first order: %w", err)
 				}
+				if err != nil {
+					log.WithError(err).Warnf("%s: could not load first order; using saved order", id.String())
+					order = svc.trader.OrderSvc().OrderFromDTO(dao.FirstOrder)
+				}
 				orderPair.firstOrder = order
 			} else {
 				orderPair.firstOrder = svc.trader.OrderSvc().OrderFromDTO(dao.FirstOrder)
@@ -138,9 +160,13 @@ func (svc *Service) NewFromDAO(dao OrderPairDAO) (*OrderPair, error) {
 		if dao.SecondOrder.ID != "" {
 			if dao.SecondOrder.Status != order.Canceled {
 				order, err := svc.trader.OrderSvc().Order(svc.market, dao.SecondOrder.ID)
-				if err != nil {
+				if err != nil && !tolerant {
 					return nil, fmt.Errorf("could not load second order: %w", err)
 				}
+				if err != nil {
+					log.WithError(err).Warnf("%s: could not load second order; using saved order", id.String())
+					order = svc.trader.OrderSvc().OrderFromDTO(dao.SecondOrder)
+				}
 				orderPair.secondOrder = order
 			} else {
 				orderPair.secondOrder = svc.trader.OrderSvc().OrderFromDTO(dao.SecondOrder)
@@ -152,9 +178,13 @@ func (svc *Service) NewFromDAO(dao OrderPairDAO) (*OrderPair, error) {
 		if dao.ReversalOrder.ID != "" {
 			if dao.ReversalOrder.Status != order.Canceled {
 				order, err := svc.trader.OrderSvc().Order(svc.market, dao.ReversalOrder.ID)
-				if err != nil {
+				if err != nil && !tolerant {
 					return nil, fmt.Errorf("could not load reversal order: %w", err)
 				}
+				if err != nil {
+					log.WithError(err).Warnf("%s: could not load reversal order; using saved order", id.String())
+					order = svc.trader.OrderSvc().OrderFromDTO(dao.ReversalOrder)
+				}
 				orderPair.reversalOrder = order
 			} else {
 				orderPair.reversalOrder = svc.trader.OrderSvc().OrderFromDTO(dao.ReversalOrder)
@@ -235,6 +265,42 @@ func (svc *Service) LoadOpenPairs() (pairs []*OrderPair, err error) {
 	return
 }
 
+// RealizedReturn sums the returns, in the quote currency, of the pairs that were completed or reversed between start and end.
+func (svc *Service) RealizedReturn(start time.Time, end time.Time) (ret decimal.Decimal, err error) {
+	query := orderStatsQuery + `select coalesce(sum("totalReturn"), 0) from pairs where "status" in ('SUCCESS', 'REVERSED')`
+	err = svc.db.QueryRow(query, start, end).Scan(&ret)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("could not load realized return from database: %w", err)
+	}
+	return
+}
+
+// ConsecutiveFailures counts the reversed or broken pairs that ended since the given time without a successful pair
+// in between them, starting with the most recent.
+func (svc *Service) ConsecutiveFailures(since time.Time) (count int, err error) {
+	rows, err := svc.db.Query(`SELECT data->>'status' FROM orderpairs
+		WHERE data->>'status' IN ('SUCCESS', 'REVERSED', 'BROKEN') AND (data->>'endedAt')::timestamp >= $1::timestamp
+		ORDER BY (data->>'endedAt')::timestamp DESC`, since)
+	if err != nil {
+		return 0, fmt.Errorf("could not load ended order pairs from database: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status Status
+		err = rows.Scan(&status)
+		if err != nil {
+			return 0, fmt.Errorf("could not load ended order pair from database: %w", err)
+		}
+
+		// Stop counting at the most recent success
+		if status == Success {
+			break
+		}
+		count++
+	}
+	return
+}
+
 func (svc *Service) GetCollidingOpenPair(newPair *OrderPair) (pair *OrderPair, err error) {
 	// Get the pairs from cache
 	pairs, err := svc.LoadOpenPairs()
@@ -297,79 +363,49 @@ func (svc *Service) MakeRoom(startingPrice decimal.Decimal, direction Direction)
 
 	// Make room for new orders
 	log.Debug("making room for new orders")
-	switch viper.GetString("makeRoomStrategy") {
-	case "newest":
-		for len(pairs)+1 >= max {
-			// Find the newest pair
-			newest := pairs[0]
-			var idx int
-			for i, pair := range pairs {
-				if pair.CreatedAt().After(newest.CreatedAt()) {
-					newest = pair
-					idx = i
-				}
-			}
-
-			// Cancel newest pair
-			if newest.Status() == Open {
-				log.Infof("%s: canceling pair to make room", newest.UUID().String())
-				err = newest.Cancel()
-				if err != nil {
-					return fmt.Errorf("could not cancel newest pair to make room: %w", err)
-				}
-			}
-			// Wait for the pair to make room
-			<-newest.Done()
-
-			// Remove the pair from the slice
-			pairs = append(pairs[:idx], pairs[idx+1:]...)
+	strategy, err := getRoomStrategy(viper.GetString("makeRoomStrategy"))
+	if err != nil {
+		return err
+	}
+	for len(pairs) > 0 && len(pairs)+1 >= max {
+		ticker, err := svc.market.Ticker()
+		if err != nil {
+			return fmt.Errorf("could not get ticker to make room: %w", err)
+		}
 
-			// Wait for consistency
-			<-time.NewTicker(time.Second).C
+		// Pick the pair to cancel
+		pair, err := strategy.Select(pairs, ticker)
+		if err != nil {
+			return fmt.Errorf("could not pick a pair to make room: %w", err)
+		}
 
-			// Reset max
-			max, err = svc.getMaxOpenPairs(startingPrice, direction)
+		// Cancel the pair
+		if pair.Status() == Open {
+			log.Infof("%s: canceling pair to make room", pair.UUID().String())
+			err = pair.Cancel()
 			if err != nil {
-				return fmt.Errorf("could not get max open pairs: %w", err)
+				return fmt.Errorf("could not cancel pair to make room: %w", err)
 			}
 		}
-	case "oldest":
-		for len(pairs)+1 >= max {
-			// Find the oldest pair
-			oldest := pairs[0]
-			var idx int
-			for i, pair := range pairs {
-				if pair.CreatedAt().Before(oldest.CreatedAt()) {
-					oldest = pair
-					idx = i
-				}
-			}
+		// Wait for the pair to make room
+		<-pair.Done()
 
-			// Cancel oldest pair
-			if oldest.Status() == Open {
-				log.Infof("%s: canceling pair to make room", oldest.UUID().String())
-				err = oldest.Cancel()
-				if err != nil {
-					return fmt.Errorf("could not cancel oldest pair to make room: %w", err)
-				}
+		// Remove the pair from the slice
+		for i, p := range pairs {
+			if p == pair {
+				pairs = append(pairs[:i], pairs[i+1:]...)
+				break
 			}
-			// Wait for the pair to make room
-			<-oldest.Done()
-
-			// Remove the pair from the slice
-			pairs = append(pairs[:idx], pairs[idx+1:]...)
+		}
 
-			// Wait for consistency
-			<-time.NewTicker(time.Second).C
+		// Wait for consistency
+		<-svc.Clock().After(viper.GetDuration("pair.makeRoomWait"))
 
-			// Reset max
-			max, err = svc.getMaxOpenPairs(startingPrice, direction)
-			if err != nil {
-				return fmt.Errorf("could not get max open pairs: %w", err)
-			}
+		// Reset max
+		max, err = svc.getMaxOpenPairs(startingPrice, direction)
+		if err != nil {
+			return fmt.Errorf("could not get max open pairs: %w", err)
 		}
-	default:
-		return fmt.Errorf("unknown strategy '%s'", viper.GetString("makeRoomStrategy"))
 	}
 
 	return nil
@@ -380,6 +416,10 @@ func (svc *Service) initializeDB() error {
 	if err != nil {
 		return err
 	}
+	_, err = svc.db.Exec("CREATE TABLE IF NOT EXISTS multilegpairs (uuid char(36) primary key, data JSONB);")
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -0,0 +1,241 @@
+package pair
+
+import (
+	"fmt"
+
+	"github.com/go-playground/log/v7"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+)
+
+// Leg is the price and quantity of one of the orders of a pair
+type Leg struct {
+	Price    decimal.Decimal
+	Quantity decimal.Decimal
+}
+
+// MarketRules are the increments the exchange accepts prices and quantities in and the limits it accepts them
+// between. Zero limits aren't enforced.
+type MarketRules struct {
+	PriceIncrement decimal.Decimal
+	QuantityStep   decimal.Decimal
+
+	MinPrice    decimal.Decimal
+	MaxPrice    decimal.Decimal
+	MinQuantity decimal.Decimal
+	MaxQuantity decimal.Decimal
+}
+
+// RulesFromMarket loads the rules of the market. Markets that don't report an increment fall back to the precision
+// of the currency.
+func RulesFromMarket(market types.Market) MarketRules {
+	rules := MarketRules{
+		PriceIncrement: market.PriceIncrement(),
+		QuantityStep:   market.QuantityStepSize(),
+		MinPrice:       market.MinPrice(),
+		MaxPrice:       market.MaxPrice(),
+		MinQuantity:    market.MinQuantity(),
+		MaxQuantity:    market.MaxQuantity(),
+	}
+	if !rules.PriceIncrement.IsPositive() {
+		rules.PriceIncrement = decimal.New(1, -int32(market.QuoteCurrency().Precision()))
+	}
+	if !rules.QuantityStep.IsPositive() {
+		rules.QuantityStep = decimal.New(1, -int32(market.BaseCurrency().Precision()))
+	}
+	return rules
+}
+
+// checkIncrements makes sure there are increments to snap to
+func (r MarketRules) checkIncrements() error {
+	if !r.PriceIncrement.IsPositive() || !r.QuantityStep.IsPositive() {
+		return fmt.Errorf("market increments of %s and %s must be positive", r.PriceIncrement, r.QuantityStep)
+	}
+	return nil
+}
+
+// checkPrice makes sure the price is within the limits of the market
+func (r MarketRules) checkPrice(price decimal.Decimal) error {
+	if r.MinPrice.IsPositive() && price.LessThan(r.MinPrice) {
+		return &MarketLimitError{"price", price, r.MinPrice, false}
+	}
+	if r.MaxPrice.IsPositive() && price.GreaterThan(r.MaxPrice) {
+		return &MarketLimitError{"price", price, r.MaxPrice, true}
+	}
+	return nil
+}
+
+// checkQuantity makes sure the quantity is within the limits of the market
+func (r MarketRules) checkQuantity(qty decimal.Decimal) error {
+	if r.MinQuantity.IsPositive() && qty.LessThan(r.MinQuantity) {
+		return &MarketLimitError{"quantity", qty, r.MinQuantity, false}
+	}
+	if r.MaxQuantity.IsPositive() && qty.GreaterThan(r.MaxQuantity) {
+		return &MarketLimitError{"quantity", qty, r.MaxQuantity, true}
+	}
+	return nil
+}
+
+// SizingInput is everything needed to size the second order of a pair from the first
+type SizingInput struct {
+	Direction Direction
+	First     Leg
+
+	// Fee rates charged on the buy and the sell, in quote currency
+	BuyFee  decimal.Decimal
+	SellFee decimal.Decimal
+
+	// The return to target. Half of it is taken in base currency and half in quote currency.
+	Target decimal.Decimal
+
+	Rules MarketRules
+}
+
+// FitFirstLeg snaps the first order to the increments of the market and shrinks it to fit the quantity limit,
+// leaving room for the second order to fit as well. Orders that can't be made to fit are rejected.
+func FitFirstLeg(in SizingInput) (first Leg, err error) {
+	err = in.Rules.checkIncrements()
+	if err != nil {
+		return Leg{}, err
+	}
+
+	// Snap the price away from the second order so the spread only grows
+	first = in.First
+	if in.Direction == Upward {
+		first.Price = snapDown(first.Price, in.Rules.PriceIncrement)
+	} else {
+		first.Price = snapUp(first.Price, in.Rules.PriceIncrement)
+	}
+	err = in.Rules.checkPrice(first.Price)
+	if err != nil {
+		return Leg{}, fmt.Errorf("first order does not fit the market: %w", err)
+	}
+
+	// Downward pairs buy back more than they sell so the first order has to leave room under the maximum
+	max := in.Rules.MaxQuantity
+	if in.Direction == Downward && max.IsPositive() {
+		half := in.Target.Div(decimal.NewFromInt(2))
+		max = snapDown(max.Div(decimal.NewFromInt(1).Add(half)), in.Rules.QuantityStep)
+	}
+	first.Quantity = snapDown(first.Quantity, in.Rules.QuantityStep)
+	if max.IsPositive() && first.Quantity.GreaterThan(max) {
+		log.Debugf("shrinking first order from %s to %s to fit the market", first.Quantity, max)
+		first.Quantity = max
+	}
+	err = in.Rules.checkQuantity(first.Quantity)
+	if err != nil {
+		return Leg{}, fmt.Errorf("first order does not fit the market: %w", err)
+	}
+	return first, nil
+}
+
+// SolveSecondLeg returns the second order that makes the pair gain at least half the target, relative to the first
+// order, in both currencies after fees and snapping to the market increments.
+//
+// With a = buy quantity, b = buy price, c = sell quantity, d = sell price, f = buy fee, g = sell fee and t = target the
+// gains are (a - c) in base currency and (cd(1 - g) - ab(1 + f)) in quote currency. Upward pairs sell as much of what
+// they bought as the base target allows and solve the quote target for the lowest sell price:
+//
+//	c = a(1 - t/2), d = ab(1 + f + t/2) / c(1 - g)
+//
+// Downward pairs buy back just enough to meet the base target and solve the quote target for the highest buy price:
+//
+//	a = c(1 + t/2), b = cd(1 - g - t/2) / a(1 + f)
+//
+// Quantities and prices are snapped in whichever direction keeps the targets and the result is checked against the
+// limits of the market.
+func SolveSecondLeg(in SizingInput) (second Leg, err error) {
+	err = in.Rules.checkIncrements()
+	if err != nil {
+		return Leg{}, err
+	}
+	if !in.First.Price.IsPositive() || !in.First.Quantity.IsPositive() {
+		return Leg{}, fmt.Errorf("cannot size the second order from a first order of %s @ %s", in.First.Quantity, in.First.Price)
+	}
+
+	one := decimal.NewFromInt(1)
+	half := in.Target.Div(decimal.NewFromInt(2))
+
+	switch in.Direction {
+	case Upward:
+		a, b := in.First.Quantity, in.First.Price
+		c := snapDown(a.Mul(one.Sub(half)), in.Rules.QuantityStep)
+
+		denominator := c.Mul(one.Sub(in.SellFee))
+		if !denominator.IsPositive() {
+			return Leg{}, &DegenerateSizingError{denominator}
+		}
+		d := snapUp(a.Mul(b).Mul(one.Add(in.BuyFee).Add(half)).Div(denominator), in.Rules.PriceIncrement)
+
+		second = Leg{Price: d, Quantity: c}
+		if quoteGain(second, in.First, in).LessThan(a.Mul(b).Mul(half)) {
+			// Make up for the division rounding
+			second.Price = second.Price.Add(in.Rules.PriceIncrement)
+		}
+
+	case Downward:
+		c, d := in.First.Quantity, in.First.Price
+		a := snapUp(c.Mul(one.Add(half)), in.Rules.QuantityStep)
+
+		denominator := a.Mul(one.Add(in.BuyFee))
+		if !denominator.IsPositive() {
+			return Leg{}, &DegenerateSizingError{denominator}
+		}
+		b := snapDown(c.Mul(d).Mul(one.Sub(in.SellFee).Sub(half)).Div(denominator), in.Rules.PriceIncrement)
+
+		second = Leg{Price: b, Quantity: a}
+		if quoteGain(in.First, second, in).LessThan(c.Mul(d).Mul(half)) {
+			// Make up for the division rounding
+			second.Price = second.Price.Sub(in.Rules.PriceIncrement)
+		}
+		if !second.Price.IsPositive() {
+			return Leg{}, fmt.Errorf("cannot buy back at a price of %s; the fees and target are too high", second.Price)
+		}
+
+	default:
+		return Leg{}, fmt.Errorf("unhandled direction %s", in.Direction)
+	}
+
+	// Make sure the exchange will take it
+	err = in.Rules.checkPrice(second.Price)
+	if err == nil {
+		err = in.Rules.checkQuantity(second.Quantity)
+	}
+	if err != nil {
+		return Leg{}, fmt.Errorf("second order does not fit the market: %w", err)
+	}
+
+	// Check the snapped pair still makes money
+	base, quote := pairGains(in, second)
+	if base.LessThan(in.First.Quantity.Mul(half)) || quote.LessThan(in.First.Quantity.Mul(in.First.Price).Mul(half)) {
+		return Leg{}, fmt.Errorf("gains of %s base and %s quote miss the target after snapping, %w", base, quote, &LosingPropositionError{})
+	}
+	return second, nil
+}
+
+// pairGains returns what the pair makes in each currency after fees
+func pairGains(in SizingInput, second Leg) (base decimal.Decimal, quote decimal.Decimal) {
+	buy, sell := in.First, second
+	if in.Direction == Downward {
+		buy, sell = second, in.First
+	}
+	return buy.Quantity.Sub(sell.Quantity), quoteGain(sell, buy, in)
+}
+
+// quoteGain returns how much quote currency is left after selling and buying back, net of fees
+func quoteGain(sell Leg, buy Leg, in SizingInput) decimal.Decimal {
+	one := decimal.NewFromInt(1)
+	proceeds := sell.Price.Mul(sell.Quantity).Mul(one.Sub(in.SellFee))
+	cost := buy.Price.Mul(buy.Quantity).Mul(one.Add(in.BuyFee))
+	return proceeds.Sub(cost)
+}
+
+// snapDown rounds down to a multiple of the step
+func snapDown(d decimal.Decimal, step decimal.Decimal) decimal.Decimal {
+	return d.Div(step).Floor().Mul(step)
+}
+
+// snapUp rounds up to a multiple of the step
+func snapUp(d decimal.Decimal, step decimal.Decimal) decimal.Decimal {
+	return d.Div(step).Ceil().Mul(step)
+}
@@ -0,0 +1,346 @@
+package pair
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair/fake_types"
+	"github.com/spf13/viper"
+)
+
+// sizingCase is a random but sane pair to size. Prices and quantities are at least a thousand of their increments
+// so snapping can't eat the whole target.
+type sizingCase struct {
+	in SizingInput
+}
+
+// testRules snaps to cents and doesn't limit anything
+var testRules = MarketRules{PriceIncrement: decimal.New(1, -2), QuantityStep: decimal.New(1, -2)}
+
+// randomStep returns an increment like the ones exchanges use, such as 0.01, 0.05 or 25
+func randomStep(r *rand.Rand) decimal.Decimal {
+	multiples := []int64{1, 2, 5, 25}
+	return decimal.New(multiples[r.Intn(len(multiples))], -int32(r.Intn(9)))
+}
+
+func (sizingCase) Generate(r *rand.Rand, size int) reflect.Value {
+	in := SizingInput{
+		Direction: Upward,
+		BuyFee:    decimal.New(r.Int63n(101), -4),
+		SellFee:   decimal.New(r.Int63n(101), -4),
+		Target:    decimal.New(r.Int63n(5000)+1, -5),
+		Rules:     MarketRules{PriceIncrement: randomStep(r), QuantityStep: randomStep(r)},
+	}
+	if r.Intn(2) == 0 {
+		in.Direction = Downward
+	}
+	in.First = Leg{
+		Price:    decimal.NewFromInt(r.Int63n(10000000) + 1000).Mul(in.Rules.PriceIncrement),
+		Quantity: decimal.NewFromInt(r.Int63n(10000000) + 1000).Mul(in.Rules.QuantityStep),
+	}
+	return reflect.ValueOf(sizingCase{in})
+}
+
+// onIncrements reports whether the leg is snapped to the increments of the market
+func (c sizingCase) onIncrements(leg Leg) bool {
+	return leg.Price.Mod(c.in.Rules.PriceIncrement).IsZero() && leg.Quantity.Mod(c.in.Rules.QuantityStep).IsZero()
+}
+
+func TestSolveSecondLeg_MeetsTargets(t *testing.T) {
+	property := func(c sizingCase) bool {
+		second, err := SolveSecondLeg(c.in)
+		if err != nil {
+			t.Logf("%+v: %s", c.in, err)
+			return false
+		}
+
+		half := c.in.Target.Div(decimal.NewFromInt(2))
+		base, quote := pairGains(c.in, second)
+		if base.LessThan(c.in.First.Quantity.Mul(half)) {
+			t.Logf("%+v: base gain %s is short of the target", c.in, base)
+			return false
+		}
+		if quote.LessThan(c.in.First.Quantity.Mul(c.in.First.Price).Mul(half)) {
+			t.Logf("%+v: quote gain %s is short of the target", c.in, quote)
+			return false
+		}
+		if !c.onIncrements(second) {
+			t.Logf("%+v: %+v is not snapped to the increments", c.in, second)
+			return false
+		}
+		return true
+	}
+
+	err := quick.Check(property, &quick.Config{MaxCount: 2000})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSolveSecondLeg_TightestPrice(t *testing.T) {
+	property := func(c sizingCase) bool {
+		second, err := SolveSecondLeg(c.in)
+		if err != nil {
+			return false
+		}
+
+		// Moving the price one increment towards the first order should miss the quote target
+		unit := c.in.Rules.PriceIncrement
+		if c.in.Direction == Upward {
+			second.Price = second.Price.Sub(unit)
+		} else {
+			second.Price = second.Price.Add(unit)
+		}
+		half := c.in.Target.Div(decimal.NewFromInt(2))
+		_, quote := pairGains(c.in, second)
+		return quote.LessThan(c.in.First.Quantity.Mul(c.in.First.Price).Mul(half))
+	}
+
+	err := quick.Check(property, &quick.Config{MaxCount: 2000})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSolveSecondLeg_PassesValidate(t *testing.T) {
+	defer viper.Set("disableFees", viper.GetBool("disableFees"))
+	defer viper.Set("forceMakerOrders", viper.GetBool("forceMakerOrders"))
+	viper.Set("disableFees", false)
+	viper.Set("forceMakerOrders", false)
+
+	property := func(c sizingCase) bool {
+		second, err := SolveSecondLeg(c.in)
+		if err != nil {
+			return false
+		}
+
+		// The first order is charged the taker rate and the second the maker rate
+		rates := types.FeesDTO{TakerRate: c.in.BuyFee, MakerRate: c.in.SellFee}
+		firstSide, secondSide := order.Buy, order.Sell
+		if c.in.Direction == Downward {
+			rates = types.FeesDTO{TakerRate: c.in.SellFee, MakerRate: c.in.BuyFee}
+			firstSide, secondSide = order.Sell, order.Buy
+		}
+		trader := fake_types.NewTrader(types.MarketDTO{}, rates)
+		market := trader.Market()
+
+		op := &OrderPair{
+			svc:           &Service{trader: trader, market: market},
+			direction:     c.in.Direction,
+			firstRequest:  order.NewRequest(market, order.Limit, firstSide, c.in.First.Quantity, c.in.First.Price, decimal.Zero, false),
+			secondRequest: order.NewRequest(market, order.Limit, secondSide, second.Quantity, second.Price, decimal.Zero, false),
+		}
+		err = op.validate()
+		if err != nil {
+			t.Logf("%+v: %s", c.in, err)
+			return false
+		}
+		return true
+	}
+
+	err := quick.Check(property, &quick.Config{MaxCount: 500})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSolveSecondLeg_Degenerate(t *testing.T) {
+	one := decimal.NewFromInt(1)
+	cent := decimal.New(1, -2)
+	tests := []struct {
+		scenario string
+		in       SizingInput
+	}{
+		{
+			"nothing left to sell after the base target",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromInt(100), one}, Target: decimal.NewFromFloat(0.05), Rules: MarketRules{PriceIncrement: cent, QuantityStep: one}},
+		},
+		{
+			"sell fee takes everything",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromInt(100), decimal.NewFromInt(10)}, SellFee: one, Rules: testRules},
+		},
+		{
+			"buy fee cancels out the buy",
+			SizingInput{Direction: Downward, First: Leg{decimal.NewFromInt(100), decimal.NewFromInt(10)}, BuyFee: one.Neg(), Rules: testRules},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			_, err := SolveSecondLeg(tt.in)
+			var expected *DegenerateSizingError
+			if !errors.As(err, &expected) {
+				t.Errorf("expected DegenerateSizingError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSolveSecondLeg_Unsizable(t *testing.T) {
+	tests := []struct {
+		scenario string
+		in       SizingInput
+	}{
+		{
+			"empty first order",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromInt(100), decimal.Zero}, Rules: testRules},
+		},
+		{
+			"fees leave nothing to buy back with",
+			SizingInput{Direction: Downward, First: Leg{decimal.NewFromInt(100), decimal.NewFromInt(10)}, SellFee: decimal.NewFromFloat(0.99), Target: decimal.NewFromFloat(0.05), Rules: testRules},
+		},
+		{
+			"unknown direction",
+			SizingInput{Direction: "SIDEWAYS", First: Leg{decimal.NewFromInt(100), decimal.NewFromInt(10)}, Rules: testRules},
+		},
+		{
+			"no increments to snap to",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromInt(100), decimal.NewFromInt(10)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			_, err := SolveSecondLeg(tt.in)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestFitFirstLeg(t *testing.T) {
+	limited := testRules
+	limited.MinPrice = decimal.NewFromInt(1)
+	limited.MaxPrice = decimal.NewFromInt(1000)
+	limited.MinQuantity = decimal.NewFromInt(1)
+	limited.MaxQuantity = decimal.NewFromInt(10)
+
+	tests := []struct {
+		scenario string
+		in       SizingInput
+		expected Leg
+		limited  bool
+	}{
+		{
+			"snaps away from the second order",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromFloat(100.019), decimal.NewFromFloat(5.559)}, Rules: limited},
+			Leg{decimal.NewFromFloat(100.01), decimal.NewFromFloat(5.55)},
+			false,
+		},
+		{
+			"snaps a downward pair up",
+			SizingInput{Direction: Downward, First: Leg{decimal.NewFromFloat(100.011), decimal.NewFromFloat(5.559)}, Rules: limited},
+			Leg{decimal.NewFromFloat(100.02), decimal.NewFromFloat(5.55)},
+			false,
+		},
+		{
+			"shrinks to the maximum",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromInt(100), decimal.NewFromInt(50)}, Rules: limited},
+			Leg{decimal.NewFromInt(100), decimal.NewFromInt(10)},
+			false,
+		},
+		{
+			"leaves room to buy back under the maximum",
+			SizingInput{Direction: Downward, First: Leg{decimal.NewFromInt(100), decimal.NewFromInt(50)}, Target: decimal.NewFromFloat(0.1), Rules: limited},
+			Leg{decimal.NewFromInt(100), decimal.NewFromFloat(9.52)},
+			false,
+		},
+		{
+			"below the minimum quantity",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromInt(100), decimal.NewFromFloat(0.5)}, Rules: limited},
+			Leg{},
+			true,
+		},
+		{
+			"above the maximum price",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromInt(2000), decimal.NewFromInt(5)}, Rules: limited},
+			Leg{},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			first, err := FitFirstLeg(tt.in)
+			if tt.limited {
+				var expected *MarketLimitError
+				if !errors.As(err, &expected) {
+					t.Errorf("expected MarketLimitError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not fit the first order: %s", err)
+			}
+			if !first.Price.Equal(tt.expected.Price) || !first.Quantity.Equal(tt.expected.Quantity) {
+				t.Errorf("expected %s @ %s, got %s @ %s", tt.expected.Quantity, tt.expected.Price, first.Quantity, first.Price)
+			}
+
+			// Whatever fits first has to leave a second order that fits too
+			_, err = SolveSecondLeg(SizingInput{Direction: tt.in.Direction, First: first, Target: tt.in.Target, Rules: tt.in.Rules})
+			if err != nil {
+				t.Errorf("second order does not fit: %s", err)
+			}
+		})
+	}
+}
+
+func TestSolveSecondLeg_MarketLimits(t *testing.T) {
+	limited := testRules
+	limited.MaxPrice = decimal.NewFromInt(105)
+	limited.MinQuantity = decimal.NewFromInt(1)
+
+	tests := []struct {
+		scenario string
+		in       SizingInput
+	}{
+		{
+			"sell price above the maximum",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromInt(100), decimal.NewFromInt(5)}, Target: decimal.NewFromFloat(0.2), Rules: limited},
+		},
+		{
+			"sell quantity below the minimum",
+			SizingInput{Direction: Upward, First: Leg{decimal.NewFromInt(100), decimal.NewFromFloat(1.01)}, Target: decimal.NewFromFloat(0.02), Rules: limited},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			_, err := SolveSecondLeg(tt.in)
+			var expected *MarketLimitError
+			if !errors.As(err, &expected) {
+				t.Errorf("expected MarketLimitError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildSpreadBasedPair(t *testing.T) {
+	for _, dir := range []Direction{Upward, Downward} {
+		t.Run(string(dir), func(t *testing.T) {
+			h := newLifecycleHarness(t)
+			h.trader.Market().SetPrice(decimal.NewFromFloat(30000.12))
+
+			pair, err := BuildSpreadBasedPair(h.svc, dir)
+			if err != nil {
+				t.Fatalf("could not build pair: %s", err)
+			}
+			if pair.Direction() != dir {
+				t.Errorf("expected a %s pair, got %s", dir, pair.Direction())
+			}
+			if !pair.SellRequest().Price().GreaterThan(pair.BuyRequest().Price()) {
+				t.Errorf("expected to sell above %s, got %s", pair.BuyRequest().Price(), pair.SellRequest().Price())
+			}
+			if !pair.BuyRequest().Quantity().GreaterThan(pair.SellRequest().Quantity()) {
+				t.Errorf("expected to buy more than the %s sold, got %s", pair.SellRequest().Quantity(), pair.BuyRequest().Quantity())
+			}
+		})
+	}
+}
@@ -66,7 +66,7 @@ with pairs as (
 			) as raw_pairs
 		) as pair_returns
 		where
-			timeslot && tsrange(?, ?)
+			timeslot && tsrange($1::timestamp, $2::timestamp)
 	) as total_returns
 )
 `
@@ -10,4 +10,5 @@ var (
 	Canceled Status = "CANCELED"
 	Broken   Status = "BROKEN"
 	Reversed Status = "REVERSED"
+	Resolved Status = "RESOLVED"
 )
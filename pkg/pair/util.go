@@ -2,6 +2,7 @@ package pair
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/go-playground/log/v7"
 	"github.com/shopspring/decimal"
@@ -12,10 +13,6 @@ import (
 )
 
 func BuildSpreadBasedPair(svc *Service, dir Direction) (pair *OrderPair, err error) {
-	// Get the currencies
-	quoteCurrency := svc.market.QuoteCurrency()
-	baseCurrency := svc.market.BaseCurrency()
-
 	// Get the ticker for the current prices
 	ticker, err := svc.market.Ticker()
 	if err != nil {
@@ -23,116 +20,105 @@ func BuildSpreadBasedPair(svc *Service, dir Direction) (pair *OrderPair, err err
 	}
 
 	// Determine sell size so that both currencies gain
-	orderFee, err := getFees(svc.trader)
+	orderFee, err := getMarketFees(svc.trader, svc.market)
 	if err != nil {
 		return nil, fmt.Errorf("could not load fees: %w", err)
 	}
 
-	// Set the profit target
-	targetReturn := decimal.NewFromFloat(viper.GetFloat64("targetReturn"))
-
-	// Setup the numbers we need
-	two := decimal.NewFromFloat(2)
-
 	// Set the prices and fees
-	var buyPrice, buySize, sellPrice, sellSize, fee1, fee2 decimal.Decimal
-	switch dir {
-	case Upward:
-		fee2 = orderFee.MakerRate()
-
-		// Force maker orders
-		if viper.GetBool("forceMakerOrders") {
-			fee1 = orderFee.MakerRate()
-			buyPrice = ticker.Bid()
-		} else {
-			fee1 = orderFee.TakerRate()
-			buyPrice = ticker.Ask()
-		}
+	in := SizingInput{
+		Direction: dir,
+		Target:    decimal.NewFromFloat(viper.GetFloat64("targetReturn")),
+		Rules:     RulesFromMarket(svc.market),
+	}
+	if dir != Upward && dir != Downward {
+		return nil, fmt.Errorf("unhandled direction %s", dir)
+	}
+	in.BuyFee, in.SellFee = legFees(orderFee, dir)
 
-		// Determine the fee rate
-		rate := fee1.Add(fee2)
+	// Force maker orders
+	price := ticker.Ask()
+	if viper.GetBool("forceMakerOrders") {
+		price = ticker.Bid()
+	}
 
-		// Calculate spread
-		spread := targetReturn.Add(rate)
+	// Set the base size
+	quantity, err := size(svc, price, dir)
+	if err != nil {
+		return nil, err
+	}
+	in.First = Leg{price, quantity}
 
-		// Determine sell price from spread
-		sellPrice = buyPrice.Add(buyPrice.Mul(spread)).Round(int32(quoteCurrency.Precision()))
+	return buildPair(svc, in, viper.GetBool("forceMakerOrders"))
+}
 
-		// Set the base size
-		buySize, err = size(svc, buyPrice, dir)
-		if err != nil {
-			return nil, err
-		}
-		buySize = buySize.Round(int32(baseCurrency.Precision()))
-
-		// a = buyQty; b = buyPrice; c = sellQty; d = sellPrice; f = fee1; g = fee2
-		// Solving for c, t/2cd + t/2a + (fab + gcd) = (a - c) + (cd - ab)
-		// 2a - 2ab - ta - 2abf
-		n := two.Mul(buySize).Sub(two.Mul(buySize).Mul(buyPrice)).Sub(targetReturn.Mul(buySize)).Sub(two.Mul(buySize).Mul(buyPrice).Mul(fee1))
-		// td + 2gd + 2 - 2d
-		d := targetReturn.Mul(sellPrice).Add(two.Mul(fee2).Mul(sellPrice)).Add(two).Sub(two.Mul(sellPrice))
-
-		// Set sell size
-		sellSize = n.Div(d).Round(int32(baseCurrency.Precision()))
-	case Downward:
-		fee1 = orderFee.MakerRate()
-
-		// Force maker orders
-		if viper.GetBool("forceMakerOrders") {
-			fee2 = orderFee.MakerRate()
-			sellPrice = ticker.Bid()
-		} else {
-			fee2 = orderFee.TakerRate()
-			sellPrice = ticker.Ask()
-		}
+// BuildPairAt builds a pair whose first order rests at the given price and quantity. The first order is posted only
+// but it's charged the same fees the pair is validated with.
+func BuildPairAt(svc *Service, dir Direction, price decimal.Decimal, quantity decimal.Decimal) (*OrderPair, error) {
+	orderFee, err := getMarketFees(svc.trader, svc.market)
+	if err != nil {
+		return nil, fmt.Errorf("could not load fees: %w", err)
+	}
 
-		// Determine the fee rate
-		rate := fee1.Add(fee2)
+	in := SizingInput{
+		Direction: dir,
+		First:     Leg{price, quantity},
+		Target:    decimal.NewFromFloat(viper.GetFloat64("targetReturn")),
+		Rules:     RulesFromMarket(svc.market),
+	}
+	in.BuyFee, in.SellFee = legFees(orderFee, dir)
+	return buildPair(svc, in, true)
+}
 
-		// Calculate spread
-		spread := targetReturn.Add(rate)
+// legFees returns the rates the buy and sell of a pair are charged. The second order rests so it's charged the maker
+// rate and the first is charged the taker rate unless forceMakerOrders is set.
+func legFees(rates types.Fees, dir Direction) (buyFee decimal.Decimal, sellFee decimal.Decimal) {
+	first := rates.TakerRate()
+	if viper.GetBool("forceMakerOrders") {
+		first = rates.MakerRate()
+	}
+	if dir == Upward {
+		return first, rates.MakerRate()
+	}
+	return rates.MakerRate(), first
+}
 
-		// Determine buy price from spread
-		buyPrice = sellPrice.Sub(sellPrice.Mul(spread)).Round(int32(quoteCurrency.Precision()))
+// buildPair fits the first order to the market, solves for the second and creates the pair
+func buildPair(svc *Service, in SizingInput, postOnly bool) (*OrderPair, error) {
+	firstSide, secondSide := order.Buy, order.Sell
+	if in.Direction == Downward {
+		firstSide, secondSide = order.Sell, order.Buy
+	} else if in.Direction != Upward {
+		return nil, fmt.Errorf("unhandled direction %s", in.Direction)
+	}
 
-		// Set sell size to base size
-		sellSize, err = size(svc, sellPrice, dir)
-		if err != nil {
-			return nil, err
-		}
-		sellSize = sellSize.Round(int32(baseCurrency.Precision()))
-
-		// a = buyQty; b = buyPrice; c = sellQty; d = sellPrice; f = fee1; g = fee2
-		// Solving for a, t/2cd + t/2a + (fab + gcd) = (a - c) + (cd - ab)
-		// -2c + 2cd - tcd - 2gcd
-		n := two.Neg().Mul(sellSize).Add(two.Mul(sellSize).Mul(sellPrice)).Sub(targetReturn.Mul(sellSize).Mul(sellPrice)).Sub(two.Mul(fee2).Mul(sellSize).Mul(sellPrice))
-		// t + 2bf - 2 + 2b
-		d := targetReturn.Add(two.Mul(buyPrice).Mul(fee1)).Sub(two).Add(two.Mul(buyPrice))
-
-		// Set buy size
-		buySize = n.Div(d).Round(int32(baseCurrency.Precision()))
-	default:
-		return nil, fmt.Errorf("unhandled direction %s", dir)
+	// Fit the first order to the market
+	first, err := FitFirstLeg(in)
+	if err != nil {
+		return nil, fmt.Errorf("could not size the %s order: %w", strings.ToLower(string(firstSide)), err)
+	}
+	in.First = first
+
+	// Solve for the second order that reaches the target
+	second, err := SolveSecondLeg(in)
+	if err != nil {
+		return nil, fmt.Errorf("could not size the %s order: %w", strings.ToLower(string(secondSide)), err)
 	}
 
 	// Create order pair
-	var op *OrderPair
-	var sellReq, buyReq types.OrderRequest
-	if dir == Upward {
-		sellReq = order.NewRequest(svc.market, order.Limit, order.Sell, sellSize, sellPrice, decimal.Zero, false)
-		buyReq = order.NewRequest(svc.market, order.Limit, order.Buy, buySize, buyPrice, decimal.Zero, viper.GetBool("forceMakerOrders"))
-		op, err = svc.New(buyReq, sellReq)
-	} else {
-		sellReq = order.NewRequest(svc.market, order.Limit, order.Sell, sellSize, sellPrice, decimal.Zero, viper.GetBool("forceMakerOrders"))
-		buyReq = order.NewRequest(svc.market, order.Limit, order.Buy, buySize, buyPrice, decimal.Zero, false)
-		op, err = svc.New(sellReq, buyReq)
+	firstReq := order.NewRequest(svc.market, order.Limit, firstSide, first.Quantity, first.Price, decimal.Zero, postOnly)
+	secondReq := order.NewRequest(svc.market, order.Limit, secondSide, second.Quantity, second.Price, decimal.Zero, false)
+	op, err := svc.New(firstReq, secondReq)
+	buy, sell := first, second
+	if in.Direction == Downward {
+		buy, sell = second, first
 	}
 	log.WithFields(
-		log.F("sellSize", sellSize.String()),
-		log.F("sellPrice", sellPrice.String()),
-		log.F("buySize", buySize.String()),
-		log.F("buyPrice", buyPrice.String()),
-	).Infof("building %s trending order pair", dir)
+		log.F("sellSize", sell.Quantity.String()),
+		log.F("sellPrice", sell.Price.String()),
+		log.F("buySize", buy.Quantity.String()),
+		log.F("buyPrice", buy.Price.String()),
+	).Infof("building %s trending order pair", in.Direction)
 
 	if err != nil {
 		return nil, fmt.Errorf("could not create order pair: %w", err)
@@ -156,6 +142,61 @@ func getFees(trader types.Trader) (f types.Fees, err error) {
 	return
 }
 
+// getMarketFees returns the fee rates of the market. Rates set for the market's name under fees.makerRates and
+// fees.takerRates replace the account's rates, for exchanges that charge some markets differently.
+func getMarketFees(trader types.Trader, market types.Market) (types.Fees, error) {
+	f, err := getFees(trader)
+	if err != nil || viper.GetBool("disableFees") {
+		return f, err
+	}
+
+	maker, err := marketRate("fees.makerRates", market)
+	if err != nil {
+		return fees.ZeroFee(), err
+	}
+	taker, err := marketRate("fees.takerRates", market)
+	if err != nil {
+		return fees.ZeroFee(), err
+	}
+	if !maker.Valid && !taker.Valid {
+		return f, nil
+	}
+
+	dto := f.ToDTO()
+	if maker.Valid {
+		dto.MakerRate = maker.Decimal
+	}
+	if taker.Valid {
+		dto.TakerRate = taker.Decimal
+	}
+	return marketFees{dto}, nil
+}
+
+// marketRate returns the rate set for the market under the key, if there is one
+func marketRate(key string, market types.Market) (decimal.NullDecimal, error) {
+	rates := viper.GetStringMapString(key)
+	if len(rates) == 0 {
+		return decimal.NullDecimal{}, nil
+	}
+	raw, ok := rates[strings.ToLower(market.Name())]
+	if !ok {
+		return decimal.NullDecimal{}, nil
+	}
+	rate, err := decimal.NewFromString(raw)
+	if err != nil {
+		return decimal.NullDecimal{}, fmt.Errorf("could not parse %s of %s: %w", key, market.Name(), err)
+	}
+	return decimal.NullDecimal{Decimal: rate, Valid: true}, nil
+}
+
+// marketFees are the fee rates of a single market
+type marketFees struct{ dto types.FeesDTO }
+
+func (f marketFees) MakerRate() decimal.Decimal { return f.dto.MakerRate }
+func (f marketFees) TakerRate() decimal.Decimal { return f.dto.TakerRate }
+func (f marketFees) Volume() decimal.Decimal    { return f.dto.Volume }
+func (f marketFees) ToDTO() types.FeesDTO       { return f.dto }
+
 func size(svc *Service, price decimal.Decimal, dir Direction) (decimal.Decimal, error) {
 	// Get the max order size from max number of open orders plus 1 to add a buffer
 	maxOpenPairs := decimal.NewFromFloat(viper.GetFloat64("maxOpenPairs")).Add(decimal.NewFromFloat(1))
@@ -186,6 +227,16 @@ func size(svc *Service, price decimal.Decimal, dir Direction) (decimal.Decimal,
 		size = baseWallet.Available().Div(ratio)
 	}
 
+	// Shrink pairs that would push the portfolio further out of its target band
+	allocation, err := svc.Allocation(price)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if pull := allocation.Pull(); pull != "" && pull != dir {
+		log.Infof("base currency is %s of the portfolio; shrinking %s pair", allocation.BaseRatio.StringFixed(4), dir)
+		size = size.Mul(decimal.NewFromFloat(viper.GetFloat64("rebalance.sizeBias")))
+	}
+
 	// Set the base size
 	return size, nil
 }
@@ -22,6 +22,38 @@ type MoneytreeClient interface {
 	GetOpenPairs(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*PairCollection, error)
 	GetCandles(ctx context.Context, in *GetCandlesRequest, opts ...grpc.CallOption) (*CandleCollection, error)
 	RefreshPair(ctx context.Context, in *PairRequest, opts ...grpc.CallOption) (*Pair, error)
+	// Returns the state of the risk guard that halts new pairs when losses pile up.
+	GetRiskStatus(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*RiskStatus, error)
+	// Resumes trading after the risk guard has halted it.
+	ResumeTrading(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*RiskStatus, error)
+	// Compares the pairs against the exchange, fixing what it can and reporting the rest.
+	Reconcile(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*ReconcileReport, error)
+	// Inspects a broken pair or repairs it by retrying the second order, reversing it or marking it resolved.
+	RepairPair(ctx context.Context, in *RepairPairRequest, opts ...grpc.CallOption) (*RepairPairResponse, error)
+	// Returns the latest ticker.
+	GetTicker(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*Ticker, error)
+	// Streams the ticker as it trades. Slow clients skip to the latest ticks.
+	StreamTicker(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (Moneytree_StreamTickerClient, error)
+	// Streams snapshots of the top of the order book. Slow clients skip to the latest snapshot.
+	StreamOrderBook(ctx context.Context, in *StreamOrderBookRequest, opts ...grpc.CallOption) (Moneytree_StreamOrderBookClient, error)
+	// Returns the balances of every currency, how much of them the open pairs are holding and the current fees.
+	GetAccount(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*Account, error)
+	// Returns the audit entries recorded for the mutating calls and the calls that were turned down, newest first.
+	AuditLog(ctx context.Context, in *AuditLogRequest, opts ...grpc.CallOption) (*AuditLogResponse, error)
+	// Returns the grid of pairs kept at fixed prices within a band.
+	GetGrid(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*Grid, error)
+	// Lays out a ladder of pairs within a band and rearms each level when its pair is done until the grid is stopped.
+	StartGrid(ctx context.Context, in *StartGridRequest, opts ...grpc.CallOption) (*Grid, error)
+	// Stops rearming the grid, optionally canceling the pairs whose first order hasn't filled.
+	StopGrid(ctx context.Context, in *StopGridRequest, opts ...grpc.CallOption) (*Grid, error)
+	// Schedules a maker buy of a fixed quote amount whenever the cron expression matches, optionally skipping or
+	// doubling it on the trix oscillator.
+	CreateSchedule(ctx context.Context, in *CreateScheduleRequest, opts ...grpc.CallOption) (*Schedule, error)
+	// Returns the accumulation schedules and their recent runs, oldest schedule first.
+	ListSchedules(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*ScheduleCollection, error)
+	// Returns how the value of the portfolio splits between the currencies, the target band and the direction of pair
+	// that pulls it back into the band.
+	GetAllocation(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*Allocation, error)
 }
 
 type moneytreeClient struct {
@@ -68,6 +100,187 @@ func (c *moneytreeClient) RefreshPair(ctx context.Context, in *PairRequest, opts
 	return out, nil
 }
 
+func (c *moneytreeClient) GetRiskStatus(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*RiskStatus, error) {
+	out := new(RiskStatus)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/GetRiskStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) ResumeTrading(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*RiskStatus, error) {
+	out := new(RiskStatus)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/ResumeTrading", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) Reconcile(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*ReconcileReport, error) {
+	out := new(ReconcileReport)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/Reconcile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) RepairPair(ctx context.Context, in *RepairPairRequest, opts ...grpc.CallOption) (*RepairPairResponse, error) {
+	out := new(RepairPairResponse)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/RepairPair", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) GetTicker(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*Ticker, error) {
+	out := new(Ticker)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/GetTicker", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) StreamTicker(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (Moneytree_StreamTickerClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Moneytree_serviceDesc.Streams[0], "/moneytree.Moneytree/StreamTicker", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &moneytreeStreamTickerClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Moneytree_StreamTickerClient interface {
+	Recv() (*Ticker, error)
+	grpc.ClientStream
+}
+
+type moneytreeStreamTickerClient struct {
+	grpc.ClientStream
+}
+
+func (x *moneytreeStreamTickerClient) Recv() (*Ticker, error) {
+	m := new(Ticker)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *moneytreeClient) StreamOrderBook(ctx context.Context, in *StreamOrderBookRequest, opts ...grpc.CallOption) (Moneytree_StreamOrderBookClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Moneytree_serviceDesc.Streams[1], "/moneytree.Moneytree/StreamOrderBook", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &moneytreeStreamOrderBookClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Moneytree_StreamOrderBookClient interface {
+	Recv() (*OrderBook, error)
+	grpc.ClientStream
+}
+
+type moneytreeStreamOrderBookClient struct {
+	grpc.ClientStream
+}
+
+func (x *moneytreeStreamOrderBookClient) Recv() (*OrderBook, error) {
+	m := new(OrderBook)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *moneytreeClient) GetAccount(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*Account, error) {
+	out := new(Account)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/GetAccount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) AuditLog(ctx context.Context, in *AuditLogRequest, opts ...grpc.CallOption) (*AuditLogResponse, error) {
+	out := new(AuditLogResponse)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/AuditLog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) GetGrid(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*Grid, error) {
+	out := new(Grid)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/GetGrid", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) StartGrid(ctx context.Context, in *StartGridRequest, opts ...grpc.CallOption) (*Grid, error) {
+	out := new(Grid)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/StartGrid", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) StopGrid(ctx context.Context, in *StopGridRequest, opts ...grpc.CallOption) (*Grid, error) {
+	out := new(Grid)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/StopGrid", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) CreateSchedule(ctx context.Context, in *CreateScheduleRequest, opts ...grpc.CallOption) (*Schedule, error) {
+	out := new(Schedule)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/CreateSchedule", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) ListSchedules(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*ScheduleCollection, error) {
+	out := new(ScheduleCollection)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/ListSchedules", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *moneytreeClient) GetAllocation(ctx context.Context, in *NullRequest, opts ...grpc.CallOption) (*Allocation, error) {
+	out := new(Allocation)
+	err := c.cc.Invoke(ctx, "/moneytree.Moneytree/GetAllocation", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MoneytreeServer is the server API for Moneytree service.
 // All implementations must embed UnimplementedMoneytreeServer
 // for forward compatibility
@@ -77,6 +290,38 @@ type MoneytreeServer interface {
 	GetOpenPairs(context.Context, *NullRequest) (*PairCollection, error)
 	GetCandles(context.Context, *GetCandlesRequest) (*CandleCollection, error)
 	RefreshPair(context.Context, *PairRequest) (*Pair, error)
+	// Returns the state of the risk guard that halts new pairs when losses pile up.
+	GetRiskStatus(context.Context, *NullRequest) (*RiskStatus, error)
+	// Resumes trading after the risk guard has halted it.
+	ResumeTrading(context.Context, *NullRequest) (*RiskStatus, error)
+	// Compares the pairs against the exchange, fixing what it can and reporting the rest.
+	Reconcile(context.Context, *NullRequest) (*ReconcileReport, error)
+	// Inspects a broken pair or repairs it by retrying the second order, reversing it or marking it resolved.
+	RepairPair(context.Context, *RepairPairRequest) (*RepairPairResponse, error)
+	// Returns the latest ticker.
+	GetTicker(context.Context, *NullRequest) (*Ticker, error)
+	// Streams the ticker as it trades. Slow clients skip to the latest ticks.
+	StreamTicker(*NullRequest, Moneytree_StreamTickerServer) error
+	// Streams snapshots of the top of the order book. Slow clients skip to the latest snapshot.
+	StreamOrderBook(*StreamOrderBookRequest, Moneytree_StreamOrderBookServer) error
+	// Returns the balances of every currency, how much of them the open pairs are holding and the current fees.
+	GetAccount(context.Context, *NullRequest) (*Account, error)
+	// Returns the audit entries recorded for the mutating calls and the calls that were turned down, newest first.
+	AuditLog(context.Context, *AuditLogRequest) (*AuditLogResponse, error)
+	// Returns the grid of pairs kept at fixed prices within a band.
+	GetGrid(context.Context, *NullRequest) (*Grid, error)
+	// Lays out a ladder of pairs within a band and rearms each level when its pair is done until the grid is stopped.
+	StartGrid(context.Context, *StartGridRequest) (*Grid, error)
+	// Stops rearming the grid, optionally canceling the pairs whose first order hasn't filled.
+	StopGrid(context.Context, *StopGridRequest) (*Grid, error)
+	// Schedules a maker buy of a fixed quote amount whenever the cron expression matches, optionally skipping or
+	// doubling it on the trix oscillator.
+	CreateSchedule(context.Context, *CreateScheduleRequest) (*Schedule, error)
+	// Returns the accumulation schedules and their recent runs, oldest schedule first.
+	ListSchedules(context.Context, *NullRequest) (*ScheduleCollection, error)
+	// Returns how the value of the portfolio splits between the currencies, the target band and the direction of pair
+	// that pulls it back into the band.
+	GetAllocation(context.Context, *NullRequest) (*Allocation, error)
 	mustEmbedUnimplementedMoneytreeServer()
 }
 
@@ -96,6 +341,51 @@ func (UnimplementedMoneytreeServer) GetCandles(context.Context, *GetCandlesReque
 func (UnimplementedMoneytreeServer) RefreshPair(context.Context, *PairRequest) (*Pair, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RefreshPair not implemented")
 }
+func (UnimplementedMoneytreeServer) GetRiskStatus(context.Context, *NullRequest) (*RiskStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRiskStatus not implemented")
+}
+func (UnimplementedMoneytreeServer) ResumeTrading(context.Context, *NullRequest) (*RiskStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeTrading not implemented")
+}
+func (UnimplementedMoneytreeServer) Reconcile(context.Context, *NullRequest) (*ReconcileReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reconcile not implemented")
+}
+func (UnimplementedMoneytreeServer) RepairPair(context.Context, *RepairPairRequest) (*RepairPairResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RepairPair not implemented")
+}
+func (UnimplementedMoneytreeServer) GetTicker(context.Context, *NullRequest) (*Ticker, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTicker not implemented")
+}
+func (UnimplementedMoneytreeServer) StreamTicker(*NullRequest, Moneytree_StreamTickerServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTicker not implemented")
+}
+func (UnimplementedMoneytreeServer) StreamOrderBook(*StreamOrderBookRequest, Moneytree_StreamOrderBookServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamOrderBook not implemented")
+}
+func (UnimplementedMoneytreeServer) GetAccount(context.Context, *NullRequest) (*Account, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAccount not implemented")
+}
+func (UnimplementedMoneytreeServer) AuditLog(context.Context, *AuditLogRequest) (*AuditLogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AuditLog not implemented")
+}
+func (UnimplementedMoneytreeServer) GetGrid(context.Context, *NullRequest) (*Grid, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetGrid not implemented")
+}
+func (UnimplementedMoneytreeServer) StartGrid(context.Context, *StartGridRequest) (*Grid, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartGrid not implemented")
+}
+func (UnimplementedMoneytreeServer) StopGrid(context.Context, *StopGridRequest) (*Grid, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopGrid not implemented")
+}
+func (UnimplementedMoneytreeServer) CreateSchedule(context.Context, *CreateScheduleRequest) (*Schedule, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSchedule not implemented")
+}
+func (UnimplementedMoneytreeServer) ListSchedules(context.Context, *NullRequest) (*ScheduleCollection, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSchedules not implemented")
+}
+func (UnimplementedMoneytreeServer) GetAllocation(context.Context, *NullRequest) (*Allocation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllocation not implemented")
+}
 func (UnimplementedMoneytreeServer) mustEmbedUnimplementedMoneytreeServer() {}
 
 // UnsafeMoneytreeServer may be embedded to opt out of forward compatibility for this service.
@@ -181,6 +471,282 @@ func _Moneytree_RefreshPair_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Moneytree_GetRiskStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NullRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).GetRiskStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/GetRiskStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).GetRiskStatus(ctx, req.(*NullRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_ResumeTrading_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NullRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).ResumeTrading(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/ResumeTrading",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).ResumeTrading(ctx, req.(*NullRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_Reconcile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NullRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).Reconcile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/Reconcile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).Reconcile(ctx, req.(*NullRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_RepairPair_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RepairPairRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).RepairPair(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/RepairPair",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).RepairPair(ctx, req.(*RepairPairRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_GetTicker_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NullRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).GetTicker(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/GetTicker",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).GetTicker(ctx, req.(*NullRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_StreamTicker_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(NullRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MoneytreeServer).StreamTicker(m, &moneytreeStreamTickerServer{stream})
+}
+
+type Moneytree_StreamTickerServer interface {
+	Send(*Ticker) error
+	grpc.ServerStream
+}
+
+type moneytreeStreamTickerServer struct {
+	grpc.ServerStream
+}
+
+func (x *moneytreeStreamTickerServer) Send(m *Ticker) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Moneytree_StreamOrderBook_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamOrderBookRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MoneytreeServer).StreamOrderBook(m, &moneytreeStreamOrderBookServer{stream})
+}
+
+type Moneytree_StreamOrderBookServer interface {
+	Send(*OrderBook) error
+	grpc.ServerStream
+}
+
+type moneytreeStreamOrderBookServer struct {
+	grpc.ServerStream
+}
+
+func (x *moneytreeStreamOrderBookServer) Send(m *OrderBook) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Moneytree_GetAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NullRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).GetAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/GetAccount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).GetAccount(ctx, req.(*NullRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_AuditLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuditLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).AuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/AuditLog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).AuditLog(ctx, req.(*AuditLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_GetGrid_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NullRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).GetGrid(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/GetGrid",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).GetGrid(ctx, req.(*NullRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_StartGrid_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartGridRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).StartGrid(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/StartGrid",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).StartGrid(ctx, req.(*StartGridRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_StopGrid_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopGridRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).StopGrid(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/StopGrid",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).StopGrid(ctx, req.(*StopGridRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_CreateSchedule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateScheduleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).CreateSchedule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/CreateSchedule",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).CreateSchedule(ctx, req.(*CreateScheduleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_ListSchedules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NullRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).ListSchedules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/ListSchedules",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).ListSchedules(ctx, req.(*NullRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Moneytree_GetAllocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NullRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MoneytreeServer).GetAllocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/moneytree.Moneytree/GetAllocation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MoneytreeServer).GetAllocation(ctx, req.(*NullRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Moneytree_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "moneytree.Moneytree",
 	HandlerType: (*MoneytreeServer)(nil),
@@ -201,7 +767,70 @@ var _Moneytree_serviceDesc = grpc.ServiceDesc{
 			MethodName: "RefreshPair",
 			Handler:    _Moneytree_RefreshPair_Handler,
 		},
+		{
+			MethodName: "GetRiskStatus",
+			Handler:    _Moneytree_GetRiskStatus_Handler,
+		},
+		{
+			MethodName: "ResumeTrading",
+			Handler:    _Moneytree_ResumeTrading_Handler,
+		},
+		{
+			MethodName: "Reconcile",
+			Handler:    _Moneytree_Reconcile_Handler,
+		},
+		{
+			MethodName: "RepairPair",
+			Handler:    _Moneytree_RepairPair_Handler,
+		},
+		{
+			MethodName: "GetTicker",
+			Handler:    _Moneytree_GetTicker_Handler,
+		},
+		{
+			MethodName: "GetAccount",
+			Handler:    _Moneytree_GetAccount_Handler,
+		},
+		{
+			MethodName: "AuditLog",
+			Handler:    _Moneytree_AuditLog_Handler,
+		},
+		{
+			MethodName: "GetGrid",
+			Handler:    _Moneytree_GetGrid_Handler,
+		},
+		{
+			MethodName: "StartGrid",
+			Handler:    _Moneytree_StartGrid_Handler,
+		},
+		{
+			MethodName: "StopGrid",
+			Handler:    _Moneytree_StopGrid_Handler,
+		},
+		{
+			MethodName: "CreateSchedule",
+			Handler:    _Moneytree_CreateSchedule_Handler,
+		},
+		{
+			MethodName: "ListSchedules",
+			Handler:    _Moneytree_ListSchedules_Handler,
+		},
+		{
+			MethodName: "GetAllocation",
+			Handler:    _Moneytree_GetAllocation_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTicker",
+			Handler:       _Moneytree_StreamTicker_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamOrderBook",
+			Handler:       _Moneytree_StreamOrderBook_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/moneytree.proto",
 }
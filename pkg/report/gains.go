@@ -0,0 +1,226 @@
+// Package report builds reports from the pairs stored in the database
+package report
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+)
+
+type LotMethod string
+
+var (
+	// FIFO disposes of the oldest lots first
+	FIFO LotMethod = "fifo"
+
+	// SpecificID disposes of the lot bought by the same pair first and falls back to FIFO for the rest
+	SpecificID LotMethod = "specific-id"
+)
+
+// ParseLotMethod converts a user supplied method name into a LotMethod
+func ParseLotMethod(raw string) (LotMethod, error) {
+	for _, method := range []LotMethod{FIFO, SpecificID} {
+		if string(method) == raw {
+			return method, nil
+		}
+	}
+	return "", fmt.Errorf("unknown lot method '%s'; methods are %s and %s", raw, FIFO, SpecificID)
+}
+
+// Trade is a filled order of a pair
+type Trade struct {
+	PairUUID string
+	OrderID  string
+	Time     time.Time
+	Side     types.OrderSide
+	Quantity decimal.Decimal
+	Value    decimal.Decimal
+	Fees     decimal.Decimal
+}
+
+// Disposal is the sale of all or part of a lot
+type Disposal struct {
+	PairUUID  string
+	Quantity  decimal.Decimal
+	Acquired  time.Time
+	Disposed  time.Time
+	Proceeds  decimal.Decimal
+	CostBasis decimal.Decimal
+	Fees      decimal.Decimal
+}
+
+// Gain returns the proceeds less the cost basis and fees
+func (d Disposal) Gain() decimal.Decimal {
+	return d.Proceeds.Sub(d.CostBasis).Sub(d.Fees)
+}
+
+type lot struct {
+	pairUUID  string
+	acquired  time.Time
+	remaining decimal.Decimal
+	quantity  decimal.Decimal
+	cost      decimal.Decimal
+	fees      decimal.Decimal
+}
+
+// LoadTrades returns the filled orders of every finished pair, oldest first
+func LoadTrades(db *sql.DB) (trades []Trade, err error) {
+	rows, err := db.Query("SELECT data FROM orderpairs WHERE data->>'done' = 'true' ORDER BY data->>'createdAt';")
+	if err != nil {
+		return nil, fmt.Errorf("could not load pairs from database: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dao := pair.OrderPairDAO{}
+		err = rows.Scan(&dao)
+		if err != nil {
+			return nil, fmt.Errorf("could not load pair from database: %w", err)
+		}
+		trades = append(trades, pairTrades(dao)...)
+	}
+
+	sort.SliceStable(trades, func(i, j int) bool { return trades[i].Time.Before(trades[j].Time) })
+	return
+}
+
+func pairTrades(dao pair.OrderPairDAO) (trades []Trade) {
+	for _, o := range []types.OrderDTO{dao.FirstOrder, dao.SecondOrder, dao.ReversalOrder} {
+		if o.ID == "" || !o.Filled.IsPositive() {
+			continue
+		}
+
+		// Prefer what was actually paid over the requested price. The exchange includes the fees in what was paid and
+		// they're accounted for separately.
+		value := o.Paid.Sub(o.Fees)
+		if !o.Paid.IsPositive() {
+			value = o.Filled.Mul(o.Request.Price)
+		}
+
+		// The exchange doesn't report when orders fill so go with when they were placed
+		ts := o.CreationTime
+		if ts.IsZero() {
+			ts = dao.CreatedAt
+		}
+		trades = append(trades, Trade{dao.Uuid, o.ID, ts, o.Request.Side, o.Filled, value, o.Fees})
+	}
+	return
+}
+
+// BuildDisposals matches the sells against the lots bought before them. Sells without enough lots to cover them are
+// disposed of with no cost basis and no acquisition date.
+func BuildDisposals(trades []Trade, method LotMethod) (disposals []Disposal) {
+	lots := []*lot{}
+	for _, t := range trades {
+		if t.Side == order.Buy {
+			lots = append(lots, &lot{t.PairUUID, t.Time, t.Quantity, t.Quantity, t.Value, t.Fees})
+			continue
+		}
+
+		// Line up the lots to dispose of
+		candidates := lots
+		if method == SpecificID {
+			candidates = []*lot{}
+			for _, l := range lots {
+				if l.pairUUID == t.PairUUID {
+					candidates = append(candidates, l)
+				}
+			}
+			for _, l := range lots {
+				if l.pairUUID != t.PairUUID {
+					candidates = append(candidates, l)
+				}
+			}
+		}
+
+		remaining := t.Quantity
+		for _, l := range candidates {
+			if !remaining.IsPositive() {
+				break
+			}
+			if !l.remaining.IsPositive() {
+				continue
+			}
+
+			qty := decimal.Min(remaining, l.remaining)
+			share := qty.Div(t.Quantity)
+			lotShare := qty.Div(l.quantity)
+			disposals = append(disposals, Disposal{
+				PairUUID:  t.PairUUID,
+				Quantity:  qty,
+				Acquired:  l.acquired,
+				Disposed:  t.Time,
+				Proceeds:  t.Value.Mul(share),
+				CostBasis: l.cost.Mul(lotShare),
+				Fees:      t.Fees.Mul(share).Add(l.fees.Mul(lotShare)),
+			})
+			l.remaining = l.remaining.Sub(qty)
+			remaining = remaining.Sub(qty)
+		}
+
+		// Nothing left to match against
+		if remaining.IsPositive() {
+			share := remaining.Div(t.Quantity)
+			disposals = append(disposals, Disposal{
+				PairUUID: t.PairUUID,
+				Quantity: remaining,
+				Disposed: t.Time,
+				Proceeds: t.Value.Mul(share),
+				Fees:     t.Fees.Mul(share),
+			})
+		}
+
+		// Drop the used up lots
+		open := lots[:0]
+		for _, l := range lots {
+			if l.remaining.IsPositive() {
+				open = append(open, l)
+			}
+		}
+		lots = open
+	}
+	return
+}
+
+// WriteGainsCSV writes the disposals made during the year as CSV
+func WriteGainsCSV(w io.Writer, disposals []Disposal, year int) error {
+	out := csv.NewWriter(w)
+	err := out.Write([]string{"pair", "quantity", "acquired", "disposed", "proceeds", "cost basis", "fees", "gain"})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range disposals {
+		if d.Disposed.Year() != year {
+			continue
+		}
+		acquired := ""
+		if !d.Acquired.IsZero() {
+			acquired = d.Acquired.Format("2006-01-02")
+		}
+		err = out.Write([]string{
+			d.PairUUID,
+			d.Quantity.String(),
+			acquired,
+			d.Disposed.Format("2006-01-02"),
+			d.Proceeds.StringFixed(2),
+			d.CostBasis.StringFixed(2),
+			d.Fees.StringFixed(2),
+			d.Gain().StringFixed(2),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
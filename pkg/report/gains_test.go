@@ -0,0 +1,102 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+)
+
+func buildTrades() []Trade {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+	dec := decimal.NewFromFloat
+	return []Trade{
+		{"a", "1", day(1), order.Buy, dec(1), dec(100), dec(1)},
+		{"b", "2", day(2), order.Buy, dec(1), dec(110), dec(1)},
+		{"b", "3", day(3), order.Sell, dec(1), dec(120), dec(2)},
+		{"c", "4", day(4), order.Sell, dec(2), dec(250), dec(2)},
+	}
+}
+
+func TestBuildDisposals(t *testing.T) {
+	var tests = []struct {
+		method   LotMethod
+		expected []string
+	}{
+		// The first sell takes the oldest lot
+		{FIFO, []string{"b 1 2026-01-01 120 100 3 17", "c 1 2026-01-02 125 110 2 13", "c 1  125 0 1 124"}},
+		// The first sell takes the lot of its own pair
+		{SpecificID, []string{"b 1 2026-01-02 120 110 3 7", "c 1 2026-01-01 125 100 2 23", "c 1  125 0 1 124"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.method), func(t *testing.T) {
+			disposals := BuildDisposals(buildTrades(), tt.method)
+			if len(disposals) != len(tt.expected) {
+				t.Fatalf("expected %d disposals got %d", len(tt.expected), len(disposals))
+			}
+			for i, d := range disposals {
+				acquired := ""
+				if !d.Acquired.IsZero() {
+					acquired = d.Acquired.Format("2006-01-02")
+				}
+				actual := d.PairUUID + " " + d.Quantity.String() + " " + acquired + " " + d.Proceeds.String() + " " + d.CostBasis.String() + " " + d.Fees.String() + " " + d.Gain().String()
+				if actual != tt.expected[i] {
+					t.Errorf("disposal %d: expected '%s' got '%s'", i, tt.expected[i], actual)
+				}
+			}
+		})
+	}
+}
+
+func TestPairTrades(t *testing.T) {
+	dec := decimal.NewFromFloat
+	placed := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Bought 1 at 100, the second order never filled and the market reversal sold it for 95
+	dao := pair.OrderPairDAO{
+		Uuid:      "a",
+		CreatedAt: placed,
+		FirstOrder: types.OrderDTO{
+			ID:           "1",
+			CreationTime: placed,
+			Request:      types.OrderRequestDTO{Type: order.Limit, Side: order.Buy, Quantity: dec(1), Price: dec(100)},
+			Filled:       dec(1),
+			Fees:         dec(0.5),
+		},
+		SecondOrder: types.OrderDTO{
+			ID:      "2",
+			Request: types.OrderRequestDTO{Type: order.Limit, Side: order.Sell, Quantity: dec(0.99), Price: dec(110)},
+			Status:  order.Canceled,
+		},
+		ReversalOrder: types.OrderDTO{
+			ID:           "3",
+			CreationTime: placed.Add(time.Hour),
+			Request:      types.OrderRequestDTO{Type: order.Market, Side: order.Sell, Price: dec(95), Funds: dec(95)},
+			Filled:       dec(1),
+			Paid:         dec(95.475),
+			Fees:         dec(0.475),
+		},
+	}
+
+	trades := pairTrades(dao)
+	if len(trades) != 2 {
+		t.Fatalf("expected 2 trades, got %d", len(trades))
+	}
+	expected := []string{"1 BUY 1 100 0.5", "3 SELL 1 95 0.475"}
+	for i, trade := range trades {
+		actual := trade.OrderID + " " + string(trade.Side) + " " + trade.Quantity.String() + " " + trade.Value.String() + " " + trade.Fees.String()
+		if actual != expected[i] {
+			t.Errorf("trade %d: expected '%s' got '%s'", i, expected[i], actual)
+		}
+	}
+
+	// The fees only count once
+	disposals := BuildDisposals(trades, FIFO)
+	if len(disposals) != 1 || !disposals[0].Gain().Equal(dec(-5.975)) {
+		t.Errorf("expected a loss of 5.975, got %+v", disposals)
+	}
+}
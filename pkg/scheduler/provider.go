@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+)
+
+// The endpoints the provider's requests are limited under
+const (
+	PlaceOrder  = "placeOrder"
+	CancelOrder = "cancelOrder"
+	GetOrder    = "getOrder"
+	Account     = "account"
+	MarketData  = "marketData"
+)
+
+// Endpoints lists the endpoints the provider sends requests to
+var Endpoints = []string{PlaceOrder, CancelOrder, GetOrder, Account, MarketData}
+
+// Provider sends every request of the provider it wraps through the scheduler. Cancels and market orders, which is
+// how pairs are reversed, go ahead of everything else and new limit orders go last. Only the streams go straight to
+// the wrapped provider.
+type Provider struct {
+	types.Provider
+	scheduler *Scheduler
+}
+
+// NewProvider wraps the provider so its requests go through the scheduler
+func NewProvider(provider types.Provider, scheduler *Scheduler) *Provider {
+	return &Provider{provider, scheduler}
+}
+
+func (p *Provider) AttemptOrder(req types.OrderRequestDTO) (dto types.OrderDTO, err error) {
+	priority := Low
+	if req.Type == order.Market {
+		priority = High
+	}
+	stopped := p.scheduler.Do(PlaceOrder, priority, func() {
+		dto, err = p.Provider.AttemptOrder(req)
+	})
+	if stopped != nil {
+		return types.OrderDTO{}, stopped
+	}
+	return
+}
+
+func (p *Provider) CancelOrder(dto types.OrderDTO) (err error) {
+	stopped := p.scheduler.Do(CancelOrder, High, func() {
+		err = p.Provider.CancelOrder(dto)
+	})
+	if stopped != nil {
+		return stopped
+	}
+	return
+}
+
+func (p *Provider) Order(market types.MarketDTO, id string) (dto types.OrderDTO, err error) {
+	stopped := p.scheduler.Do(GetOrder, Normal, func() {
+		dto, err = p.Provider.Order(market, id)
+	})
+	if stopped != nil {
+		return types.OrderDTO{}, stopped
+	}
+	return
+}
+
+func (p *Provider) RefreshOrder(in types.OrderDTO) (dto types.OrderDTO, err error) {
+	stopped := p.scheduler.Do(GetOrder, Normal, func() {
+		dto, err = p.Provider.RefreshOrder(in)
+	})
+	if stopped != nil {
+		return types.OrderDTO{}, stopped
+	}
+	return
+}
+
+func (p *Provider) Fees() (fees types.FeesDTO, err error) {
+	stopped := p.scheduler.Do(Account, Normal, func() {
+		fees, err = p.Provider.Fees()
+	})
+	if stopped != nil {
+		return types.FeesDTO{}, stopped
+	}
+	return
+}
+
+func (p *Provider) Wallet(currency types.CurrencyDTO) (wallet types.WalletDTO, err error) {
+	stopped := p.scheduler.Do(Account, Normal, func() {
+		wallet, err = p.Provider.Wallet(currency)
+	})
+	if stopped != nil {
+		return types.WalletDTO{}, stopped
+	}
+	return
+}
+
+func (p *Provider) Wallets() (wallets []types.WalletDTO, err error) {
+	stopped := p.scheduler.Do(Account, Normal, func() {
+		wallets, err = p.Provider.Wallets()
+	})
+	if stopped != nil {
+		return nil, stopped
+	}
+	return
+}
+
+func (p *Provider) AverageTradeVolume(market types.MarketDTO) (volume decimal.Decimal, err error) {
+	stopped := p.scheduler.Do(MarketData, Normal, func() {
+		volume, err = p.Provider.AverageTradeVolume(market)
+	})
+	if stopped != nil {
+		return decimal.Zero, stopped
+	}
+	return
+}
+
+func (p *Provider) Candles(market types.MarketDTO, interval types.CandleInterval, start time.Time, end time.Time) (candles []types.CandleDTO, err error) {
+	stopped := p.scheduler.Do(MarketData, Normal, func() {
+		candles, err = p.Provider.Candles(market, interval, start, end)
+	})
+	if stopped != nil {
+		return nil, stopped
+	}
+	return
+}
+
+func (p *Provider) Currencies() (currencies []types.CurrencyDTO, err error) {
+	stopped := p.scheduler.Do(MarketData, Normal, func() {
+		currencies, err = p.Provider.Currencies()
+	})
+	if stopped != nil {
+		return nil, stopped
+	}
+	return
+}
+
+func (p *Provider) Markets() (markets []types.MarketDTO, err error) {
+	stopped := p.scheduler.Do(MarketData, Normal, func() {
+		markets, err = p.Provider.Markets()
+	})
+	if stopped != nil {
+		return nil, stopped
+	}
+	return
+}
+
+func (p *Provider) Ticker(market types.MarketDTO) (ticker types.TickerDTO, err error) {
+	stopped := p.scheduler.Do(MarketData, Normal, func() {
+		ticker, err = p.Provider.Ticker(market)
+	})
+	if stopped != nil {
+		return types.TickerDTO{}, stopped
+	}
+	return
+}
@@ -0,0 +1,216 @@
+// Package scheduler queues requests to the exchange and sends them within its rate limits, most urgent first.
+package scheduler
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrStopped is returned for requests that were still queued when the scheduler stopped
+var ErrStopped = errors.New("scheduler stopped")
+
+// Priority orders the queued requests. Lower priorities go first.
+type Priority int
+
+const (
+	// High is for requests that take risk off, like cancels and reversals
+	High Priority = iota
+	// Normal is for requests that read the state of orders and the account
+	Normal
+	// Low is for new orders
+	Low
+)
+
+// Priorities lists the priorities in the order they're served
+var Priorities = []Priority{High, Normal, Low}
+
+func (p Priority) String() string {
+	switch p {
+	case High:
+		return "high"
+	case Normal:
+		return "normal"
+	case Low:
+		return "low"
+	}
+	return "unknown"
+}
+
+// Limit is how many requests per second can be sent with bursts of up to Burst. A zero rate isn't limited.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Scheduler sends the queued requests as fast as the overall limit and the limit of each endpoint allow. The most
+// urgent request that its endpoint has room for goes next, oldest first within a priority.
+type Scheduler struct {
+	mutex   sync.Mutex
+	queues  map[Priority][]*request
+	overall *bucket
+	limits  map[string]Limit
+	buckets map[string]*bucket
+	wake    chan bool
+	stop    <-chan bool
+}
+
+type request struct {
+	endpoint string
+	fn       func()
+	done     chan bool
+}
+
+// New starts a scheduler that sends requests within the overall limit and the limits of each endpoint until stopped.
+// Endpoints without a limit are only held to the overall limit.
+func New(stop <-chan bool, overall Limit, limits map[string]Limit) *Scheduler {
+	s := &Scheduler{
+		queues:  map[Priority][]*request{},
+		overall: newBucket(overall, time.Now()),
+		limits:  limits,
+		buckets: map[string]*bucket{},
+		wake:    make(chan bool, 1),
+		stop:    stop,
+	}
+	go s.run()
+	return s
+}
+
+// Do queues fn for the endpoint and waits for it to run. ErrStopped is returned if the scheduler stops first.
+func (s *Scheduler) Do(endpoint string, priority Priority, fn func()) error {
+	req := &request{endpoint: endpoint, fn: fn, done: make(chan bool)}
+
+	s.mutex.Lock()
+	s.queues[priority] = append(s.queues[priority], req)
+	s.mutex.Unlock()
+
+	// Let the dispatcher know there's something new to look at
+	select {
+	case s.wake <- true:
+	default:
+	}
+
+	select {
+	case <-req.done:
+		return nil
+	case <-s.stop:
+		return ErrStopped
+	}
+}
+
+// Depth returns how many requests of the priority are waiting to be sent
+func (s *Scheduler) Depth(priority Priority) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.queues[priority])
+}
+
+func (s *Scheduler) run() {
+	for {
+		s.mutex.Lock()
+		req, wait := s.next(time.Now())
+		s.mutex.Unlock()
+
+		if req != nil {
+			go func() {
+				req.fn()
+				close(req.done)
+			}()
+			continue
+		}
+
+		// Sleep until a token frees up or something new is queued
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// next takes the first request that can be sent now off the queue. When nothing can be sent it returns how long until
+// something can, or zero if the queue is empty. The mutex must be held.
+func (s *Scheduler) next(now time.Time) (*request, time.Duration) {
+	overallWait := s.overall.wait(now)
+	soonest := time.Duration(math.MaxInt64)
+	for _, priority := range Priorities {
+		for i, req := range s.queues[priority] {
+			endpoint := s.bucket(req.endpoint, now)
+			wait := endpoint.wait(now)
+			if wait == 0 && overallWait == 0 {
+				s.queues[priority] = append(s.queues[priority][:i], s.queues[priority][i+1:]...)
+				endpoint.take()
+				s.overall.take()
+				return req, 0
+			}
+			if overallWait > wait {
+				wait = overallWait
+			}
+			if wait < soonest {
+				soonest = wait
+			}
+		}
+	}
+	if soonest == time.Duration(math.MaxInt64) {
+		return nil, 0
+	}
+	return nil, soonest
+}
+
+// bucket returns the bucket of the endpoint. The mutex must be held.
+func (s *Scheduler) bucket(endpoint string, now time.Time) *bucket {
+	b, ok := s.buckets[endpoint]
+	if !ok {
+		b = newBucket(s.limits[endpoint], now)
+		s.buckets[endpoint] = b
+	}
+	return b
+}
+
+// bucket is a token bucket that fills at the rate of its limit up to its burst
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit Limit, now time.Time) *bucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+// wait fills the bucket up to now and returns how long until there's a token
+func (b *bucket) wait(now time.Time) time.Duration {
+	if b.limit.Rate <= 0 {
+		return 0
+	}
+	if now.After(b.last) {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - b.tokens) / b.limit.Rate * float64(time.Second)))
+}
+
+// take uses up a token. wait must have found one first.
+func (b *bucket) take() {
+	if b.limit.Rate > 0 {
+		b.tokens--
+	}
+}
@@ -0,0 +1,222 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+)
+
+var _ types.Provider = &Provider{}
+
+// recorder keeps track of the order requests run in
+type recorder struct {
+	mutex sync.Mutex
+	ran   []string
+}
+
+func (r *recorder) record(name string) func() {
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		r.ran = append(r.ran, name)
+	}
+}
+
+func (r *recorder) order() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.ran...)
+}
+
+func newTestScheduler(t *testing.T, overall Limit, limits map[string]Limit) *Scheduler {
+	stop := make(chan bool)
+	t.Cleanup(func() { close(stop) })
+	return New(stop, overall, limits)
+}
+
+// queue queues the request in the background and waits for it to show up in the queue
+func queue(t *testing.T, wg *sync.WaitGroup, s *Scheduler, endpoint string, priority Priority, fn func()) {
+	t.Helper()
+	depth := s.Depth(priority)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.Do(endpoint, priority, fn)
+	}()
+	waitFor(t, func() bool { return s.Depth(priority) > depth })
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectOrder(t *testing.T, actual []string, expected ...string) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v to run, got %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("expected %v to run, got %v", expected, actual)
+		}
+	}
+}
+
+func TestScheduler_Priority(t *testing.T) {
+	s := newTestScheduler(t, Limit{Rate: 5, Burst: 1}, nil)
+	r := &recorder{}
+
+	// Use up the only token so everything after it waits in the queue
+	s.Do("orders", Low, r.record("first"))
+
+	wg := &sync.WaitGroup{}
+	queue(t, wg, s, "orders", Low, r.record("place"))
+	queue(t, wg, s, "orders", Normal, r.record("refresh"))
+	queue(t, wg, s, "orders", High, r.record("cancel"))
+	queue(t, wg, s, "orders", High, r.record("reverse"))
+	wg.Wait()
+
+	expectOrder(t, r.order(), "first", "cancel", "reverse", "refresh", "place")
+}
+
+func TestScheduler_EndpointLimits(t *testing.T) {
+	s := newTestScheduler(t, Limit{}, map[string]Limit{"cancels": {Rate: 5, Burst: 1}})
+	r := &recorder{}
+	s.Do("cancels", High, r.record("first cancel"))
+
+	// A less urgent request on an endpoint with room goes ahead of one that's waiting on its endpoint
+	wg := &sync.WaitGroup{}
+	queue(t, wg, s, "cancels", High, r.record("second cancel"))
+	s.Do("orders", Low, r.record("place"))
+	wg.Wait()
+
+	expectOrder(t, r.order(), "first cancel", "place", "second cancel")
+}
+
+func TestScheduler_Rate(t *testing.T) {
+	s := newTestScheduler(t, Limit{Rate: 50, Burst: 2}, nil)
+
+	// The burst goes straight out and the other 4 wait 20ms apiece
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Do("orders", Low, func() {})
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 75*time.Millisecond {
+		t.Errorf("expected 6 requests at 50 a second with bursts of 2 to take at least 80ms, took %s", elapsed)
+	}
+}
+
+func TestScheduler_Stop(t *testing.T) {
+	stop := make(chan bool)
+	s := New(stop, Limit{Rate: 0.001, Burst: 1}, nil)
+	s.Do("orders", Low, func() {})
+
+	result := make(chan error)
+	go func() { result <- s.Do("orders", Low, func() { t.Error("expected the request to never run") }) }()
+	waitFor(t, func() bool { return s.Depth(Low) == 1 })
+	close(stop)
+
+	select {
+	case err := <-result:
+		if err != ErrStopped {
+			t.Errorf("expected %s, got %v", ErrStopped, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the queued request to give up")
+	}
+}
+
+// stubProvider records the order requests it receives
+type stubProvider struct {
+	types.Provider
+	*recorder
+}
+
+func (p *stubProvider) AttemptOrder(req types.OrderRequestDTO) (types.OrderDTO, error) {
+	p.record(string(req.Type))()
+	return types.OrderDTO{ID: string(req.Type), Request: req}, nil
+}
+
+func (p *stubProvider) CancelOrder(dto types.OrderDTO) error {
+	p.record("cancel")()
+	return nil
+}
+
+func TestProvider_Priorities(t *testing.T) {
+	s := newTestScheduler(t, Limit{Rate: 5, Burst: 1}, nil)
+	r := &recorder{}
+	p := NewProvider(&stubProvider{recorder: r}, s)
+	limit := types.OrderRequestDTO{Type: order.Limit, Side: order.Buy, Quantity: decimal.NewFromInt(1), Price: decimal.NewFromInt(100)}
+	reversal := types.OrderRequestDTO{Type: order.Market, Side: order.Sell, Quantity: decimal.NewFromInt(1)}
+
+	ord, err := p.AttemptOrder(limit)
+	if err != nil || ord.ID != string(order.Limit) {
+		t.Fatalf("expected the order to be placed, got %q: %v", ord.ID, err)
+	}
+
+	// Reversals and cancels jump ahead of new orders
+	wg := &sync.WaitGroup{}
+	queue(t, wg, s, PlaceOrder, Low, func() { p.Provider.AttemptOrder(limit) })
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.AttemptOrder(reversal)
+	}()
+	waitFor(t, func() bool { return s.Depth(High) == 1 })
+	go func() {
+		defer wg.Done()
+		p.CancelOrder(ord)
+	}()
+	waitFor(t, func() bool { return s.Depth(High) == 2 })
+	wg.Wait()
+
+	expectOrder(t, r.order(), string(order.Limit), string(order.Market), "cancel", string(order.Limit))
+}
+
+func (p *stubProvider) Ticker(market types.MarketDTO) (types.TickerDTO, error) {
+	p.record("ticker")()
+	return types.TickerDTO{Price: decimal.NewFromInt(100)}, nil
+}
+
+func TestProvider_MarketData(t *testing.T) {
+	s := newTestScheduler(t, Limit{}, map[string]Limit{MarketData: {Rate: 0.001, Burst: 1}})
+	r := &recorder{}
+	p := NewProvider(&stubProvider{recorder: r}, s)
+
+	ticker, err := p.Ticker(types.MarketDTO{})
+	if err != nil || !ticker.Price.Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("expected the ticker, got %s: %v", ticker.Price, err)
+	}
+
+	// Once its endpoint is out of room the next read waits in the queue while the orders go ahead
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		p.Ticker(types.MarketDTO{})
+	}()
+	waitFor(t, func() bool { return s.Depth(Normal) == 1 })
+	p.CancelOrder(types.OrderDTO{})
+	expectOrder(t, r.order(), "ticker", "cancel")
+	select {
+	case <-done:
+		t.Error("expected the second ticker to wait for its endpoint")
+	default:
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// auditedMethods are the calls that change something and get recorded in the audit log
+var auditedMethods = map[string]bool{
+	"PlacePair":      true,
+	"RefreshPair":    true,
+	"ResumeTrading":  true,
+	"Reconcile":      true,
+	"RepairPair":     true,
+	"StartGrid":      true,
+	"StopGrid":       true,
+	"CreateSchedule": true,
+}
+
+type auditEntry struct {
+	ID        int64           `json:"-"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Caller    string          `json:"caller"`
+	Peer      string          `json:"peer"`
+	Method    string          `json:"method"`
+	Request   json.RawMessage `json:"request"`
+	PairUUIDs []string        `json:"pairUuids"`
+	Outcome   string          `json:"outcome"`
+	Error     string          `json:"error,omitempty"`
+	Latency   time.Duration   `json:"latency"`
+}
+
+func (a auditEntry) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (a *auditEntry) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &a)
+}
+
+// auditInterceptor records who made each mutating call, what they asked for and how it turned out. It runs before
+// the authenticator so calls that are turned down are recorded too, whatever the method.
+func (s *Server) auditInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+
+	// The authenticator fills in the caller once it finds their token
+	identified := &caller{}
+	ctx = context.WithValue(ctx, identifiedKey{}, identified)
+
+	start := time.Now()
+	res, err := handler(ctx, req)
+	if auditedMethods[method] || isDenied(err) {
+		s.audit(ctx, identified, method, start, req, res, err)
+	}
+	return res, err
+}
+
+// auditStreamInterceptor records the streams the authenticator turns down
+func (s *Server) auditStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+	identified := &caller{}
+	ctx := context.WithValue(ss.Context(), identifiedKey{}, identified)
+
+	start := time.Now()
+	err := handler(srv, &authorizedStream{ss, ctx})
+	if isDenied(err) {
+		s.audit(ctx, identified, method, start, nil, nil, err)
+	}
+	return err
+}
+
+func isDenied(err error) bool {
+	code := status.Code(err)
+	return code == codes.Unauthenticated || code == codes.PermissionDenied
+}
+
+func (s *Server) audit(ctx context.Context, identified *caller, method string, start time.Time, req interface{}, res interface{}, err error) {
+	entry := auditEntry{
+		CreatedAt: start,
+		Caller:    identified.name,
+		Method:    method,
+		PairUUIDs: auditPairUUIDs(req, res),
+		Outcome:   "OK",
+		Latency:   time.Since(start),
+	}
+	if entry.Caller == "" {
+		entry.Caller = "anonymous"
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		entry.Peer = p.Addr.String()
+	}
+	if m, ok := req.(protobuf.Message); ok {
+		entry.Request, _ = protojson.Marshal(m)
+	}
+	if err != nil {
+		entry.Outcome = status.Code(err).String()
+		entry.Error = err.Error()
+	}
+
+	_, dbErr := s.db.Exec("INSERT INTO auditlog (createdAt, data) VALUES ($1, $2);", entry.CreatedAt, entry)
+	if dbErr != nil {
+		log.WithError(dbErr).WithFields(log.F("caller", entry.Caller), log.F("method", method)).Error("could not write audit entry")
+	}
+}
+
+// auditPairUUIDs picks the pairs a call was about out of the request and response
+func auditPairUUIDs(req interface{}, res interface{}) (uuids []string) {
+	seen := map[string]bool{}
+	add := func(uuid string) {
+		if uuid != "" && !seen[uuid] {
+			seen[uuid] = true
+			uuids = append(uuids, uuid)
+		}
+	}
+
+	if r, ok := req.(interface{ GetUuid() string }); ok {
+		add(r.GetUuid())
+	}
+	switch r := res.(type) {
+	case *proto.Pair:
+		add(r.GetUuid())
+	case interface{ GetPair() *proto.Pair }:
+		add(r.GetPair().GetUuid())
+	case *proto.ReconcileReport:
+		for _, issue := range r.GetIssues() {
+			add(issue.GetPairUuid())
+		}
+	case *proto.Grid:
+		for _, level := range r.GetLadder() {
+			add(level.GetPair().GetUuid())
+		}
+	}
+	return
+}
+
+func (s *Server) AuditLog(ctx context.Context, in *proto.AuditLogRequest) (*proto.AuditLogResponse, error) {
+	log.Debug("Received audit log request")
+	start := time.Unix(in.StartTime, 0)
+	end := time.Now()
+	if in.EndTime > 0 {
+		end = time.Unix(in.EndTime, 0)
+	}
+	limit := in.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := s.db.Query(`SELECT id, data FROM auditlog
+		WHERE createdAt BETWEEN $1 AND $2 AND ($3 = '' OR data->>'method' = $3) AND ($4 = '' OR data->>'caller' = $4)
+		ORDER BY id DESC LIMIT $5;`, start, end, in.Method, in.Caller, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not load audit log: %w", err)
+	}
+	defer rows.Close()
+
+	res := &proto.AuditLogResponse{}
+	for rows.Next() {
+		entry := auditEntry{}
+		err = rows.Scan(&entry.ID, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("could not load audit entry: %w", err)
+		}
+		res.Entries = append(res.Entries, &proto.AuditEntry{
+			Id:        entry.ID,
+			Ts:        entry.CreatedAt.Unix(),
+			Caller:    entry.Caller,
+			Peer:      entry.Peer,
+			Method:    entry.Method,
+			Request:   string(entry.Request),
+			PairUuids: entry.PairUUIDs,
+			Outcome:   entry.Outcome,
+			Error:     entry.Error,
+			LatencyMs: entry.Latency.Milliseconds(),
+		})
+	}
+	return res, nil
+}
+
+func (s *Server) initializeAuditLog() error {
+	_, err := s.db.Exec("CREATE TABLE IF NOT EXISTS auditlog (id bigserial primary key, createdAt timestamptz, data JSONB);")
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type auditHarness struct {
+	t      *testing.T
+	server *Server
+	unary  []grpc.UnaryServerInterceptor
+	stream []grpc.StreamServerInterceptor
+}
+
+func newAuditHarness(t *testing.T) *auditHarness {
+	db := openTestDB()
+	t.Cleanup(func() { db.Close() })
+
+	s := &Server{db: db}
+	err := s.initializeAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAuthenticator(t,
+		tokenConfig{Name: "dashboard", Token: "read-token", Role: "read-only"},
+		tokenConfig{Name: "grow", Token: "trade-token", Role: "trader"},
+	)
+	unary, stream := s.interceptors(a)
+	return &auditHarness{t, s, unary, stream}
+}
+
+// call runs the request through the interceptors to the handler the way the gRPC server chains them
+func (h *auditHarness) call(ctx context.Context, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/moneytree.Moneytree/" + method}
+	for i := len(h.unary) - 1; i >= 0; i-- {
+		interceptor, next := h.unary[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler(ctx, req)
+}
+
+// auditStream is a server stream that only has a context
+type auditStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s auditStream) Context() context.Context { return s.ctx }
+
+func (h *auditHarness) openStream(ctx context.Context, method string, handler grpc.StreamHandler) error {
+	info := &grpc.StreamServerInfo{FullMethod: "/moneytree.Moneytree/" + method, IsServerStream: true}
+	for i := len(h.stream) - 1; i >= 0; i-- {
+		interceptor, next := h.stream[i], handler
+		handler = func(srv interface{}, ss grpc.ServerStream) error {
+			return interceptor(srv, ss, info, next)
+		}
+	}
+	return handler(nil, auditStream{ctx: ctx})
+}
+
+func (h *auditHarness) entries(req *proto.AuditLogRequest) []*proto.AuditEntry {
+	h.t.Helper()
+	res, err := h.server.AuditLog(context.Background(), req)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return res.Entries
+}
+
+func placed(ctx context.Context, req interface{}) (interface{}, error) {
+	return &proto.PlacePairResponse{Pair: &proto.Pair{Uuid: "pair-1"}}, nil
+}
+
+func TestAudit_MutatingCalls(t *testing.T) {
+	h := newAuditHarness(t)
+
+	_, err := h.call(withToken("trade-token"), "PlacePair", &proto.PlacePairRequest{Direction: "UP"}, placed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = h.call(withToken("trade-token"), "RefreshPair", &proto.PairRequest{Uuid: "pair-2"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "pair pair-2 was not found")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected the handler's error, got %v", err)
+	}
+
+	entries := h.entries(&proto.AuditLogRequest{})
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	refreshed, place := entries[0], entries[1]
+	if place.Caller != "grow" || place.Method != "PlacePair" || place.Outcome != "OK" || !reflect.DeepEqual(place.PairUuids, []string{"pair-1"}) {
+		t.Errorf("expected grow's placed pair to be recorded, got %+v", place)
+	}
+	recorded := &proto.PlacePairRequest{}
+	if err := protojson.Unmarshal([]byte(place.Request), recorded); err != nil || recorded.Direction != "UP" {
+		t.Errorf("expected the request to be recorded as JSON, got %s", place.Request)
+	}
+	if refreshed.Outcome != codes.NotFound.String() || refreshed.Error == "" || !reflect.DeepEqual(refreshed.PairUuids, []string{"pair-2"}) {
+		t.Errorf("expected the failed refresh to be recorded, got %+v", refreshed)
+	}
+}
+
+func TestAudit_ReadsAreNotRecorded(t *testing.T) {
+	h := newAuditHarness(t)
+
+	_, err := h.call(withToken("read-token"), "GetCandles", &proto.GetCandlesRequest{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &proto.CandleCollection{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := h.entries(&proto.AuditLogRequest{}); len(entries) != 0 {
+		t.Errorf("expected nothing to be recorded, got %+v", entries)
+	}
+}
+
+func TestAudit_Denials(t *testing.T) {
+	h := newAuditHarness(t)
+	handled := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = true
+		return &proto.CandleCollection{}, nil
+	}
+
+	// Turned down for the role and for the token, on mutating calls and reads alike
+	_, err := h.call(withToken("read-token"), "PlacePair", &proto.PlacePairRequest{Direction: "UP"}, handler)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected the read-only caller to be turned down, got %v", err)
+	}
+	_, err = h.call(withToken("stolen"), "GetCandles", &proto.GetCandlesRequest{}, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the unknown token to be turned down, got %v", err)
+	}
+	err = h.openStream(withToken("stolen"), "StreamTicker", func(srv interface{}, ss grpc.ServerStream) error {
+		handled = true
+		return nil
+	})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected the unknown token's stream to be turned down, got %v", err)
+	}
+	if handled {
+		t.Error("expected none of the calls to be handled")
+	}
+
+	entries := h.entries(&proto.AuditLogRequest{})
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	expected := []struct{ caller, method, outcome string }{
+		{"anonymous", "StreamTicker", codes.Unauthenticated.String()},
+		{"anonymous", "GetCandles", codes.Unauthenticated.String()},
+		{"dashboard", "PlacePair", codes.PermissionDenied.String()},
+	}
+	for i, e := range expected {
+		if entries[i].Caller != e.caller || entries[i].Method != e.method || entries[i].Outcome != e.outcome {
+			t.Errorf("expected %s calling %s to be recorded as %s, got %+v", e.caller, e.method, e.outcome, entries[i])
+		}
+	}
+}
+
+func TestAuditLog_Filters(t *testing.T) {
+	h := newAuditHarness(t)
+	for _, token := range []string{"trade-token", "read-token", "trade-token"} {
+		h.call(withToken(token), "PlacePair", &proto.PlacePairRequest{}, placed)
+	}
+	h.call(withToken("trade-token"), "StopGrid", &proto.StopGridRequest{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("no grid is running")
+	})
+
+	tests := []struct {
+		name    string
+		req     *proto.AuditLogRequest
+		methods []string
+	}{
+		{"everything", &proto.AuditLogRequest{}, []string{"StopGrid", "PlacePair", "PlacePair", "PlacePair"}},
+		{"by method", &proto.AuditLogRequest{Method: "StopGrid"}, []string{"StopGrid"}},
+		{"by caller", &proto.AuditLogRequest{Caller: "dashboard"}, []string{"PlacePair"}},
+		{"limited", &proto.AuditLogRequest{Limit: 2}, []string{"StopGrid", "PlacePair"}},
+		{"too late", &proto.AuditLogRequest{StartTime: time.Now().Add(time.Hour).Unix()}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var methods []string
+			for _, e := range h.entries(test.req) {
+				methods = append(methods, e.Method)
+			}
+			if !reflect.DeepEqual(methods, test.methods) {
+				t.Errorf("expected %v, got %v", test.methods, methods)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/auth"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// methodRoles is the least privileged role allowed to call each method. Methods that aren't listed need admin.
+var methodRoles = map[string]auth.Role{
+	"GetOpenPairs":    auth.ReadOnly,
+	"GetCandles":      auth.ReadOnly,
+	"GetTicker":       auth.ReadOnly,
+	"GetRiskStatus":   auth.ReadOnly,
+	"GetAccount":      auth.ReadOnly,
+	"StreamTicker":    auth.ReadOnly,
+	"StreamOrderBook": auth.ReadOnly,
+	"GetGrid":         auth.ReadOnly,
+	"ListSchedules":   auth.ReadOnly,
+	"GetAllocation":   auth.ReadOnly,
+	"PlacePair":       auth.Trader,
+	"RefreshPair":     auth.Trader,
+	"StartGrid":       auth.Trader,
+	"StopGrid":        auth.Trader,
+	"CreateSchedule":  auth.Trader,
+	"ResumeTrading":   auth.Admin,
+	"Reconcile":       auth.Admin,
+	"RepairPair":      auth.Admin,
+	"AuditLog":        auth.Admin,
+}
+
+type tokenConfig struct {
+	Name  string
+	Token string
+	Role  string
+}
+
+type caller struct {
+	name string
+	role auth.Role
+}
+
+type callerKey struct{}
+
+// identifiedKey holds the caller the audit log is waiting to hear about
+type identifiedKey struct{}
+
+// callerFromContext returns the name of the token used for the call, if any
+func callerFromContext(ctx context.Context) string {
+	if c, ok := ctx.Value(callerKey{}).(caller); ok {
+		return c.name
+	}
+	return ""
+}
+
+// authenticator checks the bearer token of every call against the configured auth.tokens
+type authenticator struct {
+	tokens map[string]caller
+}
+
+func newAuthenticator() (*authenticator, error) {
+	configs := []tokenConfig{}
+	err := viper.UnmarshalKey("auth.tokens", &configs)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse auth.tokens: %w", err)
+	}
+
+	a := &authenticator{tokens: map[string]caller{}}
+	for _, c := range configs {
+		if c.Token == "" {
+			return nil, fmt.Errorf("token for %s is empty", c.Name)
+		}
+		role, err := auth.ParseRole(c.Role)
+		if err != nil {
+			return nil, fmt.Errorf("could not load token for %s: %w", c.Name, err)
+		}
+		a.tokens[c.Token] = caller{c.Name, role}
+	}
+
+	// Make sure an open server doesn't go unnoticed
+	if len(a.tokens) == 0 {
+		log.Error("AUTHENTICATION IS DISABLED: no auth.tokens are configured so anyone who can reach the server can trade, halt and repair pairs")
+		if !viper.GetBool("tls.enabled") {
+			log.Error("TLS IS ALSO DISABLED: calls to the server are neither authenticated nor encrypted")
+		}
+	}
+	return a, nil
+}
+
+func (a *authenticator) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if len(a.tokens) == 0 {
+		return ctx, nil
+	}
+
+	// Find the token
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	for _, value := range md.Get("authorization") {
+		if strings.HasPrefix(value, "Bearer ") {
+			token = strings.TrimPrefix(value, "Bearer ")
+		}
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	var found *caller
+	for t, c := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			c := c
+			found = &c
+		}
+	}
+	if found == nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	if identified, ok := ctx.Value(identifiedKey{}).(*caller); ok {
+		*identified = *found
+	}
+
+	// Make sure the role can call the method
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	required, ok := methodRoles[method]
+	if !ok {
+		required = auth.Admin
+	}
+	if !found.role.Allows(required) {
+		log.Warnf("%s (%s) is not allowed to call %s", found.name, found.role, method)
+		return nil, status.Errorf(codes.PermissionDenied, "%s requires the %s role", method, required)
+	}
+
+	return context.WithValue(ctx, callerKey{}, *found), nil
+}
+
+func (a *authenticator) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *authenticator) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{ss, ctx})
+}
+
+// authorizedStream carries the caller in the context of a stream
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+// serverCredentials loads the TLS configuration. Client certificates are required and verified when tls.clientCA
+// is set.
+func serverCredentials() ([]grpc.ServerOption, error) {
+	if !viper.GetBool("tls.enabled") {
+		log.Warn("TLS is disabled; the server is accepting insecure connections")
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(viper.GetString("tls.cert"), viper.GetString("tls.key"))
+	if err != nil {
+		return nil, fmt.Errorf("could not load server certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if clientCA := viper.GetString("tls.clientCA"); clientCA != "" {
+		pem, err := ioutil.ReadFile(clientCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA certificate: %w", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("could not parse client CA certificate %s", clientCA)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(config))}, nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sinisterminister/moneytree/pkg/auth"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func newTestAuthenticator(t *testing.T, tokens ...tokenConfig) *authenticator {
+	t.Helper()
+	setConfig(t, "auth.tokens", tokens)
+	a, err := newAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestAuthorize(t *testing.T) {
+	a := newTestAuthenticator(t,
+		tokenConfig{Name: "dashboard", Token: "read-token", Role: "read-only"},
+		tokenConfig{Name: "grow", Token: "trade-token", Role: "trader"},
+		tokenConfig{Name: "ops", Token: "admin-token", Role: "admin"},
+	)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		code   codes.Code
+		caller string
+	}{
+		{"no token", context.Background(), "GetCandles", codes.Unauthenticated, ""},
+		{"not a bearer token", metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Basic read-token")), "GetCandles", codes.Unauthenticated, ""},
+		{"unknown token", withToken("nope"), "GetCandles", codes.Unauthenticated, ""},
+		{"read-only reads", withToken("read-token"), "GetCandles", codes.OK, "dashboard"},
+		{"read-only streams", withToken("read-token"), "StreamTicker", codes.OK, "dashboard"},
+		{"read-only trades", withToken("read-token"), "PlacePair", codes.PermissionDenied, ""},
+		{"trader trades", withToken("trade-token"), "PlacePair", codes.OK, "grow"},
+		{"trader reads", withToken("trade-token"), "GetOpenPairs", codes.OK, "grow"},
+		{"trader resumes", withToken("trade-token"), "ResumeTrading", codes.PermissionDenied, ""},
+		{"admin repairs", withToken("admin-token"), "RepairPair", codes.OK, "ops"},
+		{"unlisted methods need admin", withToken("trade-token"), "Shutdown", codes.PermissionDenied, ""},
+		{"admin calls unlisted methods", withToken("admin-token"), "Shutdown", codes.OK, "ops"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, err := a.authorize(test.ctx, "/moneytree.Moneytree/"+test.method)
+			if code := status.Code(err); code != test.code {
+				t.Fatalf("expected %s, got %v", test.code, err)
+			}
+			if err == nil && callerFromContext(ctx) != test.caller {
+				t.Errorf("expected the caller to be %q, got %q", test.caller, callerFromContext(ctx))
+			}
+		})
+	}
+}
+
+func TestAuthorize_NoTokens(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	ctx, err := a.authorize(context.Background(), "/moneytree.Moneytree/ResumeTrading")
+	if err != nil || callerFromContext(ctx) != "" {
+		t.Errorf("expected every call to be allowed without a caller, got %v", err)
+	}
+}
+
+func TestNewAuthenticator_BadTokens(t *testing.T) {
+	for _, token := range []tokenConfig{{Name: "empty", Role: "admin"}, {Name: "typo", Token: "token", Role: "superuser"}} {
+		setConfig(t, "auth.tokens", []tokenConfig{token})
+		if _, err := newAuthenticator(); err == nil {
+			t.Errorf("expected the %s token to be turned down", token.Name)
+		}
+	}
+}
+
+func TestMethodRoles(t *testing.T) {
+	methods := proto.File_proto_moneytree_proto.Services().ByName("Moneytree").Methods()
+
+	// Every listed method has to exist or a typo would quietly leave it needing admin
+	for method, role := range methodRoles {
+		if methods.ByName(protoreflect.Name(method)) == nil {
+			t.Errorf("%s is not a Moneytree method", method)
+		}
+		if _, err := auth.ParseRole(string(role)); err != nil {
+			t.Errorf("%s: %s", method, err)
+		}
+	}
+
+	// And every method should be listed on purpose, even the admin ones
+	for i := 0; i < methods.Len(); i++ {
+		if _, ok := methodRoles[string(methods.Get(i).Name())]; !ok {
+			t.Errorf("%s has no role", methods.Get(i).Name())
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package server
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/candle"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/viper"
+)
+
+// The exchange returns at most this many candles per request
+const maxCandlesPerRequest = 300
+
+// candleInterval is a requested interval and the exchange interval its history is backfilled from
+type candleInterval struct {
+	width time.Duration
+	base  types.CandleInterval
+}
+
+var candleIntervals = map[proto.GetCandlesRequest_Duration]candleInterval{
+	proto.GetCandlesRequest_ONE_MINUTE:        {time.Minute, candle.OneMinute},
+	proto.GetCandlesRequest_THREE_MINUTES:     {3 * time.Minute, candle.OneMinute},
+	proto.GetCandlesRequest_FIVE_MINUTES:      {5 * time.Minute, candle.FiveMinutes},
+	proto.GetCandlesRequest_FIFTEEN_MINUTES:   {15 * time.Minute, candle.FifteenMinutes},
+	proto.GetCandlesRequest_THIRTY_MINUTES:    {30 * time.Minute, candle.FifteenMinutes},
+	proto.GetCandlesRequest_ONE_HOUR:          {time.Hour, candle.OneHour},
+	proto.GetCandlesRequest_FOUR_HOURS:        {4 * time.Hour, candle.OneHour},
+	proto.GetCandlesRequest_TWELVE_HOURS:      {12 * time.Hour, candle.TwelveHours},
+	proto.GetCandlesRequest_TWENTY_FOUR_HOURS: {24 * time.Hour, candle.OneDay},
+}
+
+var baseWidths = map[types.CandleInterval]time.Duration{
+	candle.OneMinute:      time.Minute,
+	candle.FiveMinutes:    5 * time.Minute,
+	candle.FifteenMinutes: 15 * time.Minute,
+	candle.OneHour:        time.Hour,
+	candle.TwelveHours:    12 * time.Hour,
+	candle.OneDay:         24 * time.Hour,
+}
+
+type candleDAO struct {
+	Timestamp time.Time       `json:"ts"`
+	Open      decimal.Decimal `json:"open"`
+	High      decimal.Decimal `json:"high"`
+	Low       decimal.Decimal `json:"low"`
+	Close     decimal.Decimal `json:"close"`
+	Volume    decimal.Decimal `json:"volume"`
+}
+
+func (c candleDAO) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+func (c *candleDAO) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &c)
+}
+
+// candleStore serves candles from memory and the database, only going to the exchange for what it hasn't seen. One
+// minute candles are built from the ticker stream as it trades and larger intervals are aggregated from them. The
+// exchange intervals that divide the larger intervals only backfill the history from before the first stored minute.
+type candleStore struct {
+	db     *sql.DB
+	market types.Market
+
+	mutex   sync.RWMutex
+	cache   map[types.CandleInterval]map[int64]candleDAO
+	live    *candleDAO
+	trusted time.Time
+}
+
+func newCandleStore(db *sql.DB, market types.Market) (store *candleStore, err error) {
+	store = &candleStore{
+		db:     db,
+		market: market,
+		cache:  map[types.CandleInterval]map[int64]candleDAO{},
+	}
+	for base := range baseWidths {
+		store.cache[base] = map[int64]candleDAO{}
+	}
+
+	err = store.initializeDB()
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Start builds one minute candles from the ticker stream until stopped
+func (s *candleStore) Start(stop <-chan bool) {
+	// The minute we start in is only partially covered by the stream
+	s.mutex.Lock()
+	s.trusted = time.Now().Truncate(time.Minute).Add(time.Minute)
+	s.mutex.Unlock()
+
+	go func() {
+		stream := s.market.TickerStream(stop)
+		for {
+			select {
+			case <-stop:
+				return
+			case tick, ok := <-stream:
+				if !ok {
+					log.Warn("ticker stream closed; no longer building candles")
+					return
+				}
+				s.addTick(tick)
+			}
+		}
+	}()
+}
+
+func (s *candleStore) addTick(tick types.Ticker) {
+	ts := tick.Timestamp().Truncate(time.Minute)
+	price := tick.Price()
+	closed := []candleDAO{}
+
+	s.mutex.Lock()
+	switch {
+	case s.live == nil || ts.After(s.live.Timestamp):
+		// Close out the last minute
+		if s.live != nil && !s.live.Timestamp.Before(s.trusted) && s.cacheCandle(candle.OneMinute, *s.live) {
+			closed = append(closed, *s.live)
+		}
+		s.live = &candleDAO{ts, price, price, price, price, tick.Quantity()}
+		s.prune()
+	case ts.Equal(s.live.Timestamp):
+		s.live.High = decimal.Max(s.live.High, price)
+		s.live.Low = decimal.Min(s.live.Low, price)
+		s.live.Close = price
+		s.live.Volume = s.live.Volume.Add(tick.Quantity())
+	}
+	s.mutex.Unlock()
+
+	s.save(candle.OneMinute, closed)
+}
+
+// cacheCandle keeps a finished candle in memory and reports whether it wasn't already. The mutex must be held.
+func (s *candleStore) cacheCandle(base types.CandleInterval, c candleDAO) bool {
+	if _, ok := s.cache[base][c.Timestamp.Unix()]; ok {
+		return false
+	}
+	s.cache[base][c.Timestamp.Unix()] = c
+	return true
+}
+
+// save writes finished candles to the database. The mutex must not be held so the ticker stream isn't held up by
+// the database.
+func (s *candleStore) save(base types.CandleInterval, candles []candleDAO) {
+	for _, c := range candles {
+		_, err := s.db.Exec("INSERT INTO candles (market, interval, ts, data) VALUES ($1, $2, $3, $4) ON CONFLICT (market, interval, ts) DO NOTHING;", s.market.Name(), string(base), c.Timestamp, c)
+		if err != nil {
+			log.WithError(err).Errorf("could not save %s candle %s", base, c.Timestamp)
+		}
+	}
+}
+
+// prune drops the cached candles older than candles.retention. The mutex must be held.
+func (s *candleStore) prune() {
+	cutoff := time.Now().Add(-viper.GetDuration("candles.retention")).Unix()
+	for _, candles := range s.cache {
+		for ts := range candles {
+			if ts < cutoff {
+				delete(candles, ts)
+			}
+		}
+	}
+}
+
+// Candles returns the candles of the width between start and end, newest first. Periods without trades are filled
+// with the previous close. They're aggregated from the stored one minute candles and only the history from before
+// the first stored minute is aggregated from the exchange interval.
+func (s *candleStore) Candles(interval candleInterval, start time.Time, end time.Time) ([]candleDAO, error) {
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+	start = start.Truncate(interval.width)
+
+	// Find the first bucket the one minute candles cover in full
+	history := start
+	if interval.base != candle.OneMinute {
+		first, ok, err := s.firstStoredMinute(start, end)
+		if err != nil {
+			return nil, err
+		}
+		history = end.Truncate(interval.width).Add(interval.width)
+		if ok {
+			history = first.Truncate(interval.width)
+			if history.Before(first) {
+				history = history.Add(interval.width)
+			}
+		}
+	}
+
+	candles := []candleDAO{}
+	if history.After(start) {
+		width := baseWidths[interval.base]
+		last := history.Add(-width)
+		if last.After(end) {
+			last = end
+		}
+		bases, err := s.load(interval.base, start, last)
+		if err != nil {
+			return nil, err
+		}
+		candles = aggregate(candles, bases, start, last, width, interval.width)
+	}
+	if !history.After(end) {
+		minutes, err := s.load(candle.OneMinute, history, end)
+		if err != nil {
+			return nil, err
+		}
+		candles = aggregate(candles, minutes, history, end, time.Minute, interval.width)
+	}
+
+	// Newest first like the exchange
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Timestamp.After(candles[j].Timestamp) })
+	return candles, nil
+}
+
+// aggregate appends the base candles between start and end to the candles, merging them into buckets of the width
+func aggregate(candles []candleDAO, bases map[int64]candleDAO, start time.Time, end time.Time, baseWidth time.Duration, width time.Duration) []candleDAO {
+	for ts := start; !ts.After(end); ts = ts.Add(baseWidth) {
+		c, ok := bases[ts.Unix()]
+		if !ok {
+			continue
+		}
+
+		bucket := ts.Truncate(width)
+		if len(candles) == 0 || !candles[len(candles)-1].Timestamp.Equal(bucket) {
+			c.Timestamp = bucket
+			candles = append(candles, c)
+			continue
+		}
+		agg := &candles[len(candles)-1]
+		agg.High = decimal.Max(agg.High, c.High)
+		agg.Low = decimal.Min(agg.Low, c.Low)
+		agg.Close = c.Close
+		agg.Volume = agg.Volume.Add(c.Volume)
+	}
+	return candles
+}
+
+// firstStoredMinute returns the earliest one minute candle between start and end in memory or the database
+func (s *candleStore) firstStoredMinute(start time.Time, end time.Time) (first time.Time, ok bool, err error) {
+	s.mutex.RLock()
+	for ts, c := range s.cache[candle.OneMinute] {
+		if ts >= start.Unix() && ts <= end.Unix() && (!ok || c.Timestamp.Before(first)) {
+			first, ok = c.Timestamp, true
+		}
+	}
+	if s.live != nil && !s.live.Timestamp.Before(s.trusted) && !s.live.Timestamp.Before(start) && !s.live.Timestamp.After(end) &&
+		(!ok || s.live.Timestamp.Before(first)) {
+		first, ok = s.live.Timestamp, true
+	}
+	s.mutex.RUnlock()
+
+	var stored sql.NullTime
+	err = s.db.QueryRow("SELECT min(ts) FROM candles WHERE market = $1 AND interval = $2 AND ts BETWEEN $3 AND $4;", s.market.Name(), string(candle.OneMinute), start, end).Scan(&stored)
+	if err != nil {
+		return first, ok, fmt.Errorf("could not find the first stored candle: %w", err)
+	}
+	if stored.Valid && (!ok || stored.Time.Before(first)) {
+		first, ok = stored.Time, true
+	}
+	return
+}
+
+// load returns the base candles between start and end keyed by their unix timestamps. Gaps are filled with the
+// previous close.
+func (s *candleStore) load(base types.CandleInterval, start time.Time, end time.Time) (candles map[int64]candleDAO, err error) {
+	width := baseWidths[base]
+	start = start.Truncate(width)
+	candles = map[int64]candleDAO{}
+
+	// Check memory first
+	s.mutex.RLock()
+	for ts := start; !ts.After(end); ts = ts.Add(width) {
+		if c, ok := s.cache[base][ts.Unix()]; ok {
+			candles[ts.Unix()] = c
+		}
+	}
+	if s.live != nil && base == candle.OneMinute && !s.live.Timestamp.Before(s.trusted) && !s.live.Timestamp.Before(start) {
+		candles[s.live.Timestamp.Unix()] = *s.live
+	}
+	s.mutex.RUnlock()
+
+	// Then the database
+	first, last, missing := missingCandles(candles, start, end, width)
+	if missing {
+		err = s.loadFromDB(base, candles, first, last)
+		if err != nil {
+			return
+		}
+	}
+
+	// Then the exchange
+	first, last, missing = missingCandles(candles, start, end, width)
+	if missing {
+		err = s.loadFromExchange(base, candles, first, last)
+		if err != nil {
+			return
+		}
+	}
+
+	// Fill the gaps and keep the candles that have settled. Only candles the exchange reported are saved; the gaps
+	// are filled again from the exchange after a restart.
+	settled := time.Now().Add(-viper.GetDuration("candles.settleTime"))
+	var previous *candleDAO
+	fetched := []candleDAO{}
+	s.mutex.Lock()
+	for ts := start; !ts.After(end); ts = ts.Add(width) {
+		c, reported := candles[ts.Unix()]
+		if !reported {
+			if previous == nil {
+				continue
+			}
+			c = candleDAO{ts, previous.Close, previous.Close, previous.Close, previous.Close, decimal.Zero}
+			candles[ts.Unix()] = c
+		}
+		if ts.Add(width).Before(settled) && s.cacheCandle(base, c) && reported {
+			fetched = append(fetched, c)
+		}
+		previous = &c
+	}
+	s.mutex.Unlock()
+
+	s.save(base, fetched)
+	return
+}
+
+func (s *candleStore) loadFromDB(base types.CandleInterval, candles map[int64]candleDAO, start time.Time, end time.Time) error {
+	rows, err := s.db.Query("SELECT data FROM candles WHERE market = $1 AND interval = $2 AND ts BETWEEN $3 AND $4;", s.market.Name(), string(base), start, end)
+	if err != nil {
+		return fmt.Errorf("could not load candles from database: %w", err)
+	}
+	defer rows.Close()
+
+	loaded := []candleDAO{}
+	for rows.Next() {
+		c := candleDAO{}
+		err = rows.Scan(&c)
+		if err != nil {
+			return fmt.Errorf("could not load candle from database: %w", err)
+		}
+		loaded = append(loaded, c)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, c := range loaded {
+		candles[c.Timestamp.Unix()] = c
+		s.cache[base][c.Timestamp.Unix()] = c
+	}
+	return nil
+}
+
+func (s *candleStore) loadFromExchange(base types.CandleInterval, candles map[int64]candleDAO, start time.Time, end time.Time) error {
+	width := baseWidths[base]
+	for from := start; !from.After(end); from = from.Add(width * maxCandlesPerRequest) {
+		to := from.Add(width * (maxCandlesPerRequest - 1))
+		if to.After(end) {
+			to = end
+		}
+
+		log.WithFields(log.F("interval", base), log.F("start", from), log.F("end", to)).Debug("fetching candles")
+		fetched, err := s.market.Candles(base, from, to)
+		if err != nil {
+			return fmt.Errorf("could not fetch candles: %w", err)
+		}
+		for _, c := range fetched {
+			ts := c.Timestamp().Truncate(width)
+			if _, ok := candles[ts.Unix()]; ok || ts.Before(start) || ts.After(end) {
+				continue
+			}
+			candles[ts.Unix()] = candleDAO{ts, c.Open(), c.High(), c.Low(), c.Close(), c.Volume()}
+		}
+	}
+	return nil
+}
+
+// missingCandles returns the range of timestamps between the first and last candle missing from the map
+func missingCandles(candles map[int64]candleDAO, start time.Time, end time.Time, width time.Duration) (first time.Time, last time.Time, missing bool) {
+	for ts := start; !ts.After(end); ts = ts.Add(width) {
+		if _, ok := candles[ts.Unix()]; ok {
+			continue
+		}
+		if !missing {
+			first = ts
+			missing = true
+		}
+		last = ts
+	}
+	return
+}
+
+func (s *candleStore) initializeDB() error {
+	_, err := s.db.Exec("CREATE TABLE IF NOT EXISTS candles (market varchar(32), interval varchar(8), ts timestamptz, data JSONB, primary key (market, interval, ts));")
+	if err != nil {
+		return err
+	}
+	return nil
+}
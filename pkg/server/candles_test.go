@@ -0,0 +1,278 @@
+package server
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/candle"
+	"github.com/sinisterminister/currencytrader/types/ticker"
+	"github.com/sinisterminister/moneytree/pkg/pair/fake_types"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+)
+
+// candleMarket serves the candles the test gives it and remembers the ranges it was asked for
+type candleMarket struct {
+	*fake_types.Market
+
+	mutex    sync.Mutex
+	candles  []types.Candle
+	wide     map[types.CandleInterval][]types.Candle
+	requests [][2]time.Time
+}
+
+func (m *candleMarket) Candles(interval types.CandleInterval, start time.Time, end time.Time) ([]types.Candle, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.requests = append(m.requests, [2]time.Time{start, end})
+	served := m.candles
+	if interval != candle.OneMinute {
+		served = m.wide[interval]
+	}
+	candles := []types.Candle{}
+	for _, c := range served {
+		if !c.Timestamp().Before(start) && !c.Timestamp().After(end) {
+			candles = append(candles, c)
+		}
+	}
+	return candles, nil
+}
+
+func (m *candleMarket) add(ts time.Time, open, high, low, close, volume float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.candles = append(m.candles, newCandle(ts, open, high, low, close, volume))
+}
+
+// addWide adds a candle the exchange serves for an interval other than one minute
+func (m *candleMarket) addWide(interval types.CandleInterval, ts time.Time, open, high, low, close, volume float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.wide == nil {
+		m.wide = map[types.CandleInterval][]types.Candle{}
+	}
+	m.wide[interval] = append(m.wide[interval], newCandle(ts, open, high, low, close, volume))
+}
+
+func newCandle(ts time.Time, open, high, low, close, volume float64) types.Candle {
+	return candle.New(types.CandleDTO{
+		Timestamp: ts,
+		Open:      decimal.NewFromFloat(open),
+		High:      decimal.NewFromFloat(high),
+		Low:       decimal.NewFromFloat(low),
+		Close:     decimal.NewFromFloat(close),
+		Volume:    decimal.NewFromFloat(volume),
+	})
+}
+
+func (m *candleMarket) fetched() [][2]time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([][2]time.Time{}, m.requests...)
+}
+
+type candleHarness struct {
+	t      *testing.T
+	db     *sql.DB
+	market *candleMarket
+	store  *candleStore
+
+	// An hour ago, so every candle has settled
+	start time.Time
+}
+
+func newCandleHarness(t *testing.T) *candleHarness {
+	db := openTestDB()
+	t.Cleanup(func() { db.Close() })
+
+	trader := fake_types.NewTrader(btcUSD(), types.FeesDTO{})
+	h := &candleHarness{t: t, db: db, start: time.Now().Add(-time.Hour).Truncate(time.Hour)}
+	h.market = &candleMarket{Market: trader.Market()}
+	h.store = h.newStore()
+	return h
+}
+
+// newStore starts another store on the same database and market with nothing in memory
+func (h *candleHarness) newStore() *candleStore {
+	h.t.Helper()
+	store, err := newCandleStore(h.db, h.market)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return store
+}
+
+func (h *candleHarness) minute(i int) time.Time { return h.start.Add(time.Duration(i) * time.Minute) }
+
+func (h *candleHarness) candles(store *candleStore, duration proto.GetCandlesRequest_Duration, start time.Time, end time.Time) []candleDAO {
+	h.t.Helper()
+	candles, err := store.Candles(candleIntervals[duration], start, end)
+	if err != nil {
+		h.t.Fatalf("could not get candles: %s", err)
+	}
+	return candles
+}
+
+func (h *candleHarness) saved() map[int64]candleDAO {
+	h.t.Helper()
+	candles := map[int64]candleDAO{}
+	err := h.store.loadFromDB(candle.OneMinute, candles, h.start.Add(-24*time.Hour), h.start.Add(24*time.Hour))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return candles
+}
+
+func expectCandle(t *testing.T, c candleDAO, ts time.Time, open, high, low, close, volume float64) {
+	t.Helper()
+	expected := candleDAO{ts, decimal.NewFromFloat(open), decimal.NewFromFloat(high), decimal.NewFromFloat(low), decimal.NewFromFloat(close), decimal.NewFromFloat(volume)}
+	if !c.Timestamp.Equal(expected.Timestamp) || !c.Open.Equal(expected.Open) || !c.High.Equal(expected.High) ||
+		!c.Low.Equal(expected.Low) || !c.Close.Equal(expected.Close) || !c.Volume.Equal(expected.Volume) {
+		t.Errorf("expected candle %+v, got %+v", expected, c)
+	}
+}
+
+func TestCandles_Aggregation(t *testing.T) {
+	h := newCandleHarness(t)
+	for i := 0; i < 7; i++ {
+		price := float64(100 + i)
+		h.market.add(h.minute(i), price, price+2, price-1, price+1, 1)
+	}
+
+	// The start is moved back to the start of its bucket and the end's bucket only has the end in it
+	candles := h.candles(h.store, proto.GetCandlesRequest_THREE_MINUTES, h.minute(1), h.minute(6))
+	if len(candles) != 3 {
+		t.Fatalf("expected 3 candles, got %d", len(candles))
+	}
+	expectCandle(t, candles[0], h.minute(6), 106, 108, 105, 107, 1)
+	expectCandle(t, candles[1], h.minute(3), 103, 107, 102, 106, 3)
+	expectCandle(t, candles[2], h.minute(0), 100, 104, 99, 103, 3)
+}
+
+func TestCandles_AggregatedFromStoredMinutes(t *testing.T) {
+	h := newCandleHarness(t)
+	h.market.addWide(candle.FiveMinutes, h.minute(0), 90, 95, 85, 92, 10)
+	h.market.addWide(candle.FiveMinutes, h.minute(5), 1, 1, 1, 1, 1)
+
+	// The stored minutes start partway into the first bucket
+	minutes := []candleDAO{}
+	for i := 3; i < 10; i++ {
+		price := decimal.NewFromInt(int64(100 + i))
+		minutes = append(minutes, candleDAO{h.minute(i), price, price.Add(decimal.NewFromInt(2)), price.Sub(decimal.NewFromInt(1)), price.Add(decimal.NewFromInt(1)), decimal.NewFromInt(1)})
+	}
+	h.store.save(candle.OneMinute, minutes)
+
+	// So only the first bucket is backfilled from the exchange
+	candles := h.candles(h.store, proto.GetCandlesRequest_FIVE_MINUTES, h.minute(0), h.minute(9))
+	if len(candles) != 2 {
+		t.Fatalf("expected 2 candles, got %d", len(candles))
+	}
+	expectCandle(t, candles[0], h.minute(5), 105, 111, 104, 110, 5)
+	expectCandle(t, candles[1], h.minute(0), 90, 95, 85, 92, 10)
+	requests := h.market.fetched()
+	if len(requests) != 1 || !requests[0][0].Equal(h.minute(0)) || !requests[0][1].Equal(h.minute(0)) {
+		t.Errorf("expected only the first bucket to be fetched, got %v", requests)
+	}
+}
+
+func TestCandles_NewestFirst(t *testing.T) {
+	h := newCandleHarness(t)
+	for i := 0; i < 5; i++ {
+		h.market.add(h.minute(i), 100, 100, 100, 100, 1)
+	}
+
+	candles := h.candles(h.store, proto.GetCandlesRequest_ONE_MINUTE, h.minute(0), h.minute(4))
+	if len(candles) != 5 {
+		t.Fatalf("expected 5 candles, got %d", len(candles))
+	}
+	for i, c := range candles {
+		if !c.Timestamp.Equal(h.minute(4 - i)) {
+			t.Errorf("expected candle %d to be at %s, got %s", i, h.minute(4-i), c.Timestamp)
+		}
+	}
+}
+
+func TestCandles_GapFill(t *testing.T) {
+	h := newCandleHarness(t)
+	h.market.add(h.minute(1), 100, 102, 99, 101, 1)
+	h.market.add(h.minute(3), 101, 103, 100, 102, 1)
+
+	// Nothing comes before the first trade and the gap after it carries its close
+	candles := h.candles(h.store, proto.GetCandlesRequest_ONE_MINUTE, h.minute(0), h.minute(3))
+	if len(candles) != 3 {
+		t.Fatalf("expected 3 candles, got %d", len(candles))
+	}
+	expectCandle(t, candles[0], h.minute(3), 101, 103, 100, 102, 1)
+	expectCandle(t, candles[1], h.minute(2), 101, 101, 101, 101, 0)
+	expectCandle(t, candles[2], h.minute(1), 100, 102, 99, 101, 1)
+
+	// Only what the exchange reported is saved
+	saved := h.saved()
+	if _, ok := saved[h.minute(2).Unix()]; ok || len(saved) != 2 {
+		t.Errorf("expected only the traded minutes to be saved, got %v", saved)
+	}
+
+	// So another store asks the exchange for the gaps again
+	h.candles(h.newStore(), proto.GetCandlesRequest_ONE_MINUTE, h.minute(1), h.minute(3))
+	requests := h.market.fetched()
+	if len(requests) != 2 || !requests[1][0].Equal(h.minute(2)) || !requests[1][1].Equal(h.minute(2)) {
+		t.Errorf("expected the second store to only fetch the gap at %s, got %v", h.minute(2), requests)
+	}
+}
+
+func TestCandles_DatabaseRoundTrip(t *testing.T) {
+	h := newCandleHarness(t)
+	for i := 0; i < 3; i++ {
+		price := float64(100 + i)
+		h.market.add(h.minute(i), price, price+2, price-1, price+1, 1.5)
+	}
+	h.candles(h.store, proto.GetCandlesRequest_ONE_MINUTE, h.minute(0), h.minute(2))
+
+	// A store with nothing in memory gets the candles from the database without going to the exchange
+	candles := h.candles(h.newStore(), proto.GetCandlesRequest_ONE_MINUTE, h.minute(0), h.minute(2))
+	if len(candles) != 3 {
+		t.Fatalf("expected 3 candles, got %d", len(candles))
+	}
+	expectCandle(t, candles[0], h.minute(2), 102, 104, 101, 103, 1.5)
+	expectCandle(t, candles[2], h.minute(0), 100, 102, 99, 101, 1.5)
+	if requests := h.market.fetched(); len(requests) != 1 {
+		t.Errorf("expected the exchange to be asked once, got %v", requests)
+	}
+}
+
+func TestCandles_Ticks(t *testing.T) {
+	h := newCandleHarness(t)
+	tick := func(offset time.Duration, price float64) {
+		h.store.addTick(ticker.New(types.TickerDTO{Price: decimal.NewFromFloat(price), Quantity: decimal.NewFromInt(1), Timestamp: h.start.Add(offset)}))
+	}
+
+	tick(10*time.Second, 100)
+	tick(20*time.Second, 103)
+	tick(30*time.Second, 98)
+	tick(50*time.Second, 101)
+	if saved := h.saved(); len(saved) != 0 {
+		t.Errorf("expected nothing to be saved while the minute is still forming, got %v", saved)
+	}
+
+	// The next minute closes it out
+	tick(time.Minute+5*time.Second, 102)
+	saved := h.saved()
+	if len(saved) != 1 {
+		t.Fatalf("expected the closed minute to be saved, got %v", saved)
+	}
+	expectCandle(t, saved[h.start.Unix()], h.start, 100, 103, 98, 101, 4)
+
+	candles := h.candles(h.store, proto.GetCandlesRequest_ONE_MINUTE, h.minute(0), h.minute(1))
+	if len(candles) != 2 {
+		t.Fatalf("expected 2 candles, got %d", len(candles))
+	}
+	expectCandle(t, candles[0], h.minute(1), 102, 102, 102, 102, 1)
+	expectCandle(t, candles[1], h.minute(0), 100, 103, 98, 101, 4)
+}
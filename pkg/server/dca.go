@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/moneytree/pkg/dca"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/sinisterminister/moneytree/pkg/trix"
+	"github.com/spf13/viper"
+)
+
+func (s *Server) CreateSchedule(ctx context.Context, in *proto.CreateScheduleRequest) (*proto.Schedule, error) {
+	log.WithFields(log.F("caller", callerFromContext(ctx))).Infof("received create schedule request for %s every %q", in.QuoteAmount, in.Cron)
+	amount, err := decimal.NewFromString(in.QuoteAmount)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse quote amount: %w", err)
+	}
+	skipAbove, err := parseThreshold(in.SkipAbove)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse skip threshold: %w", err)
+	}
+	doubleBelow, err := parseThreshold(in.DoubleBelow)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse double threshold: %w", err)
+	}
+
+	schedule, err := s.dca.Create(dca.Schedule{
+		Cron:        in.Cron,
+		QuoteAmount: amount,
+		SkipAbove:   skipAbove,
+		DoubleBelow: doubleBelow,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return createProtoSchedule(schedule), nil
+}
+
+func (s *Server) ListSchedules(ctx context.Context, in *proto.NullRequest) (*proto.ScheduleCollection, error) {
+	log.Debug("Received list schedules request")
+	schedules, err := s.dca.List()
+	if err != nil {
+		return nil, err
+	}
+
+	collection := &proto.ScheduleCollection{}
+	for _, schedule := range schedules {
+		collection.Schedules = append(collection.Schedules, createProtoSchedule(schedule))
+	}
+	return collection, nil
+}
+
+// parseThreshold parses an optional oscillator threshold; empty means unset
+func parseThreshold(value string) (decimal.NullDecimal, error) {
+	if value == "" {
+		return decimal.NullDecimal{}, nil
+	}
+	threshold, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.NullDecimal{}, err
+	}
+	return decimal.NullDecimal{Decimal: threshold, Valid: true}, nil
+}
+
+func createProtoSchedule(schedule dca.Schedule) *proto.Schedule {
+	protoSchedule := &proto.Schedule{
+		Uuid:        schedule.Uuid,
+		Cron:        schedule.Cron,
+		QuoteAmount: schedule.QuoteAmount.String(),
+		Created:     schedule.CreatedAt.Unix(),
+		NextRun:     schedule.NextRun.Unix(),
+	}
+	if schedule.SkipAbove.Valid {
+		protoSchedule.SkipAbove = schedule.SkipAbove.Decimal.String()
+	}
+	if schedule.DoubleBelow.Valid {
+		protoSchedule.DoubleBelow = schedule.DoubleBelow.Decimal.String()
+	}
+	for _, run := range schedule.Runs {
+		protoSchedule.Runs = append(protoSchedule.Runs, &proto.ScheduleRun{
+			Ts:       run.Time.Unix(),
+			Action:   string(run.Action),
+			Details:  run.Details,
+			OrderId:  run.OrderID,
+			Price:    run.Price.String(),
+			Quantity: run.Quantity.String(),
+			Amount:   run.Amount.String(),
+			Status:   string(run.Status),
+			Filled:   run.Filled.String(),
+		})
+	}
+	return protoSchedule
+}
+
+// trixSignal reads the trix oscillator from the stored candles for the schedules
+type trixSignal struct {
+	candles *candleStore
+}
+
+func (t *trixSignal) Oscillator() (decimal.Decimal, error) {
+	duration, ok := proto.GetCandlesRequest_Duration_value[viper.GetString("dca.trixDuration")]
+	if !ok {
+		return decimal.Zero, fmt.Errorf("unknown candle duration %s", viper.GetString("dca.trixDuration"))
+	}
+
+	now := time.Now()
+	candles, err := t.candles.Candles(candleIntervals[proto.GetCandlesRequest_Duration(duration)], now.Add(-viper.GetDuration("dca.trixLookback")), now)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("could not load candles: %w", err)
+	}
+
+	// Oldest first, leaving out the candle that's still forming
+	prices := []float64{}
+	for i := len(candles) - 1; i > 0; i-- {
+		price, _ := candles[i].Close.Float64()
+		prices = append(prices, price)
+	}
+	_, oscillator, err := trix.GetTrixIndicator(prices, 5)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimal.NewFromFloat(oscillator), nil
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-playground/log/v7"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+)
+
+func (s *Server) GetGrid(ctx context.Context, in *proto.NullRequest) (*proto.Grid, error) {
+	log.Debug("Received get grid request")
+	return s.createProtoGrid(s.grid.State()), nil
+}
+
+func (s *Server) StartGrid(ctx context.Context, in *proto.StartGridRequest) (*proto.Grid, error) {
+	log.WithFields(log.F("caller", callerFromContext(ctx))).Infof("received start grid request from %s to %s", in.Lower, in.Upper)
+	lower, err := decimal.NewFromString(in.Lower)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse lower price: %w", err)
+	}
+	upper, err := decimal.NewFromString(in.Upper)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse upper price: %w", err)
+	}
+	quantity, err := decimal.NewFromString(in.Quantity)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse quantity: %w", err)
+	}
+
+	state, err := s.grid.Start(pair.GridConfig{Lower: lower, Upper: upper, Levels: int(in.Levels), Quantity: quantity})
+	if err != nil {
+		return nil, err
+	}
+	return s.createProtoGrid(state), nil
+}
+
+func (s *Server) StopGrid(ctx context.Context, in *proto.StopGridRequest) (*proto.Grid, error) {
+	log.WithFields(log.F("caller", callerFromContext(ctx))).Info("received stop grid request")
+	state, err := s.grid.Stop(in.CancelOpenPairs)
+	if err != nil {
+		return nil, err
+	}
+	return s.createProtoGrid(state), nil
+}
+
+func (s *Server) createProtoGrid(state pair.GridState) *proto.Grid {
+	grid := &proto.Grid{
+		Running:  state.Running,
+		Lower:    state.Config.Lower.String(),
+		Upper:    state.Config.Upper.String(),
+		Levels:   int32(state.Config.Levels),
+		Quantity: state.Config.Quantity.String(),
+		Started:  state.StartedAt.Unix(),
+		Stopped:  state.StoppedAt.Unix(),
+	}
+	for _, level := range state.Levels {
+		protoLevel := &proto.GridLevel{
+			Price:     level.Price.String(),
+			Direction: string(level.Direction),
+			Completed: int32(level.Completed),
+			Paused:    level.Paused,
+			Details:   level.Details,
+		}
+		if level.PairUUID != "" {
+			op, err := s.pairSvc.Load(level.PairUUID)
+			if err != nil {
+				log.WithError(err).Errorf("could not load grid pair %s", level.PairUUID)
+			} else {
+				protoLevel.Pair = createProtoPair(op)
+			}
+		}
+		grid.Ladder = append(grid.Ladder, protoLevel)
+	}
+	return grid
+}
@@ -17,7 +17,9 @@ func init() {
 	viper.AddConfigPath(".")
 	viper.AutomaticEnv()
 	err := viper.ReadInConfig()
-	if err != nil {
+	if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+		log.Warn("no config file found, using defaults and environment")
+	} else if err != nil {
 		log.WithError(err).Panic("fatal error loading config file")
 	}
 
@@ -27,6 +29,83 @@ func init() {
 	viper.SetDefault("postgres.pass", "postgres")
 	viper.SetDefault("postgres.database", "moneytree")
 
+	// Halt trading once the realized loss over the loss window reaches this amount of quote currency. 0 disables the limit
+	viper.SetDefault("riskGuard.maxLoss", 0)
+	viper.SetDefault("riskGuard.lossWindow", "24h")
+
+	// Halt trading after this many reversed or broken pairs in a row over the failure window. 0 disables the limit
+	viper.SetDefault("riskGuard.maxConsecutiveFailures", 0)
+	viper.SetDefault("riskGuard.failureWindow", "6h")
+
+	// Cancel the first legs of open pairs that haven't been filled when trading is halted
+	viper.SetDefault("riskGuard.cancelOpenFirstLegs", false)
+
+	// Keep this much candle history in memory; older candles are loaded from the database
+	viper.SetDefault("candles.retention", "24h")
+
+	// Only save candles once the exchange has had this long to settle them
+	viper.SetDefault("candles.settleTime", "2m")
+
+	// Number of updates buffered for each streaming client before the oldest are dropped
+	viper.SetDefault("streams.bufferSize", 16)
+
+	// How often order book snapshots are taken while clients are streaming them
+	viper.SetDefault("streams.orderBookInterval", "1s")
+
+	// Serve over TLS with tls.cert and tls.key. Client certificates are required when tls.clientCA is set
+	viper.SetDefault("tls.enabled", false)
+
+	// Post notifications to notifier.webhooks, each with a url, a secret to sign the payloads with and the events
+	// it wants. Failed deliveries are retried with a doubling backoff until they run out of attempts
+	viper.SetDefault("notifier.timeout", "10s")
+	viper.SetDefault("notifier.pollInterval", "1s")
+	viper.SetDefault("notifier.maxAttempts", 10)
+	viper.SetDefault("notifier.backoff", "5s")
+	viper.SetDefault("notifier.maxBackoff", "1h")
+
+	// Hour of the day, in UTC, to send the daily PnL summary
+	viper.SetDefault("notifier.dailySummaryHour", 0)
+
+	// Exchange to trade on; coinbase or simulated. Each provider reads its settings from under its own name
+	viper.SetDefault("provider", "coinbase")
+
+	// Paper trade BTC-USD in memory. The price starts at simulated.price and takes a lognormal step with a standard
+	// deviation of simulated.volatility every tick interval. Resting orders fill at the maker rate once the price
+	// crosses them and crossing orders fill straight away at the taker rate. The walk is extended simulated.history
+	// back from the starting price so the trix strategies and signal have candles to warm up on
+	viper.SetDefault("simulated.price", 10000)
+	viper.SetDefault("simulated.volatility", 0.0005)
+	viper.SetDefault("simulated.tickInterval", "1s")
+	viper.SetDefault("simulated.history", "72h")
+	viper.SetDefault("simulated.seed", 0)
+	viper.SetDefault("simulated.makerRate", 0.005)
+	viper.SetDefault("simulated.takerRate", 0.005)
+	viper.SetDefault("simulated.balances", map[string]interface{}{"BTC": "1", "USD": "10000"})
+	viper.SetDefault("simulated.basePrecision", 8)
+	viper.SetDefault("simulated.quotePrecision", 2)
+	viper.SetDefault("simulated.priceIncrement", 0.01)
+	viper.SetDefault("simulated.quantityStep", 0.00000001)
+	viper.SetDefault("simulated.minQuantity", 0.001)
+
+	// Exchange requests are queued and sent at up to scheduler.rateLimit per second, with bursts of up to burstLimit.
+	// Each endpoint has its own limit on top of that. Cancels and reversals go first, then reads, then new orders
+	viper.SetDefault("scheduler.rateLimit", 5)
+	viper.SetDefault("scheduler.burstLimit", 10)
+	viper.SetDefault("scheduler.placeOrder.rateLimit", 3)
+	viper.SetDefault("scheduler.placeOrder.burstLimit", 5)
+	viper.SetDefault("scheduler.cancelOrder.rateLimit", 5)
+	viper.SetDefault("scheduler.cancelOrder.burstLimit", 10)
+	viper.SetDefault("scheduler.getOrder.rateLimit", 3)
+	viper.SetDefault("scheduler.getOrder.burstLimit", 5)
+	viper.SetDefault("scheduler.account.rateLimit", 2)
+	viper.SetDefault("scheduler.account.burstLimit", 4)
+	viper.SetDefault("scheduler.marketData.rateLimit", 3)
+	viper.SetDefault("scheduler.marketData.burstLimit", 5)
+
+	// Read the trix oscillator for the accumulation schedules from candles of this duration over the lookback
+	viper.SetDefault("dca.trixDuration", "ONE_HOUR")
+	viper.SetDefault("dca.trixLookback", "72h")
+
 	// Setup json logging for containers
 	if _, err := os.Stat("/.dockerenv"); err == nil {
 		// Setup the console logger
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// memDB is just enough of a database/sql driver to save and load the server's state without postgres. Each data
+// source name gets its own tables.
+type memDB struct {
+	mutex  sync.Mutex
+	tables map[string]*memTable
+}
+
+type memTable struct {
+	mutex sync.Mutex
+
+	orderPairs map[string][]byte
+	riskGuard  []byte
+	candles    []memCandle
+	auditLog   []memAuditEntry
+}
+
+type memAuditEntry struct {
+	createdAt time.Time
+	data      []byte
+}
+
+type memCandle struct {
+	market   string
+	interval string
+	ts       time.Time
+	data     []byte
+}
+
+var testDB = &memDB{tables: map[string]*memTable{}}
+
+func init() {
+	sql.Register("memdb", testDB)
+}
+
+// openTestDB opens a fresh set of tables
+func openTestDB() *sql.DB {
+	db, err := sql.Open("memdb", uuid.NewV4().String())
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func (d *memDB) Open(name string) (driver.Conn, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	table, ok := d.tables[name]
+	if !ok {
+		table = &memTable{orderPairs: map[string][]byte{}}
+		d.tables[name] = table
+	}
+	return &memConn{table}, nil
+}
+
+type memConn struct{ table *memTable }
+
+func (c *memConn) Prepare(query string) (driver.Stmt, error) { return &memStmt{c.table, query}, nil }
+
+func (c *memConn) Close() error { return nil }
+
+func (c *memConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("memdb does not support transactions")
+}
+
+type memStmt struct {
+	table *memTable
+	query string
+}
+
+func (s *memStmt) Close() error { return nil }
+
+func (s *memStmt) NumInput() int { return -1 }
+
+func (s *memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.table.mutex.Lock()
+	defer s.table.mutex.Unlock()
+
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+	case strings.HasPrefix(s.query, "INSERT INTO orderpairs"):
+		s.table.orderPairs[args[0].(string)] = append([]byte{}, args[1].([]byte)...)
+	case strings.HasPrefix(s.query, "INSERT INTO riskguard"):
+		s.table.riskGuard = append([]byte{}, args[0].([]byte)...)
+	case strings.HasPrefix(s.query, "INSERT INTO auditlog"):
+		s.table.auditLog = append(s.table.auditLog, memAuditEntry{args[0].(time.Time), append([]byte{}, args[1].([]byte)...)})
+	case strings.HasPrefix(s.query, "INSERT INTO candles"):
+		c := memCandle{args[0].(string), args[1].(string), args[2].(time.Time), append([]byte{}, args[3].([]byte)...)}
+		for _, saved := range s.table.candles {
+			if saved.market == c.market && saved.interval == c.interval && saved.ts.Equal(c.ts) {
+				return driver.RowsAffected(0), nil
+			}
+		}
+		s.table.candles = append(s.table.candles, c)
+	default:
+		return nil, fmt.Errorf("memdb does not support %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.table.mutex.Lock()
+	defer s.table.mutex.Unlock()
+
+	rows := &memRows{columns: []string{"data"}}
+	switch {
+	case strings.HasPrefix(s.query, "SELECT data FROM riskguard WHERE id = 1"):
+		if s.table.riskGuard != nil {
+			rows.data = append(rows.data, []driver.Value{s.table.riskGuard})
+		}
+	case strings.HasPrefix(s.query, "SELECT id, data FROM auditlog"):
+		rows.columns = []string{"id", "data"}
+		for id := int64(len(s.table.auditLog)); id > 0 && int64(len(rows.data)) < args[4].(int64); id-- {
+			entry := s.table.auditLog[id-1]
+			filter := struct{ Method, Caller string }{}
+			json.Unmarshal(entry.data, &filter)
+			if entry.createdAt.Before(args[0].(time.Time)) || entry.createdAt.After(args[1].(time.Time)) ||
+				(args[2] != "" && filter.Method != args[2]) || (args[3] != "" && filter.Caller != args[3]) {
+				continue
+			}
+			rows.data = append(rows.data, []driver.Value{id, entry.data})
+		}
+	case strings.HasPrefix(s.query, "SELECT min(ts) FROM candles"):
+		rows.columns = []string{"min"}
+		var first driver.Value
+		for _, c := range s.table.candles {
+			if c.market == args[0] && c.interval == args[1] && !c.ts.Before(args[2].(time.Time)) && !c.ts.After(args[3].(time.Time)) &&
+				(first == nil || c.ts.Before(first.(time.Time))) {
+				first = c.ts
+			}
+		}
+		rows.data = append(rows.data, []driver.Value{first})
+	case strings.HasPrefix(s.query, "SELECT data FROM candles"):
+		for _, c := range s.table.candles {
+			if c.market == args[0] && c.interval == args[1] && !c.ts.Before(args[2].(time.Time)) && !c.ts.After(args[3].(time.Time)) {
+				rows.data = append(rows.data, []driver.Value{c.data})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("memdb does not support %q", s.query)
+	}
+	return rows, nil
+}
+
+type memRows struct {
+	columns []string
+	data    [][]driver.Value
+	next    int
+}
+
+func (r *memRows) Columns() []string { return r.columns }
+
+func (r *memRows) Close() error { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.next])
+	r.next++
+	return nil
+}
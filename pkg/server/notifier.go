@@ -0,0 +1,312 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+	"github.com/spf13/viper"
+)
+
+type notificationEvent string
+
+var (
+	pairSuccessEvent    = notificationEvent(pair.PairSucceeded)
+	pairReversedEvent   = notificationEvent(pair.PairReversed)
+	pairBrokenEvent     = notificationEvent(pair.PairBroken)
+	lossMitigatorEvent  = notificationEvent(pair.LossMitigatorTriggered)
+	circuitBreakerEvent = notificationEvent("CIRCUIT_BREAKER")
+	dailyPnLEvent       = notificationEvent("DAILY_PNL")
+)
+
+type webhookConfig struct {
+	URL    string
+	Secret string
+	Events []string
+}
+
+// wants reports whether the webhook is subscribed to the event. Webhooks without events get all of them.
+func (w webhookConfig) wants(event notificationEvent) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if notificationEvent(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+type deliveryStatus string
+
+var (
+	deliveryPending   deliveryStatus = "PENDING"
+	deliveryDelivered deliveryStatus = "DELIVERED"
+	deliveryFailed    deliveryStatus = "FAILED"
+)
+
+type webhookDelivery struct {
+	URL           string            `json:"url"`
+	Event         notificationEvent `json:"event"`
+	Payload       json.RawMessage   `json:"payload"`
+	Status        deliveryStatus    `json:"status"`
+	Attempts      int               `json:"attempts"`
+	NextAttemptAt time.Time         `json:"nextAttemptAt"`
+	LastError     string            `json:"lastError,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt"`
+}
+
+func (d webhookDelivery) Value() (driver.Value, error) {
+	return json.Marshal(d)
+}
+
+func (d *webhookDelivery) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &d)
+}
+
+// notifier posts signed JSON payloads to the configured webhooks. Deliveries are queued in the database so they
+// survive restarts and are retried with exponential backoff until they succeed or run out of attempts.
+type notifier struct {
+	db       *sql.DB
+	pairSvc  *pair.Service
+	webhooks []webhookConfig
+	client   *http.Client
+}
+
+func newNotifier(db *sql.DB, pairSvc *pair.Service) (n *notifier, err error) {
+	n = &notifier{db: db, pairSvc: pairSvc, client: &http.Client{Timeout: viper.GetDuration("notifier.timeout")}}
+	err = viper.UnmarshalKey("notifier.webhooks", &n.webhooks)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse notifier.webhooks: %w", err)
+	}
+	for _, w := range n.webhooks {
+		if w.URL == "" {
+			return nil, fmt.Errorf("webhook url is empty")
+		}
+	}
+
+	err = n.initializeDB()
+	if err != nil {
+		return nil, err
+	}
+
+	pairSvc.AddEventListener(n)
+	return
+}
+
+// Start delivers the queued notifications and sends the daily summaries until stopped
+func (n *notifier) Start(stop <-chan bool) {
+	if len(n.webhooks) == 0 {
+		log.Info("no webhooks are configured; notifier is disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(viper.GetDuration("notifier.pollInterval"))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				n.deliverPending()
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(nextDailySummary(time.Now())))
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case now := <-timer.C:
+				n.sendDailySummary(now)
+			}
+		}
+	}()
+}
+
+func (n *notifier) PairEvent(event pair.Event) {
+	n.Notify(notificationEvent(event.Kind), map[string]interface{}{
+		"pair":    createProtoPair(event.Pair),
+		"details": event.Details,
+	})
+}
+
+// Notify queues the event for every webhook that wants it
+func (n *notifier) Notify(event notificationEvent, data map[string]interface{}) {
+	if len(n.webhooks) == 0 {
+		return
+	}
+
+	payload := map[string]interface{}{"event": event, "time": time.Now()}
+	for k, v := range data {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.WithError(err).Errorf("could not build %s notification", event)
+		return
+	}
+
+	for _, w := range n.webhooks {
+		if !w.wants(event) {
+			continue
+		}
+		delivery := webhookDelivery{URL: w.URL, Event: event, Payload: body, Status: deliveryPending, NextAttemptAt: time.Now(), CreatedAt: time.Now()}
+		_, err = n.db.Exec("INSERT INTO webhookdeliveries (data) VALUES ($1);", delivery)
+		if err != nil {
+			log.WithError(err).Errorf("could not queue %s notification for %s", event, w.URL)
+		}
+	}
+}
+
+func (n *notifier) deliverPending() {
+	rows, err := n.db.Query(`SELECT id, data FROM webhookdeliveries
+		WHERE data->>'status' = 'PENDING' AND (data->>'nextAttemptAt')::timestamptz <= now()
+		ORDER BY id LIMIT 20;`)
+	if err != nil {
+		log.WithError(err).Error("could not load pending notifications")
+		return
+	}
+	ids := []int64{}
+	deliveries := []webhookDelivery{}
+	for rows.Next() {
+		var id int64
+		delivery := webhookDelivery{}
+		err = rows.Scan(&id, &delivery)
+		if err != nil {
+			log.WithError(err).Error("could not load pending notification")
+			continue
+		}
+		ids = append(ids, id)
+		deliveries = append(deliveries, delivery)
+	}
+	rows.Close()
+
+	for i, delivery := range deliveries {
+		n.attempt(ids[i], delivery)
+	}
+}
+
+func (n *notifier) attempt(id int64, delivery webhookDelivery) {
+	delivery.Attempts++
+	err := n.post(id, delivery)
+	if err == nil {
+		delivery.Status = deliveryDelivered
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= viper.GetInt("notifier.maxAttempts") {
+			log.WithError(err).Alertf("giving up on %s notification to %s after %d attempts", delivery.Event, delivery.URL, delivery.Attempts)
+			delivery.Status = deliveryFailed
+		} else {
+			delivery.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+			log.WithError(err).Warnf("could not deliver %s notification to %s; retrying at %s", delivery.Event, delivery.URL, delivery.NextAttemptAt.Format(time.RFC3339))
+		}
+	}
+
+	_, err = n.db.Exec("UPDATE webhookdeliveries SET data = $2 WHERE id = $1;", id, delivery)
+	if err != nil {
+		log.WithError(err).Errorf("could not save notification %d", id)
+	}
+}
+
+func (n *notifier) post(id int64, delivery webhookDelivery) error {
+	var secret string
+	for _, w := range n.webhooks {
+		if w.URL == delivery.URL {
+			secret = w.Secret
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Moneytree-Event", string(delivery.Event))
+	req.Header.Set("X-Moneytree-Delivery", fmt.Sprint(id))
+	if secret != "" {
+		req.Header.Set("X-Moneytree-Signature", "sha256="+signPayload(secret, delivery.Payload))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", res.Status)
+	}
+	return nil
+}
+
+func (n *notifier) sendDailySummary(now time.Time) {
+	start := now.Add(-24 * time.Hour)
+	ret, err := n.pairSvc.RealizedReturn(start, now)
+	if err != nil {
+		log.WithError(err).Error("could not calculate daily PnL")
+		return
+	}
+	n.Notify(dailyPnLEvent, map[string]interface{}{
+		"start":          start,
+		"end":            now,
+		"realizedReturn": ret,
+	})
+}
+
+// signPayload returns the hex encoded HMAC-SHA256 of the payload
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff doubles the wait after each failed attempt up to notifier.maxBackoff
+func webhookBackoff(attempts int) time.Duration {
+	backoff := viper.GetDuration("notifier.backoff")
+	max := viper.GetDuration("notifier.maxBackoff")
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// nextDailySummary returns the next time the daily summary is due at notifier.dailySummaryHour UTC
+func nextDailySummary(now time.Time) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), viper.GetInt("notifier.dailySummaryHour"), 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+	return next
+}
+
+func (n *notifier) initializeDB() error {
+	_, err := n.db.Exec("CREATE TABLE IF NOT EXISTS webhookdeliveries (id bigserial primary key, data JSONB);")
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		payload string
+		sig     string
+	}{
+		{"empty", "", "", "b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad"},
+		{"known", "key", "The quick brown fox jumps over the lazy dog", "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{"other secret", "other", "The quick brown fox jumps over the lazy dog", "f1ceb2ae30d9ae1bb4259f1a41bfa3cb1d6266a1fe2f860e7cdbcc0973bffbb8"},
+		{"json", "s3cret", `{"event":"PAIR_SUCCESS"}`, "2de6fe199f050057dc53124426906909e472b25f47ec1480428453c48181d4e5"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if sig := signPayload(test.secret, []byte(test.payload)); sig != test.sig {
+				t.Errorf("expected %s, got %s", test.sig, sig)
+			}
+		})
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	setConfig(t, "notifier.backoff", "1s")
+	setConfig(t, "notifier.maxBackoff", "10s")
+
+	tests := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if backoff := webhookBackoff(test.attempts); backoff != test.backoff {
+			t.Errorf("expected to wait %s after %d attempts, got %s", test.backoff, test.attempts, backoff)
+		}
+	}
+}
+
+func TestNextDailySummary(t *testing.T) {
+	eastern := time.FixedZone("EST", -5*60*60)
+	tests := []struct {
+		name string
+		hour int
+		now  time.Time
+		next time.Time
+	}{
+		{"later today", 9, time.Date(2021, 3, 4, 8, 59, 59, 0, time.UTC), time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC)},
+		{"due now", 9, time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC), time.Date(2021, 3, 5, 9, 0, 0, 0, time.UTC)},
+		{"tomorrow", 9, time.Date(2021, 3, 4, 9, 0, 1, 0, time.UTC), time.Date(2021, 3, 5, 9, 0, 0, 0, time.UTC)},
+		{"midnight", 0, time.Date(2021, 3, 4, 23, 59, 0, 0, time.UTC), time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"end of month", 9, time.Date(2021, 2, 28, 12, 0, 0, 0, time.UTC), time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)},
+		{"end of year", 9, time.Date(2021, 12, 31, 23, 30, 0, 0, time.UTC), time.Date(2022, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{"local time already past midnight UTC", 2, time.Date(2021, 3, 4, 22, 0, 0, 0, eastern), time.Date(2021, 3, 6, 2, 0, 0, 0, time.UTC)},
+		{"local time still before the hour UTC", 4, time.Date(2021, 3, 4, 22, 0, 0, 0, eastern), time.Date(2021, 3, 5, 4, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setConfig(t, "notifier.dailySummaryHour", test.hour)
+			if next := nextDailySummary(test.now); !next.Equal(test.next) {
+				t.Errorf("expected the summary to be due at %s, got %s", test.next, next)
+			}
+		})
+	}
+}
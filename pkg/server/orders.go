@@ -0,0 +1,65 @@
+package server
+
+import (
+	"time"
+
+	"github.com/sinisterminister/currencytrader/types"
+	coinbaseclient "github.com/sinisterminister/currencytrader/types/provider/coinbase/client"
+	"github.com/sinisterminister/go-coinbasepro/v2"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+)
+
+// coinbaseOrderLister lists the open orders straight from coinbase since the trader doesn't expose them
+type coinbaseOrderLister struct {
+	client *coinbaseclient.Client
+}
+
+func (l *coinbaseOrderLister) OpenOrderIDs(market types.Market) (ids []string, err error) {
+	cursor := l.client.ListOrders(coinbasepro.ListOrdersParams{Status: "open", ProductID: market.Name()})
+	for cursor.HasMore {
+		var orders []coinbasepro.Order
+		err = cursor.NextPage(&orders)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range orders {
+			ids = append(ids, o.ID)
+		}
+	}
+	return
+}
+
+// coinbaseOrderBook loads the aggregated top 50 levels of the book straight from coinbase
+type coinbaseOrderBook struct {
+	client *coinbaseclient.Client
+}
+
+func (b *coinbaseOrderBook) OrderBook(market types.Market) (*proto.OrderBook, error) {
+	book, err := b.client.GetBook(market.Name(), 2)
+	if err != nil {
+		return nil, err
+	}
+
+	convert := func(entries []coinbasepro.BookEntry) (converted []*proto.BookEntry) {
+		for _, e := range entries {
+			converted = append(converted, &proto.BookEntry{Price: e.Price, Size: e.Size, Orders: int32(e.NumberOfOrders)})
+		}
+		return
+	}
+	return &proto.OrderBook{Ts: time.Now().Unix(), Sequence: book.Sequence, Bids: convert(book.Bids), Asks: convert(book.Asks)}, nil
+}
+
+// tickerOrderBook makes a single level book out of the ticker for exchanges that don't publish their book
+type tickerOrderBook struct{}
+
+func (b *tickerOrderBook) OrderBook(market types.Market) (*proto.OrderBook, error) {
+	ticker, err := market.Ticker()
+	if err != nil {
+		return nil, err
+	}
+	return &proto.OrderBook{
+		Ts:   ticker.Timestamp().Unix(),
+		Bids: []*proto.BookEntry{{Price: ticker.Bid().String(), Size: ticker.Quantity().String(), Orders: 1}},
+		Asks: []*proto.BookEntry{{Price: ticker.Ask().String(), Size: ticker.Quantity().String(), Orders: 1}},
+	}, nil
+}
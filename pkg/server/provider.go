@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/provider/coinbase"
+	coinbaseclient "github.com/sinisterminister/currencytrader/types/provider/coinbase/client"
+	"github.com/sinisterminister/go-coinbasepro/v2"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+	"github.com/sinisterminister/moneytree/pkg/simulated"
+	"github.com/spf13/viper"
+)
+
+// exchange is the provider the trader runs on along with the pieces of the exchange the trader doesn't expose
+type exchange struct {
+	provider    types.Provider
+	orderLister pair.OpenOrderLister
+	orderBook   orderBookSource
+}
+
+// exchangeFactory builds an exchange from the settings namespaced under its name
+type exchangeFactory func(stop <-chan bool, namespace string) (*exchange, error)
+
+var exchangeFactories = map[string]exchangeFactory{
+	"coinbase":  newCoinbaseExchange,
+	"simulated": newSimulatedExchange,
+}
+
+// newExchange builds the exchange picked by the provider setting
+func newExchange(stop <-chan bool) (*exchange, error) {
+	name := viper.GetString("provider")
+	factory, ok := exchangeFactories[name]
+	if !ok {
+		available := []string{}
+		for n := range exchangeFactories {
+			available = append(available, n)
+		}
+		sort.Strings(available)
+		return nil, fmt.Errorf("unknown provider %q; expected one of %s", name, strings.Join(available, ", "))
+	}
+	return factory(stop, name)
+}
+
+// The scheduler keeps the requests to coinbase within its limits, so the provider's own limiter is opened up far
+// enough to never hold a request back
+const (
+	coinbaseRateLimit  = 1000
+	coinbaseBurstLimit = 2000
+)
+
+func newCoinbaseExchange(stop <-chan bool, namespace string) (*exchange, error) {
+	client := coinbaseclient.NewClient()
+	client.UpdateConfig(&coinbasepro.ClientConfig{
+		BaseURL:    viper.GetString(namespace + ".baseUrl"),
+		Key:        viper.GetString(namespace + ".key"),
+		Passphrase: viper.GetString(namespace + ".passphrase"),
+		Secret:     viper.GetString(namespace + ".secret"),
+	})
+
+	return &exchange{
+		provider:    coinbase.New(stop, client, coinbaseRateLimit, coinbaseBurstLimit),
+		orderLister: &coinbaseOrderLister{client},
+		orderBook:   &coinbaseOrderBook{client},
+	}, nil
+}
+
+func newSimulatedExchange(stop <-chan bool, namespace string) (*exchange, error) {
+	setting := func(key string) decimal.Decimal {
+		return decimal.NewFromFloat(viper.GetFloat64(namespace + "." + key))
+	}
+
+	balances := map[string]decimal.Decimal{}
+	for symbol, balance := range viper.GetStringMapString(namespace + ".balances") {
+		amount, err := decimal.NewFromString(balance)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s balance: %w", symbol, err)
+		}
+		balances[strings.ToUpper(symbol)] = amount
+	}
+
+	base := types.CurrencyDTO{Name: "BTC", Symbol: "BTC", Precision: viper.GetInt(namespace + ".basePrecision")}
+	quote := types.CurrencyDTO{Name: "USD", Symbol: "USD", Precision: viper.GetInt(namespace + ".quotePrecision")}
+	provider := simulated.New(stop, simulated.Config{
+		Market: types.MarketDTO{
+			Name:             "BTC-USD",
+			BaseCurrency:     base,
+			QuoteCurrency:    quote,
+			PriceIncrement:   setting("priceIncrement"),
+			QuantityStepSize: setting("quantityStep"),
+			MinQuantity:      setting("minQuantity"),
+		},
+		Fees: types.FeesDTO{
+			MakerRate: setting("makerRate"),
+			TakerRate: setting("takerRate"),
+		},
+		Balances:     balances,
+		Price:        setting("price"),
+		Volatility:   viper.GetFloat64(namespace + ".volatility"),
+		TickInterval: viper.GetDuration(namespace + ".tickInterval"),
+		History:      viper.GetDuration(namespace + ".history"),
+		Seed:         viper.GetInt64(namespace + ".seed"),
+	})
+
+	return &exchange{
+		provider:    provider,
+		orderLister: provider,
+		orderBook:   &tickerOrderBook{},
+	}, nil
+}
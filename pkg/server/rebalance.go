@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+)
+
+func (s *Server) GetAllocation(ctx context.Context, in *proto.NullRequest) (*proto.Allocation, error) {
+	log.Debug("Received get allocation request")
+	ticker, err := market.Ticker()
+	if err != nil {
+		return nil, fmt.Errorf("could not load ticker: %w", err)
+	}
+	a, err := s.pairSvc.Allocation(ticker.Price())
+	if err != nil {
+		return nil, err
+	}
+
+	state := s.rebalancer.State()
+	allocation := &proto.Allocation{
+		Price:            a.Price.String(),
+		BaseValue:        a.BaseValue.String(),
+		QuoteValue:       a.QuoteValue.String(),
+		BaseRatio:        a.BaseRatio.StringFixed(6),
+		Target:           a.Target.String(),
+		Lower:            a.Lower.String(),
+		Upper:            a.Upper.String(),
+		Pull:             string(a.Pull()),
+		RebalanceOrderId: state.OrderID,
+		RebalanceDetails: state.Details,
+	}
+	if !state.LastRun.IsZero() {
+		allocation.LastRebalance = state.LastRun.Unix()
+	}
+	return allocation, nil
+}
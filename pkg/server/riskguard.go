@@ -0,0 +1,219 @@
+package server
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+	"github.com/spf13/viper"
+)
+
+// TradingHaltedError is returned when the risk guard has halted the placement of new pairs
+type TradingHaltedError struct {
+	reason   string
+	haltedAt time.Time
+}
+
+func (err *TradingHaltedError) Error() string {
+	return fmt.Sprintf("trading halted since %s: %s; use ResumeTrading to resume", err.haltedAt.Format(time.RFC3339), err.reason)
+}
+
+type riskGuardState struct {
+	Halted    bool      `json:"halted"`
+	Reason    string    `json:"reason"`
+	HaltedAt  time.Time `json:"haltedAt"`
+	ResumedAt time.Time `json:"resumedAt"`
+}
+
+func (r riskGuardState) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+func (r *riskGuardState) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, &r)
+}
+
+// pairHistory is what the risk guard needs from the pair service to judge the losses
+type pairHistory interface {
+	RealizedReturn(start time.Time, end time.Time) (decimal.Decimal, error)
+	ConsecutiveFailures(since time.Time) (int, error)
+	LoadOpenPairs() ([]*pair.OrderPair, error)
+	Clock() pair.Clock
+}
+
+// riskGuard halts the placement of new pairs when losses pile up. Once tripped, trading stays halted until it is
+// explicitly resumed.
+type riskGuard struct {
+	db       *sql.DB
+	pairSvc  pairHistory
+	notifier *notifier
+
+	mutex sync.Mutex
+	state riskGuardState
+}
+
+func newRiskGuard(db *sql.DB, pairSvc pairHistory, notifier *notifier) (guard *riskGuard, err error) {
+	guard = &riskGuard{db: db, pairSvc: pairSvc, notifier: notifier}
+	err = guard.initializeDB()
+	if err != nil {
+		return nil, err
+	}
+	err = guard.load()
+	return
+}
+
+// Check returns a TradingHaltedError if trading is halted or any of the configured limits have been breached
+func (g *riskGuard) Check() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !g.state.Halted {
+		reason, err := g.evaluate()
+		if err != nil {
+			return fmt.Errorf("could not evaluate risk limits: %w", err)
+		}
+		if reason == "" {
+			return nil
+		}
+		g.trip(reason)
+	}
+
+	return &TradingHaltedError{g.state.Reason, g.state.HaltedAt}
+}
+
+// Resume clears a halt. Only losses after the resume are counted towards the limits from then on.
+func (g *riskGuard) Resume() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	log.Noticef("resuming trading")
+	g.state = riskGuardState{ResumedAt: g.pairSvc.Clock().Now()}
+	return g.save()
+}
+
+// Status returns whether trading is halted and why
+func (g *riskGuard) Status() riskGuardState {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.state
+}
+
+// RealizedReturn returns the realized return and consecutive failures counted towards the current limits
+func (g *riskGuard) RealizedReturn() (ret decimal.Decimal, failures int, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	ret, err = g.pairSvc.RealizedReturn(g.windowStart(viper.GetDuration("riskGuard.lossWindow")), g.pairSvc.Clock().Now())
+	if err != nil {
+		return
+	}
+	failures, err = g.pairSvc.ConsecutiveFailures(g.windowStart(viper.GetDuration("riskGuard.failureWindow")))
+	return
+}
+
+func (g *riskGuard) evaluate() (reason string, err error) {
+	// Check the realized loss
+	maxLoss := decimal.NewFromFloat(viper.GetFloat64("riskGuard.maxLoss"))
+	if maxLoss.IsPositive() {
+		window := viper.GetDuration("riskGuard.lossWindow")
+		ret, err := g.pairSvc.RealizedReturn(g.windowStart(window), g.pairSvc.Clock().Now())
+		if err != nil {
+			return "", err
+		}
+		if ret.Neg().GreaterThanOrEqual(maxLoss) {
+			return fmt.Sprintf("realized loss of %s over the last %s reached the limit of %s", ret.Neg(), window, maxLoss), nil
+		}
+	}
+
+	// Check the losing streak
+	maxFailures := viper.GetInt("riskGuard.maxConsecutiveFailures")
+	if maxFailures > 0 {
+		window := viper.GetDuration("riskGuard.failureWindow")
+		failures, err := g.pairSvc.ConsecutiveFailures(g.windowStart(window))
+		if err != nil {
+			return "", err
+		}
+		if failures >= maxFailures {
+			return fmt.Sprintf("%d consecutive reversed or broken pairs over the last %s reached the limit of %d", failures, window, maxFailures), nil
+		}
+	}
+
+	return "", nil
+}
+
+func (g *riskGuard) trip(reason string) {
+	log.Alertf("halting trading: %s", reason)
+	g.state.Halted = true
+	g.state.Reason = reason
+	g.state.HaltedAt = g.pairSvc.Clock().Now()
+
+	err := g.save()
+	if err != nil {
+		log.WithError(err).Error("could not save risk guard state")
+	}
+	g.notifier.Notify(circuitBreakerEvent, map[string]interface{}{"reason": reason, "haltedAt": g.state.HaltedAt})
+
+	// Pull the first legs that haven't filled yet off the books
+	if viper.GetBool("riskGuard.cancelOpenFirstLegs") {
+		go g.cancelOpenFirstLegs()
+	}
+}
+
+func (g *riskGuard) cancelOpenFirstLegs() {
+	pairs, err := g.pairSvc.LoadOpenPairs()
+	if err != nil {
+		log.WithError(err).Error("could not load open pairs to cancel")
+		return
+	}
+	for _, p := range pairs {
+		if p.SecondOrder() == nil {
+			log.Infof("%s: canceling first leg after trading halt", p.UUID().String())
+			err = p.Cancel()
+			if err != nil {
+				log.WithError(err).Errorf("%s: could not cancel first leg", p.UUID().String())
+			}
+		}
+	}
+}
+
+// windowStart returns the start of the rolling window, ignoring anything from before the last resume
+func (g *riskGuard) windowStart(window time.Duration) time.Time {
+	start := g.pairSvc.Clock().Now().Add(-window)
+	if g.state.ResumedAt.After(start) {
+		return g.state.ResumedAt
+	}
+	return start
+}
+
+func (g *riskGuard) initializeDB() error {
+	_, err := g.db.Exec("CREATE TABLE IF NOT EXISTS riskguard (id int primary key, data JSONB);")
+	return err
+}
+
+func (g *riskGuard) load() error {
+	err := g.db.QueryRow("SELECT data FROM riskguard WHERE id = 1;").Scan(&g.state)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("could not load risk guard state from database: %w", err)
+	}
+	return nil
+}
+
+func (g *riskGuard) save() error {
+	_, err := g.db.Exec("INSERT INTO riskguard (id, data) VALUES (1, $1) ON CONFLICT (id) DO UPDATE SET data = $1;", g.state)
+	if err != nil {
+		return fmt.Errorf("could not insert into database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/order"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+	"github.com/sinisterminister/moneytree/pkg/pair/fake_types"
+	"github.com/spf13/viper"
+)
+
+// How long to wait on the pairs' goroutines before giving up
+const testTimeout = 2 * time.Second
+
+// setConfig changes a setting for the rest of the test
+func setConfig(t *testing.T, key string, value interface{}) {
+	previous := viper.Get(key)
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, previous) })
+}
+
+// btcUSD is the market the server tests trade on
+func btcUSD() types.MarketDTO {
+	return types.MarketDTO{
+		Name:          "BTC-USD",
+		BaseCurrency:  types.CurrencyDTO{Name: "Bitcoin", Symbol: "BTC", Precision: 8},
+		QuoteCurrency: types.CurrencyDTO{Name: "US Dollar", Symbol: "USD", Precision: 2},
+		MinQuantity:   decimal.NewFromFloat(0.001),
+	}
+}
+
+// fakeHistory reports whatever losses the test needs. Everything else comes from a pair service running on the fake
+// trader and clock.
+type fakeHistory struct {
+	*pair.Service
+
+	mutex        sync.Mutex
+	ret          decimal.Decimal
+	failures     int
+	open         []*pair.OrderPair
+	lossStart    time.Time
+	failureStart time.Time
+}
+
+func (h *fakeHistory) RealizedReturn(start time.Time, end time.Time) (decimal.Decimal, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.lossStart = start
+	return h.ret, nil
+}
+
+func (h *fakeHistory) ConsecutiveFailures(since time.Time) (int, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.failureStart = since
+	return h.failures, nil
+}
+
+func (h *fakeHistory) LoadOpenPairs() ([]*pair.OrderPair, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.open, nil
+}
+
+func (h *fakeHistory) setReturn(ret decimal.Decimal) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.ret = ret
+}
+
+func (h *fakeHistory) setFailures(failures int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.failures = failures
+}
+
+func (h *fakeHistory) starts() (loss time.Time, failure time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.lossStart, h.failureStart
+}
+
+type riskGuardHarness struct {
+	t       *testing.T
+	db      *sql.DB
+	trader  *fake_types.Trader
+	clock   *fake_types.Clock
+	history *fakeHistory
+	guard   *riskGuard
+}
+
+func newRiskGuardHarness(t *testing.T) *riskGuardHarness {
+	db := openTestDB()
+	t.Cleanup(func() { db.Close() })
+
+	trader := fake_types.NewTrader(btcUSD(), types.FeesDTO{MakerRate: decimal.NewFromFloat(0.005), TakerRate: decimal.NewFromFloat(0.005)})
+	trader.SetBalance("USD", decimal.NewFromInt(1000000))
+	trader.SetBalance("BTC", decimal.NewFromInt(1000))
+
+	svc, err := pair.NewService(db, trader, trader.Market())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := fake_types.NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	svc.SetClock(clock)
+
+	history := &fakeHistory{Service: svc}
+	guard, err := newRiskGuard(db, history, &notifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &riskGuardHarness{t, db, trader, clock, history, guard}
+}
+
+func (h *riskGuardHarness) expectHalted(reason string) {
+	h.t.Helper()
+	err := h.guard.Check()
+	var halted *TradingHaltedError
+	if !errors.As(err, &halted) {
+		h.t.Fatalf("expected trading to be halted, got %v", err)
+	}
+	if !strings.Contains(halted.reason, reason) {
+		h.t.Errorf("expected the halt to be because of %q, got %q", reason, halted.reason)
+	}
+}
+
+func (h *riskGuardHarness) expectTrading() {
+	h.t.Helper()
+	if err := h.guard.Check(); err != nil {
+		h.t.Fatalf("expected trading to continue, got %s", err)
+	}
+}
+
+// executePair places a pair that buys 1 at 100 and sells 0.99 at 200 and returns its first order
+func (h *riskGuardHarness) executePair() (*pair.OrderPair, *fake_types.Order) {
+	h.t.Helper()
+	market := h.trader.Market()
+	first := order.NewRequest(market, order.Limit, order.Buy, decimal.NewFromFloat(1), decimal.NewFromFloat(100), decimal.Zero, false)
+	second := order.NewRequest(market, order.Limit, order.Sell, decimal.NewFromFloat(0.99), decimal.NewFromFloat(200), decimal.Zero, false)
+	p, err := h.history.New(first, second)
+	if err != nil {
+		h.t.Fatalf("could not create pair: %s", err)
+	}
+	err = p.Execute()
+	if err != nil {
+		h.t.Fatalf("could not execute pair: %s", err)
+	}
+	return p, h.placed()
+}
+
+func (h *riskGuardHarness) placed() *fake_types.Order {
+	h.t.Helper()
+	select {
+	case ord := <-h.trader.Placed():
+		return ord
+	case <-time.After(testTimeout):
+		h.t.Fatal("timed out waiting for an order to be placed")
+	}
+	return nil
+}
+
+func TestRiskGuard_DisabledLimits(t *testing.T) {
+	h := newRiskGuardHarness(t)
+	h.history.setReturn(decimal.NewFromInt(-1000000))
+	h.history.setFailures(100)
+
+	h.expectTrading()
+}
+
+func TestRiskGuard_MaxLoss(t *testing.T) {
+	h := newRiskGuardHarness(t)
+	setConfig(t, "riskGuard.maxLoss", 100)
+
+	h.history.setReturn(decimal.NewFromInt(-99))
+	h.expectTrading()
+
+	h.history.setReturn(decimal.NewFromInt(-100))
+	h.expectHalted("realized loss of 100")
+	if state := h.guard.Status(); !state.Halted || !state.HaltedAt.Equal(h.clock.Now()) {
+		t.Errorf("expected trading to be halted at %s, got %+v", h.clock.Now(), state)
+	}
+
+	// The halt sticks once the losses are made back
+	h.history.setReturn(decimal.NewFromInt(50))
+	h.expectHalted("realized loss of 100")
+}
+
+func TestRiskGuard_ConsecutiveFailures(t *testing.T) {
+	h := newRiskGuardHarness(t)
+	setConfig(t, "riskGuard.maxConsecutiveFailures", 3)
+
+	h.history.setFailures(2)
+	h.expectTrading()
+
+	h.history.setFailures(3)
+	h.expectHalted("3 consecutive reversed or broken pairs")
+}
+
+func TestRiskGuard_HaltSurvivesRestart(t *testing.T) {
+	h := newRiskGuardHarness(t)
+	setConfig(t, "riskGuard.maxConsecutiveFailures", 1)
+	h.history.setFailures(1)
+	h.expectHalted("consecutive")
+
+	restarted, err := newRiskGuard(h.db, h.history, &notifier{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.history.setFailures(0)
+	h.guard = restarted
+	h.expectHalted("consecutive")
+}
+
+func TestRiskGuard_Resume(t *testing.T) {
+	h := newRiskGuardHarness(t)
+	setConfig(t, "riskGuard.maxLoss", 100)
+	setConfig(t, "riskGuard.maxConsecutiveFailures", 3)
+	h.history.setReturn(decimal.NewFromInt(-100))
+	h.expectHalted("realized loss")
+
+	// Only what happens after the resume counts
+	<-h.clock.After(time.Hour)
+	resumedAt := h.clock.Now()
+	err := h.guard.Resume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.history.setReturn(decimal.Zero)
+	h.expectTrading()
+	if loss, failure := h.history.starts(); !loss.Equal(resumedAt) || !failure.Equal(resumedAt) {
+		t.Errorf("expected both windows to start at the resume at %s, got %s and %s", resumedAt, loss, failure)
+	}
+
+	// Until the windows roll past it
+	<-h.clock.After(48 * time.Hour)
+	h.expectTrading()
+	loss, failure := h.history.starts()
+	if expected := h.clock.Now().Add(-24 * time.Hour); !loss.Equal(expected) {
+		t.Errorf("expected the loss window to start at %s, got %s", expected, loss)
+	}
+	if expected := h.clock.Now().Add(-6 * time.Hour); !failure.Equal(expected) {
+		t.Errorf("expected the failure window to start at %s, got %s", expected, failure)
+	}
+}
+
+func TestRiskGuard_CancelOpenFirstLegs(t *testing.T) {
+	h := newRiskGuardHarness(t)
+	setConfig(t, "riskGuard.maxLoss", 100)
+	setConfig(t, "riskGuard.cancelOpenFirstLegs", true)
+
+	// One pair is waiting on its second leg and the other on its first
+	filled, first := h.executePair()
+	first.Fill(decimal.NewFromFloat(1))
+	second := h.placed()
+	waiting, unfilled := h.executePair()
+	h.history.mutex.Lock()
+	h.history.open = []*pair.OrderPair{filled, waiting}
+	h.history.mutex.Unlock()
+
+	h.history.setReturn(decimal.NewFromInt(-100))
+	h.expectHalted("realized loss")
+
+	select {
+	case <-waiting.Done():
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out waiting for the unfilled pair to be canceled; status is %s", waiting.Status())
+	}
+	if waiting.Status() != pair.Canceled || unfilled.Status() != order.Canceled {
+		t.Errorf("expected the unfilled pair to be %s, got %s with its first order %s", pair.Canceled, waiting.Status(), unfilled.Status())
+	}
+	if second.IsDone() || filled.IsDone() {
+		t.Errorf("expected the pair waiting on its second leg to be left alone, got %s", filled.Status())
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/moneytree/pkg/pair"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/sinisterminister/moneytree/pkg/scheduler"
+	"github.com/spf13/viper"
+)
+
+// newRequestScheduler builds the scheduler from the scheduler settings and reports the depth of each of its queues
+func newRequestScheduler(stop <-chan bool) *scheduler.Scheduler {
+	limits := map[string]scheduler.Limit{}
+	for _, endpoint := range scheduler.Endpoints {
+		limits[endpoint] = scheduler.Limit{
+			Rate:  viper.GetFloat64("scheduler." + endpoint + ".rateLimit"),
+			Burst: viper.GetInt("scheduler." + endpoint + ".burstLimit"),
+		}
+	}
+	s := scheduler.New(stop, scheduler.Limit{Rate: viper.GetFloat64("scheduler.rateLimit"), Burst: viper.GetInt("scheduler.burstLimit")}, limits)
+
+	for _, priority := range scheduler.Priorities {
+		priority := priority
+		prometheus.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace:   "moneytree",
+				Subsystem:   "scheduler",
+				Name:        "queue_depth",
+				Help:        "Number of exchange requests waiting to be sent",
+				ConstLabels: prometheus.Labels{"priority": priority.String()},
+			},
+			func() float64 { return float64(s.Depth(priority)) },
+		))
+	}
+	return s
+}
+
+// scheduledOrderLister lists the open orders through the scheduler along with the rest of the order requests
+type scheduledOrderLister struct {
+	lister    pair.OpenOrderLister
+	scheduler *scheduler.Scheduler
+}
+
+func (l *scheduledOrderLister) OpenOrderIDs(market types.Market) (ids []string, err error) {
+	stopped := l.scheduler.Do(scheduler.GetOrder, scheduler.Normal, func() {
+		ids, err = l.lister.OpenOrderIDs(market)
+	})
+	if stopped != nil {
+		return nil, stopped
+	}
+	return
+}
+
+// scheduledOrderBook loads the order book through the scheduler along with the rest of the market data
+type scheduledOrderBook struct {
+	source    orderBookSource
+	scheduler *scheduler.Scheduler
+}
+
+func (b *scheduledOrderBook) OrderBook(market types.Market) (book *proto.OrderBook, err error) {
+	stopped := b.scheduler.Do(scheduler.MarketData, scheduler.Normal, func() {
+		book, err = b.source.OrderBook(market)
+	})
+	if stopped != nil {
+		return nil, stopped
+	}
+	return
+}
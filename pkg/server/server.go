@@ -10,19 +10,19 @@ import (
 
 	"github.com/go-playground/log/v7"
 	"github.com/heptiolabs/healthcheck"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/shopspring/decimal"
-	"github.com/sinisterminister/go-coinbasepro/v2"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 
 	"github.com/sinisterminister/currencytrader"
 	"github.com/sinisterminister/currencytrader/types"
-	"github.com/sinisterminister/currencytrader/types/candle"
 	"github.com/sinisterminister/currencytrader/types/order"
-	"github.com/sinisterminister/currencytrader/types/provider/coinbase"
-	coinbaseclient "github.com/sinisterminister/currencytrader/types/provider/coinbase/client"
+	"github.com/sinisterminister/moneytree/pkg/dca"
 	"github.com/sinisterminister/moneytree/pkg/pair"
 	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/sinisterminister/moneytree/pkg/scheduler"
 
 	// Load up postgres driver
 	_ "github.com/lib/pq"
@@ -37,22 +37,17 @@ func NewServer(port string) error {
 	// Setup the kill switch
 	killSwitch := make(chan bool)
 
-	// Setup a coinbase client
-	client := coinbaseclient.NewClient()
-
-	// Connect to live
-	client.UpdateConfig(&coinbasepro.ClientConfig{
-		BaseURL:    viper.GetString("coinbase.baseUrl"),
-		Key:        viper.GetString("coinbase.key"),
-		Passphrase: viper.GetString("coinbase.passphrase"),
-		Secret:     viper.GetString("coinbase.secret"),
-	})
+	// Start up the configured provider
+	exchange, err := newExchange(killSwitch)
+	if err != nil {
+		log.WithError(err).Fatal("could not set up the provider")
+	}
 
-	// Start up a coinbase provider
-	provider := coinbase.New(killSwitch, client, 5, 10)
+	// Queue the requests to the exchange so cancels and reversals go out ahead of everything else
+	requests := newRequestScheduler(killSwitch)
 
 	// Get an instance of the trader
-	trader = currencytrader.New(provider)
+	trader = currencytrader.New(scheduler.NewProvider(exchange.provider, requests))
 	trader.Start()
 
 	// Setup the market
@@ -75,8 +70,18 @@ func NewServer(port string) error {
 		log.WithError(err).Fatal("could not listen for connections")
 		return err
 	}
-	s := grpc.NewServer()
+	opts, err := serverCredentials()
+	if err != nil {
+		log.WithError(err).Fatal("could not load server credentials")
+	}
+	authenticator, err := newAuthenticator()
+	if err != nil {
+		log.WithError(err).Fatal("could not load auth tokens")
+	}
 	svr := &Server{}
+	unary, stream := svr.interceptors(authenticator)
+	opts = append(opts, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+	s := grpc.NewServer(opts...)
 
 	// Initialize server
 	err = svr.init(trader, market)
@@ -84,6 +89,26 @@ func NewServer(port string) error {
 		log.WithError(err).Fatal("could not initialize the server")
 	}
 
+	// Keep the database in line with the exchange
+	svr.pairSvc.SetOpenOrderLister(&scheduledOrderLister{exchange.orderLister, requests})
+	svr.pairSvc.StartReconciler(killSwitch)
+
+	// Send the notifications
+	svr.notifier.Start(killSwitch)
+
+	// Build candles from the ticker stream
+	svr.candles.Start(killSwitch)
+
+	// Keep the portfolio within its target band
+	svr.rebalancer.Start(killSwitch)
+
+	// Run the accumulation schedules
+	svr.dca.Start(killSwitch)
+
+	// Fan the market data out to the streaming clients
+	svr.startTickerFeed(killSwitch, market)
+	svr.startOrderBookFeed(killSwitch, market, &scheduledOrderBook{exchange.orderBook, requests})
+
 	proto.RegisterMoneytreeServer(s, svr)
 
 	if err := s.Serve(listener); err != nil {
@@ -96,11 +121,28 @@ type Server struct {
 	proto.UnimplementedMoneytreeServer
 	db *sql.DB
 
-	pairSvc *pair.Service
+	pairSvc    *pair.Service
+	riskGuard  *riskGuard
+	grid       *pair.Grid
+	rebalancer *pair.Rebalancer
+	dca        *dca.Service
+	candles    *candleStore
+
+	tickers    *broadcaster
+	orderBooks *broadcaster
+	notifier   *notifier
 }
 
 func (s *Server) PlacePair(ctx context.Context, in *proto.PlacePairRequest) (*proto.PlacePairResponse, error) {
-	log.Infof("received place %s pair request", in.Direction)
+	log.WithFields(log.F("caller", callerFromContext(ctx))).Infof("received place %s pair request", in.Direction)
+
+	// Make sure trading hasn't been halted
+	err := s.riskGuard.Check()
+	if err != nil {
+		log.WithError(err).Warn("rejecting pair")
+		return nil, err
+	}
+
 	orderPair, err := pair.BuildSpreadBasedPair(s.pairSvc, pair.Direction(in.Direction))
 	if err != nil {
 		log.WithError(err).Error("could not build pair")
@@ -142,6 +184,13 @@ func (s *Server) PlacePair(ctx context.Context, in *proto.PlacePairRequest) (*pr
 
 	// Try to make room if we're placing a new order
 	if orderPair != openPair {
+		// Don't make room for a pair the exposure limits will turn down when it's executed
+		err = s.pairSvc.CheckExposure(orderPair)
+		if err != nil {
+			log.WithError(err).Warn("rejecting pair")
+			return nil, err
+		}
+
 		err = s.pairSvc.MakeRoom(orderPair.FirstRequest().Price(), pair.Direction(in.Direction))
 		if err != nil {
 			return nil, err
@@ -163,20 +212,9 @@ func (s *Server) GetCandles(ctx context.Context, in *proto.GetCandlesRequest) (*
 	log.Debug("Received get candles request")
 
 	// Deserialize the interval
-	var interval types.CandleInterval
-	switch in.Duration {
-	case proto.GetCandlesRequest_ONE_MINUTE:
-		interval = candle.OneMinute
-	case proto.GetCandlesRequest_FIVE_MINUTES:
-		interval = candle.FiveMinutes
-	case proto.GetCandlesRequest_FIFTEEN_MINUTES:
-		interval = candle.FifteenMinutes
-	case proto.GetCandlesRequest_ONE_HOUR:
-		interval = candle.OneHour
-	case proto.GetCandlesRequest_TWELVE_HOURS:
-		interval = candle.TwelveHours
-	case proto.GetCandlesRequest_TWENTY_FOUR_HOURS:
-		interval = candle.OneDay
+	interval, ok := candleIntervals[in.Duration]
+	if !ok {
+		return nil, fmt.Errorf("unknown candle duration %s", in.Duration)
 	}
 
 	// Deserialize the times
@@ -184,10 +222,10 @@ func (s *Server) GetCandles(ctx context.Context, in *proto.GetCandlesRequest) (*
 	end := time.Unix(in.EndTime, 0)
 
 	// Fetch the candles
-	log.WithFields(log.F("interval", interval), log.F("start", start), log.F("end", end)).Debug("fetching candles")
-	candles, err := market.Candles(interval, start, end)
+	log.WithFields(log.F("interval", interval.width), log.F("start", start), log.F("end", end)).Debug("loading candles")
+	candles, err := s.candles.Candles(interval, start, end)
 	if err != nil {
-		log.WithError(err).Error("could not fetch candles")
+		log.WithError(err).Error("could not load candles")
 		return nil, err
 	}
 
@@ -195,17 +233,27 @@ func (s *Server) GetCandles(ctx context.Context, in *proto.GetCandlesRequest) (*
 	protoCandles := []*proto.Candle{}
 	for _, candle := range candles {
 		protoCandles = append(protoCandles, &proto.Candle{
-			Ts:     candle.Timestamp().Unix(),
-			Open:   candle.Open().String(),
-			Close:  candle.Close().String(),
-			High:   candle.High().String(),
-			Low:    candle.Low().String(),
-			Volume: candle.Volume().String(),
+			Ts:     candle.Timestamp.Unix(),
+			Open:   candle.Open.String(),
+			Close:  candle.Close.String(),
+			High:   candle.High.String(),
+			Low:    candle.Low.String(),
+			Volume: candle.Volume.String(),
 		})
 	}
 	return &proto.CandleCollection{Candles: protoCandles}, nil
 }
 
+func (s *Server) GetTicker(ctx context.Context, in *proto.NullRequest) (*proto.Ticker, error) {
+	log.Debug("Received get ticker request")
+	ticker, err := market.Ticker()
+	if err != nil {
+		log.WithError(err).Error("could not load ticker")
+		return nil, err
+	}
+	return createProtoTicker(ticker), nil
+}
+
 func (s *Server) GetOpenPairs(ctx context.Context, in *proto.NullRequest) (*proto.PairCollection, error) {
 	log.Debug("Received get open pairs request")
 	openPairs, err := s.pairSvc.LoadOpenPairs()
@@ -295,6 +343,91 @@ func (s *Server) RefreshPair(ctx context.Context, in *proto.PairRequest) (*proto
 	return createProtoPair(op), nil
 }
 
+func (s *Server) GetRiskStatus(ctx context.Context, in *proto.NullRequest) (*proto.RiskStatus, error) {
+	log.Debug("Received get risk status request")
+	return s.createProtoRiskStatus()
+}
+
+func (s *Server) ResumeTrading(ctx context.Context, in *proto.NullRequest) (*proto.RiskStatus, error) {
+	log.Info("received resume trading request")
+	err := s.riskGuard.Resume()
+	if err != nil {
+		return nil, err
+	}
+	return s.createProtoRiskStatus()
+}
+
+func (s *Server) GetAccount(ctx context.Context, in *proto.NullRequest) (*proto.Account, error) {
+	log.Debug("Received get account request")
+	wallets, err := trader.AccountSvc().Wallets()
+	if err != nil {
+		return nil, fmt.Errorf("could not load wallets: %w", err)
+	}
+	fees, err := trader.AccountSvc().Fees()
+	if err != nil {
+		return nil, fmt.Errorf("could not load fees: %w", err)
+	}
+	baseInPairs, quoteInPairs, err := s.pairSvc.HeldInPairs()
+	if err != nil {
+		return nil, err
+	}
+
+	// The scheduled buys hold quote currency outside of the pairs
+	quoteInBuys, err := s.dca.HeldInBuys()
+	if err != nil {
+		return nil, err
+	}
+	quoteInPairs = quoteInPairs.Add(quoteInBuys)
+	return createProtoAccount(wallets, fees, map[string]decimal.Decimal{
+		market.BaseCurrency().Symbol():  baseInPairs,
+		market.QuoteCurrency().Symbol(): quoteInPairs,
+	}), nil
+}
+
+func (s *Server) Reconcile(ctx context.Context, in *proto.NullRequest) (*proto.ReconcileReport, error) {
+	log.Info("received reconcile request")
+	report, err := s.pairSvc.Reconcile()
+	if err != nil {
+		return nil, err
+	}
+	return createProtoReconcileReport(report), nil
+}
+
+func (s *Server) RepairPair(ctx context.Context, in *proto.RepairPairRequest) (*proto.RepairPairResponse, error) {
+	log.Infof("received repair pair request for %s", in.Uuid)
+	action := pair.InspectPair
+	if in.Action != "" {
+		var err error
+		action, err = pair.ParseRepairAction(in.Action)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	op, plan, err := s.pairSvc.Repair(in.Uuid, action, in.Note)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []string{}
+	for _, a := range plan.Actions {
+		actions = append(actions, string(a))
+	}
+	return &proto.RepairPairResponse{
+		Pair:           createProtoPair(op),
+		BaseImbalance:  plan.BaseImbalance.String(),
+		QuoteImbalance: plan.QuoteImbalance.String(),
+		Actions:        actions,
+	}, nil
+}
+
+// interceptors returns what runs around every call, in order. The audit log goes first so it sees the calls the
+// authenticator turns down.
+func (s *Server) interceptors(a *authenticator) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	return []grpc.UnaryServerInterceptor{s.auditInterceptor, a.unaryInterceptor},
+		[]grpc.StreamServerInterceptor{s.auditStreamInterceptor, a.streamInterceptor}
+}
+
 func (s *Server) init(trader types.Trader, market types.Market) (err error) {
 	err = s.connectToDatabase()
 	if err != nil {
@@ -302,11 +435,61 @@ func (s *Server) init(trader types.Trader, market types.Market) (err error) {
 	}
 
 	s.startHealthcheckHandler()
+
+	err = s.initializeAuditLog()
+	if err != nil {
+		return
+	}
+
 	s.pairSvc, err = pair.NewService(s.db, trader, market)
 	if err != nil {
 		return
 	}
 
+	s.notifier, err = newNotifier(s.db, s.pairSvc)
+	if err != nil {
+		return
+	}
+
+	s.riskGuard, err = newRiskGuard(s.db, s.pairSvc, s.notifier)
+	if err != nil {
+		return
+	}
+
+	// Hold the grid off while trading is halted
+	s.grid, err = pair.NewGrid(s.pairSvc)
+	if err != nil {
+		return
+	}
+	s.grid.SetGuard(s.riskGuard)
+
+	// Hold off rebalancing while trading is halted too
+	s.rebalancer, err = pair.NewRebalancer(s.pairSvc)
+	if err != nil {
+		return
+	}
+	s.rebalancer.SetGuard(s.riskGuard)
+
+	s.candles, err = newCandleStore(s.db, market)
+	if err != nil {
+		return
+	}
+
+	// Skip or double the scheduled buys on the trix oscillator, hold them off while trading is halted and keep them
+	// within the exposure limits
+	s.dca, err = dca.NewService(s.db, trader, market)
+	if err != nil {
+		return
+	}
+	s.dca.SetSignal(&trixSignal{s.candles})
+	s.dca.SetGuard(s.riskGuard)
+	s.dca.SetPlacer(s.pairSvc)
+	s.dca.SetClock(s.pairSvc.Clock())
+	s.pairSvc.AddKnownOrders(s.dca)
+
+	s.tickers = newBroadcaster(viper.GetInt("streams.bufferSize"))
+	s.orderBooks = newBroadcaster(viper.GetInt("streams.bufferSize"))
+
 	// Load the open pairs
 	pairs, err := s.pairSvc.LoadOpenPairs()
 	if err != nil {
@@ -317,26 +500,41 @@ func (s *Server) init(trader types.Trader, market types.Market) (err error) {
 	for _, pair := range pairs {
 		pair.Execute()
 	}
+
+	// Pick the multi-leg pairs back up too
+	multiLegPairs, err := s.pairSvc.LoadOpenMultiLegPairs()
+	if err != nil {
+		return
+	}
+	for _, pair := range multiLegPairs {
+		pair.Execute()
+	}
+
+	// Pick the grid back up once its pairs are running
+	s.grid.Resume()
 	return
 }
 
 func (s *Server) startHealthcheckHandler() {
-	// Create a healthcheck.Handler
-	health := healthcheck.NewHandler()
+	// Create a healthcheck.Handler that reports its checks as metrics
+	health := healthcheck.NewMetricsHandler(prometheus.DefaultRegisterer, "moneytree")
+
+	// Expose the /live, /ready and /metrics endpoints over HTTP (on port 8086)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/", health)
+	go http.ListenAndServe("0.0.0.0:8086", mux)
+}
 
-	// Expose the /live and /ready endpoints over HTTP (on port 8086)
-	go http.ListenAndServe("0.0.0.0:8086", health)
+func (s *Server) connectToDatabase() (err error) {
+	s.db, err = OpenDatabase()
+	return
 }
 
-func (s *Server) connectToDatabase() error {
+// OpenDatabase connects to the configured postgres database
+func OpenDatabase() (*sql.DB, error) {
 	log.Info("connecting to database")
-	db, err := sql.Open("postgres", getDBConnectionString())
-	if err != nil {
-		return err
-	}
-	s.db = db
-
-	return nil
+	return sql.Open("postgres", getDBConnectionString())
 }
 
 func getDBConnectionString() string {
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/moneytree/pkg/proto"
+	"github.com/spf13/viper"
+)
+
+// broadcaster fans values out to any number of subscribers. A subscriber that falls behind drops its oldest value
+// instead of holding up the feed or the other subscribers.
+type broadcaster struct {
+	mutex       sync.Mutex
+	subscribers map[chan interface{}]bool
+	bufferSize  int
+}
+
+func newBroadcaster(bufferSize int) *broadcaster {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &broadcaster{subscribers: map[chan interface{}]bool{}, bufferSize: bufferSize}
+}
+
+// subscribe returns a channel of the published values and a function to stop receiving them
+func (b *broadcaster) subscribe() (<-chan interface{}, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	sub := make(chan interface{}, b.bufferSize)
+	b.subscribers[sub] = true
+	return sub, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.subscribers, sub)
+	}
+}
+
+// publish sends the value to every subscriber without blocking
+func (b *broadcaster) publish(value interface{}) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for sub := range b.subscribers {
+		select {
+		case sub <- value:
+			continue
+		default:
+		}
+
+		// Make room by dropping the oldest value
+		select {
+		case <-sub:
+			log.Debug("subscriber is falling behind; dropped a value")
+		default:
+		}
+		select {
+		case sub <- value:
+		default:
+		}
+	}
+}
+
+func (b *broadcaster) count() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.subscribers)
+}
+
+// orderBookSource loads a snapshot of the order book since the trader doesn't expose one
+type orderBookSource interface {
+	OrderBook(market types.Market) (*proto.OrderBook, error)
+}
+
+// startTickerFeed publishes every tick from the market until stopped
+func (s *Server) startTickerFeed(stop <-chan bool, market types.Market) {
+	go func() {
+		stream := market.TickerStream(stop)
+		for {
+			select {
+			case <-stop:
+				return
+			case tick, ok := <-stream:
+				if !ok {
+					log.Warn("ticker stream closed; no longer streaming tickers")
+					return
+				}
+				s.tickers.publish(createProtoTicker(tick))
+			}
+		}
+	}()
+}
+
+// startOrderBookFeed publishes order book snapshots every streams.orderBookInterval while anyone is subscribed
+func (s *Server) startOrderBookFeed(stop <-chan bool, market types.Market, source orderBookSource) {
+	go func() {
+		ticker := time.NewTicker(viper.GetDuration("streams.orderBookInterval"))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if s.orderBooks.count() == 0 {
+					continue
+				}
+				book, err := source.OrderBook(market)
+				if err != nil {
+					log.WithError(err).Warn("could not load order book")
+					continue
+				}
+				s.orderBooks.publish(book)
+			}
+		}
+	}()
+}
+
+func (s *Server) StreamTicker(in *proto.NullRequest, stream proto.Moneytree_StreamTickerServer) error {
+	log.Debug("Received stream ticker request")
+	sub, unsubscribe := s.tickers.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case tick := <-sub:
+			err := stream.Send(tick.(*proto.Ticker))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) StreamOrderBook(in *proto.StreamOrderBookRequest, stream proto.Moneytree_StreamOrderBookServer) error {
+	log.Debug("Received stream order book request")
+	depth := int(in.Depth)
+	if depth <= 0 {
+		depth = 10
+	}
+
+	sub, unsubscribe := s.orderBooks.subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case value := <-sub:
+			// The snapshot is shared so trim a copy
+			snapshot := value.(*proto.OrderBook)
+			book := &proto.OrderBook{Ts: snapshot.Ts, Sequence: snapshot.Sequence, Bids: snapshot.Bids, Asks: snapshot.Asks}
+			if len(book.Bids) > depth {
+				book.Bids = book.Bids[:depth]
+			}
+			if len(book.Asks) > depth {
+				book.Asks = book.Asks[:depth]
+			}
+			err := stream.Send(book)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
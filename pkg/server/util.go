@@ -1,6 +1,8 @@
 package server
 
 import (
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
 	"github.com/sinisterminister/moneytree/pkg/pair"
 	"github.com/sinisterminister/moneytree/pkg/proto"
 )
@@ -52,3 +54,74 @@ func createProtoPair(op *pair.OrderPair) *proto.Pair {
 		SellOrder:     sellOrder,
 	}
 }
+
+func (s *Server) createProtoRiskStatus() (*proto.RiskStatus, error) {
+	state := s.riskGuard.Status()
+	ret, failures, err := s.riskGuard.RealizedReturn()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &proto.RiskStatus{
+		Halted:              state.Halted,
+		Reason:              state.Reason,
+		RealizedReturn:      ret.String(),
+		ConsecutiveFailures: int32(failures),
+	}
+	if !state.HaltedAt.IsZero() {
+		status.HaltedAt = state.HaltedAt.Unix()
+	}
+	if !state.ResumedAt.IsZero() {
+		status.ResumedAt = state.ResumedAt.Unix()
+	}
+	return status, nil
+}
+
+func createProtoReconcileReport(report pair.ReconcileReport) *proto.ReconcileReport {
+	issues := []*proto.ReconcileIssue{}
+	for _, issue := range report.Issues {
+		issues = append(issues, &proto.ReconcileIssue{
+			PairUuid: issue.PairUUID,
+			OrderId:  issue.OrderID,
+			Kind:     string(issue.Kind),
+			Details:  issue.Details,
+			Fixed:    issue.Fixed,
+		})
+	}
+
+	return &proto.ReconcileReport{
+		Started:      report.StartedAt.Unix(),
+		Ended:        report.EndedAt.Unix(),
+		PairsChecked: int32(report.PairsChecked),
+		Issues:       issues,
+	}
+}
+
+func createProtoTicker(tick types.Ticker) *proto.Ticker {
+	return &proto.Ticker{
+		Ts:       tick.Timestamp().Unix(),
+		Price:    tick.Price().String(),
+		Bid:      tick.Bid().String(),
+		Ask:      tick.Ask().String(),
+		Quantity: tick.Quantity().String(),
+		Volume:   tick.Volume().String(),
+	}
+}
+
+func createProtoAccount(wallets []types.Wallet, fees types.Fees, inPairs map[string]decimal.Decimal) *proto.Account {
+	account := &proto.Account{
+		MakerRate: fees.MakerRate().String(),
+		TakerRate: fees.TakerRate().String(),
+		Volume:    fees.Volume().String(),
+	}
+	for _, w := range wallets {
+		account.Balances = append(account.Balances, &proto.Balance{
+			Currency:  w.Currency().Symbol(),
+			Total:     w.Total().String(),
+			Available: w.Available().String(),
+			Held:      w.Total().Sub(w.Available()).String(),
+			InPairs:   inPairs[w.Currency().Symbol()].String(),
+		})
+	}
+	return account
+}
@@ -0,0 +1,495 @@
+// Package simulated is an exchange that lives in memory for paper trading. The price takes a random walk, limit
+// orders fill at their price once a trade crosses it and market orders fill at the top of the book. Candles are built
+// from the walk.
+package simulated
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-playground/log/v7"
+	uuid "github.com/satori/go.uuid"
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/candle"
+	"github.com/sinisterminister/currencytrader/types/order"
+)
+
+// Minute candles older than this are dropped
+const candleRetention = 7 * 24 * time.Hour
+
+var candleWidths = map[types.CandleInterval]time.Duration{
+	candle.OneMinute:      time.Minute,
+	candle.FiveMinutes:    5 * time.Minute,
+	candle.FifteenMinutes: 15 * time.Minute,
+	candle.OneHour:        time.Hour,
+	candle.TwelveHours:    12 * time.Hour,
+	candle.OneDay:         24 * time.Hour,
+}
+
+// Config sets up the market, the starting balances and how the price moves
+type Config struct {
+	Market types.MarketDTO
+	Fees   types.FeesDTO
+
+	// Balances are the starting free balances keyed by currency symbol
+	Balances map[string]decimal.Decimal
+
+	// Price is where the walk starts. Each tick moves it by a normally distributed step with a standard deviation of
+	// Volatility times the price. A zero TickInterval leaves the price where it's set.
+	Price        decimal.Decimal
+	Volatility   float64
+	TickInterval time.Duration
+
+	// History is how far the walk is extended back from the starting price so there are candles from the start. It
+	// needs a TickInterval.
+	History time.Duration
+
+	// Seed seeds the walk. Zero seeds it from the clock.
+	Seed int64
+}
+
+// Provider is a types.Provider for a single simulated market
+type Provider struct {
+	config Config
+
+	mutex      sync.Mutex
+	rand       *rand.Rand
+	ticker     types.TickerDTO
+	volume     decimal.Decimal
+	wallets    map[string]*types.WalletDTO
+	orders     map[string]*types.OrderDTO
+	held       map[string]decimal.Decimal
+	orderSubs  map[string][]chan types.OrderDTO
+	tickerSubs map[chan types.TickerDTO]bool
+	minutes    []types.CandleDTO
+}
+
+// New creates the provider and walks the price every tick interval until stopped
+func New(stop <-chan bool, config Config) *Provider {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	p := &Provider{
+		config:     config,
+		rand:       rand.New(rand.NewSource(seed)),
+		wallets:    map[string]*types.WalletDTO{},
+		orders:     map[string]*types.OrderDTO{},
+		held:       map[string]decimal.Decimal{},
+		orderSubs:  map[string][]chan types.OrderDTO{},
+		tickerSubs: map[chan types.TickerDTO]bool{},
+	}
+	for _, cur := range []types.CurrencyDTO{config.Market.BaseCurrency, config.Market.QuoteCurrency} {
+		p.wallets[cur.Symbol] = &types.WalletDTO{Currency: cur, ID: "simulated-" + cur.Symbol, Free: config.Balances[cur.Symbol]}
+	}
+	if config.TickInterval > 0 && config.History > 0 {
+		p.walkHistory()
+	}
+	p.SetPrice(config.Price)
+
+	if config.TickInterval > 0 {
+		go p.walk(stop)
+	}
+	return p
+}
+
+// SetPrice trades at the price, filling the orders it crosses
+func (p *Provider) SetPrice(price decimal.Decimal) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	increment := p.priceIncrement()
+	price = price.Div(increment).Round(0).Mul(increment)
+	if !price.IsPositive() {
+		price = increment
+	}
+	quantity := decimal.NewFromFloat(p.rand.Float64()).Round(int32(p.config.Market.BaseCurrency.Precision))
+	p.ticker = types.TickerDTO{
+		Price:     price,
+		Bid:       price,
+		Ask:       price.Add(increment),
+		Quantity:  quantity,
+		Volume:    p.ticker.Volume.Add(quantity),
+		Timestamp: time.Now(),
+	}
+	p.record(price, quantity, p.ticker.Timestamp)
+
+	for _, ord := range p.orders {
+		if ord.Status != order.Pending {
+			continue
+		}
+		if (ord.Request.Side == order.Buy && !price.GreaterThan(ord.Request.Price)) ||
+			(ord.Request.Side == order.Sell && !price.LessThan(ord.Request.Price)) {
+			p.fill(ord, p.config.Fees.MakerRate)
+		}
+	}
+
+	for sub := range p.tickerSubs {
+		select {
+		case sub <- p.ticker:
+		default:
+			// Slow streams skip ticks rather than holding up the market
+		}
+	}
+}
+
+func (p *Provider) walk(stop <-chan bool) {
+	ticker := time.NewTicker(p.config.TickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.mutex.Lock()
+			step := math.Exp(p.rand.NormFloat64() * p.config.Volatility)
+			price := p.ticker.Price.Mul(decimal.NewFromFloat(step))
+			p.mutex.Unlock()
+			p.SetPrice(price)
+		}
+	}
+}
+
+// walkHistory walks back from the starting price a tick at a time and records the trades leading up to it
+func (p *Provider) walkHistory() {
+	steps := int(p.config.History / p.config.TickInterval)
+	prices := make([]float64, steps)
+	price, _ := p.config.Price.Float64()
+	for i := steps - 1; i >= 0; i-- {
+		price /= math.Exp(p.rand.NormFloat64() * p.config.Volatility)
+		prices[i] = price
+	}
+
+	increment := p.priceIncrement()
+	start := time.Now().Add(-time.Duration(steps) * p.config.TickInterval)
+	for i, price := range prices {
+		rounded := decimal.NewFromFloat(price).Div(increment).Round(0).Mul(increment)
+		if !rounded.IsPositive() {
+			rounded = increment
+		}
+		quantity := decimal.NewFromFloat(p.rand.Float64()).Round(int32(p.config.Market.BaseCurrency.Precision))
+		p.record(rounded, quantity, start.Add(time.Duration(i)*p.config.TickInterval))
+	}
+}
+
+// record adds a trade to its minute candle. The mutex must be held.
+func (p *Provider) record(price decimal.Decimal, quantity decimal.Decimal, ts time.Time) {
+	minute := ts.Truncate(time.Minute)
+	if n := len(p.minutes); n > 0 && p.minutes[n-1].Timestamp.Equal(minute) {
+		last := &p.minutes[n-1]
+		last.High = decimal.Max(last.High, price)
+		last.Low = decimal.Min(last.Low, price)
+		last.Close = price
+		last.Volume = last.Volume.Add(quantity)
+		return
+	}
+
+	p.minutes = append(p.minutes, types.CandleDTO{Timestamp: minute, Open: price, High: price, Low: price, Close: price, Volume: quantity})
+	cutoff := minute.Add(-candleRetention)
+	for len(p.minutes) > 0 && p.minutes[0].Timestamp.Before(cutoff) {
+		p.minutes = p.minutes[1:]
+	}
+}
+
+func (p *Provider) priceIncrement() decimal.Decimal {
+	if p.config.Market.PriceIncrement.IsPositive() {
+		return p.config.Market.PriceIncrement
+	}
+	return decimal.New(1, -int32(p.config.Market.QuoteCurrency.Precision))
+}
+
+// fill fills the whole order at its price, charging the fee in the quote currency
+func (p *Provider) fill(ord *types.OrderDTO, rate decimal.Decimal) {
+	base, quote := p.wallets[ord.Market.BaseCurrency.Symbol], p.wallets[ord.Market.QuoteCurrency.Symbol]
+	notional := ord.Request.Quantity.Mul(ord.Request.Price)
+	fee := notional.Mul(rate).Round(int32(ord.Market.QuoteCurrency.Precision))
+	held := p.held[ord.ID]
+	delete(p.held, ord.ID)
+
+	if ord.Request.Side == order.Buy {
+		quote.Locked = quote.Locked.Sub(held)
+		quote.Free = quote.Free.Add(held).Sub(notional).Sub(fee)
+		base.Free = base.Free.Add(ord.Request.Quantity)
+	} else {
+		base.Locked = base.Locked.Sub(held)
+		base.Free = base.Free.Add(held).Sub(ord.Request.Quantity)
+		quote.Free = quote.Free.Add(notional).Sub(fee)
+	}
+
+	ord.Filled = ord.Request.Quantity
+	ord.Fees = fee
+	ord.Paid = notional.Add(fee)
+	ord.Status = order.Filled
+	p.volume = p.volume.Add(notional)
+	log.Debugf("simulated %s order %s filled %s at %s", ord.Request.Side, ord.ID, ord.Filled, ord.Request.Price)
+	p.publish(ord)
+}
+
+// publish sends the order to its streams and closes them once it's done
+func (p *Provider) publish(ord *types.OrderDTO) {
+	done := ord.Status == order.Filled || ord.Status == order.Canceled
+	for _, sub := range p.orderSubs[ord.ID] {
+		select {
+		case sub <- *ord:
+		default:
+		}
+		if done {
+			close(sub)
+		}
+	}
+	if done {
+		delete(p.orderSubs, ord.ID)
+	}
+}
+
+func (p *Provider) AttemptOrder(req types.OrderRequestDTO) (types.OrderDTO, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if req.Market.Name != p.config.Market.Name {
+		return types.OrderDTO{}, fmt.Errorf("unknown market %s", req.Market.Name)
+	}
+	switch req.Type {
+	case order.Limit:
+	case order.Market:
+		if req.ForceMaker {
+			return types.OrderDTO{}, fmt.Errorf("market orders can't be post only")
+		}
+		req = p.priceMarketOrder(req)
+	default:
+		return types.OrderDTO{}, fmt.Errorf("%s orders aren't simulated", req.Type)
+	}
+	if !req.Price.IsPositive() || !req.Quantity.IsPositive() {
+		return types.OrderDTO{}, fmt.Errorf("order of %s at %s must have a positive price and quantity", req.Quantity, req.Price)
+	}
+	if min := p.config.Market.MinQuantity; min.IsPositive() && req.Quantity.LessThan(min) {
+		return types.OrderDTO{}, fmt.Errorf("quantity of %s is below the minimum of %s", req.Quantity, min)
+	}
+
+	crosses := (req.Side == order.Buy && !req.Price.LessThan(p.ticker.Ask)) || (req.Side == order.Sell && !req.Price.GreaterThan(p.ticker.Bid))
+	if crosses && req.ForceMaker {
+		return types.OrderDTO{}, fmt.Errorf("post only order at %s would cross the book", req.Price)
+	}
+
+	// Hold the funds, with room for the taker fee on buys
+	wallet, held := p.wallets[req.Market.BaseCurrency.Symbol], req.Quantity
+	if req.Side == order.Buy {
+		wallet = p.wallets[req.Market.QuoteCurrency.Symbol]
+		held = req.Quantity.Mul(req.Price).Mul(decimal.NewFromInt(1).Add(p.config.Fees.TakerRate))
+	}
+	if held.GreaterThan(wallet.Free) {
+		return types.OrderDTO{}, fmt.Errorf("insufficient funds: %s %s needed, %s available", held, wallet.Currency.Symbol, wallet.Free)
+	}
+	wallet.Free = wallet.Free.Sub(held)
+	wallet.Locked = wallet.Locked.Add(held)
+
+	ord := &types.OrderDTO{
+		Market:       p.config.Market,
+		CreationTime: time.Now(),
+		ID:           uuid.NewV4().String(),
+		Request:      req,
+		Status:       order.Pending,
+	}
+	p.orders[ord.ID] = ord
+	p.held[ord.ID] = held
+
+	if crosses {
+		p.fill(ord, p.config.Fees.TakerRate)
+	}
+	return *ord, nil
+}
+
+// priceMarketOrder prices a market order at the top of the book so it crosses it. Orders placed by funds get the
+// quantity the funds buy or sell at that price, leaving room for the taker fee on buys.
+func (p *Provider) priceMarketOrder(req types.OrderRequestDTO) types.OrderRequestDTO {
+	req.Price = p.ticker.Bid
+	if req.Side == order.Buy {
+		req.Price = p.ticker.Ask
+	}
+	if req.Funds.IsPositive() {
+		price := req.Price
+		if req.Side == order.Buy {
+			price = price.Mul(decimal.NewFromInt(1).Add(p.config.Fees.TakerRate))
+		}
+		req.Quantity = req.Funds.Div(price).Truncate(int32(p.config.Market.BaseCurrency.Precision))
+	}
+	return req
+}
+
+func (p *Provider) AverageTradeVolume(mkt types.MarketDTO) (decimal.Decimal, error) {
+	return decimal.Zero, nil
+}
+
+func (p *Provider) CancelOrder(dto types.OrderDTO) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ord, ok := p.orders[dto.ID]
+	if !ok {
+		return fmt.Errorf("order %s NotFound", dto.ID)
+	}
+	if ord.Status != order.Pending {
+		return fmt.Errorf("order %s is already %s", ord.ID, ord.Status)
+	}
+
+	wallet := p.wallets[ord.Market.BaseCurrency.Symbol]
+	if ord.Request.Side == order.Buy {
+		wallet = p.wallets[ord.Market.QuoteCurrency.Symbol]
+	}
+	held := p.held[ord.ID]
+	delete(p.held, ord.ID)
+	wallet.Locked = wallet.Locked.Sub(held)
+	wallet.Free = wallet.Free.Add(held)
+
+	ord.Status = order.Canceled
+	p.publish(ord)
+	return nil
+}
+
+// Candles aggregates the minutes the price has walked through into the interval, newest first like the exchange
+func (p *Provider) Candles(mkt types.MarketDTO, interval types.CandleInterval, start time.Time, end time.Time) ([]types.CandleDTO, error) {
+	width, ok := candleWidths[interval]
+	if !ok {
+		return nil, fmt.Errorf("%s candles aren't simulated", interval)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	candles := []types.CandleDTO{}
+	for _, minute := range p.minutes {
+		bucket := minute.Timestamp.Truncate(width)
+		if bucket.Before(start) || bucket.After(end) {
+			continue
+		}
+		if len(candles) == 0 || !candles[len(candles)-1].Timestamp.Equal(bucket) {
+			minute.Timestamp = bucket
+			candles = append(candles, minute)
+			continue
+		}
+		agg := &candles[len(candles)-1]
+		agg.High = decimal.Max(agg.High, minute.High)
+		agg.Low = decimal.Min(agg.Low, minute.Low)
+		agg.Close = minute.Close
+		agg.Volume = agg.Volume.Add(minute.Volume)
+	}
+
+	for i, j := 0, len(candles)-1; i < j; i, j = i+1, j-1 {
+		candles[i], candles[j] = candles[j], candles[i]
+	}
+	return candles, nil
+}
+
+func (p *Provider) Currencies() ([]types.CurrencyDTO, error) {
+	return []types.CurrencyDTO{p.config.Market.BaseCurrency, p.config.Market.QuoteCurrency}, nil
+}
+
+func (p *Provider) Fees() (types.FeesDTO, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	fees := p.config.Fees
+	fees.Volume = p.volume
+	return fees, nil
+}
+
+func (p *Provider) Markets() ([]types.MarketDTO, error) {
+	return []types.MarketDTO{p.config.Market}, nil
+}
+
+func (p *Provider) Order(mkt types.MarketDTO, id string) (types.OrderDTO, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ord, ok := p.orders[id]
+	if !ok {
+		return types.OrderDTO{}, fmt.Errorf("order %s NotFound", id)
+	}
+	return *ord, nil
+}
+
+func (p *Provider) OrderStream(stop <-chan bool, dto types.OrderDTO) (<-chan types.OrderDTO, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ord, ok := p.orders[dto.ID]
+	if !ok {
+		return nil, fmt.Errorf("order %s NotFound", dto.ID)
+	}
+
+	// The order only changes once more so a single slot is enough
+	stream := make(chan types.OrderDTO, 1)
+	if ord.Status != order.Pending {
+		stream <- *ord
+		close(stream)
+		return stream, nil
+	}
+	p.orderSubs[ord.ID] = append(p.orderSubs[ord.ID], stream)
+	return stream, nil
+}
+
+// OpenOrderIDs lists the orders that are still open so they can be reconciled
+func (p *Provider) OpenOrderIDs(market types.Market) (ids []string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for id, ord := range p.orders {
+		if ord.Status == order.Pending && ord.Market.Name == market.Name() {
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+func (p *Provider) RefreshOrder(in types.OrderDTO) (types.OrderDTO, error) {
+	return p.Order(in.Market, in.ID)
+}
+
+func (p *Provider) Ticker(market types.MarketDTO) (types.TickerDTO, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.ticker, nil
+}
+
+func (p *Provider) TickerStream(stop <-chan bool, market types.MarketDTO) (<-chan types.TickerDTO, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stream := make(chan types.TickerDTO, 16)
+	p.tickerSubs[stream] = true
+	go func() {
+		<-stop
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		delete(p.tickerSubs, stream)
+		close(stream)
+	}()
+	return stream, nil
+}
+
+func (p *Provider) Wallet(currency types.CurrencyDTO) (types.WalletDTO, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	wallet, ok := p.wallets[currency.Symbol]
+	if !ok {
+		return types.WalletDTO{}, fmt.Errorf("no %s wallet", currency.Symbol)
+	}
+	return *wallet, nil
+}
+
+func (p *Provider) Wallets() ([]types.WalletDTO, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	wallets := []types.WalletDTO{}
+	for _, cur := range []types.CurrencyDTO{p.config.Market.BaseCurrency, p.config.Market.QuoteCurrency} {
+		wallets = append(wallets, *p.wallets[cur.Symbol])
+	}
+	return wallets, nil
+}
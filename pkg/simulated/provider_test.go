@@ -0,0 +1,294 @@
+package simulated
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sinisterminister/currencytrader"
+	"github.com/sinisterminister/currencytrader/types"
+	"github.com/sinisterminister/currencytrader/types/candle"
+	"github.com/sinisterminister/currencytrader/types/order"
+)
+
+var _ types.Provider = &Provider{}
+
+var btcUSD = types.MarketDTO{
+	Name:           "BTC-USD",
+	BaseCurrency:   types.CurrencyDTO{Name: "Bitcoin", Symbol: "BTC", Precision: 8},
+	QuoteCurrency:  types.CurrencyDTO{Name: "US Dollar", Symbol: "USD", Precision: 2},
+	PriceIncrement: decimal.NewFromFloat(0.01),
+	MinQuantity:    decimal.NewFromFloat(0.001),
+}
+
+// newTestProvider starts a provider at a price of 100 with 1000 USD and 10 BTC that only moves when told to
+func newTestProvider(t *testing.T) *Provider {
+	stop := make(chan bool)
+	t.Cleanup(func() { close(stop) })
+	return New(stop, Config{
+		Market:   btcUSD,
+		Fees:     types.FeesDTO{MakerRate: decimal.NewFromFloat(0.001), TakerRate: decimal.NewFromFloat(0.002)},
+		Balances: map[string]decimal.Decimal{"USD": decimal.NewFromInt(1000), "BTC": decimal.NewFromInt(10)},
+		Price:    decimal.NewFromInt(100),
+		Seed:     1,
+	})
+}
+
+func limit(side types.OrderSide, quantity int64, price float64, postOnly bool) types.OrderRequestDTO {
+	return types.OrderRequestDTO{
+		Market:     btcUSD,
+		Type:       order.Limit,
+		Side:       side,
+		Quantity:   decimal.NewFromInt(quantity),
+		Price:      decimal.NewFromFloat(price),
+		ForceMaker: postOnly,
+	}
+}
+
+func wallets(t *testing.T, p *Provider) (base types.WalletDTO, quote types.WalletDTO) {
+	t.Helper()
+	base, err := p.Wallet(btcUSD.BaseCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote, err = p.Wallet(btcUSD.QuoteCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestProvider_RestingOrderFills(t *testing.T) {
+	p := newTestProvider(t)
+	ord, err := p.AttemptOrder(limit(order.Buy, 5, 99, true))
+	if err != nil {
+		t.Fatalf("could not place order: %s", err)
+	}
+	stream, err := p.OrderStream(make(chan bool), ord)
+	if err != nil {
+		t.Fatalf("could not stream order: %s", err)
+	}
+
+	// The funds are held with room for the taker fee
+	_, quote := wallets(t, p)
+	if !quote.Locked.Equal(decimal.NewFromFloat(495.99)) || !quote.Free.Equal(decimal.NewFromFloat(504.01)) {
+		t.Errorf("expected 495.99 USD held, got %s held and %s free", quote.Locked, quote.Free)
+	}
+
+	// Trading above the price leaves it be
+	p.SetPrice(decimal.NewFromFloat(99.5))
+	if ord, _ = p.Order(btcUSD, ord.ID); ord.Status != order.Pending {
+		t.Errorf("expected order to rest, got %s", ord.Status)
+	}
+
+	p.SetPrice(decimal.NewFromFloat(98.5))
+	select {
+	case filled := <-stream:
+		if filled.Status != order.Filled || !filled.Filled.Equal(decimal.NewFromInt(5)) || !filled.Fees.Equal(decimal.NewFromFloat(0.5)) {
+			t.Errorf("expected 5 filled at the maker rate, got %s of %s with %s fees", filled.Status, filled.Filled, filled.Fees)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the fill")
+	}
+	if _, open := <-stream; open {
+		t.Error("expected the stream to close once the order is done")
+	}
+
+	base, quote := wallets(t, p)
+	if !base.Free.Equal(decimal.NewFromInt(15)) || !quote.Free.Equal(decimal.NewFromFloat(504.5)) || !quote.Locked.IsZero() {
+		t.Errorf("expected 15 BTC and 504.5 USD, got %s BTC and %s USD with %s held", base.Free, quote.Free, quote.Locked)
+	}
+}
+
+func TestProvider_CrossingOrders(t *testing.T) {
+	p := newTestProvider(t)
+
+	_, err := p.AttemptOrder(limit(order.Sell, 1, 99, true))
+	if err == nil {
+		t.Error("expected a post only order that crosses the book to be refused")
+	}
+
+	ord, err := p.AttemptOrder(limit(order.Sell, 1, 99, false))
+	if err != nil {
+		t.Fatalf("could not place order: %s", err)
+	}
+	if ord.Status != order.Filled || !ord.Fees.Equal(decimal.NewFromFloat(0.2)) {
+		t.Errorf("expected the order to fill at the taker rate, got %s with %s fees", ord.Status, ord.Fees)
+	}
+	base, quote := wallets(t, p)
+	if !base.Free.Equal(decimal.NewFromInt(9)) || !quote.Free.Equal(decimal.NewFromFloat(1098.8)) {
+		t.Errorf("expected 9 BTC and 1098.8 USD, got %s BTC and %s USD", base.Free, quote.Free)
+	}
+}
+
+func TestProvider_MarketOrders(t *testing.T) {
+	tests := []struct {
+		scenario string
+		req      types.OrderRequestDTO
+		price    float64
+		filled   float64
+		fees     float64
+		paid     float64
+	}{
+		{"buy by quantity at the ask", types.OrderRequestDTO{Side: order.Buy, Quantity: decimal.NewFromInt(2)}, 100.01, 2, 0.4, 200.42},
+		{"buy by funds leaving room for the fee", types.OrderRequestDTO{Side: order.Buy, Funds: decimal.NewFromFloat(100.2)}, 100.01, 0.9999, 0.2, 100.199999},
+		{"sell by quantity at the bid", types.OrderRequestDTO{Side: order.Sell, Quantity: decimal.NewFromInt(2)}, 100, 2, 0.4, 200.4},
+		{"sell by funds", types.OrderRequestDTO{Side: order.Sell, Funds: decimal.NewFromInt(50)}, 100, 0.5, 0.1, 50.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			p := newTestProvider(t)
+			tt.req.Market = btcUSD
+			tt.req.Type = order.Market
+
+			ord, err := p.AttemptOrder(tt.req)
+			if err != nil {
+				t.Fatalf("could not place order: %s", err)
+			}
+			if ord.Status != order.Filled || !ord.Request.Price.Equal(decimal.NewFromFloat(tt.price)) || !ord.Filled.Equal(decimal.NewFromFloat(tt.filled)) {
+				t.Errorf("expected %v filled at %v, got %s of %s at %s", tt.filled, tt.price, ord.Status, ord.Filled, ord.Request.Price)
+			}
+			if !ord.Fees.Equal(decimal.NewFromFloat(tt.fees)) || !ord.Paid.Equal(decimal.NewFromFloat(tt.paid)) {
+				t.Errorf("expected %v in taker fees and %v paid with them, got %s and %s", tt.fees, tt.paid, ord.Fees, ord.Paid)
+			}
+
+			base, quote := wallets(t, p)
+			if !base.Locked.IsZero() || !quote.Locked.IsZero() {
+				t.Errorf("expected nothing to stay held, got %s BTC and %s USD", base.Locked, quote.Locked)
+			}
+		})
+	}
+}
+
+func TestProvider_Refusals(t *testing.T) {
+	p := newTestProvider(t)
+	tests := []struct {
+		scenario string
+		req      types.OrderRequestDTO
+	}{
+		{"insufficient funds", limit(order.Sell, 11, 101, true)},
+		{"below the minimum", types.OrderRequestDTO{Market: btcUSD, Type: order.Limit, Side: order.Buy, Quantity: decimal.NewFromFloat(0.0001), Price: decimal.NewFromInt(99)}},
+		{"market order without a size", types.OrderRequestDTO{Market: btcUSD, Type: order.Market, Side: order.Buy}},
+		{"post only market order", types.OrderRequestDTO{Market: btcUSD, Type: order.Market, Side: order.Buy, Quantity: decimal.NewFromInt(1), ForceMaker: true}},
+		{"unknown order type", types.OrderRequestDTO{Market: btcUSD, Type: "STOP", Side: order.Buy, Quantity: decimal.NewFromInt(1), Price: decimal.NewFromInt(99)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			_, err := p.AttemptOrder(tt.req)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestProvider_Cancel(t *testing.T) {
+	p := newTestProvider(t)
+	ord, err := p.AttemptOrder(limit(order.Sell, 4, 101, true))
+	if err != nil {
+		t.Fatalf("could not place order: %s", err)
+	}
+	err = p.CancelOrder(ord)
+	if err != nil {
+		t.Fatalf("could not cancel order: %s", err)
+	}
+
+	base, _ := wallets(t, p)
+	if !base.Free.Equal(decimal.NewFromInt(10)) || !base.Locked.IsZero() {
+		t.Errorf("expected the held BTC to be released, got %s free and %s held", base.Free, base.Locked)
+	}
+	p.SetPrice(decimal.NewFromInt(102))
+	if ord, _ = p.Order(btcUSD, ord.ID); ord.Status != order.Canceled {
+		t.Errorf("expected the order to stay canceled, got %s", ord.Status)
+	}
+	if err = p.CancelOrder(ord); err == nil {
+		t.Error("expected an error canceling a canceled order")
+	}
+}
+
+func TestProvider_Candles(t *testing.T) {
+	stop := make(chan bool)
+	defer close(stop)
+	p := New(stop, Config{
+		Market:       btcUSD,
+		Price:        decimal.NewFromInt(100),
+		Volatility:   0.01,
+		TickInterval: 10 * time.Second,
+		History:      30 * time.Minute,
+		Seed:         1,
+	})
+
+	end := time.Now()
+	minutes, err := p.Candles(btcUSD, candle.OneMinute, end.Add(-time.Hour), end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(minutes) < 30 || !minutes[0].Close.Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("expected the history to lead up to the starting price, got %d candles closing at %s", len(minutes), minutes[0].Close)
+	}
+
+	// Wider intervals are aggregated from the same minutes
+	candles, err := p.Candles(btcUSD, candle.FifteenMinutes, end.Add(-time.Hour), end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range candles {
+		bucket := []types.CandleDTO{}
+		for _, m := range minutes {
+			if m.Timestamp.Truncate(15 * time.Minute).Equal(c.Timestamp) {
+				bucket = append(bucket, m)
+			}
+		}
+		if len(bucket) == 0 || !c.Timestamp.Equal(c.Timestamp.Truncate(15*time.Minute)) || (i > 0 && !c.Timestamp.Before(candles[i-1].Timestamp)) {
+			t.Fatalf("expected candle %d at %s to be a newest first bucket of minutes", i, c.Timestamp)
+		}
+		high, low, volume := bucket[0].High, bucket[0].Low, decimal.Zero
+		for _, m := range bucket {
+			high, low, volume = decimal.Max(high, m.High), decimal.Min(low, m.Low), volume.Add(m.Volume)
+		}
+		if !c.Open.Equal(bucket[len(bucket)-1].Open) || !c.Close.Equal(bucket[0].Close) || !c.High.Equal(high) || !c.Low.Equal(low) || !c.Volume.Equal(volume) {
+			t.Errorf("expected candle %d to aggregate its minutes, got %+v", i, c)
+		}
+	}
+
+	if _, err = p.Candles(btcUSD, types.CandleInterval("2h"), end.Add(-time.Hour), end); err == nil {
+		t.Error("expected an error for an interval that isn't simulated")
+	}
+}
+
+func TestProvider_Trader(t *testing.T) {
+	p := newTestProvider(t)
+	trader := currencytrader.New(p)
+	trader.Start()
+	defer trader.Stop()
+
+	btc, err := trader.AccountSvc().Currency("BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usd, err := trader.AccountSvc().Currency("USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	market, err := trader.MarketSvc().Market(btc, usd)
+	if err != nil {
+		t.Fatalf("could not load market: %s", err)
+	}
+	if !market.PriceIncrement().Equal(decimal.NewFromFloat(0.01)) || !market.MinQuantity().Equal(decimal.NewFromFloat(0.001)) {
+		t.Errorf("expected the market rules to come through, got %s and %s", market.PriceIncrement(), market.MinQuantity())
+	}
+
+	ord, err := market.AttemptOrder(order.NewRequest(market, order.Limit, order.Sell, decimal.NewFromInt(1), decimal.NewFromInt(105), decimal.Zero, true))
+	if err != nil {
+		t.Fatalf("could not place order: %s", err)
+	}
+	p.SetPrice(decimal.NewFromInt(106))
+	select {
+	case <-ord.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the order to fill")
+	}
+	if ord.Status() != order.Filled {
+		t.Errorf("expected the order to be filled, got %s", ord.Status())
+	}
+}
@@ -1,43 +1,86 @@
 package trix
 
-import "github.com/sinisterminister/moneytree/pkg/ewma"
+import (
+	"errors"
+	"fmt"
 
-func GetTrixIndicator(prices []float64, periods float64) (ma float64, oscillator float64) {
-	singleSmoothedValues := []float64{}
-	doubleSmoothedValues := []float64{}
-	tripleSmoothedValues := []float64{}
+	"github.com/sinisterminister/moneytree/pkg/ewma"
+)
 
-	singleSmoothed := ewma.NewMovingAverage(periods)
-	doubleSmoothed := ewma.NewMovingAverage(periods)
-	tripleSmoothed := ewma.NewMovingAverage(periods)
+// ErrNotWarm is returned when the indicator hasn't seen enough prices to produce a value
+var ErrNotWarm = errors.New("trix indicator is not warmed up")
 
-	// Calculate the single smoothed moving average values
-	for _, price := range prices {
-		singleSmoothed.Add(price)
-		if singleSmoothed.Value() != 0.0 {
-			singleSmoothedValues = append(singleSmoothedValues, singleSmoothed.Value())
-		}
+// Trix is a streaming triple smoothed moving average and its rate of change. It is warmed up once from the price
+// history and then updated with each new price.
+type Trix struct {
+	singleSmoothed ewma.MovingAverage
+	doubleSmoothed ewma.MovingAverage
+	tripleSmoothed ewma.MovingAverage
+
+	count    int
+	previous float64
+	current  float64
+}
+
+func New(periods float64) *Trix {
+	return &Trix{
+		singleSmoothed: ewma.NewMovingAverage(periods),
+		doubleSmoothed: ewma.NewMovingAverage(periods),
+		tripleSmoothed: ewma.NewMovingAverage(periods),
 	}
+}
 
-	// Calculate the double smoothed moving average values
-	for _, s := range singleSmoothedValues {
-		doubleSmoothed.Add(s)
-		if doubleSmoothed.Value() != 0.0 {
-			doubleSmoothedValues = append(doubleSmoothedValues, doubleSmoothed.Value())
-		}
+// Warm adds the historical prices, oldest first, and returns an error if they weren't enough to warm up
+func (t *Trix) Warm(prices []float64) error {
+	for _, price := range prices {
+		t.Add(price)
+	}
+	if !t.IsWarm() {
+		return fmt.Errorf("%w after %d prices", ErrNotWarm, len(prices))
 	}
+	return nil
+}
 
-	// Calculate the triple smoothed moving average values
-	for _, s := range doubleSmoothedValues {
-		tripleSmoothed.Add(s)
-		if tripleSmoothed.Value() != 0.0 {
-			tripleSmoothedValues = append(tripleSmoothedValues, tripleSmoothed.Value())
-		}
+// Add updates the indicator with the next price
+func (t *Trix) Add(price float64) {
+	// Each average only starts taking values once the one before it has warmed up
+	t.singleSmoothed.Add(price)
+	if t.singleSmoothed.Value() == 0.0 {
+		return
+	}
+	t.doubleSmoothed.Add(t.singleSmoothed.Value())
+	if t.doubleSmoothed.Value() == 0.0 {
+		return
 	}
+	t.tripleSmoothed.Add(t.doubleSmoothed.Value())
+	if t.tripleSmoothed.Value() == 0.0 {
+		return
+	}
+
+	t.count++
+	t.previous = t.current
+	t.current = t.tripleSmoothed.Value()
+}
+
+// IsWarm reports whether there are enough triple smoothed values to calculate the oscillator
+func (t *Trix) IsWarm() bool {
+	return t.count >= 2
+}
 
-	ma = tripleSmoothed.Value()
-	originalValue := tripleSmoothedValues[len(tripleSmoothedValues)-2]
-	oscillator = (ma - originalValue) / originalValue
+// Value returns the triple smoothed moving average and the oscillator
+func (t *Trix) Value() (ma float64, oscillator float64, err error) {
+	if !t.IsWarm() {
+		return 0, 0, ErrNotWarm
+	}
+	return t.current, (t.current - t.previous) / t.previous, nil
+}
 
-	return ma, oscillator
+// GetTrixIndicator calculates the indicator over the prices, oldest first
+func GetTrixIndicator(prices []float64, periods float64) (ma float64, oscillator float64, err error) {
+	t := New(periods)
+	err = t.Warm(prices)
+	if err != nil {
+		return
+	}
+	return t.Value()
 }
@@ -0,0 +1,52 @@
+package trix
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func buildPrices(count int) []float64 {
+	prices := make([]float64, count)
+	for i := range prices {
+		prices[i] = 100 + 10*math.Sin(float64(i)/5)
+	}
+	return prices
+}
+
+func TestGetTrixIndicatorShortInput(t *testing.T) {
+	for _, count := range []int{0, 1, 10, 31} {
+		_, _, err := GetTrixIndicator(buildPrices(count), 5)
+		if !errors.Is(err, ErrNotWarm) {
+			t.Errorf("%d prices: expected ErrNotWarm got %v", count, err)
+		}
+	}
+
+	_, _, err := GetTrixIndicator(buildPrices(32), 5)
+	if err != nil {
+		t.Errorf("32 prices: expected no error got %s", err)
+	}
+}
+
+func TestTrixIncremental(t *testing.T) {
+	prices := buildPrices(120)
+
+	streaming := New(5)
+	err := streaming.Warm(prices[:60])
+	if err != nil {
+		t.Fatalf("could not warm up: %s", err)
+	}
+
+	for i := 60; i < len(prices); i++ {
+		streaming.Add(prices[i])
+		ma, osc, err := streaming.Value()
+		if err != nil {
+			t.Fatalf("price %d: %s", i, err)
+		}
+
+		expectedMa, expectedOsc, _ := GetTrixIndicator(prices[:i+1], 5)
+		if ma != expectedMa || osc != expectedOsc {
+			t.Errorf("price %d: expected %f/%f got %f/%f", i, expectedMa, expectedOsc, ma, osc)
+		}
+	}
+}